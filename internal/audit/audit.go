@@ -0,0 +1,95 @@
+package audit
+
+// This package records who did what in the shim as audit.k8s.io/v1 events, with the stages and
+// levels of the kube-apiserver, in a rotated log file and in batches sent to a webhook
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	k8saudit "k8s.io/apiserver/pkg/audit"
+	"k8s.io/apiserver/pkg/audit/policy"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/plugin/pkg/audit/buffered"
+	pluginlog "k8s.io/apiserver/plugin/pkg/audit/log"
+)
+
+// Auditor decides the level of the requests with the policy and sends their events to the sinks
+type Auditor struct {
+	evaluator k8saudit.PolicyRuleEvaluator
+	backend   k8saudit.Backend
+	redactor  redactor
+}
+
+// NewAuditor returns the auditor of the config, or nil when there is no policy and the requests are not audited
+func NewAuditor(cfg config.Audit) (*Auditor, error) {
+	if cfg.PolicyFile == "" {
+		return nil, nil
+	}
+	auditPolicy, err := policy.LoadPolicyFromFile(cfg.PolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error loading the audit policy: %v", err)
+	}
+
+	backends := []k8saudit.Backend{}
+	switch cfg.Log.Path {
+	case "":
+	case "-":
+		backends = append(backends, pluginlog.NewBackend(os.Stdout, pluginlog.FormatJson, auditv1.SchemeGroupVersion))
+	default:
+		file, err := newRotatingFile(cfg.Log.Path, cfg.Log.MaxSize, cfg.Log.MaxBackups)
+		if err != nil {
+			return nil, fmt.Errorf("error opening the audit log: %v", err)
+		}
+		backends = append(backends, pluginlog.NewBackend(file, pluginlog.FormatJson, auditv1.SchemeGroupVersion))
+	}
+	if cfg.Webhook.URL != "" {
+		backends = append(backends, buffered.NewBackend(newWebhook(cfg.Webhook), buffered.BatchConfig{
+			BufferSize:   cfg.Webhook.BufferSize,
+			MaxBatchSize: cfg.Webhook.BatchMaxSize,
+			MaxBatchWait: cfg.Webhook.BatchMaxWait,
+		}))
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("the audit policy %s has no sink, set the log path or the webhook url", cfg.PolicyFile)
+	}
+
+	return &Auditor{
+		evaluator: policy.NewPolicyRuleEvaluator(auditPolicy),
+		backend:   k8saudit.Union(backends...),
+		redactor:  newRedactor(cfg.RedactedFields),
+	}, nil
+}
+
+// Run starts the sinks, the batches of the webhook are sent until stopCh is closed
+func (a *Auditor) Run(stopCh <-chan struct{}) error {
+	return a.backend.Run(stopCh)
+}
+
+// Shutdown sends the events still waiting, after stopCh of Run is closed
+func (a *Auditor) Shutdown() {
+	a.backend.Shutdown()
+}
+
+// Evaluate returns the level and the stages omitted of a request, by the first rule of the policy it matches
+func (a *Auditor) Evaluate(attributes authorizer.Attributes) k8saudit.RequestAuditConfigWithLevel {
+	return a.evaluator.EvaluatePolicyRule(attributes)
+}
+
+// Record sends the event of a stage to the sinks, unless the stage is omitted by the policy
+func (a *Auditor) Record(ev *auditinternal.Event, omitStages []auditinternal.Stage) {
+	for _, stage := range omitStages {
+		if ev.Stage == stage {
+			return
+		}
+	}
+	a.backend.ProcessEvents(ev)
+}
+
+// Redact returns a json object with the values of the redacted fields replaced
+func (a *Auditor) Redact(object []byte) []byte {
+	return a.redactor.redact(object)
+}
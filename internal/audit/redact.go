@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// redactedValue replaces the values of the redacted fields
+const redactedValue = "[REDACTED]"
+
+// redactor replaces the secret fields of the objects recorded in the events, at any depth, the values
+// of the data of the Secrets and the cells of the Table columns named after a secret field, so the
+// credentials of the backend do not end in the logs
+type redactor struct {
+	fields map[string]bool
+}
+
+func newRedactor(fields []string) redactor {
+	r := redactor{fields: map[string]bool{}}
+	for _, field := range fields {
+		r.fields[strings.ToLower(field)] = true
+	}
+	return r
+}
+
+// redact returns the object with the redacted fields replaced, the objects that are not json are dropped
+func (r redactor) redact(object []byte) []byte {
+	var content interface{}
+	if err := json.Unmarshal(object, &content); err != nil {
+		return nil
+	}
+	redacted, err := json.Marshal(r.redactValue(content))
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
+
+func (r redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		secret := v["kind"] == "Secret"
+		if v["kind"] == "Table" {
+			r.redactCells(v)
+		}
+		for key, field := range v {
+			switch {
+			case r.fields[strings.ToLower(key)]:
+				v[key] = redactedValue
+			case secret && (key == "data" || key == "stringData"):
+				v[key] = redactMap(field)
+			default:
+				v[key] = r.redactValue(field)
+			}
+		}
+		return v
+	case []interface{}:
+		for i := range v {
+			v[i] = r.redactValue(v[i])
+		}
+		return v
+	}
+	return value
+}
+
+// redactCells replaces the cells of the columns of a Table named after a redacted field, like the
+// Access Key column of the accessKey field
+func (r redactor) redactCells(table map[string]interface{}) {
+	columns, _ := table["columnDefinitions"].([]interface{})
+	redacted := map[int]bool{}
+	for i, column := range columns {
+		definition, _ := column.(map[string]interface{})
+		name, _ := definition["name"].(string)
+		if r.fields[columnField(name)] {
+			redacted[i] = true
+		}
+	}
+	if len(redacted) == 0 {
+		return
+	}
+
+	rows, _ := table["rows"].([]interface{})
+	for _, row := range rows {
+		tableRow, _ := row.(map[string]interface{})
+		cells, _ := tableRow["cells"].([]interface{})
+		for i := range cells {
+			if redacted[i] {
+				cells[i] = redactedValue
+			}
+		}
+	}
+}
+
+// columnField is the field a column of a Table is named after, in lower case like the redacted fields
+func columnField(name string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "", "_", "").Replace(name))
+}
+
+// redactMap keeps the keys of the data of a Secret and replaces their values
+func redactMap(value interface{}) interface{} {
+	data, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for key := range data {
+		data[key] = redactedValue
+	}
+	return data
+}
@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r := newRedactor([]string{"accessKey", "kubeconfig"})
+
+	tests := []struct {
+		name     string
+		object   string
+		expected string
+	}{
+		{
+			name:     "fields at any depth",
+			object:   `{"kind":"KubernetesCluster","spec":{"name":"a","kubeconfig":"secret"},"items":[{"status":{"AccessKey":"key"}}]}`,
+			expected: `{"kind":"KubernetesCluster","spec":{"name":"a","kubeconfig":"[REDACTED]"},"items":[{"status":{"AccessKey":"[REDACTED]"}}]}`,
+		},
+		{
+			name:     "data of the secrets",
+			object:   `{"kind":"Secret","data":{"password":"c2VjcmV0"},"type":"Opaque"}`,
+			expected: `{"kind":"Secret","data":{"password":"[REDACTED]"},"type":"Opaque"}`,
+		},
+		{
+			name: "cells of the tables",
+			object: `{"kind":"Table","columnDefinitions":[{"name":"Name"},{"name":"Access Key"},{"name":"Status"}],` +
+				`"rows":[{"cells":["a","key-a","ready"],"object":{"spec":{"accessKey":"key-a"}}},{"cells":["b","key-b","ready"]}]}`,
+			expected: `{"kind":"Table","columnDefinitions":[{"name":"Name"},{"name":"Access Key"},{"name":"Status"}],` +
+				`"rows":[{"cells":["a","[REDACTED]","ready"],"object":{"spec":{"accessKey":"[REDACTED]"}}},{"cells":["b","[REDACTED]","ready"]}]}`,
+		},
+		{
+			name:     "tables without secret columns",
+			object:   `{"kind":"Table","columnDefinitions":[{"name":"Name"}],"rows":[{"cells":["a"]},"not a row"]}`,
+			expected: `{"kind":"Table","columnDefinitions":[{"name":"Name"}],"rows":[{"cells":["a"]},"not a row"]}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got, expected interface{}
+			if err := json.Unmarshal(r.redact([]byte(test.object)), &got); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(test.expected), &expected); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Fatalf("got %v, expected %v", got, expected)
+			}
+		})
+	}
+
+	if redacted := r.redact([]byte("not json")); redacted != nil {
+		t.Fatalf("the object that is not json is kept: %s", redacted)
+	}
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	"k8s.io/apimachinery/pkg/util/wait"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	k8saudit "k8s.io/apiserver/pkg/audit"
+)
+
+// webhookBackoff are the retries of a batch the webhook did not take
+var webhookBackoff = wait.Backoff{
+	Duration: time.Second,
+	Factor:   2,
+	Steps:    3,
+}
+
+// webhook posts the batches of events to an url as an audit.k8s.io/v1 EventList
+type webhook struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhook(cfg config.AuditWebhook) *webhook {
+	return &webhook{url: cfg.URL, client: &http.Client{Timeout: cfg.Timeout}}
+}
+
+func (w *webhook) ProcessEvents(events ...*auditinternal.Event) bool {
+	list := auditv1.EventList{Items: make([]auditv1.Event, len(events))}
+	list.Kind = "EventList"
+	list.APIVersion = auditv1.SchemeGroupVersion.String()
+	for i, ev := range events {
+		if err := k8saudit.Scheme.Convert(ev, &list.Items[i], nil); err != nil {
+			k8saudit.HandlePluginError(w.String(), err, events...)
+			return false
+		}
+	}
+	body, err := json.Marshal(list)
+	if err != nil {
+		k8saudit.HandlePluginError(w.String(), err, events...)
+		return false
+	}
+
+	var sendErr error
+	wait.ExponentialBackoff(webhookBackoff, func() (bool, error) {
+		sendErr = w.send(body)
+		return sendErr == nil, nil
+	})
+	if sendErr != nil {
+		k8saudit.HandlePluginError(w.String(), sendErr, events...)
+		return false
+	}
+	return true
+}
+
+func (w *webhook) send(body []byte) error {
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("the audit webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (w *webhook) Run(stopCh <-chan struct{}) error {
+	return nil
+}
+
+func (w *webhook) Shutdown() {}
+
+func (w *webhook) String() string {
+	return "webhook"
+}
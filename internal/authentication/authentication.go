@@ -0,0 +1,65 @@
+package authentication
+
+// This package resolves the identity of the callers of the shim from the login service of the backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	opencpspec "github.com/opencontrolplane/opencp-spec/grpc"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// Authenticate asks the login service if the token is valid and returns the identity of its owner.
+// The login service of the spec only tells if the token is valid, it does not know who owns it, so
+// the identity is derived from the token: the same token is always the same user, but two tokens
+// of the same account are two users, and the groups are only the one of the authenticated users
+func Authenticate(ctx context.Context, login opencpspec.LoginClient, token string) (user.Info, bool, error) {
+	// The login service checks the token sent in the metadata, like the other services of the backend
+	ctx = grpcMetadata.AppendToOutgoingContext(ctx, "authorization", "bearer "+token)
+
+	validToken, err := login.Check(ctx, &opencpspec.LoginRequest{Token: token})
+	if err != nil {
+		return nil, false, err
+	}
+	if validToken == nil || !validToken.Valid {
+		return nil, false, nil
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	id := hex.EncodeToString(hash[:])[:16]
+	return withAuthenticatedGroup(&user.DefaultInfo{
+		Name: "opencp:token:" + id,
+		UID:  id,
+	}), true, nil
+}
+
+// UserInfo returns the identity of a user as it is written in the reviews
+func UserInfo(u user.Info) authenticationv1.UserInfo {
+	userInfo := authenticationv1.UserInfo{
+		Username: u.GetName(),
+		UID:      u.GetUID(),
+		Groups:   u.GetGroups(),
+	}
+	if extra := u.GetExtra(); len(extra) > 0 {
+		userInfo.Extra = map[string]authenticationv1.ExtraValue{}
+		for key, value := range extra {
+			userInfo.Extra[key] = authenticationv1.ExtraValue(value)
+		}
+	}
+	return userInfo
+}
+
+// withAuthenticatedGroup adds the group every authenticated user is in, like the kube-apiserver
+func withAuthenticatedGroup(u *user.DefaultInfo) *user.DefaultInfo {
+	for _, group := range u.Groups {
+		if group == user.AllAuthenticated {
+			return u
+		}
+	}
+	u.Groups = append(u.Groups, user.AllAuthenticated)
+	return u
+}
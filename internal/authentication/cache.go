@@ -0,0 +1,231 @@
+package authentication
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	opencpspec "github.com/opencontrolplane/opencp-spec/grpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+var (
+	tokenCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "opencp_shim_token_cache_requests_total",
+		Help: "Number of token validations served by the cache, by result: hit or miss.",
+	}, []string{"result"})
+	tokenCacheEntries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "opencp_shim_token_cache_entries",
+		Help: "Number of tokens kept in the cache.",
+	})
+)
+
+// loginTimeout is how long a validation of the login service can take
+const loginTimeout = 10 * time.Second
+
+// Cache keeps the result of the token validations of the login service, so every request
+// does not wait for a call to the backend. The valid and invalid tokens are kept for their
+// own ttl, a ttl of 0 does not keep them, the errors of the login service are not kept
+type Cache struct {
+	login       opencpspec.LoginClient
+	ttl         time.Duration
+	negativeTTL time.Duration
+	size        int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru has the keys of the entries, the most recently used first
+	lru *list.List
+	// purges counts the purges, a validation running during a purge does not add its result
+	purges uint64
+	// group makes the concurrent validations of the same token a single call to the login service
+	group singleflight.Group
+}
+
+type cacheEntry struct {
+	key     string
+	user    user.Info
+	valid   bool
+	expires time.Time
+}
+
+type cacheResult struct {
+	user  user.Info
+	valid bool
+}
+
+// NewCache returns a cache of the validations of the login service
+func NewCache(login opencpspec.LoginClient, cfg config.TokenCache) *Cache {
+	return &Cache{
+		login:       login,
+		ttl:         cfg.TTL,
+		negativeTTL: cfg.NegativeTTL,
+		size:        cfg.Size,
+		entries:     map[string]*list.Element{},
+		lru:         list.New(),
+	}
+}
+
+// Authenticate returns the identity of the owner of the token, from the cache when the token
+// was validated in its ttl, from the login service otherwise
+func (c *Cache) Authenticate(ctx context.Context, token string) (user.Info, bool, error) {
+	key := tokenKeyHash(token)
+	if entry, ok := c.get(key); ok {
+		tokenCacheRequests.WithLabelValues("hit").Inc()
+		return entry.user, entry.valid, nil
+	}
+	tokenCacheRequests.WithLabelValues("miss").Inc()
+
+	// The validation is shared by the requests with the same token, so it is not canceled with the
+	// request starting it, every request stops waiting for it when its own context is done
+	flight := c.group.DoChan(key, func() (interface{}, error) {
+		loginCtx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+		defer cancel()
+
+		purges := c.purgeCount()
+		tokenUser, valid, err := Authenticate(loginCtx, c.login, token)
+		if err != nil {
+			return nil, err
+		}
+		c.add(key, purges, tokenUser, valid)
+		return cacheResult{user: tokenUser, valid: valid}, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	case result := <-flight:
+		if result.Err != nil {
+			return nil, false, result.Err
+		}
+		return result.Val.(cacheResult).user, result.Val.(cacheResult).valid, nil
+	}
+}
+
+// Purge removes a token from the cache, so its next use asks the login service again,
+// like when it is revoked. All the tokens are removed when it is empty. The validations
+// running during the purge are not kept, their result can be of before the revocation
+func (c *Cache) Purge(token string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	defer func() { tokenCacheEntries.Set(float64(c.lru.Len())) }()
+
+	c.purges++
+	if token == "" {
+		purged := c.lru.Len()
+		c.entries = map[string]*list.Element{}
+		c.lru.Init()
+		return purged
+	}
+
+	// The next requests with the token do not wait for the validation running, it asks a new one
+	key := tokenKeyHash(token)
+	c.group.Forget(key)
+	element, ok := c.entries[key]
+	if !ok {
+		return 0
+	}
+	c.remove(element)
+	return 1
+}
+
+func (c *Cache) get(key string) (*cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(element)
+		tokenCacheEntries.Set(float64(c.lru.Len()))
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+func (c *Cache) purgeCount() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.purges
+}
+
+// add keeps the result of a validation started after the purges counted, the results of
+// the validations a purge ran during are dropped
+func (c *Cache) add(key string, purges uint64, tokenUser user.Info, valid bool) {
+	ttl := c.ttl
+	if !valid {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.purges != purges {
+		return
+	}
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, user: tokenUser, valid: valid, expires: time.Now().Add(ttl)})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+	tokenCacheEntries.Set(float64(c.lru.Len()))
+}
+
+func (c *Cache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*cacheEntry).key)
+}
+
+// tokenKeyHash is the key of a token in the cache, the tokens themselves are not kept
+func tokenKeyHash(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// purgeRequest is the body of the requests to the purge endpoint
+type purgeRequest struct {
+	// Token is the token to remove from the cache, all of them are removed when it is empty
+	Token string `json:"token"`
+}
+
+// PurgeHandler serves the purge of the cache on the admin port, the token is sent in
+// the body so it does not end in the logs of the proxies
+func PurgeHandler(cache *Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		request := purgeRequest{}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "the body is not a valid purge request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"purged": cache.Purge(request.Token)})
+	}
+}
@@ -0,0 +1,136 @@
+package authentication
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	opencpspec "github.com/opencontrolplane/opencp-spec/grpc"
+	"google.golang.org/grpc"
+)
+
+// slowLogin validates every token once released, it fails the calls whose context is done
+type slowLogin struct {
+	release chan struct{}
+	calls   int32
+}
+
+func (l *slowLogin) Check(ctx context.Context, in *opencpspec.LoginRequest, opts ...grpc.CallOption) (*opencpspec.LoginResponse, error) {
+	atomic.AddInt32(&l.calls, 1)
+	select {
+	case <-l.release:
+		return &opencpspec.LoginResponse{Valid: true}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestCacheValidationIsNotCanceledWithTheFirstRequest(t *testing.T) {
+	login := &slowLogin{release: make(chan struct{})}
+	cache := NewCache(login, config.TokenCache{TTL: time.Minute, NegativeTTL: time.Minute, Size: 10})
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error)
+	go func() {
+		_, _, err := cache.Authenticate(firstCtx, "token")
+		firstErr <- err
+	}()
+	for atomic.LoadInt32(&login.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	type result struct {
+		valid bool
+		err   error
+	}
+	second := make(chan result)
+	go func() {
+		_, valid, err := cache.Authenticate(context.Background(), "token")
+		second <- result{valid, err}
+	}()
+
+	cancelFirst()
+	if err := <-firstErr; err != context.Canceled {
+		t.Fatalf("the canceled request got %v", err)
+	}
+	close(login.release)
+
+	if got := <-second; got.err != nil || !got.valid {
+		t.Fatalf("the second request got %v, %v", got.valid, got.err)
+	}
+	if calls := atomic.LoadInt32(&login.calls); calls != 1 {
+		t.Fatalf("the login service was called %d times", calls)
+	}
+}
+
+func TestCachePurge(t *testing.T) {
+	login := &slowLogin{release: make(chan struct{})}
+	close(login.release)
+	cache := NewCache(login, config.TokenCache{TTL: time.Minute, NegativeTTL: time.Minute, Size: 10})
+
+	for _, token := range []string{"a", "b", "a"} {
+		if _, valid, err := cache.Authenticate(context.Background(), token); err != nil || !valid {
+			t.Fatalf("the token %s got %v, %v", token, valid, err)
+		}
+	}
+	if calls := atomic.LoadInt32(&login.calls); calls != 2 {
+		t.Fatalf("the login service was called %d times for two tokens", calls)
+	}
+
+	if purged := cache.Purge("a"); purged != 1 {
+		t.Fatalf("purged %d tokens", purged)
+	}
+	cache.Authenticate(context.Background(), "a")
+	if calls := atomic.LoadInt32(&login.calls); calls != 3 {
+		t.Fatal("the purged token was not validated again")
+	}
+	if purged := cache.Purge(""); purged != 2 {
+		t.Fatalf("purged %d tokens of 2", purged)
+	}
+}
+
+func TestCachePurgeDuringAValidationDropsItsResult(t *testing.T) {
+	login := &slowLogin{release: make(chan struct{})}
+	cache := NewCache(login, config.TokenCache{TTL: time.Minute, NegativeTTL: time.Minute, Size: 10})
+
+	validated := make(chan error)
+	go func() {
+		_, _, err := cache.Authenticate(context.Background(), "token")
+		validated <- err
+	}()
+	for atomic.LoadInt32(&login.calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The token is revoked while the login service still validates it
+	cache.Purge("token")
+	close(login.release)
+	if err := <-validated; err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Authenticate(context.Background(), "token")
+	if calls := atomic.LoadInt32(&login.calls); calls != 2 {
+		t.Fatalf("the login service was called %d times, the validation of before the purge was kept", calls)
+	}
+}
+
+func TestCacheWithoutTTLKeepsNoToken(t *testing.T) {
+	login := &slowLogin{release: make(chan struct{})}
+	close(login.release)
+	cache := NewCache(login, config.TokenCache{TTL: 0, NegativeTTL: 0, Size: 10})
+
+	for i := 0; i < 3; i++ {
+		if _, valid, err := cache.Authenticate(context.Background(), "token"); err != nil || !valid {
+			t.Fatalf("the token got %v, %v", valid, err)
+		}
+	}
+	if calls := atomic.LoadInt32(&login.calls); calls != 3 {
+		t.Fatalf("the login service was called %d times for 3 requests", calls)
+	}
+	if purged := cache.Purge(""); purged != 0 {
+		t.Fatalf("the cache kept %d tokens", purged)
+	}
+}
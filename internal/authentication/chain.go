@@ -0,0 +1,218 @@
+package authentication
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	x509request "k8s.io/apiserver/pkg/authentication/request/x509"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/plugin/pkg/authenticator/token/oidc"
+)
+
+// Names of the authenticators of the chain in the config
+const (
+	BearerAuthenticator = "bearer"
+	X509Authenticator   = "x509"
+	OIDCAuthenticator   = "oidc"
+)
+
+// bearerPrefix is the scheme before the token in the Authorization header
+var bearerPrefix = regexp.MustCompile(`(?i)bearer\s+`)
+
+// BackendError is an error of the login service, the token could not be checked
+type BackendError struct {
+	Err error
+}
+
+func (e *BackendError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// Authenticator authenticates the requests with the authenticators of the chain, in order,
+// the first one knowing the caller gives its identity
+type Authenticator struct {
+	chain []namedAuthenticator
+	// allowlist are the expressions the User-Agent of the clients must match
+	allowlist []*regexp.Regexp
+}
+
+// namedAuthenticator is an authenticator of the chain with its name in the config
+type namedAuthenticator struct {
+	name string
+	authenticator.Request
+}
+
+// Response is the identity of the caller of a request and the name of the authenticator knowing it
+type Response struct {
+	User          user.Info
+	Authenticator string
+}
+
+// NewAuthenticator returns the authenticator of the chain in the config, the bearer tokens are
+// checked by the login service of the backend through the cache
+func NewAuthenticator(cfg config.Authentication, cache *Cache) (*Authenticator, error) {
+	a := &Authenticator{}
+	for _, name := range cfg.Chain {
+		switch name {
+		case BearerAuthenticator:
+			a.chain = append(a.chain, namedAuthenticator{name, bearerToken{cache}})
+		case X509Authenticator:
+			x509Authenticator, err := newX509(cfg.X509)
+			if err != nil {
+				return nil, err
+			}
+			a.chain = append(a.chain, namedAuthenticator{name, x509Authenticator})
+		case OIDCAuthenticator:
+			oidcAuthenticator, err := newOIDC(cfg.OIDC)
+			if err != nil {
+				return nil, err
+			}
+			a.chain = append(a.chain, namedAuthenticator{name, bearerToken{oidcAuthenticator}})
+		default:
+			return nil, fmt.Errorf("unknown authenticator %q, the valid ones are %s, %s and %s", name, BearerAuthenticator, X509Authenticator, OIDCAuthenticator)
+		}
+	}
+
+	for _, expression := range cfg.ClientAllowlist {
+		client, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client %q in the allowlist: %v", expression, err)
+		}
+		a.allowlist = append(a.allowlist, client)
+	}
+	return a, nil
+}
+
+// ClientAllowed tells if the client of a request is in the allowlist
+func (a *Authenticator) ClientAllowed(userAgent string) bool {
+	if len(a.allowlist) == 0 {
+		return true
+	}
+	for _, client := range a.allowlist {
+		if client.MatchString(userAgent) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateRequest returns the identity of the caller of a request and the authenticator knowing it.
+// The errors of the login service are returned as a BackendError when no other authenticator knows the caller
+func (a *Authenticator) AuthenticateRequest(req *http.Request) (*Response, bool, error) {
+	errs := []error{}
+	var backendErr *BackendError
+	for _, requestAuthenticator := range a.chain {
+		response, ok, err := requestAuthenticator.AuthenticateRequest(req)
+		if ok {
+			return &Response{
+				User: withAuthenticatedGroup(&user.DefaultInfo{
+					Name:   response.User.GetName(),
+					UID:    response.User.GetUID(),
+					Groups: response.User.GetGroups(),
+					Extra:  response.User.GetExtra(),
+				}),
+				Authenticator: requestAuthenticator.name,
+			}, true, nil
+		}
+		if err != nil {
+			errors.As(err, &backendErr)
+			errs = append(errs, err)
+		}
+	}
+
+	if backendErr != nil {
+		return nil, false, backendErr
+	}
+	return nil, false, utilerrors.NewAggregate(errs)
+}
+
+// BearerToken returns the token in the Authorization header of a request
+func BearerToken(req *http.Request) string {
+	tokens, ok := req.Header["Authorization"]
+	if !ok || len(tokens) == 0 {
+		return ""
+	}
+	return bearerPrefix.ReplaceAllString(tokens[0], "")
+}
+
+// AuthenticateToken makes the cache an authenticator of the chain
+func (c *Cache) AuthenticateToken(ctx context.Context, token string) (*authenticator.Response, bool, error) {
+	tokenUser, valid, err := c.Authenticate(ctx, token)
+	if err != nil {
+		return nil, false, &BackendError{Err: err}
+	}
+	if !valid {
+		return nil, false, nil
+	}
+	return &authenticator.Response{User: tokenUser}, true, nil
+}
+
+// bearerToken authenticates the requests with the token in their Authorization header
+type bearerToken struct {
+	auth authenticator.Token
+}
+
+func (b bearerToken) AuthenticateRequest(req *http.Request) (*authenticator.Response, bool, error) {
+	token := BearerToken(req)
+	if token == "" {
+		return nil, false, nil
+	}
+	return b.auth.AuthenticateToken(req.Context(), token)
+}
+
+// newX509 returns the authenticator of the client certificates, the common name
+// is the name of the user and the organizations are its groups
+func newX509(cfg config.X509) (authenticator.Request, error) {
+	bundle, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the client CA file: %v", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificate in the client CA file %s", cfg.ClientCAFile)
+	}
+
+	opts := x509request.DefaultVerifyOptions()
+	opts.Roots = roots
+	return x509request.New(opts, x509request.CommonNameUserConversion), nil
+}
+
+// newOIDC returns the authenticator of the tokens of an OpenID Connect issuer, the
+// keys of the issuer are read from its discovery document
+func newOIDC(cfg config.OIDC) (authenticator.Token, error) {
+	opts := oidc.Options{
+		IssuerURL:      cfg.IssuerURL,
+		ClientID:       cfg.ClientID,
+		UsernameClaim:  cfg.UsernameClaim,
+		UsernamePrefix: cfg.UsernamePrefix,
+		GroupsClaim:    cfg.GroupsClaim,
+		GroupsPrefix:   cfg.GroupsPrefix,
+	}
+	if cfg.CAFile != "" {
+		bundle, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the OIDC CA file: %v", err)
+		}
+		opts.CAContentProvider = caBundle(bundle)
+	}
+	return oidc.New(opts)
+}
+
+// caBundle is the bundle of the authorities of the OIDC issuer
+type caBundle []byte
+
+func (b caBundle) CurrentCABundleContent() []byte {
+	return b
+}
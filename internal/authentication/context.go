@@ -0,0 +1,118 @@
+package authentication
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+type tokenKey struct{}
+
+type authenticatorKey struct{}
+
+type impersonatorKey struct{}
+
+// Metadata keys of the identity of the caller sent to the backend on every call
+const (
+	UserMetadata   = "x-opencp-user"
+	UIDMetadata    = "x-opencp-uid"
+	GroupsMetadata = "x-opencp-groups"
+	// AuthenticatorMetadata is the authenticator of the chain knowing the caller: bearer, x509 or oidc
+	AuthenticatorMetadata = "x-opencp-authenticator"
+)
+
+// errImpersonated refuses the backend calls of the impersonated requests, the backend only knows the
+// token of the impersonator, so it would act as the impersonator and not as the impersonated user
+var errImpersonated = status.Error(codes.PermissionDenied, "impersonated requests are only served by the shim, the backend can not act as the impersonated user")
+
+// WithToken returns a copy of the context of a request carrying the token of the caller,
+// only the tokens issued by the backend are carried, the backend does not know the others
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFrom returns the token of the caller carried in the context of a request
+func TokenFrom(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(tokenKey{}).(string)
+	return token, ok
+}
+
+// WithAuthenticator returns a copy of the context of a request carrying the authenticator knowing the caller
+func WithAuthenticator(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, authenticatorKey{}, name)
+}
+
+// AuthenticatorFrom returns the authenticator knowing the caller carried in the context of a request
+func AuthenticatorFrom(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(authenticatorKey{}).(string)
+	return name, ok
+}
+
+// WithImpersonator returns a copy of the context of a request carrying the user impersonating the caller
+func WithImpersonator(ctx context.Context, impersonator user.Info) context.Context {
+	return context.WithValue(ctx, impersonatorKey{}, impersonator)
+}
+
+// ImpersonatorFrom returns the user impersonating the caller carried in the context of a request
+func ImpersonatorFrom(ctx context.Context) (user.Info, bool) {
+	impersonator, ok := ctx.Value(impersonatorKey{}).(user.Info)
+	return impersonator, ok
+}
+
+// outgoingContext adds the identity of the caller of the request and its token, when the backend
+// issued it, to the metadata of a backend call. The calls already sending a token, like the login
+// checks, keep theirs. The calls of the impersonated requests are refused
+func outgoingContext(ctx context.Context) (context.Context, error) {
+	md, _ := grpcMetadata.FromOutgoingContext(ctx)
+	if len(md.Get("authorization")) > 0 {
+		return ctx, nil
+	}
+	if _, ok := ImpersonatorFrom(ctx); ok {
+		return nil, errImpersonated
+	}
+
+	pairs := []string{}
+	if token, ok := TokenFrom(ctx); ok {
+		pairs = append(pairs, "authorization", "bearer "+token)
+	}
+	if requestUser, ok := request.UserFrom(ctx); ok {
+		pairs = append(pairs, UserMetadata, requestUser.GetName(), UIDMetadata, requestUser.GetUID())
+		for _, group := range requestUser.GetGroups() {
+			pairs = append(pairs, GroupsMetadata, group)
+		}
+	}
+	if name, ok := AuthenticatorFrom(ctx); ok {
+		pairs = append(pairs, AuthenticatorMetadata, name)
+	}
+	if len(pairs) == 0 {
+		return ctx, nil
+	}
+	return grpcMetadata.AppendToOutgoingContext(ctx, pairs...), nil
+}
+
+// UnaryClientInterceptor sends the identity and the token of the caller on every unary backend call
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := outgoingContext(ctx)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor sends the identity and the token of the caller on every streaming backend call
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := outgoingContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,37 @@
+package authentication
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestTheImpersonatedRequestsDoNotCallTheBackend(t *testing.T) {
+	ctx := WithToken(context.Background(), "admin-token")
+	ctx = WithAuthenticator(ctx, BearerAuthenticator)
+	ctx = WithImpersonator(ctx, &user.DefaultInfo{Name: "admin"})
+	ctx = request.WithUser(ctx, &user.DefaultInfo{Name: "bob"})
+
+	called := false
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		called = true
+		return nil
+	}
+
+	err := UnaryClientInterceptor()(ctx, "/opencp.VirtualMachineService/GetVirtualMachine", nil, nil, nil, invoker)
+	if status.Code(err) != codes.PermissionDenied || called {
+		t.Fatalf("the impersonated call got %v, the backend was called: %v", err, called)
+	}
+
+	// The calls sending their own token, like the login checks, are not the impersonated user's
+	loginCtx := grpcMetadata.AppendToOutgoingContext(ctx, "authorization", "bearer other-token")
+	if err := UnaryClientInterceptor()(loginCtx, "/opencp.Login/Check", nil, nil, nil, invoker); err != nil || !called {
+		t.Fatalf("the call with its own token got %v, the backend was called: %v", err, called)
+	}
+}
@@ -0,0 +1,180 @@
+package authorization
+
+// This package decides what the callers of the shim can do, for the requests and for the access reviews
+
+import (
+	"context"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	"github.com/opencontrolplane/opencp-shim/internal/store"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/authorization/union"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// ImpersonateVerb is the verb of the impersonation of users, groups, uids and extras
+const ImpersonateVerb = "impersonate"
+
+// Authorizer decides if a user can do a request and lists the rules a user has in a namespace
+type Authorizer interface {
+	authorizer.Authorizer
+	authorizer.RuleResolver
+}
+
+// unionAuthorizer asks the authorizers in order, the first allowing or denying decides
+type unionAuthorizer struct {
+	authorizer.Authorizer
+	authorizer.RuleResolver
+}
+
+// NewAuthorizer returns the authorizer of the shim. The impersonators of the config can
+// impersonate, nobody else can. With RBAC enabled the rest is allowed to the superusers of
+// the config and by the roles bound in the store. Otherwise every authenticated user is
+// allowed the rest, the backend enforces the permissions of the token on every call it receives
+func NewAuthorizer(cfg config.Config, st store.Store) Authorizer {
+	impersonators := subjectsAuthorizer{
+		subjects: newSubjects(cfg.Authorization.Impersonators),
+		verb:     ImpersonateVerb,
+		reason:   "impersonator in the config",
+		rule: &authorizer.DefaultResourceRuleInfo{
+			Verbs:     []string{ImpersonateVerb},
+			APIGroups: []string{"", "authentication.k8s.io"},
+			Resources: []string{"users", "groups", "uids", "userextras/*"},
+		},
+	}
+
+	if cfg.Authorization.RBAC.Enabled {
+		superusers := subjectsAuthorizer{
+			subjects: newSubjects(cfg.Authorization.RBAC.Superusers),
+			verb:     "*",
+			reason:   "superuser in the config",
+			rule: &authorizer.DefaultResourceRuleInfo{
+				Verbs:     []string{"*"},
+				APIGroups: []string{"*"},
+				Resources: []string{"*"},
+			},
+			nonResourceRule: &authorizer.DefaultNonResourceRuleInfo{
+				Verbs:           []string{"*"},
+				NonResourceURLs: []string{"*"},
+			},
+		}
+		rbac := rbacAuthorizer{store: st}
+
+		return unionAuthorizer{
+			Authorizer:   union.New(impersonators, superusers, rbac),
+			RuleResolver: union.NewRuleResolvers(impersonators, superusers, rbac),
+		}
+	}
+
+	backend := backendAuthorizer{}
+	return unionAuthorizer{
+		Authorizer:   union.New(impersonators, backend),
+		RuleResolver: union.NewRuleResolvers(impersonators, backend),
+	}
+}
+
+// reviewKey is the key of the access reviews in the context
+type reviewKey struct{}
+
+// WithReview marks the context of an access review, the authorizers that can not
+// tell what the backend allows give no opinion on it instead of allowing it
+func WithReview(ctx context.Context) context.Context {
+	return context.WithValue(ctx, reviewKey{}, true)
+}
+
+func isReview(ctx context.Context) bool {
+	review, _ := ctx.Value(reviewKey{}).(bool)
+	return review
+}
+
+// User returns the user of the request, the users without a known identity
+// are only in the group of the authenticated users
+func User(ctx context.Context) user.Info {
+	if requestUser, ok := request.UserFrom(ctx); ok {
+		return requestUser
+	}
+	return &user.DefaultInfo{Groups: []string{user.AllAuthenticated}}
+}
+
+// subjects are the users and groups granted a permission in the config
+type subjects struct {
+	users  map[string]bool
+	groups map[string]bool
+}
+
+func newSubjects(cfg config.Subjects) subjects {
+	s := subjects{users: map[string]bool{}, groups: map[string]bool{}}
+	for _, name := range cfg.Users {
+		s.users[name] = true
+	}
+	for _, group := range cfg.Groups {
+		s.groups[group] = true
+	}
+	return s
+}
+
+func (s subjects) granted(u user.Info) bool {
+	if u == nil {
+		return false
+	}
+	if s.users[u.GetName()] {
+		return true
+	}
+	for _, group := range u.GetGroups() {
+		if s.groups[group] {
+			return true
+		}
+	}
+	return false
+}
+
+// subjectsAuthorizer allows the subjects of the config a verb, or every verb with *
+type subjectsAuthorizer struct {
+	subjects        subjects
+	verb            string
+	reason          string
+	rule            authorizer.ResourceRuleInfo
+	nonResourceRule authorizer.NonResourceRuleInfo
+}
+
+func (s subjectsAuthorizer) Authorize(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+	if (s.verb == "*" || a.GetVerb() == s.verb) && s.subjects.granted(a.GetUser()) {
+		return authorizer.DecisionAllow, s.reason, nil
+	}
+	return authorizer.DecisionNoOpinion, "", nil
+}
+
+func (s subjectsAuthorizer) RulesFor(u user.Info, namespace string) ([]authorizer.ResourceRuleInfo, []authorizer.NonResourceRuleInfo, bool, error) {
+	if !s.subjects.granted(u) {
+		return nil, nil, false, nil
+	}
+	nonResourceRules := []authorizer.NonResourceRuleInfo{}
+	if s.nonResourceRule != nil {
+		nonResourceRules = append(nonResourceRules, s.nonResourceRule)
+	}
+	return []authorizer.ResourceRuleInfo{s.rule}, nonResourceRules, false, nil
+}
+
+// backendReason is why the access reviews are not allowed without RBAC
+const backendReason = "RBAC is not enabled in the shim, the backend decides on every call it receives with the permissions of the token"
+
+// backendAuthorizer allows every request and leaves the permissions to the backend,
+// except the impersonation, the backend does not know who can impersonate. The shim
+// can not tell what the backend allows, so the access reviews are not allowed
+type backendAuthorizer struct{}
+
+func (backendAuthorizer) Authorize(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+	if a.GetVerb() == ImpersonateVerb {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+	if isReview(ctx) {
+		return authorizer.DecisionNoOpinion, backendReason, nil
+	}
+	return authorizer.DecisionAllow, "", nil
+}
+
+// RulesFor has no rules to list, they are only known to the backend
+func (backendAuthorizer) RulesFor(u user.Info, namespace string) ([]authorizer.ResourceRuleInfo, []authorizer.NonResourceRuleInfo, bool, error) {
+	return nil, nil, true, nil
+}
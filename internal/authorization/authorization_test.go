@@ -0,0 +1,65 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	"github.com/opencontrolplane/opencp-shim/internal/store"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestWithoutRBACTheRequestsAreLeftToTheBackend(t *testing.T) {
+	cfg := config.Config{}
+	cfg.Authorization.Impersonators.Users = []string{"admin"}
+	authz := NewAuthorizer(cfg, store.NewMemory())
+
+	alice := &user.DefaultInfo{Name: "alice"}
+	list := authorizer.AttributesRecord{User: alice, Verb: "list", APIGroup: "opencp.io", Resource: "virtualmachines", ResourceRequest: true}
+	impersonate := authorizer.AttributesRecord{User: alice, Verb: ImpersonateVerb, Resource: "users", Name: "bob", ResourceRequest: true}
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		attributes authorizer.AttributesRecord
+		decision   authorizer.Decision
+		reason     bool
+	}{
+		{name: "request", ctx: context.Background(), attributes: list, decision: authorizer.DecisionAllow},
+		{name: "review", ctx: WithReview(context.Background()), attributes: list, decision: authorizer.DecisionNoOpinion, reason: true},
+		{name: "impersonation", ctx: context.Background(), attributes: impersonate, decision: authorizer.DecisionNoOpinion},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decision, reason, err := authz.Authorize(test.ctx, test.attributes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision != test.decision {
+				t.Fatalf("got the decision %v, expected %v", decision, test.decision)
+			}
+			if test.reason && reason == "" {
+				t.Fatal("the decision has no reason")
+			}
+		})
+	}
+
+	admin := impersonate
+	admin.User = &user.DefaultInfo{Name: "admin"}
+	if decision, _, _ := authz.Authorize(context.Background(), admin); decision != authorizer.DecisionAllow {
+		t.Fatalf("the impersonator of the config got the decision %v", decision)
+	}
+}
+
+func TestWithoutRBACTheRulesAreIncomplete(t *testing.T) {
+	authz := NewAuthorizer(config.Config{}, store.NewMemory())
+
+	resourceRules, nonResourceRules, incomplete, err := authz.RulesFor(&user.DefaultInfo{Name: "alice"}, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !incomplete || len(resourceRules) != 0 || len(nonResourceRules) != 0 {
+		t.Fatalf("got the rules %v %v, incomplete %v", resourceRules, nonResourceRules, incomplete)
+	}
+}
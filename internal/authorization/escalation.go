@@ -0,0 +1,169 @@
+package authorization
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opencontrolplane/opencp-shim/internal/store"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// The verbs that let a user grant the rules it does not have, like in the kube-apiserver
+const (
+	EscalateVerb = "escalate"
+	BindVerb     = "bind"
+)
+
+// ConfirmRoleAllowed returns a Forbidden error when the user can not write a role with the rules,
+// it must be allowed to escalate the role or hold every rule of it in the namespace of the role
+func ConfirmRoleAllowed(ctx context.Context, a Authorizer, u user.Info, resource, namespace, name string, rules []rbacv1.PolicyRule) error {
+	if allowed(ctx, a, u, EscalateVerb, resource, namespace, name) {
+		return nil
+	}
+	return confirmNoEscalation(a, u, resource, namespace, name, rules)
+}
+
+// ConfirmBindingAllowed returns a Forbidden error when the user can not write a binding of the role,
+// it must be allowed to bind the role or hold every rule of it in the namespace of the binding
+func ConfirmBindingAllowed(ctx context.Context, a Authorizer, st store.Store, u user.Info, resource, namespace, name string, roleRef rbacv1.RoleRef) error {
+	roleResource := ClusterRolesResource
+	if roleRef.Kind == "Role" {
+		roleResource = RolesResource
+	}
+	if allowed(ctx, a, u, BindVerb, roleResource, namespace, roleRef.Name) {
+		return nil
+	}
+
+	rules, err := rbacAuthorizer{store: st}.roleRules(ctx, roleRef, namespace)
+	if err != nil {
+		return err
+	}
+	return confirmNoEscalation(a, u, resource, namespace, name, rules)
+}
+
+// allowed tells if the user can do the verb on a role of the rbac.authorization.k8s.io group
+func allowed(ctx context.Context, a Authorizer, u user.Info, verb, resource, namespace, name string) bool {
+	decision, _, _ := a.Authorize(ctx, authorizer.AttributesRecord{
+		User:            u,
+		Verb:            verb,
+		Namespace:       namespace,
+		APIGroup:        rbacv1.GroupName,
+		APIVersion:      rbacv1.SchemeGroupVersion.Version,
+		Resource:        resource,
+		Name:            name,
+		ResourceRequest: true,
+	})
+	return decision == authorizer.DecisionAllow
+}
+
+// confirmNoEscalation returns a Forbidden error with the rules the user does not hold in the namespace
+func confirmNoEscalation(a Authorizer, u user.Info, resource, namespace, name string, rules []rbacv1.PolicyRule) error {
+	resourceRules, nonResourceRules, _, err := a.RulesFor(u, namespace)
+	owned := make([]rbacv1.PolicyRule, 0, len(resourceRules)+len(nonResourceRules))
+	for _, rule := range resourceRules {
+		owned = append(owned, rbacv1.PolicyRule{
+			Verbs:         rule.GetVerbs(),
+			APIGroups:     rule.GetAPIGroups(),
+			Resources:     rule.GetResources(),
+			ResourceNames: rule.GetResourceNames(),
+		})
+	}
+	for _, rule := range nonResourceRules {
+		owned = append(owned, rbacv1.PolicyRule{
+			Verbs:           rule.GetVerbs(),
+			NonResourceURLs: rule.GetNonResourceURLs(),
+		})
+	}
+
+	missing := []string{}
+	for _, rule := range rules {
+		for _, atomic := range breakdownRule(rule) {
+			if !covered(owned, atomic) {
+				missing = append(missing, compactRule(atomic))
+			}
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	message := fmt.Sprintf("user %q (groups=%q) is attempting to grant RBAC permissions not currently held:\n%s", u.GetName(), u.GetGroups(), strings.Join(missing, "\n"))
+	if err != nil {
+		message += fmt.Sprintf("; resolution errors: %v", err)
+	}
+	return apierrors.NewForbidden(schema.GroupResource{Group: rbacv1.GroupName, Resource: resource}, name, fmt.Errorf("%s", message))
+}
+
+// breakdownRule splits a rule in rules of one verb and one group, resource and name or one url
+func breakdownRule(rule rbacv1.PolicyRule) []rbacv1.PolicyRule {
+	rules := []rbacv1.PolicyRule{}
+	for _, verb := range rule.Verbs {
+		for _, group := range rule.APIGroups {
+			for _, resource := range rule.Resources {
+				if len(rule.ResourceNames) == 0 {
+					rules = append(rules, rbacv1.PolicyRule{Verbs: []string{verb}, APIGroups: []string{group}, Resources: []string{resource}})
+					continue
+				}
+				for _, name := range rule.ResourceNames {
+					rules = append(rules, rbacv1.PolicyRule{Verbs: []string{verb}, APIGroups: []string{group}, Resources: []string{resource}, ResourceNames: []string{name}})
+				}
+			}
+		}
+		for _, url := range rule.NonResourceURLs {
+			rules = append(rules, rbacv1.PolicyRule{Verbs: []string{verb}, NonResourceURLs: []string{url}})
+		}
+	}
+	return rules
+}
+
+// covered tells if one of the rules grants a rule of breakdownRule, a wildcard is only covered by a wildcard
+func covered(rules []rbacv1.PolicyRule, atomic rbacv1.PolicyRule) bool {
+	verb := atomic.Verbs[0]
+	for _, rule := range rules {
+		if !matches(rule.Verbs, verb) {
+			continue
+		}
+
+		if len(atomic.NonResourceURLs) > 0 {
+			if nonResourceURLMatches(rule.NonResourceURLs, atomic.NonResourceURLs[0]) {
+				return true
+			}
+			continue
+		}
+
+		resource, subresource, _ := strings.Cut(atomic.Resources[0], "/")
+		if !matches(rule.APIGroups, atomic.APIGroups[0]) || !resourceMatches(rule.Resources, resource, subresource) {
+			continue
+		}
+		if len(rule.ResourceNames) == 0 || (len(atomic.ResourceNames) > 0 && containsString(rule.ResourceNames, atomic.ResourceNames[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+// compactRule formats a rule like the errors of the kube-apiserver
+func compactRule(rule rbacv1.PolicyRule) string {
+	fields := []string{}
+	add := func(name string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		quoted := make([]string, len(values))
+		for i, value := range values {
+			quoted[i] = fmt.Sprintf("%q", value)
+		}
+		fields = append(fields, fmt.Sprintf("%s:[%s]", name, strings.Join(quoted, " ")))
+	}
+	add("APIGroups", rule.APIGroups)
+	add("Resources", rule.Resources)
+	add("ResourceNames", rule.ResourceNames)
+	add("NonResourceURLs", rule.NonResourceURLs)
+	add("Verbs", rule.Verbs)
+	return "{" + strings.Join(fields, ", ") + "}"
+}
@@ -0,0 +1,119 @@
+package authorization
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	"github.com/opencontrolplane/opencp-shim/internal/store"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+func putRBAC(t *testing.T, st store.Store, resource string, meta metav1.ObjectMeta, obj interface{}) {
+	t.Helper()
+	if err := PutRBAC(context.Background(), st, resource, &meta, obj, true, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// escalationStore has alice allowed to read the deployments of the default namespace,
+// bob allowed to escalate and bind in it and an admin role to bind
+func escalationStore(t *testing.T) store.Store {
+	st := store.NewMemory()
+
+	reader := metav1.ObjectMeta{Namespace: "default", Name: "reader"}
+	putRBAC(t, st, RolesResource, reader, &rbacv1.Role{ObjectMeta: reader, Rules: []rbacv1.PolicyRule{
+		{Verbs: []string{"get", "list"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}},
+	}})
+	escalator := metav1.ObjectMeta{Namespace: "default", Name: "escalator"}
+	putRBAC(t, st, RolesResource, escalator, &rbacv1.Role{ObjectMeta: escalator, Rules: []rbacv1.PolicyRule{
+		{Verbs: []string{EscalateVerb, BindVerb}, APIGroups: []string{rbacv1.GroupName}, Resources: []string{"*"}},
+	}})
+	admin := metav1.ObjectMeta{Name: "admin"}
+	putRBAC(t, st, ClusterRolesResource, admin, &rbacv1.ClusterRole{ObjectMeta: admin, Rules: []rbacv1.PolicyRule{
+		{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}},
+	}})
+
+	for name, role := range map[string]string{"alice": "reader", "bob": "escalator"} {
+		binding := metav1.ObjectMeta{Namespace: "default", Name: name}
+		putRBAC(t, st, RoleBindingsResource, binding, &rbacv1.RoleBinding{
+			ObjectMeta: binding,
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: name}},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: role},
+		})
+	}
+	return st
+}
+
+func rbacConfig() config.Config {
+	cfg := config.Config{}
+	cfg.Authorization.RBAC.Enabled = true
+	cfg.Authorization.RBAC.Superusers.Groups = []string{"system:masters"}
+	return cfg
+}
+
+func TestRolesCanOnlyGrantTheRulesOfTheirCreator(t *testing.T) {
+	st := escalationStore(t)
+	authz := NewAuthorizer(rbacConfig(), st)
+
+	get := rbacv1.PolicyRule{Verbs: []string{"get"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}, ResourceNames: []string{"web"}}
+	deleteRule := rbacv1.PolicyRule{Verbs: []string{"delete"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}
+	wildcard := rbacv1.PolicyRule{Verbs: []string{"*"}, APIGroups: []string{"apps"}, Resources: []string{"deployments"}}
+
+	tests := []struct {
+		name      string
+		user      user.Info
+		namespace string
+		rules     []rbacv1.PolicyRule
+		forbidden bool
+	}{
+		{name: "held rule", user: &user.DefaultInfo{Name: "alice"}, namespace: "default", rules: []rbacv1.PolicyRule{get}},
+		{name: "rule not held", user: &user.DefaultInfo{Name: "alice"}, namespace: "default", rules: []rbacv1.PolicyRule{get, deleteRule}, forbidden: true},
+		{name: "wildcard not held", user: &user.DefaultInfo{Name: "alice"}, namespace: "default", rules: []rbacv1.PolicyRule{wildcard}, forbidden: true},
+		{name: "rule held in another namespace", user: &user.DefaultInfo{Name: "alice"}, namespace: "other", rules: []rbacv1.PolicyRule{get}, forbidden: true},
+		{name: "escalate verb", user: &user.DefaultInfo{Name: "bob"}, namespace: "default", rules: []rbacv1.PolicyRule{wildcard}},
+		{name: "superuser", user: &user.DefaultInfo{Name: "carol", Groups: []string{"system:masters"}}, namespace: "default", rules: []rbacv1.PolicyRule{wildcard}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ConfirmRoleAllowed(context.Background(), authz, test.user, RolesResource, test.namespace, "new", test.rules)
+			if test.forbidden != apierrors.IsForbidden(err) || (!test.forbidden && err != nil) {
+				t.Fatalf("got the error %v", err)
+			}
+		})
+	}
+}
+
+func TestBindingsCanOnlyBindTheRulesOfTheirCreator(t *testing.T) {
+	st := escalationStore(t)
+	authz := NewAuthorizer(rbacConfig(), st)
+
+	reader := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "reader"}
+	admin := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "admin"}
+	missing := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "missing"}
+
+	tests := []struct {
+		name    string
+		user    string
+		roleRef rbacv1.RoleRef
+		check   func(error) bool
+	}{
+		{name: "held role", user: "alice", roleRef: reader, check: func(err error) bool { return err == nil }},
+		{name: "role not held", user: "alice", roleRef: admin, check: apierrors.IsForbidden},
+		{name: "bind verb", user: "bob", roleRef: admin, check: func(err error) bool { return err == nil }},
+		{name: "missing role", user: "alice", roleRef: missing, check: apierrors.IsNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ConfirmBindingAllowed(context.Background(), authz, st, &user.DefaultInfo{Name: test.user}, RoleBindingsResource, "default", "new", test.roleRef)
+			if !test.check(err) {
+				t.Fatalf("got the error %v", err)
+			}
+		})
+	}
+}
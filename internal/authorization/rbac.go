@@ -0,0 +1,407 @@
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencontrolplane/opencp-shim/internal/store"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// rbacPrefix is the prefix of the keys of the roles and bindings in the store
+const rbacPrefix = "rbac/"
+
+// The resources of the rbac.authorization.k8s.io group
+const (
+	RolesResource               = "roles"
+	ClusterRolesResource        = "clusterroles"
+	RoleBindingsResource        = "rolebindings"
+	ClusterRoleBindingsResource = "clusterrolebindings"
+)
+
+// RBACObject are the roles and bindings kept in the store
+type RBACObject interface {
+	rbacv1.Role | rbacv1.ClusterRole | rbacv1.RoleBinding | rbacv1.ClusterRoleBinding
+}
+
+// rbacMu serializes the writes of the roles and bindings, so the resourceVersion check is not raced
+var rbacMu sync.Mutex
+
+// rbacKey is the key of a role or binding in the store, the cluster ones have no namespace
+func rbacKey(resource, namespace, name string) string {
+	return fmt.Sprintf("%s%s/%s/%s", rbacPrefix, resource, namespace, name)
+}
+
+// GetRBAC returns a role or binding of the store, or a NotFound error
+func GetRBAC[T RBACObject](ctx context.Context, st store.Store, resource, namespace, name string) (*T, error) {
+	value, err := st.Get(ctx, rbacKey(resource, namespace, name))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, apierrors.NewNotFound(schema.GroupResource{Group: rbacv1.GroupName, Resource: resource}, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj := new(T)
+	if err := json.Unmarshal(value, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// ListRBAC returns the roles or bindings of a namespace, or of all the namespaces when it is empty, by name
+func ListRBAC[T RBACObject](ctx context.Context, st store.Store, resource, namespace string) ([]T, error) {
+	prefix := rbacPrefix + resource + "/"
+	if namespace != "" {
+		prefix = rbacKey(resource, namespace, "")
+	}
+
+	values, err := st.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	items := make([]T, 0, len(keys))
+	for _, key := range keys {
+		obj := new(T)
+		if err := json.Unmarshal(values[key], obj); err != nil {
+			return nil, err
+		}
+		items = append(items, *obj)
+	}
+	return items, nil
+}
+
+// PutRBAC creates or updates a role or binding in the store. The creation fails if it exists,
+// the update if it does not or if the object has a resourceVersion that is not the stored one.
+// With dryRun the object is checked and filled but not stored
+func PutRBAC(ctx context.Context, st store.Store, resource string, meta *metav1.ObjectMeta, obj interface{}, create, dryRun bool) error {
+	rbacMu.Lock()
+	defer rbacMu.Unlock()
+
+	groupResource := schema.GroupResource{Group: rbacv1.GroupName, Resource: resource}
+	key := rbacKey(resource, meta.Namespace, meta.Name)
+	value, err := st.Get(ctx, key)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	exists := err == nil
+
+	switch {
+	case create && exists:
+		return apierrors.NewAlreadyExists(groupResource, meta.Name)
+	case !create && !exists:
+		return apierrors.NewNotFound(groupResource, meta.Name)
+	}
+
+	now := time.Now()
+	if exists {
+		stored := metav1.PartialObjectMetadata{}
+		if err := json.Unmarshal(value, &stored); err != nil {
+			return err
+		}
+		if meta.ResourceVersion != "" && meta.ResourceVersion != stored.ResourceVersion {
+			return apierrors.NewConflict(groupResource, meta.Name, errors.New("the object has been modified; please apply your changes to the latest version and try again"))
+		}
+		meta.UID = stored.UID
+		meta.CreationTimestamp = stored.CreationTimestamp
+	} else {
+		meta.UID = types.UID(fmt.Sprintf("%s-%s-%d", resource, meta.Name, now.UnixNano()))
+		meta.CreationTimestamp = metav1.NewTime(now)
+	}
+	meta.ResourceVersion = strconv.FormatInt(now.UnixNano(), 10)
+	if dryRun {
+		return nil
+	}
+
+	value, err = json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return st.Put(ctx, key, value)
+}
+
+// DeleteRBAC removes a role or binding from the store, or returns a NotFound error. With dryRun it is not removed
+func DeleteRBAC(ctx context.Context, st store.Store, resource, namespace, name string, dryRun bool) error {
+	rbacMu.Lock()
+	defer rbacMu.Unlock()
+
+	key := rbacKey(resource, namespace, name)
+	if _, err := st.Get(ctx, key); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return apierrors.NewNotFound(schema.GroupResource{Group: rbacv1.GroupName, Resource: resource}, name)
+		}
+		return err
+	}
+	if dryRun {
+		return nil
+	}
+	return st.Delete(ctx, key)
+}
+
+// bootstrapRules are allowed to every authenticated user, like the system:discovery and
+// system:basic-user cluster roles of the kube-apiserver, so the clients can find the resources
+// and ask what they can do
+var bootstrapRules = []rbacv1.PolicyRule{
+	{
+		Verbs:           []string{"get"},
+		NonResourceURLs: []string{"/api", "/api/*", "/apis", "/apis/*", "/version", "/version/", "/openapi", "/openapi/*"},
+	},
+	{
+		Verbs:     []string{"create"},
+		APIGroups: []string{"authorization.k8s.io"},
+		Resources: []string{"selfsubjectaccessreviews", "selfsubjectrulesreviews"},
+	},
+	{
+		Verbs:     []string{"create"},
+		APIGroups: []string{"authentication.k8s.io"},
+		Resources: []string{"selfsubjectreviews"},
+	},
+}
+
+// rbacAuthorizer allows the requests granted by the roles bound to the user, in the cluster
+// role bindings and in the role bindings of the namespace of the request
+type rbacAuthorizer struct {
+	store store.Store
+}
+
+func (r rbacAuthorizer) Authorize(ctx context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+	u := a.GetUser()
+	if u == nil {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+
+	if containsString(u.GetGroups(), user.AllAuthenticated) && rulesAllow(a, bootstrapRules) {
+		return authorizer.DecisionAllow, "allowed to every authenticated user", nil
+	}
+
+	var reason string
+	err := r.visitRules(ctx, u, a.GetNamespace(), func(binding string, rules []rbacv1.PolicyRule) bool {
+		if rulesAllow(a, rules) {
+			reason = "allowed by " + binding
+			return false
+		}
+		return true
+	})
+	if reason != "" {
+		return authorizer.DecisionAllow, reason, nil
+	}
+	if err != nil {
+		return authorizer.DecisionNoOpinion, "", err
+	}
+	return authorizer.DecisionNoOpinion, "", nil
+}
+
+func (r rbacAuthorizer) RulesFor(u user.Info, namespace string) ([]authorizer.ResourceRuleInfo, []authorizer.NonResourceRuleInfo, bool, error) {
+	resourceRules := []authorizer.ResourceRuleInfo{}
+	nonResourceRules := []authorizer.NonResourceRuleInfo{}
+	addRules := func(binding string, rules []rbacv1.PolicyRule) bool {
+		for _, rule := range rules {
+			if len(rule.Resources) > 0 {
+				resourceRules = append(resourceRules, &authorizer.DefaultResourceRuleInfo{
+					Verbs:         rule.Verbs,
+					APIGroups:     rule.APIGroups,
+					Resources:     rule.Resources,
+					ResourceNames: rule.ResourceNames,
+				})
+			}
+			if len(rule.NonResourceURLs) > 0 {
+				nonResourceRules = append(nonResourceRules, &authorizer.DefaultNonResourceRuleInfo{
+					Verbs:           rule.Verbs,
+					NonResourceURLs: rule.NonResourceURLs,
+				})
+			}
+		}
+		return true
+	}
+
+	if containsString(u.GetGroups(), user.AllAuthenticated) {
+		addRules("", bootstrapRules)
+	}
+	err := r.visitRules(context.Background(), u, namespace, addRules)
+	return resourceRules, nonResourceRules, err != nil, err
+}
+
+// visitRules calls visit with the rules of the roles bound to the user, until it returns false.
+// The roles that can not be read are skipped and their errors returned at the end
+func (r rbacAuthorizer) visitRules(ctx context.Context, u user.Info, namespace string, visit func(binding string, rules []rbacv1.PolicyRule) bool) error {
+	errs := []error{}
+
+	clusterRoleBindings, err := ListRBAC[rbacv1.ClusterRoleBinding](ctx, r.store, ClusterRoleBindingsResource, "")
+	if err != nil {
+		return err
+	}
+	for _, binding := range clusterRoleBindings {
+		if !subjectsMatch(binding.Subjects, u, "") {
+			continue
+		}
+		rules, err := r.roleRules(ctx, binding.RoleRef, "")
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !visit(fmt.Sprintf("ClusterRoleBinding %q of %s %q", binding.Name, binding.RoleRef.Kind, binding.RoleRef.Name), rules) {
+			return nil
+		}
+	}
+
+	if namespace != "" {
+		roleBindings, err := ListRBAC[rbacv1.RoleBinding](ctx, r.store, RoleBindingsResource, namespace)
+		if err != nil {
+			return err
+		}
+		for _, binding := range roleBindings {
+			if !subjectsMatch(binding.Subjects, u, namespace) {
+				continue
+			}
+			rules, err := r.roleRules(ctx, binding.RoleRef, namespace)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if !visit(fmt.Sprintf("RoleBinding %q of %s %q in namespace %q", binding.Name, binding.RoleRef.Kind, binding.RoleRef.Name, namespace), rules) {
+				return nil
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// roleRules returns the rules of the role of a binding, a Role in the namespace of the binding or a ClusterRole
+func (r rbacAuthorizer) roleRules(ctx context.Context, roleRef rbacv1.RoleRef, namespace string) ([]rbacv1.PolicyRule, error) {
+	switch roleRef.Kind {
+	case "Role":
+		if namespace == "" {
+			return nil, fmt.Errorf("the cluster role binding of Role %q is not valid", roleRef.Name)
+		}
+		role, err := GetRBAC[rbacv1.Role](ctx, r.store, RolesResource, namespace, roleRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		return role.Rules, nil
+	case "ClusterRole":
+		clusterRole, err := GetRBAC[rbacv1.ClusterRole](ctx, r.store, ClusterRolesResource, "", roleRef.Name)
+		if err != nil {
+			return nil, err
+		}
+		return clusterRole.Rules, nil
+	}
+	return nil, fmt.Errorf("unknown kind %q of role %q", roleRef.Kind, roleRef.Name)
+}
+
+// subjectsMatch tells if the user is a subject of a binding, the service accounts
+// without namespace are in the namespace of the binding
+func subjectsMatch(subjects []rbacv1.Subject, u user.Info, namespace string) bool {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.UserKind:
+			if subject.Name == u.GetName() {
+				return true
+			}
+		case rbacv1.GroupKind:
+			if containsString(u.GetGroups(), subject.Name) {
+				return true
+			}
+		case rbacv1.ServiceAccountKind:
+			saNamespace := subject.Namespace
+			if saNamespace == "" {
+				saNamespace = namespace
+			}
+			if saNamespace != "" && serviceaccount.MakeUsername(saNamespace, subject.Name) == u.GetName() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rulesAllow tells if a rule allows the request, with the matching of the kube-apiserver
+func rulesAllow(a authorizer.Attributes, rules []rbacv1.PolicyRule) bool {
+	for _, rule := range rules {
+		if !matches(rule.Verbs, a.GetVerb()) {
+			continue
+		}
+
+		if !a.IsResourceRequest() {
+			if nonResourceURLMatches(rule.NonResourceURLs, a.GetPath()) {
+				return true
+			}
+			continue
+		}
+
+		if matches(rule.APIGroups, a.GetAPIGroup()) &&
+			resourceMatches(rule.Resources, a.GetResource(), a.GetSubresource()) &&
+			(len(rule.ResourceNames) == 0 || containsString(rule.ResourceNames, a.GetName())) {
+			return true
+		}
+	}
+	return false
+}
+
+func matches(values []string, value string) bool {
+	return containsString(values, rbacv1.VerbAll) || containsString(values, value)
+}
+
+// resourceMatches matches the resource, or the resource and subresource as resource/subresource,
+// */subresource matches the subresource of every resource
+func resourceMatches(resources []string, resource, subresource string) bool {
+	combined := resource
+	if subresource != "" {
+		combined = resource + "/" + subresource
+	}
+	for _, r := range resources {
+		switch {
+		case r == rbacv1.ResourceAll, r == combined:
+			return true
+		case subresource != "" && r == "*/"+subresource:
+			return true
+		}
+	}
+	return false
+}
+
+// nonResourceURLMatches matches the path, the urls ending in * match the paths starting with them
+func nonResourceURLMatches(urls []string, path string) bool {
+	for _, url := range urls {
+		switch {
+		case url == rbacv1.NonResourceAll, url == path:
+			return true
+		case strings.HasSuffix(url, "*") && strings.HasPrefix(path, strings.TrimSuffix(url, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package authorization
+
+import (
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func TestRulesAllowMatchesLikeTheKubeAPIServer(t *testing.T) {
+	rules := []rbacv1.PolicyRule{
+		{Verbs: []string{"get", "list"}, APIGroups: []string{"opencp.io"}, Resources: []string{"virtualmachines"}},
+		{Verbs: []string{"update"}, APIGroups: []string{"opencp.io"}, Resources: []string{"virtualmachines/status"}, ResourceNames: []string{"web"}},
+		{Verbs: []string{"*"}, APIGroups: []string{""}, Resources: []string{"*/log"}},
+		{Verbs: []string{"get"}, NonResourceURLs: []string{"/healthz", "/metrics/*"}},
+	}
+
+	resource := func(verb, group, resource, subresource, name string) authorizer.AttributesRecord {
+		return authorizer.AttributesRecord{Verb: verb, APIGroup: group, Resource: resource, Subresource: subresource, Name: name, ResourceRequest: true}
+	}
+	nonResource := func(verb, path string) authorizer.AttributesRecord {
+		return authorizer.AttributesRecord{Verb: verb, Path: path}
+	}
+
+	tests := []struct {
+		name       string
+		attributes authorizer.AttributesRecord
+		allowed    bool
+	}{
+		{name: "verb and resource", attributes: resource("list", "opencp.io", "virtualmachines", "", ""), allowed: true},
+		{name: "other verb", attributes: resource("delete", "opencp.io", "virtualmachines", "", ""), allowed: false},
+		{name: "other group", attributes: resource("get", "", "virtualmachines", "", ""), allowed: false},
+		{name: "subresource of a resource rule", attributes: resource("get", "opencp.io", "virtualmachines", "status", ""), allowed: false},
+		{name: "resource name", attributes: resource("update", "opencp.io", "virtualmachines", "status", "web"), allowed: true},
+		{name: "other resource name", attributes: resource("update", "opencp.io", "virtualmachines", "status", "db"), allowed: false},
+		{name: "subresource of every resource", attributes: resource("get", "", "pods", "log", ""), allowed: true},
+		{name: "exact url", attributes: nonResource("get", "/healthz"), allowed: true},
+		{name: "url prefix", attributes: nonResource("get", "/metrics/cardinality"), allowed: true},
+		{name: "other url", attributes: nonResource("get", "/version"), allowed: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if allowed := rulesAllow(test.attributes, rules); allowed != test.allowed {
+				t.Fatalf("the rules allow it: %v, expected %v", allowed, test.allowed)
+			}
+		})
+	}
+}
+
+func TestSubjectsMatchTheUsersGroupsAndServiceAccounts(t *testing.T) {
+	subjects := []rbacv1.Subject{
+		{Kind: rbacv1.UserKind, Name: "alice"},
+		{Kind: rbacv1.GroupKind, Name: "developers"},
+		{Kind: rbacv1.ServiceAccountKind, Name: "deployer"},
+		{Kind: rbacv1.ServiceAccountKind, Namespace: "ci", Name: "builder"},
+	}
+
+	tests := []struct {
+		name      string
+		user      user.Info
+		namespace string
+		match     bool
+	}{
+		{name: "user", user: &user.DefaultInfo{Name: "alice"}, match: true},
+		{name: "group", user: &user.DefaultInfo{Name: "bob", Groups: []string{"developers"}}, match: true},
+		{name: "neither", user: &user.DefaultInfo{Name: "bob", Groups: []string{"testers"}}, match: false},
+		{name: "service account of the binding namespace", user: &user.DefaultInfo{Name: "system:serviceaccount:default:deployer"}, namespace: "default", match: true},
+		{name: "service account without namespace in a cluster binding", user: &user.DefaultInfo{Name: "system:serviceaccount:default:deployer"}, match: false},
+		{name: "service account of its namespace", user: &user.DefaultInfo{Name: "system:serviceaccount:ci:builder"}, namespace: "default", match: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if match := subjectsMatch(subjects, test.user, test.namespace); match != test.match {
+				t.Fatalf("the subjects match: %v, expected %v", match, test.match)
+			}
+		})
+	}
+}
@@ -3,8 +3,11 @@ package config
 // THnis pacake is use to loadf the config file in yaml format and convert it to a []metav1.APIResource
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -18,6 +21,8 @@ type ApiResource struct {
 	SingularName string   `yaml:"SingularName"`
 	Name         string   `yaml:"Name"`
 	Version      string   `yaml:"Version"`
+	// SelectableFields are the fields supported in the fieldSelector of the list
+	SelectableFields []string `yaml:"SelectableFields"`
 }
 
 // GrpcServer is the struct that holds the grpc server config
@@ -27,14 +32,185 @@ type GrpcServer struct {
 
 // EtcdServer is the struct that holds the etcd server config
 type EtcdServer struct {
-	Host []string `yaml:"Host"`
+	Enabled bool     `yaml:"Enabled"`
+	Host    []string `yaml:"Host"`
+}
+
+// Watch is the struct that holds the watch config
+type Watch struct {
+	PollInterval     time.Duration `yaml:"PollInterval"`
+	BookmarkInterval time.Duration `yaml:"BookmarkInterval"`
+}
+
+// Pagination is the struct that holds the config of the paginated lists
+type Pagination struct {
+	TokenTTL time.Duration `yaml:"TokenTTL"`
+	// SigningKey signs the continue tokens, a random key is used when it is empty
+	SigningKey string `yaml:"SigningKey"`
+}
+
+// Events is the struct that holds the config of the events recorded by the shim
+type Events struct {
+	// TTL is how long an event is kept after it last happened
+	TTL time.Duration `yaml:"TTL"`
+}
+
+// TokenCache is the struct that holds the config of the cache of the token validations
+type TokenCache struct {
+	// TTL is how long a valid token is trusted without asking the login service again, 1m by default,
+	// the valid tokens are not kept when it is 0
+	TTL time.Duration `yaml:"TTL"`
+	// NegativeTTL is how long an invalid token is rejected without asking the login service again, 10s
+	// by default, the invalid tokens are not kept when it is 0
+	NegativeTTL time.Duration `yaml:"NegativeTTL"`
+	// Size is the maximum number of tokens kept, the least recently used are dropped
+	Size int `yaml:"Size"`
+	// PurgeAddress is where the purge of the cache is served, on the loopback by default so only the
+	// callers on the host of the shim can purge it
+	PurgeAddress string `yaml:"PurgeAddress"`
+}
+
+// X509 is the struct that holds the config of the authentication with client certificates
+type X509 struct {
+	// ClientCAFile is the bundle of the authorities the client certificates are verified with
+	ClientCAFile string `yaml:"ClientCAFile"`
+}
+
+// OIDC is the struct that holds the config of the authentication with OpenID Connect tokens
+type OIDC struct {
+	IssuerURL string `yaml:"IssuerURL"`
+	ClientID  string `yaml:"ClientID"`
+	// CAFile is the bundle of the authorities of the issuer, the ones of the system are used when it is empty
+	CAFile         string `yaml:"CAFile"`
+	UsernameClaim  string `yaml:"UsernameClaim"`
+	UsernamePrefix string `yaml:"UsernamePrefix"`
+	GroupsClaim    string `yaml:"GroupsClaim"`
+	GroupsPrefix   string `yaml:"GroupsPrefix"`
+}
+
+// Authentication is the struct that holds the config of the authentication of the callers
+type Authentication struct {
+	// Chain are the authenticators tried in the order of the list: x509, oidc or bearer, the token of the backend
+	Chain []string `yaml:"Chain"`
+	X509  X509     `yaml:"X509"`
+	OIDC  OIDC     `yaml:"OIDC"`
+	// ClientAllowlist are the expressions the User-Agent of the clients must match, any client is allowed when it is empty
+	ClientAllowlist []string `yaml:"ClientAllowlist"`
+}
+
+// Subjects is the struct that holds users and groups granted a permission in the config
+type Subjects struct {
+	Users  []string `yaml:"Users"`
+	Groups []string `yaml:"Groups"`
+}
+
+// RBAC is the struct that holds the config of the roles and bindings of the shim
+type RBAC struct {
+	// Enabled makes the requests need a role bound to the caller granting them, without it the roles and bindings are read only
+	Enabled bool `yaml:"Enabled"`
+	// Superusers are allowed every request, to create the first roles and bindings
+	Superusers Subjects `yaml:"Superusers"`
+}
+
+// Authorization is the struct that holds the config of what the callers can do in the shim
+type Authorization struct {
+	// Impersonators can act as any user, group or uid with the Impersonate headers
+	Impersonators Subjects `yaml:"Impersonators"`
+	RBAC          RBAC     `yaml:"RBAC"`
+}
+
+// AuditLog is the struct that holds the config of the file the audit events are written to
+type AuditLog struct {
+	// Path is the file of the events, - is the standard output, they are not written to a file when it is empty
+	Path string `yaml:"Path"`
+	// MaxSize is the size in megabytes the file is rotated at
+	MaxSize int `yaml:"MaxSize"`
+	// MaxBackups is the number of rotated files kept
+	MaxBackups int `yaml:"MaxBackups"`
+}
+
+// AuditWebhook is the struct that holds the config of the webhook the audit events are sent to in batches
+type AuditWebhook struct {
+	// URL receives the events as an audit.k8s.io/v1 EventList, they are not sent when it is empty
+	URL string `yaml:"URL"`
+	// BufferSize is the number of events waiting to be sent, the ones above it are dropped
+	BufferSize   int           `yaml:"BufferSize"`
+	BatchMaxSize int           `yaml:"BatchMaxSize"`
+	BatchMaxWait time.Duration `yaml:"BatchMaxWait"`
+	Timeout      time.Duration `yaml:"Timeout"`
+}
+
+// Audit is the struct that holds the config of the audit of the requests
+type Audit struct {
+	// PolicyFile is the audit.k8s.io/v1 Policy of the events recorded, the requests are not audited when it is empty
+	PolicyFile string       `yaml:"PolicyFile"`
+	Log        AuditLog     `yaml:"Log"`
+	Webhook    AuditWebhook `yaml:"Webhook"`
+	// RedactedFields are the fields of the request and response objects replaced in the events, like the kubeconfigs
+	RedactedFields []string `yaml:"RedactedFields"`
+}
+
+// PriorityLevel is the struct that holds the config of a priority level of the flow control
+type PriorityLevel struct {
+	Name string `yaml:"Name"`
+	// Exempt levels are never limited nor queued
+	Exempt bool `yaml:"Exempt"`
+	// ConcurrencyShares is the part of the server concurrency limit the level gets, against the shares of the other levels
+	ConcurrencyShares int32 `yaml:"ConcurrencyShares"`
+	// Queues are the queues of the requests waiting for the level, without queues they are rejected when the level is full
+	Queues int32 `yaml:"Queues"`
+	// HandSize is the number of queues a flow can be put in, the shortest one is taken
+	HandSize         int32 `yaml:"HandSize"`
+	QueueLengthLimit int32 `yaml:"QueueLengthLimit"`
+}
+
+// FlowSchemaRule is the struct that holds the requests a flow schema matches, the empty fields match everything
+type FlowSchemaRule struct {
+	Users     []string `yaml:"Users"`
+	Groups    []string `yaml:"Groups"`
+	Verbs     []string `yaml:"Verbs"`
+	APIGroups []string `yaml:"APIGroups"`
+	Resources []string `yaml:"Resources"`
+	// Namespaces of the resources, only the namespaced resources are matched when it is set
+	Namespaces      []string `yaml:"Namespaces"`
+	NonResourceURLs []string `yaml:"NonResourceURLs"`
+}
+
+// FlowSchema is the struct that holds the config of a flow schema, it gives a priority level to the requests it matches
+type FlowSchema struct {
+	Name          string `yaml:"Name"`
+	PriorityLevel string `yaml:"PriorityLevel"`
+	// MatchingPrecedence orders the flow schemas, the lowest matching one is taken
+	MatchingPrecedence int32 `yaml:"MatchingPrecedence"`
+	// DistinguisherMethod splits the requests in flows: ByUser, ByNamespace, or a single flow when it is empty
+	DistinguisherMethod string           `yaml:"DistinguisherMethod"`
+	Rules               []FlowSchemaRule `yaml:"Rules"`
+}
+
+// FlowControl is the struct that holds the config of the API Priority and Fairness of the requests
+type FlowControl struct {
+	// ServerConcurrencyLimit is the number of requests executed at the same time, shared by the priority levels
+	ServerConcurrencyLimit int `yaml:"ServerConcurrencyLimit"`
+	// QueueWait is how long a request waits in its queue before being rejected with a 429
+	QueueWait time.Duration `yaml:"QueueWait"`
+	// PriorityLevels and FlowSchemas have the exempt and catch-all ones added when they are missing
+	PriorityLevels []PriorityLevel `yaml:"PriorityLevels"`
+	FlowSchemas    []FlowSchema    `yaml:"FlowSchemas"`
 }
 
 // Config is the struct that holds the config file
 type Config struct {
-	ApiResource []ApiResource `yaml:"ApiResource"`
-	GrpcServer  GrpcServer    `yaml:"GrpcServer"`
-	EtcdServer  EtcdServer    `yaml:"EtcdServer"`
+	ApiResource    []ApiResource  `yaml:"ApiResource"`
+	GrpcServer     GrpcServer     `yaml:"GrpcServer"`
+	EtcdServer     EtcdServer     `yaml:"EtcdServer"`
+	Watch          Watch          `yaml:"Watch"`
+	Pagination     Pagination     `yaml:"Pagination"`
+	Events         Events         `yaml:"Events"`
+	TokenCache     TokenCache     `yaml:"TokenCache"`
+	Authentication Authentication `yaml:"Authentication"`
+	Authorization  Authorization  `yaml:"Authorization"`
+	Audit          Audit          `yaml:"Audit"`
+	FlowControl    FlowControl    `yaml:"FlowControl"`
 }
 
 // LoadConfig loads the config file and returns a Config struct
@@ -51,7 +227,8 @@ func LoadConfig(configFile string) (Config, error) {
 		return Config{}, fmt.Errorf("config file %s does not exist", configFile)
 	}
 
-	config := Config{}
+	// The ttls of the token cache are set before the file, a ttl of 0 in the file disables the cache
+	config := Config{TokenCache: TokenCache{TTL: time.Minute, NegativeTTL: 10 * time.Second}}
 	err = yaml.Unmarshal(content, &config)
 	if err != nil {
 		return Config{}, fmt.Errorf("error parsing config file %s", configFile)
@@ -62,5 +239,72 @@ func LoadConfig(configFile string) (Config, error) {
 		config.GrpcServer.Host = grpcServer
 	}
 
+	if config.Watch.PollInterval <= 0 {
+		config.Watch.PollInterval = 5 * time.Second
+	}
+	if config.Watch.BookmarkInterval <= 0 {
+		config.Watch.BookmarkInterval = time.Minute
+	}
+
+	if config.Pagination.TokenTTL <= 0 {
+		config.Pagination.TokenTTL = 5 * time.Minute
+	}
+	if config.Events.TTL <= 0 {
+		config.Events.TTL = time.Hour
+	}
+	if config.TokenCache.Size <= 0 {
+		config.TokenCache.Size = 4096
+	}
+	if config.TokenCache.PurgeAddress == "" {
+		config.TokenCache.PurgeAddress = "127.0.0.1:8082"
+	}
+	if len(config.Authentication.Chain) == 0 {
+		config.Authentication.Chain = []string{"bearer"}
+	}
+	if config.Authentication.OIDC.UsernameClaim == "" {
+		config.Authentication.OIDC.UsernameClaim = "sub"
+	}
+
+	if config.Audit.Log.MaxSize <= 0 {
+		config.Audit.Log.MaxSize = 100
+	}
+	if config.Audit.Log.MaxBackups <= 0 {
+		config.Audit.Log.MaxBackups = 5
+	}
+	if config.Audit.Webhook.BufferSize <= 0 {
+		config.Audit.Webhook.BufferSize = 10000
+	}
+	if config.Audit.Webhook.BatchMaxSize <= 0 {
+		config.Audit.Webhook.BatchMaxSize = 400
+	}
+	if config.Audit.Webhook.BatchMaxWait <= 0 {
+		config.Audit.Webhook.BatchMaxWait = 30 * time.Second
+	}
+	if config.Audit.Webhook.Timeout <= 0 {
+		config.Audit.Webhook.Timeout = 10 * time.Second
+	}
+	if config.Audit.RedactedFields == nil {
+		config.Audit.RedactedFields = []string{"kubeconfig", "accessKey", "secretKey", "password", "token"}
+	}
+
+	if config.FlowControl.ServerConcurrencyLimit <= 0 {
+		config.FlowControl.ServerConcurrencyLimit = 600
+	}
+	if config.FlowControl.QueueWait <= 0 {
+		config.FlowControl.QueueWait = 15 * time.Second
+	}
+
+	signingKey := os.Getenv("PAGINATION_SIGNING_KEY")
+	if signingKey != "" {
+		config.Pagination.SigningKey = signingKey
+	}
+	if config.Pagination.SigningKey == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return Config{}, fmt.Errorf("error generating the pagination signing key: %v", err)
+		}
+		config.Pagination.SigningKey = hex.EncodeToString(key)
+	}
+
 	return config, nil
 }
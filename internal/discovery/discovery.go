@@ -0,0 +1,482 @@
+package discovery
+
+// This package builds the discovery documents, legacy and aggregated, from the resources served by the shim
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	apidiscoveryv2beta1 "k8s.io/api/apidiscovery/v2beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// OpenCPGroup is the group of the resources served from the backend
+const OpenCPGroup = "opencp.io"
+
+// aggregatedContentType is the media type of the aggregated discovery documents
+const aggregatedContentType = "application/json;g=apidiscovery.k8s.io;v=v2beta1;as=APIGroupDiscoveryList"
+
+// GroupVersion is a group version served and its resources
+type GroupVersion struct {
+	schema.GroupVersion
+	Resources []metav1.APIResource
+}
+
+// coreResources are the resources of the core group served by the shim
+var coreResources = []metav1.APIResource{
+	{
+		Kind:         "Namespace",
+		SingularName: "",
+		Name:         "namespaces",
+		Verbs:        []string{"create", "delete", "get", "list"},
+		Namespaced:   false,
+		ShortNames:   []string{"ns"},
+	},
+	{
+		Kind:         "Namespace",
+		SingularName: "",
+		Name:         "namespaces/status",
+		Verbs:        []string{"get"},
+		Namespaced:   false,
+	},
+	{
+		Kind:         "Event",
+		SingularName: "",
+		Name:         "events",
+		Verbs:        []string{"list", "watch"},
+		Namespaced:   true,
+		ShortNames:   []string{"ev"},
+	},
+	{
+		Kind:         "Secret",
+		SingularName: "",
+		Name:         "secrets",
+		// Verbs:        []string{"create", "delete", "get", "list"},
+		Verbs:      []string{"get"},
+		Namespaced: true,
+		ShortNames: []string{"secret"},
+	},
+	{
+		Kind:         "Secret",
+		SingularName: "",
+		Name:         "secrets/status",
+		Verbs:        []string{"get"},
+		Namespaced:   true,
+	},
+}
+
+// AuthenticationGroup is the group of the reviews of the identity of the callers and of the tokens
+const AuthenticationGroup = "authentication.k8s.io"
+
+// authenticationResources are the resources of the authentication.k8s.io group served by the shim
+var authenticationResources = []metav1.APIResource{
+	{
+		Kind:         "SelfSubjectReview",
+		SingularName: "",
+		Name:         "selfsubjectreviews",
+		Verbs:        []string{"create"},
+		Namespaced:   false,
+	},
+	{
+		Kind:         "TokenReview",
+		SingularName: "",
+		Name:         "tokenreviews",
+		Verbs:        []string{"create"},
+		Namespaced:   false,
+	},
+}
+
+// authenticationV1alpha1Resources are served for the versions of kubectl asking the
+// SelfSubjectReview in v1alpha1, the version it was introduced in
+var authenticationV1alpha1Resources = []metav1.APIResource{
+	{
+		Kind:         "SelfSubjectReview",
+		SingularName: "",
+		Name:         "selfsubjectreviews",
+		Verbs:        []string{"create"},
+		Namespaced:   false,
+	},
+}
+
+// AuthorizationGroup is the group of the access reviews of the callers
+const AuthorizationGroup = "authorization.k8s.io"
+
+// authorizationResources are the resources of the authorization.k8s.io group served by the shim
+var authorizationResources = []metav1.APIResource{
+	{
+		Kind:         "SelfSubjectAccessReview",
+		SingularName: "",
+		Name:         "selfsubjectaccessreviews",
+		Verbs:        []string{"create"},
+		Namespaced:   false,
+	},
+	{
+		Kind:         "SelfSubjectRulesReview",
+		SingularName: "",
+		Name:         "selfsubjectrulesreviews",
+		Verbs:        []string{"create"},
+		Namespaced:   false,
+	},
+}
+
+// RBACGroup is the group of the roles and bindings of the shim
+const RBACGroup = "rbac.authorization.k8s.io"
+
+// rbacVerbs are the verbs of the roles and bindings, they are kept in the store of the shim
+var rbacVerbs = []string{"create", "delete", "get", "list", "patch", "update", "watch"}
+
+// rbacReadVerbs are the verbs of the roles and bindings without RBAC, nothing checks the rules they grant
+var rbacReadVerbs = []string{"get", "list", "watch"}
+
+// rbacResources are the resources of the rbac.authorization.k8s.io group served by the shim
+var rbacResources = []metav1.APIResource{
+	{
+		Kind:         "ClusterRoleBinding",
+		SingularName: "",
+		Name:         "clusterrolebindings",
+		Verbs:        rbacVerbs,
+		Namespaced:   false,
+	},
+	{
+		Kind:         "ClusterRole",
+		SingularName: "",
+		Name:         "clusterroles",
+		Verbs:        rbacVerbs,
+		Namespaced:   false,
+	},
+	{
+		Kind:         "RoleBinding",
+		SingularName: "",
+		Name:         "rolebindings",
+		Verbs:        rbacVerbs,
+		Namespaced:   true,
+	},
+	{
+		Kind:         "Role",
+		SingularName: "",
+		Name:         "roles",
+		Verbs:        rbacVerbs,
+		Namespaced:   true,
+	},
+}
+
+// FlowControlGroup is the group of the flow schemas and priority levels of the shim
+const FlowControlGroup = "flowcontrol.apiserver.k8s.io"
+
+// flowControlResources are the resources of the flowcontrol.apiserver.k8s.io group served by the shim,
+// they come from the config so they are read only
+var flowControlResources = []metav1.APIResource{
+	{
+		Kind:         "FlowSchema",
+		SingularName: "",
+		Name:         "flowschemas",
+		Verbs:        []string{"get", "list"},
+		Namespaced:   false,
+	},
+	{
+		Kind:         "PriorityLevelConfiguration",
+		SingularName: "",
+		Name:         "prioritylevelconfigurations",
+		Verbs:        []string{"get", "list"},
+		Namespaced:   false,
+	},
+}
+
+// Registry returns the group versions served, the core group first, then the
+// opencp.io versions from the ApiResource config, in the order they are configured,
+// and the groups of the shim itself
+func Registry(cfg config.Config) []GroupVersion {
+	registry := []GroupVersion{{
+		GroupVersion: schema.GroupVersion{Version: "v1"},
+		Resources:    coreResources,
+	}}
+
+	versions := map[string]int{}
+	for _, resource := range cfg.ApiResource {
+		index, ok := versions[resource.Version]
+		if !ok {
+			index = len(registry)
+			versions[resource.Version] = index
+			registry = append(registry, GroupVersion{GroupVersion: schema.GroupVersion{Group: OpenCPGroup, Version: resource.Version}})
+		}
+
+		registry[index].Resources = append(registry[index].Resources, metav1.APIResource{
+			Kind:         resource.Kind,
+			SingularName: resource.SingularName,
+			Name:         resource.Name,
+			Version:      resource.Version,
+			Verbs:        resource.Verbs,
+			Namespaced:   resource.Namespaced,
+			ShortNames:   resource.ShortNames,
+		})
+	}
+
+	rbac := rbacResources
+	if !cfg.Authorization.RBAC.Enabled {
+		rbac = withVerbs(rbacResources, rbacReadVerbs)
+	}
+
+	registry = append(registry, GroupVersion{
+		GroupVersion: schema.GroupVersion{Group: AuthenticationGroup, Version: "v1"},
+		Resources:    authenticationResources,
+	}, GroupVersion{
+		GroupVersion: schema.GroupVersion{Group: AuthenticationGroup, Version: "v1alpha1"},
+		Resources:    authenticationV1alpha1Resources,
+	}, GroupVersion{
+		GroupVersion: schema.GroupVersion{Group: AuthorizationGroup, Version: "v1"},
+		Resources:    authorizationResources,
+	}, GroupVersion{
+		GroupVersion: schema.GroupVersion{Group: RBACGroup, Version: "v1"},
+		Resources:    rbac,
+	}, GroupVersion{
+		GroupVersion: schema.GroupVersion{Group: FlowControlGroup, Version: "v1beta3"},
+		Resources:    flowControlResources,
+	})
+
+	return registry
+}
+
+// withVerbs returns a copy of the resources with the verbs
+func withVerbs(resources []metav1.APIResource, verbs []string) []metav1.APIResource {
+	copied := make([]metav1.APIResource, len(resources))
+	for i, resource := range resources {
+		resource.Verbs = verbs
+		copied[i] = resource
+	}
+	return copied
+}
+
+// APIResourceList returns the legacy discovery document of a group version
+func APIResourceList(registry []GroupVersion, groupVersion schema.GroupVersion) (metav1.APIResourceList, bool) {
+	for _, gv := range registry {
+		if gv.GroupVersion != groupVersion {
+			continue
+		}
+
+		return metav1.APIResourceList{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "APIResourceList",
+				APIVersion: "v1",
+			},
+			GroupVersion: gv.GroupVersion.String(),
+			APIResources: gv.Resources,
+		}, true
+	}
+	return metav1.APIResourceList{}, false
+}
+
+// Subresources returns the resources of a group version that are the given subresource of another
+// resource, the routes of the subresources are registered from them so they always match the discovery
+func Subresources(registry []GroupVersion, groupVersion schema.GroupVersion, subresource string) []metav1.APIResource {
+	subresources := []metav1.APIResource{}
+	for _, gv := range registry {
+		if gv.GroupVersion != groupVersion {
+			continue
+		}
+
+		for _, resource := range gv.Resources {
+			if _, name, ok := strings.Cut(resource.Name, "/"); ok && name == subresource {
+				subresources = append(subresources, resource)
+			}
+		}
+	}
+	return subresources
+}
+
+// APIGroupList returns the legacy discovery document of the named groups
+func APIGroupList(registry []GroupVersion) metav1.APIGroupList {
+	groupList := metav1.APIGroupList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "APIGroupList",
+			APIVersion: "v1",
+		},
+		Groups: []metav1.APIGroup{},
+	}
+
+	for _, gv := range registry {
+		if gv.Group == "" {
+			continue
+		}
+
+		version := metav1.GroupVersionForDiscovery{
+			GroupVersion: gv.GroupVersion.String(),
+			Version:      gv.Version,
+		}
+		group := findGroup(groupList.Groups, gv.Group)
+		if group == nil {
+			// The first version of the group is the preferred one
+			groupList.Groups = append(groupList.Groups, metav1.APIGroup{
+				Name:             gv.Group,
+				PreferredVersion: version,
+			})
+			group = &groupList.Groups[len(groupList.Groups)-1]
+		}
+		group.Versions = append(group.Versions, version)
+	}
+
+	return groupList
+}
+
+func findGroup(groups []metav1.APIGroup, name string) *metav1.APIGroup {
+	for i := range groups {
+		if groups[i].Name == name {
+			return &groups[i]
+		}
+	}
+	return nil
+}
+
+// AggregatedDiscovery returns the aggregated discovery document of the core group,
+// served at /api, or of the named groups, served at /apis
+func AggregatedDiscovery(registry []GroupVersion, core bool) apidiscoveryv2beta1.APIGroupDiscoveryList {
+	discoveryList := apidiscoveryv2beta1.APIGroupDiscoveryList{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "APIGroupDiscoveryList",
+			APIVersion: "apidiscovery.k8s.io/v2beta1",
+		},
+		Items: []apidiscoveryv2beta1.APIGroupDiscovery{},
+	}
+
+	for _, gv := range registry {
+		if (gv.Group == "") != core {
+			continue
+		}
+
+		var group *apidiscoveryv2beta1.APIGroupDiscovery
+		for i := range discoveryList.Items {
+			if discoveryList.Items[i].Name == gv.Group {
+				group = &discoveryList.Items[i]
+			}
+		}
+		if group == nil {
+			discoveryList.Items = append(discoveryList.Items, apidiscoveryv2beta1.APIGroupDiscovery{
+				ObjectMeta: metav1.ObjectMeta{Name: gv.Group},
+			})
+			group = &discoveryList.Items[len(discoveryList.Items)-1]
+		}
+
+		group.Versions = append(group.Versions, apidiscoveryv2beta1.APIVersionDiscovery{
+			Version:   gv.Version,
+			Resources: resourceDiscovery(gv),
+			Freshness: apidiscoveryv2beta1.DiscoveryFreshnessCurrent,
+		})
+	}
+
+	return discoveryList
+}
+
+// resourceDiscovery returns the resources of a group version, with their subresources
+// nested in them instead of listed as resources like in the legacy discovery
+func resourceDiscovery(gv GroupVersion) []apidiscoveryv2beta1.APIResourceDiscovery {
+	resources := []apidiscoveryv2beta1.APIResourceDiscovery{}
+	for _, resource := range gv.Resources {
+		if strings.Contains(resource.Name, "/") {
+			continue
+		}
+
+		scope := apidiscoveryv2beta1.ScopeCluster
+		if resource.Namespaced {
+			scope = apidiscoveryv2beta1.ScopeNamespace
+		}
+
+		singularName := resource.SingularName
+		if singularName == "" {
+			singularName = strings.ToLower(resource.Kind)
+		}
+
+		resources = append(resources, apidiscoveryv2beta1.APIResourceDiscovery{
+			Resource: resource.Name,
+			ResponseKind: &metav1.GroupVersionKind{
+				Group:   gv.Group,
+				Version: gv.Version,
+				Kind:    resource.Kind,
+			},
+			Scope:            scope,
+			SingularResource: singularName,
+			Verbs:            resource.Verbs,
+			ShortNames:       resource.ShortNames,
+			Categories:       resource.Categories,
+		})
+	}
+
+	for _, resource := range gv.Resources {
+		parent, subresource, ok := strings.Cut(resource.Name, "/")
+		if !ok {
+			continue
+		}
+
+		for i := range resources {
+			if resources[i].Resource != parent {
+				continue
+			}
+			resources[i].Subresources = append(resources[i].Subresources, apidiscoveryv2beta1.APISubresourceDiscovery{
+				Subresource: subresource,
+				ResponseKind: &metav1.GroupVersionKind{
+					Group:   gv.Group,
+					Version: gv.Version,
+					Kind:    resource.Kind,
+				},
+				Verbs: resource.Verbs,
+			})
+		}
+	}
+
+	return resources
+}
+
+// IsAggregated checks if the client prefers the aggregated discovery to the legacy one
+func IsAggregated(r *restful.Request) bool {
+	for _, mediaType := range pkg.ParseAccept(r.HeaderParameter("Accept")) {
+		if mediaType.Type != "application" || mediaType.SubType != "json" {
+			if mediaType.Type == "*" || mediaType.SubType == "*" {
+				return false
+			}
+			continue
+		}
+
+		as, ok := mediaType.Params["as"]
+		if !ok {
+			return false
+		}
+		if as == "APIGroupDiscoveryList" && mediaType.Params["g"] == "apidiscovery.k8s.io" && mediaType.Params["v"] == "v2beta1" {
+			return true
+		}
+	}
+	return false
+}
+
+// Write writes a discovery document with its ETag, answering 304 Not Modified
+// when the client already has the same document
+func Write(r *restful.Request, w *restful.Response, document interface{}) {
+	contentType := restful.MIME_JSON
+	if _, ok := document.(apidiscoveryv2beta1.APIGroupDiscoveryList); ok {
+		contentType = aggregatedContentType
+	}
+
+	data, err := json.Marshal(document)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	etag := strconv.Quote(fmt.Sprintf("%X", sha512.Sum512(data)))
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Vary", "Accept")
+	w.Header().Set("ETag", etag)
+
+	if r.HeaderParameter("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
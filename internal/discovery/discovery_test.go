@@ -0,0 +1,42 @@
+package discovery
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestTheRolesAndBindingsAreReadOnlyWithoutRBAC(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		verbs   string
+	}{
+		{name: "RBAC enabled", enabled: true, verbs: "create,delete,get,list,patch,update,watch"},
+		{name: "RBAC disabled", enabled: false, verbs: "get,list,watch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := config.Config{}
+			cfg.Authorization.RBAC.Enabled = test.enabled
+
+			resourceList, ok := APIResourceList(Registry(cfg), schema.GroupVersion{Group: RBACGroup, Version: "v1"})
+			if !ok || len(resourceList.APIResources) != 4 {
+				t.Fatalf("the rbac group has the resources %+v", resourceList.APIResources)
+			}
+			for _, resource := range resourceList.APIResources {
+				if verbs := strings.Join(resource.Verbs, ","); verbs != test.verbs {
+					t.Fatalf("%s has the verbs %s, expected %s", resource.Name, verbs, test.verbs)
+				}
+			}
+		})
+	}
+
+	// The read only verbs are set on copies, the resources served with RBAC keep all their verbs
+	if verbs := strings.Join(rbacResources[0].Verbs, ","); verbs != tests[0].verbs {
+		t.Fatalf("the rbac resources were changed to the verbs %s", verbs)
+	}
+}
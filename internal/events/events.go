@@ -0,0 +1,194 @@
+package events
+
+// This package records the events of the shim in the store, like the failures of the backend calls
+// and the state transitions of the objects, and reads them back for the events API. The backend
+// answers every caller with its own objects, so the events are kept and listed per caller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opencontrolplane/opencp-shim/internal/store"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/cache"
+)
+
+// Component is the source of the events recorded by the shim
+const Component = "opencp-shim"
+
+// eventsPrefix is the prefix of the keys of the events in the store
+const eventsPrefix = "events/"
+
+const (
+	// maxStates is how many objects the last state seen is kept for
+	maxStates = 100000
+	// stateTTL is how long the last state seen of an object is kept once it is no longer read
+	stateTTL = 24 * time.Hour
+)
+
+// eventLocks serialize the read-modify-write of an event, so its count is not lost, an event only
+// waits for the events sharing its lock
+var eventLocks [64]sync.Mutex
+
+// The last state seen of the objects, by caller and object, they are kept in memory so reading
+// an object only writes to the store when its state changed
+var (
+	statesMu sync.Mutex
+	states   = cache.NewLRUExpireCache(maxStates)
+)
+
+// Record records an event on an object, an event with the same reason and message as an existing
+// one increases its count instead of being recorded again, like the event correlator of client-go
+func Record(ctx context.Context, st store.Store, involvedObject corev1.ObjectReference, eventType, reason, message string) {
+	namespace := involvedObject.Namespace
+	if namespace == "" {
+		// The events of the cluster scoped objects are in the default namespace, like in the kube-apiserver
+		namespace = metav1.NamespaceDefault
+	}
+	name := eventName(involvedObject, eventType, reason, message)
+	key := eventKey(pkg.Caller(ctx), namespace, name)
+	now := metav1.Now()
+
+	lock := eventLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	event := corev1.Event{}
+	value, err := st.Get(ctx, key)
+	switch {
+	case err == nil && json.Unmarshal(value, &event) == nil:
+		event.Count++
+		event.LastTimestamp = now
+	case err != nil && !errors.Is(err, store.ErrNotFound):
+		log.Println(err)
+		return
+	default:
+		event = corev1.Event{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Event",
+				APIVersion: "v1",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         namespace,
+				UID:               types.UID(name),
+				CreationTimestamp: now,
+			},
+			InvolvedObject:      involvedObject,
+			Reason:              reason,
+			Message:             message,
+			Source:              corev1.EventSource{Component: Component},
+			FirstTimestamp:      now,
+			LastTimestamp:       now,
+			Count:               1,
+			Type:                eventType,
+			ReportingController: Component,
+			ReportingInstance:   Component,
+		}
+	}
+	// The resourceVersion is derived from the content of the event when it is read
+	event.ResourceVersion = ""
+
+	value, err = json.Marshal(event)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := st.Put(ctx, key, value); err != nil {
+		log.Println(err)
+	}
+}
+
+// ObserveState records a event when the state of an object is not the one seen the last time by its
+// caller, the backend has no history of the states so the transitions are the ones the shim sees
+func ObserveState(ctx context.Context, st store.Store, involvedObject corev1.ObjectReference, state string) {
+	if state == "" {
+		return
+	}
+
+	key := fmt.Sprintf("%s/%s/%s/%s/%s", pkg.Caller(ctx), involvedObject.Kind, involvedObject.Namespace, involvedObject.Name, involvedObject.UID)
+
+	statesMu.Lock()
+	previous := ""
+	if value, ok := states.Get(key); ok {
+		previous = value.(string)
+	}
+	states.Add(key, state, stateTTL)
+	statesMu.Unlock()
+
+	// The first state seen is not a transition
+	if previous == "" || previous == state {
+		return
+	}
+	Record(ctx, st, involvedObject, corev1.EventTypeNormal, "StateChanged", fmt.Sprintf("State changed from %s to %s", previous, state))
+}
+
+// List returns the events of the caller in a namespace, or in all the namespaces when it is empty, oldest
+// first. The events that did not happen again in the ttl are removed
+func List(ctx context.Context, st store.Store, namespace string, ttl time.Duration) ([]corev1.Event, error) {
+	prefix := eventsPrefix + pkg.Caller(ctx) + "/"
+	if namespace != "" {
+		prefix = eventKey(pkg.Caller(ctx), namespace, "")
+	}
+
+	values, err := st.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []corev1.Event{}
+	for key, value := range values {
+		event := corev1.Event{}
+		if err := json.Unmarshal(value, &event); err != nil {
+			log.Println(err)
+			continue
+		}
+		if ttl > 0 && time.Since(event.LastTimestamp.Time) > ttl {
+			if err := st.Delete(ctx, key); err != nil {
+				log.Println(err)
+			}
+			continue
+		}
+		items = append(items, event)
+	}
+
+	Sort(items)
+	return items, nil
+}
+
+// Sort sorts the events by the last time they happened, oldest first
+func Sort(items []corev1.Event) {
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].LastTimestamp.Equal(&items[j].LastTimestamp) {
+			return items[i].LastTimestamp.Before(&items[j].LastTimestamp)
+		}
+		return items[i].Name < items[j].Name
+	})
+}
+
+func eventKey(caller, namespace, name string) string {
+	return eventsPrefix + caller + "/" + namespace + "/" + name
+}
+
+func eventLock(key string) *sync.Mutex {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return &eventLocks[hash.Sum32()%uint32(len(eventLocks))]
+}
+
+// eventName is the name of the event, derived from what happened so the same event is aggregated
+func eventName(involvedObject corev1.ObjectReference, eventType, reason, message string) string {
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s/%s/%s/%s;%s;%s;%s", involvedObject.Kind, involvedObject.Namespace, involvedObject.Name, involvedObject.UID, eventType, reason, message)
+	return fmt.Sprintf("%s.%x", involvedObject.Name, hash.Sum64())
+}
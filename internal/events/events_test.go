@@ -0,0 +1,72 @@
+package events
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opencontrolplane/opencp-shim/internal/store"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func callerContext(name string) context.Context {
+	return request.WithUser(context.Background(), &user.DefaultInfo{Name: name})
+}
+
+func TestEventsAreListedOnlyToTheirCaller(t *testing.T) {
+	st := store.NewMemory()
+	alice, bob := callerContext("alice"), callerContext("bob")
+	vm := corev1.ObjectReference{Kind: "VirtualMachine", Namespace: "default", Name: "web"}
+
+	Record(alice, st, vm, corev1.EventTypeWarning, "FailedCreate", "quota exceeded")
+	Record(alice, st, vm, corev1.EventTypeWarning, "FailedCreate", "quota exceeded")
+
+	aliceEvents, err := List(alice, st, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliceEvents) != 1 || aliceEvents[0].Count != 2 {
+		t.Fatalf("alice got the events %+v", aliceEvents)
+	}
+
+	for _, namespace := range []string{"", "default"} {
+		bobEvents, err := List(bob, st, namespace, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bobEvents) != 0 {
+			t.Fatalf("bob got the events of alice in %q: %+v", namespace, bobEvents)
+		}
+	}
+}
+
+func TestObserveStateRecordsTheTransitionsSeenByTheCaller(t *testing.T) {
+	st := store.NewMemory()
+	alice, bob := callerContext("alice"), callerContext("bob")
+	vm := corev1.ObjectReference{Kind: "VirtualMachine", Namespace: "default", Name: "db", UID: "1"}
+
+	ObserveState(alice, st, vm, "BUILDING")
+	ObserveState(alice, st, vm, "BUILDING")
+	ObserveState(bob, st, vm, "ACTIVE")
+
+	aliceEvents, err := List(alice, st, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliceEvents) != 0 {
+		t.Fatalf("the first and the unchanged states are recorded: %+v", aliceEvents)
+	}
+	if values, err := st.List(context.Background(), ""); err != nil || len(values) != 0 {
+		t.Fatalf("reading the states wrote %d keys to the store (%v)", len(values), err)
+	}
+
+	ObserveState(alice, st, vm, "ACTIVE")
+	aliceEvents, err = List(alice, st, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliceEvents) != 1 || aliceEvents[0].Reason != "StateChanged" || aliceEvents[0].Message != "State changed from BUILDING to ACTIVE" {
+		t.Fatalf("alice got the events %+v", aliceEvents)
+	}
+}
@@ -0,0 +1,415 @@
+package flowcontrol
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// The reasons of the rejected requests, as the kube-apiserver gives them
+const (
+	ReasonQueueFull        = "queue-full"
+	ReasonConcurrencyLimit = "concurrency-limit"
+	ReasonTimeOut          = "time-out"
+	ReasonCancelled        = "cancelled"
+)
+
+var (
+	rejectedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "opencp_shim_flowcontrol_rejected_requests_total",
+		Help: "Number of requests rejected by the flow control, by priority level, flow schema and reason.",
+	}, []string{"priority_level", "flow_schema", "reason"})
+	executingRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "opencp_shim_flowcontrol_current_executing_requests",
+		Help: "Number of requests executing, by priority level.",
+	}, []string{"priority_level"})
+	inQueueRequests = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "opencp_shim_flowcontrol_current_inqueue_requests",
+		Help: "Number of requests waiting in the queues, by priority level.",
+	}, []string{"priority_level"})
+	concurrencyLimit = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "opencp_shim_flowcontrol_request_concurrency_limit",
+		Help: "Number of requests a priority level executes at the same time.",
+	}, []string{"priority_level"})
+)
+
+// RejectedError is the error of a request the flow control did not let through
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("the request was rejected by the flow control: %s", e.Reason)
+}
+
+// Controller gives the requests a flow schema and the priority level of the flow schema, the requests
+// of a limited priority level wait in its queues when the level executes as many requests as its limit
+type Controller struct {
+	flowSchemas []*flowSchema
+	// catchAll is the catch-all flow schema, the requests matching no flow schema are given it
+	catchAll       *flowSchema
+	priorityLevels []*priorityLevel
+	queueWait      time.Duration
+}
+
+type flowSchema struct {
+	object *flowcontrolv1beta3.FlowSchema
+	level  *priorityLevel
+}
+
+type priorityLevel struct {
+	object *flowcontrolv1beta3.PriorityLevelConfiguration
+	// queues is nil for the exempt levels
+	queues *queueSet
+}
+
+// Request is a classified request, with its flow schema, its priority level and its flow
+type Request struct {
+	FlowSchema    *flowcontrolv1beta3.FlowSchema
+	PriorityLevel *flowcontrolv1beta3.PriorityLevelConfiguration
+	schema        *flowSchema
+	flow          string
+}
+
+// NewController returns the controller of the priority levels and flow schemas of the config,
+// with the exempt and catch-all ones added when they are missing
+func NewController(cfg config.FlowControl) (*Controller, error) {
+	created := metav1.Now()
+	levels, schemas := withMandatory(cfg.PriorityLevels, cfg.FlowSchemas)
+
+	c := &Controller{queueWait: cfg.QueueWait}
+	byName := map[string]*priorityLevel{}
+	var totalShares int32
+	for _, level := range levels {
+		if level.Name == "" {
+			return nil, fmt.Errorf("a priority level has no name")
+		}
+		if _, ok := byName[level.Name]; ok {
+			return nil, fmt.Errorf("the priority level %q is defined twice", level.Name)
+		}
+		object := priorityLevelObject(level, created)
+		if object.Spec.Limited != nil {
+			totalShares += object.Spec.Limited.NominalConcurrencyShares
+		}
+		byName[level.Name] = &priorityLevel{object: object}
+		c.priorityLevels = append(c.priorityLevels, byName[level.Name])
+	}
+
+	// The server concurrency limit is shared by the limited levels by their shares, like the kube-apiserver does
+	for _, level := range c.priorityLevels {
+		limited := level.object.Spec.Limited
+		if limited == nil {
+			continue
+		}
+		limit := int(math.Ceil(float64(cfg.ServerConcurrencyLimit) * float64(limited.NominalConcurrencyShares) / float64(totalShares)))
+		level.queues = newQueueSet(level.object.Name, limit, limited.LimitResponse.Queuing)
+		concurrencyLimit.WithLabelValues(level.object.Name).Set(float64(limit))
+	}
+
+	names := map[string]bool{}
+	for _, schema := range schemas {
+		if schema.Name == "" {
+			return nil, fmt.Errorf("a flow schema has no name")
+		}
+		if names[schema.Name] {
+			return nil, fmt.Errorf("the flow schema %q is defined twice", schema.Name)
+		}
+		names[schema.Name] = true
+		level, ok := byName[schema.PriorityLevel]
+		if !ok {
+			return nil, fmt.Errorf("the flow schema %q has the unknown priority level %q", schema.Name, schema.PriorityLevel)
+		}
+		object, err := flowSchemaObject(schema, created)
+		if err != nil {
+			return nil, err
+		}
+		c.flowSchemas = append(c.flowSchemas, &flowSchema{object: object, level: level})
+		if schema.Name == flowcontrolv1beta3.FlowSchemaNameCatchAll {
+			c.catchAll = c.flowSchemas[len(c.flowSchemas)-1]
+		}
+	}
+
+	// The lowest matching precedence is taken first, the name breaks the ties
+	sort.SliceStable(c.flowSchemas, func(i, j int) bool {
+		a, b := c.flowSchemas[i].object, c.flowSchemas[j].object
+		if a.Spec.MatchingPrecedence != b.Spec.MatchingPrecedence {
+			return a.Spec.MatchingPrecedence < b.Spec.MatchingPrecedence
+		}
+		return a.Name < b.Name
+	})
+
+	return c, nil
+}
+
+// Classify returns the request with the first flow schema it matches, the requests matching
+// none, like with a catch-all flow schema of the config not matching every request, get the
+// catch-all flow schema
+func (c *Controller) Classify(attributes authorizer.Attributes) *Request {
+	for _, schema := range c.flowSchemas {
+		if !matchesFlowSchema(schema.object, attributes) {
+			continue
+		}
+		return &Request{
+			FlowSchema:    schema.object,
+			PriorityLevel: schema.level.object,
+			schema:        schema,
+			flow:          flowDistinguisher(schema.object, attributes),
+		}
+	}
+
+	return &Request{
+		FlowSchema:    c.catchAll.object,
+		PriorityLevel: c.catchAll.level.object,
+		schema:        c.catchAll,
+		flow:          flowDistinguisher(c.catchAll.object, attributes),
+	}
+}
+
+// Wait waits until the priority level of the request can execute it, the returned function
+// has to be called when the request is done. The request is rejected with a RejectedError when
+// its queue is full, when the level has no queues and is full, or when it waited too long
+func (c *Controller) Wait(ctx context.Context, request *Request) (func(), error) {
+	queues := request.schema.level.queues
+	if queues == nil {
+		return func() {}, nil
+	}
+
+	release, reason := queues.wait(ctx, request.flow, c.queueWait)
+	if reason != "" {
+		rejectedRequests.WithLabelValues(request.PriorityLevel.Name, request.FlowSchema.Name, reason).Inc()
+		return nil, &RejectedError{Reason: reason}
+	}
+	return release, nil
+}
+
+// FlowSchemas returns the flow schemas, in the order they are matched
+func (c *Controller) FlowSchemas() []flowcontrolv1beta3.FlowSchema {
+	schemas := make([]flowcontrolv1beta3.FlowSchema, len(c.flowSchemas))
+	for i, schema := range c.flowSchemas {
+		schemas[i] = *schema.object.DeepCopy()
+	}
+	return schemas
+}
+
+// PriorityLevels returns the priority levels, in the order of the config
+func (c *Controller) PriorityLevels() []flowcontrolv1beta3.PriorityLevelConfiguration {
+	levels := make([]flowcontrolv1beta3.PriorityLevelConfiguration, len(c.priorityLevels))
+	for i, level := range c.priorityLevels {
+		levels[i] = *level.object.DeepCopy()
+	}
+	return levels
+}
+
+// withMandatory adds the exempt and catch-all priority levels and flow schemas of the kube-apiserver when they are missing
+func withMandatory(levels []config.PriorityLevel, schemas []config.FlowSchema) ([]config.PriorityLevel, []config.FlowSchema) {
+	levels = append([]config.PriorityLevel{}, levels...)
+	schemas = append([]config.FlowSchema{}, schemas...)
+
+	if !hasPriorityLevel(levels, flowcontrolv1beta3.PriorityLevelConfigurationNameExempt) {
+		levels = append(levels, config.PriorityLevel{Name: flowcontrolv1beta3.PriorityLevelConfigurationNameExempt, Exempt: true})
+	}
+	if !hasPriorityLevel(levels, flowcontrolv1beta3.PriorityLevelConfigurationNameCatchAll) {
+		levels = append(levels, config.PriorityLevel{Name: flowcontrolv1beta3.PriorityLevelConfigurationNameCatchAll, ConcurrencyShares: 5})
+	}
+	if !hasFlowSchema(schemas, flowcontrolv1beta3.FlowSchemaNameExempt) {
+		schemas = append(schemas, config.FlowSchema{
+			Name:               flowcontrolv1beta3.FlowSchemaNameExempt,
+			PriorityLevel:      flowcontrolv1beta3.PriorityLevelConfigurationNameExempt,
+			MatchingPrecedence: 1,
+			Rules:              []config.FlowSchemaRule{{Groups: []string{"system:masters"}}},
+		})
+	}
+	if !hasFlowSchema(schemas, flowcontrolv1beta3.FlowSchemaNameCatchAll) {
+		schemas = append(schemas, config.FlowSchema{
+			Name:                flowcontrolv1beta3.FlowSchemaNameCatchAll,
+			PriorityLevel:       flowcontrolv1beta3.PriorityLevelConfigurationNameCatchAll,
+			MatchingPrecedence:  flowcontrolv1beta3.FlowSchemaMaxMatchingPrecedence,
+			DistinguisherMethod: string(flowcontrolv1beta3.FlowDistinguisherMethodByUserType),
+			Rules:               []config.FlowSchemaRule{{Groups: []string{"system:authenticated", "system:unauthenticated"}}},
+		})
+	}
+	return levels, schemas
+}
+
+func hasPriorityLevel(levels []config.PriorityLevel, name string) bool {
+	for _, level := range levels {
+		if level.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFlowSchema(schemas []config.FlowSchema, name string) bool {
+	for _, schema := range schemas {
+		if schema.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stableUID is the UID of an object, from its resource and name, so the same object keeps it across restarts and replicas
+func stableUID(resource, name string) types.UID {
+	return types.UID(uuid.NewSHA1(uuid.NameSpaceURL, []byte(flowcontrolv1beta3.GroupName+"/"+resource+"/"+name)).String())
+}
+
+// priorityLevelObject returns the PriorityLevelConfiguration of a priority level of the config
+func priorityLevelObject(level config.PriorityLevel, created metav1.Time) *flowcontrolv1beta3.PriorityLevelConfiguration {
+	object := &flowcontrolv1beta3.PriorityLevelConfiguration{
+		TypeMeta: metav1.TypeMeta{Kind: "PriorityLevelConfiguration", APIVersion: flowcontrolv1beta3.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              level.Name,
+			UID:               stableUID("prioritylevelconfigurations", level.Name),
+			ResourceVersion:   "1",
+			Generation:        1,
+			CreationTimestamp: created,
+		},
+	}
+	if level.Exempt {
+		object.Spec.Type = flowcontrolv1beta3.PriorityLevelEnablementExempt
+		return object
+	}
+
+	shares := level.ConcurrencyShares
+	if shares <= 0 {
+		shares = 30
+	}
+	limited := &flowcontrolv1beta3.LimitedPriorityLevelConfiguration{
+		NominalConcurrencyShares: shares,
+		LimitResponse:            flowcontrolv1beta3.LimitResponse{Type: flowcontrolv1beta3.LimitResponseTypeReject},
+	}
+	if level.Queues > 0 {
+		handSize := level.HandSize
+		if handSize <= 0 {
+			handSize = 8
+		}
+		if handSize > level.Queues {
+			handSize = level.Queues
+		}
+		queueLengthLimit := level.QueueLengthLimit
+		if queueLengthLimit <= 0 {
+			queueLengthLimit = 50
+		}
+		limited.LimitResponse = flowcontrolv1beta3.LimitResponse{
+			Type: flowcontrolv1beta3.LimitResponseTypeQueue,
+			Queuing: &flowcontrolv1beta3.QueuingConfiguration{
+				Queues:           level.Queues,
+				HandSize:         handSize,
+				QueueLengthLimit: queueLengthLimit,
+			},
+		}
+	}
+	object.Spec.Type = flowcontrolv1beta3.PriorityLevelEnablementLimited
+	object.Spec.Limited = limited
+	return object
+}
+
+// flowSchemaObject returns the FlowSchema of a flow schema of the config
+func flowSchemaObject(schema config.FlowSchema, created metav1.Time) (*flowcontrolv1beta3.FlowSchema, error) {
+	precedence := schema.MatchingPrecedence
+	if precedence == 0 {
+		precedence = 1000
+	}
+	if precedence < 1 || precedence > flowcontrolv1beta3.FlowSchemaMaxMatchingPrecedence {
+		return nil, fmt.Errorf("the matching precedence of the flow schema %q is not between 1 and %d", schema.Name, flowcontrolv1beta3.FlowSchemaMaxMatchingPrecedence)
+	}
+
+	object := &flowcontrolv1beta3.FlowSchema{
+		TypeMeta: metav1.TypeMeta{Kind: "FlowSchema", APIVersion: flowcontrolv1beta3.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              schema.Name,
+			UID:               stableUID("flowschemas", schema.Name),
+			ResourceVersion:   "1",
+			Generation:        1,
+			CreationTimestamp: created,
+		},
+		Spec: flowcontrolv1beta3.FlowSchemaSpec{
+			PriorityLevelConfiguration: flowcontrolv1beta3.PriorityLevelConfigurationReference{Name: schema.PriorityLevel},
+			MatchingPrecedence:         precedence,
+		},
+		Status: flowcontrolv1beta3.FlowSchemaStatus{
+			Conditions: []flowcontrolv1beta3.FlowSchemaCondition{{
+				Type:               flowcontrolv1beta3.FlowSchemaConditionDangling,
+				Status:             flowcontrolv1beta3.ConditionFalse,
+				LastTransitionTime: created,
+				Reason:             "Found",
+				Message:            fmt.Sprintf("This FlowSchema references the PriorityLevelConfiguration object named %q and it exists", schema.PriorityLevel),
+			}},
+		},
+	}
+
+	switch method := flowcontrolv1beta3.FlowDistinguisherMethodType(schema.DistinguisherMethod); method {
+	case "":
+	case flowcontrolv1beta3.FlowDistinguisherMethodByUserType, flowcontrolv1beta3.FlowDistinguisherMethodByNamespaceType:
+		object.Spec.DistinguisherMethod = &flowcontrolv1beta3.FlowDistinguisherMethod{Type: method}
+	default:
+		return nil, fmt.Errorf("the flow schema %q has the unknown distinguisher method %q", schema.Name, schema.DistinguisherMethod)
+	}
+
+	for _, rule := range schema.Rules {
+		object.Spec.Rules = append(object.Spec.Rules, policyRules(rule))
+	}
+	return object, nil
+}
+
+// policyRules returns the rules of a flow schema rule of the config, the empty fields match everything
+func policyRules(rule config.FlowSchemaRule) flowcontrolv1beta3.PolicyRulesWithSubjects {
+	policy := flowcontrolv1beta3.PolicyRulesWithSubjects{}
+	for _, name := range rule.Users {
+		policy.Subjects = append(policy.Subjects, flowcontrolv1beta3.Subject{
+			Kind: flowcontrolv1beta3.SubjectKindUser,
+			User: &flowcontrolv1beta3.UserSubject{Name: name},
+		})
+	}
+	for _, name := range rule.Groups {
+		policy.Subjects = append(policy.Subjects, flowcontrolv1beta3.Subject{
+			Kind:  flowcontrolv1beta3.SubjectKindGroup,
+			Group: &flowcontrolv1beta3.GroupSubject{Name: name},
+		})
+	}
+	if len(policy.Subjects) == 0 {
+		policy.Subjects = []flowcontrolv1beta3.Subject{{
+			Kind:  flowcontrolv1beta3.SubjectKindGroup,
+			Group: &flowcontrolv1beta3.GroupSubject{Name: flowcontrolv1beta3.NameAll},
+		}}
+	}
+
+	verbs := orAll(rule.Verbs)
+	resourceRule := len(rule.APIGroups) > 0 || len(rule.Resources) > 0 || len(rule.Namespaces) > 0
+	nonResourceRule := len(rule.NonResourceURLs) > 0
+	if resourceRule || !nonResourceRule {
+		policy.ResourceRules = []flowcontrolv1beta3.ResourcePolicyRule{{
+			Verbs:        verbs,
+			APIGroups:    orAll(rule.APIGroups),
+			Resources:    orAll(rule.Resources),
+			ClusterScope: len(rule.Namespaces) == 0,
+			Namespaces:   orAll(rule.Namespaces),
+		}}
+	}
+	if nonResourceRule || !resourceRule {
+		policy.NonResourceRules = []flowcontrolv1beta3.NonResourcePolicyRule{{
+			Verbs:           verbs,
+			NonResourceURLs: orAll(rule.NonResourceURLs),
+		}}
+	}
+	return policy
+}
+
+func orAll(values []string) []string {
+	if len(values) == 0 {
+		return []string{flowcontrolv1beta3.NameAll}
+	}
+	return values
+}
@@ -0,0 +1,109 @@
+package flowcontrol
+
+import (
+	"testing"
+
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+func testController(t *testing.T, schemas ...config.FlowSchema) *Controller {
+	c, err := NewController(config.FlowControl{
+		ServerConcurrencyLimit: 10,
+		PriorityLevels:         []config.PriorityLevel{{Name: "workload", ConcurrencyShares: 10}},
+		FlowSchemas:            schemas,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func listRequest(name string, groups ...string) authorizer.AttributesRecord {
+	return authorizer.AttributesRecord{
+		User:            &user.DefaultInfo{Name: name, Groups: append(groups, user.AllAuthenticated)},
+		Verb:            "list",
+		APIGroup:        "opencp.io",
+		Resource:        "virtualmachines",
+		Namespace:       "default",
+		ResourceRequest: true,
+	}
+}
+
+func TestClassifyTakesTheFirstMatchingFlowSchema(t *testing.T) {
+	c := testController(t,
+		config.FlowSchema{Name: "vms", PriorityLevel: "workload", MatchingPrecedence: 500, DistinguisherMethod: "ByUser",
+			Rules: []config.FlowSchemaRule{{Groups: []string{user.AllAuthenticated}, Verbs: []string{"list"}, APIGroups: []string{"opencp.io"}, Resources: []string{"virtualmachines"}, Namespaces: []string{"*"}}}},
+		config.FlowSchema{Name: "alice", PriorityLevel: "workload", MatchingPrecedence: 100,
+			Rules: []config.FlowSchemaRule{{Users: []string{"alice"}, Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}},
+	)
+
+	tests := []struct {
+		name       string
+		attributes authorizer.AttributesRecord
+		schema     string
+		level      string
+	}{
+		{name: "lowest precedence first", attributes: listRequest("alice"), schema: "alice", level: "workload"},
+		{name: "rule matching the resource", attributes: listRequest("bob"), schema: "vms", level: "workload"},
+		{name: "exempt group", attributes: listRequest("admin", "system:masters"), schema: flowcontrolv1beta3.FlowSchemaNameExempt, level: flowcontrolv1beta3.PriorityLevelConfigurationNameExempt},
+		{
+			name:       "nothing else matching",
+			attributes: authorizer.AttributesRecord{User: &user.DefaultInfo{Name: "bob", Groups: []string{user.AllAuthenticated}}, Verb: "get", Path: "/version"},
+			schema:     flowcontrolv1beta3.FlowSchemaNameCatchAll,
+			level:      flowcontrolv1beta3.PriorityLevelConfigurationNameCatchAll,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := c.Classify(test.attributes)
+			if request.FlowSchema.Name != test.schema || request.PriorityLevel.Name != test.level {
+				t.Fatalf("got the flow schema %s at the level %s", request.FlowSchema.Name, request.PriorityLevel.Name)
+			}
+		})
+	}
+
+	if alice, bob := c.Classify(listRequest("carol")).flow, c.Classify(listRequest("dave")).flow; alice == bob {
+		t.Fatal("the users are the same flow of a flow schema distinguishing them")
+	}
+}
+
+func TestClassifyFallsBackToTheCatchAllFlowSchema(t *testing.T) {
+	// The catch-all flow schema of the config does not match every request, and a flow schema
+	// of the same precedence is sorted after it
+	c := testController(t,
+		config.FlowSchema{Name: flowcontrolv1beta3.FlowSchemaNameCatchAll, PriorityLevel: "workload", MatchingPrecedence: flowcontrolv1beta3.FlowSchemaMaxMatchingPrecedence,
+			Rules: []config.FlowSchemaRule{{Users: []string{"nobody"}}}},
+		config.FlowSchema{Name: "zz-last", PriorityLevel: flowcontrolv1beta3.PriorityLevelConfigurationNameExempt, MatchingPrecedence: flowcontrolv1beta3.FlowSchemaMaxMatchingPrecedence,
+			Rules: []config.FlowSchemaRule{{Users: []string{"zz"}}}},
+	)
+
+	schemas := c.FlowSchemas()
+	if last := schemas[len(schemas)-1].Name; last != "zz-last" {
+		t.Fatalf("the last flow schema is %s", last)
+	}
+	request := c.Classify(listRequest("alice"))
+	if request.FlowSchema.Name != flowcontrolv1beta3.FlowSchemaNameCatchAll || request.PriorityLevel.Name != "workload" {
+		t.Fatalf("got the flow schema %s at the level %s", request.FlowSchema.Name, request.PriorityLevel.Name)
+	}
+}
+
+func TestNewControllerRejectsInvalidConfigs(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.FlowControl
+	}{
+		{name: "unknown priority level", cfg: config.FlowControl{FlowSchemas: []config.FlowSchema{{Name: "a", PriorityLevel: "unknown"}}}},
+		{name: "flow schema defined twice", cfg: config.FlowControl{FlowSchemas: []config.FlowSchema{{Name: "a", PriorityLevel: "exempt"}, {Name: "a", PriorityLevel: "exempt"}}}},
+		{name: "priority level without name", cfg: config.FlowControl{PriorityLevels: []config.PriorityLevel{{ConcurrencyShares: 1}}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewController(test.cfg); err == nil {
+				t.Fatal("the config was accepted")
+			}
+		})
+	}
+}
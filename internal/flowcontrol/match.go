@@ -0,0 +1,132 @@
+package flowcontrol
+
+import (
+	"strings"
+
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+	"k8s.io/apiserver/pkg/authentication/serviceaccount"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// matchesFlowSchema tells if a request matches one of the rules of a flow schema, with the rules of the kube-apiserver
+func matchesFlowSchema(schema *flowcontrolv1beta3.FlowSchema, attributes authorizer.Attributes) bool {
+	for _, rule := range schema.Spec.Rules {
+		if matchesPolicyRule(rule, attributes) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesPolicyRule(rule flowcontrolv1beta3.PolicyRulesWithSubjects, attributes authorizer.Attributes) bool {
+	if attributes.GetUser() == nil || !matchesSubjects(rule.Subjects, attributes) {
+		return false
+	}
+
+	if attributes.IsResourceRequest() {
+		for _, resourceRule := range rule.ResourceRules {
+			if matchesResourceRule(resourceRule, attributes) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, nonResourceRule := range rule.NonResourceRules {
+		if matchesNonResourceRule(nonResourceRule, attributes) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesSubjects(subjects []flowcontrolv1beta3.Subject, attributes authorizer.Attributes) bool {
+	user := attributes.GetUser()
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case flowcontrolv1beta3.SubjectKindUser:
+			if subject.User != nil && (subject.User.Name == flowcontrolv1beta3.NameAll || subject.User.Name == user.GetName()) {
+				return true
+			}
+		case flowcontrolv1beta3.SubjectKindGroup:
+			if subject.Group == nil {
+				continue
+			}
+			if subject.Group.Name == flowcontrolv1beta3.NameAll {
+				return true
+			}
+			for _, group := range user.GetGroups() {
+				if group == subject.Group.Name {
+					return true
+				}
+			}
+		case flowcontrolv1beta3.SubjectKindServiceAccount:
+			if subject.ServiceAccount == nil {
+				continue
+			}
+			namespace, name, err := serviceaccount.SplitUsername(user.GetName())
+			if err != nil || namespace != subject.ServiceAccount.Namespace {
+				continue
+			}
+			if subject.ServiceAccount.Name == flowcontrolv1beta3.NameAll || subject.ServiceAccount.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesResourceRule(rule flowcontrolv1beta3.ResourcePolicyRule, attributes authorizer.Attributes) bool {
+	resource := attributes.GetResource()
+	if attributes.GetSubresource() != "" {
+		resource += "/" + attributes.GetSubresource()
+	}
+	if !contains(rule.Verbs, attributes.GetVerb()) || !contains(rule.APIGroups, attributes.GetAPIGroup()) || !contains(rule.Resources, resource) {
+		return false
+	}
+
+	if attributes.GetNamespace() == "" {
+		return rule.ClusterScope
+	}
+	return contains(rule.Namespaces, attributes.GetNamespace())
+}
+
+func matchesNonResourceRule(rule flowcontrolv1beta3.NonResourcePolicyRule, attributes authorizer.Attributes) bool {
+	if !contains(rule.Verbs, attributes.GetVerb()) {
+		return false
+	}
+
+	path := attributes.GetPath()
+	for _, url := range rule.NonResourceURLs {
+		switch {
+		case url == flowcontrolv1beta3.NameAll, url == path:
+			return true
+		case strings.HasSuffix(url, "/*") && strings.HasPrefix(path, strings.TrimSuffix(url, "*")):
+			return true
+		}
+	}
+	return false
+}
+
+// contains tells if the values have the value or the wildcard
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == flowcontrolv1beta3.NameAll || v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// flowDistinguisher returns the flow of a request in its flow schema, the requests of a flow share their queues
+func flowDistinguisher(schema *flowcontrolv1beta3.FlowSchema, attributes authorizer.Attributes) string {
+	if schema.Spec.DistinguisherMethod == nil {
+		return ""
+	}
+	switch schema.Spec.DistinguisherMethod.Type {
+	case flowcontrolv1beta3.FlowDistinguisherMethodByUserType:
+		return attributes.GetUser().GetName()
+	case flowcontrolv1beta3.FlowDistinguisherMethodByNamespaceType:
+		return attributes.GetNamespace()
+	}
+	return ""
+}
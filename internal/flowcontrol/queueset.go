@@ -0,0 +1,164 @@
+package flowcontrol
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+)
+
+// queueSet executes up to the concurrency limit of a priority level, the other requests wait in
+// its queues. A flow is given a hand of queues by shuffle sharding and waits in the shortest one,
+// so a busy flow fills its own queues before the ones of the others, and the queues are
+// dispatched in turn so every flow gets its part of the level
+type queueSet struct {
+	level            string
+	limit            int
+	handSize         int
+	queueLengthLimit int
+
+	mu        sync.Mutex
+	queues    [][]*waiter
+	executing int
+	waiting   int
+	next      int
+}
+
+// waiter is a request waiting in a queue, ready is closed when it is dispatched
+type waiter struct {
+	ready      chan struct{}
+	dispatched bool
+}
+
+func newQueueSet(level string, limit int, queuing *flowcontrolv1beta3.QueuingConfiguration) *queueSet {
+	q := &queueSet{level: level, limit: limit}
+	if queuing != nil {
+		q.queues = make([][]*waiter, queuing.Queues)
+		q.handSize = int(queuing.HandSize)
+		q.queueLengthLimit = int(queuing.QueueLengthLimit)
+	}
+	return q
+}
+
+// wait returns the function releasing the seat of the request, or the reason it was rejected
+func (q *queueSet) wait(ctx context.Context, flow string, timeout time.Duration) (func(), string) {
+	q.mu.Lock()
+	if q.executing < q.limit && q.waiting == 0 {
+		q.executing++
+		q.updateMetrics()
+		q.mu.Unlock()
+		return q.releaseFunc(), ""
+	}
+	if len(q.queues) == 0 {
+		q.mu.Unlock()
+		return nil, ReasonConcurrencyLimit
+	}
+
+	index := q.shortestQueue(flow)
+	if len(q.queues[index]) >= q.queueLengthLimit {
+		q.mu.Unlock()
+		return nil, ReasonQueueFull
+	}
+	w := &waiter{ready: make(chan struct{})}
+	q.queues[index] = append(q.queues[index], w)
+	q.waiting++
+	q.updateMetrics()
+	q.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	var reason string
+	select {
+	case <-w.ready:
+		return q.releaseFunc(), ""
+	case <-timer.C:
+		reason = ReasonTimeOut
+	case <-ctx.Done():
+		reason = ReasonCancelled
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// It was dispatched while it stopped waiting
+	if w.dispatched {
+		return q.releaseFunc(), ""
+	}
+	for i, queued := range q.queues[index] {
+		if queued == w {
+			q.queues[index] = append(q.queues[index][:i], q.queues[index][i+1:]...)
+			break
+		}
+	}
+	q.waiting--
+	q.updateMetrics()
+	return nil, reason
+}
+
+func (q *queueSet) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+			q.executing--
+			q.dispatch()
+			q.updateMetrics()
+		})
+	}
+}
+
+// dispatch executes the requests waiting while the level is not full, taking the queues in turn
+func (q *queueSet) dispatch() {
+	for q.executing < q.limit && q.waiting > 0 {
+		for len(q.queues[q.next]) == 0 {
+			q.next = (q.next + 1) % len(q.queues)
+		}
+		w := q.queues[q.next][0]
+		q.queues[q.next] = q.queues[q.next][1:]
+		q.next = (q.next + 1) % len(q.queues)
+
+		q.waiting--
+		q.executing++
+		w.dispatched = true
+		close(w.ready)
+	}
+}
+
+// shortestQueue returns the shortest queue of the hand of a flow, the hand is dealt from the hash
+// of the flow so a flow always gets the same queues
+func (q *queueSet) shortestQueue(flow string) int {
+	h := fnv.New64a()
+	h.Write([]byte(flow))
+	hash := h.Sum64()
+
+	shortest := -1
+	dealt := []int{}
+	for i := 0; i < q.handSize && i < len(q.queues); i++ {
+		remaining := uint64(len(q.queues) - i)
+		card := int(hash % remaining)
+		hash /= remaining
+		// The card is an index in the queues not dealt yet, dealt is kept sorted
+		position := len(dealt)
+		for j, d := range dealt {
+			if card < d {
+				position = j
+				break
+			}
+			card++
+		}
+		dealt = append(dealt[:position], append([]int{card}, dealt[position:]...)...)
+
+		if shortest == -1 || len(q.queues[card]) < len(q.queues[shortest]) {
+			shortest = card
+		}
+	}
+	return shortest
+}
+
+// updateMetrics has to be called with the lock held
+func (q *queueSet) updateMetrics() {
+	executingRequests.WithLabelValues(q.level).Set(float64(q.executing))
+	inQueueRequests.WithLabelValues(q.level).Set(float64(q.waiting))
+}
@@ -0,0 +1,90 @@
+package flowcontrol
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+)
+
+func TestQueueSetWithoutQueuesRejectsOverTheLimit(t *testing.T) {
+	q := newQueueSet("test", 1, nil)
+
+	release, reason := q.wait(context.Background(), "a", time.Second)
+	if reason != "" {
+		t.Fatalf("the first request was rejected: %s", reason)
+	}
+	if _, reason := q.wait(context.Background(), "a", time.Second); reason != ReasonConcurrencyLimit {
+		t.Fatalf("the request over the limit got %q", reason)
+	}
+
+	release()
+	release()
+	if _, reason := q.wait(context.Background(), "a", time.Second); reason != "" {
+		t.Fatalf("the request after the release was rejected: %s", reason)
+	}
+}
+
+func TestQueueSetQueuesOverTheLimit(t *testing.T) {
+	q := newQueueSet("test", 1, &flowcontrolv1beta3.QueuingConfiguration{Queues: 1, HandSize: 1, QueueLengthLimit: 1})
+
+	release, _ := q.wait(context.Background(), "a", time.Second)
+
+	dispatched := make(chan string)
+	go func() {
+		releaseQueued, reason := q.wait(context.Background(), "b", 5*time.Second)
+		if reason == "" {
+			releaseQueued()
+		}
+		dispatched <- reason
+	}()
+	for {
+		q.mu.Lock()
+		waiting := q.waiting
+		q.mu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, reason := q.wait(context.Background(), "c", time.Second); reason != ReasonQueueFull {
+		t.Fatalf("the request over the length of the queue got %q", reason)
+	}
+
+	release()
+	if reason := <-dispatched; reason != "" {
+		t.Fatalf("the queued request was rejected: %s", reason)
+	}
+}
+
+func TestQueueSetRejectsTheRequestsWaitingTooLong(t *testing.T) {
+	q := newQueueSet("test", 1, &flowcontrolv1beta3.QueuingConfiguration{Queues: 1, HandSize: 1, QueueLengthLimit: 10})
+	q.wait(context.Background(), "a", time.Second)
+
+	if _, reason := q.wait(context.Background(), "b", 10*time.Millisecond); reason != ReasonTimeOut {
+		t.Fatalf("the request waiting too long got %q", reason)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, reason := q.wait(ctx, "b", time.Second); reason != ReasonCancelled {
+		t.Fatalf("the canceled request got %q", reason)
+	}
+	if q.waiting != 0 {
+		t.Fatalf("%d requests are still waiting", q.waiting)
+	}
+}
+
+func TestQueueSetDealsDistinctQueuesToAFlow(t *testing.T) {
+	q := newQueueSet("test", 1, &flowcontrolv1beta3.QueuingConfiguration{Queues: 8, HandSize: 8, QueueLengthLimit: 10})
+
+	// Every queue of the hand is filled in turn when the hand has distinct queues
+	for i := 0; i < len(q.queues); i++ {
+		index := q.shortestQueue("flow")
+		if len(q.queues[index]) != 0 {
+			t.Fatalf("the hand of the flow has the queue %d twice", index)
+		}
+		q.queues[index] = append(q.queues[index], &waiter{})
+	}
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/authentication"
+	"github.com/opencontrolplane/opencp-shim/internal/authorization"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	auditinternal "k8s.io/apiserver/pkg/apis/audit"
+	k8saudit "k8s.io/apiserver/pkg/audit"
+)
+
+// auditRecorder keeps the body of the response for the event, the whole body at the
+// RequestResponse level and the Status of the failures at the other levels
+type auditRecorder struct {
+	http.ResponseWriter
+	keepBody bool
+	code     int
+	body     bytes.Buffer
+}
+
+func (a *auditRecorder) WriteHeader(code int) {
+	a.code = code
+	a.ResponseWriter.WriteHeader(code)
+}
+
+func (a *auditRecorder) Write(p []byte) (int, error) {
+	if a.code == 0 {
+		a.code = http.StatusOK
+	}
+	if a.keepBody || a.code >= http.StatusBadRequest {
+		a.body.Write(p)
+	}
+	return a.ResponseWriter.Write(p)
+}
+
+func (a *auditRecorder) Flush() {
+	if flusher, ok := a.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Audit records the requests as audit.k8s.io/v1 events at the level of the first rule of the
+// audit policy they match, when they are received and when their response is complete. It runs
+// right after the authentication, so the impersonations and the requests denied are recorded too
+func Audit(r *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	if app.Auditor == nil {
+		chain.ProcessFilter(r, resp)
+		return
+	}
+
+	received := time.Now()
+	attributes, err := requestAttributes(r.Request)
+	if err != nil {
+		chain.ProcessFilter(r, resp)
+		return
+	}
+	auditConfig := app.Auditor.Evaluate(attributes)
+	if auditConfig.Level == auditinternal.LevelNone {
+		chain.ProcessFilter(r, resp)
+		return
+	}
+
+	ev, err := k8saudit.NewEventFromRequest(r.Request, received, auditConfig.Level, attributes)
+	if err != nil {
+		log.Println(err)
+		chain.ProcessFilter(r, resp)
+		return
+	}
+	if ev.Level.GreaterOrEqual(auditinternal.LevelRequest) {
+		ev.RequestObject = auditRequestObject(r, app)
+	}
+	resp.Header().Set(auditinternal.HeaderAuditID, string(ev.AuditID))
+
+	ev.Stage = auditinternal.StageRequestReceived
+	ev.StageTimestamp = metav1.NewMicroTime(received)
+	app.Auditor.Record(ev, auditConfig.OmitStages)
+
+	// The watches are not kept, they can last for hours
+	recorder := &auditRecorder{
+		ResponseWriter: resp.ResponseWriter,
+		keepBody:       ev.Level.GreaterOrEqual(auditinternal.LevelRequestResponse) && attributes.Verb != "watch",
+	}
+	resp.ResponseWriter = recorder
+	chain.ProcessFilter(r, resp)
+	resp.ResponseWriter = recorder.ResponseWriter
+
+	// The caller is the user of the event, the impersonated one is who the request was done as
+	if _, ok := authentication.ImpersonatorFrom(r.Request.Context()); ok {
+		k8saudit.LogImpersonatedUser(ev, authorization.User(r.Request.Context()))
+	}
+	ev.ResponseStatus = &metav1.Status{Code: int32(resp.StatusCode())}
+	if isJSON(resp.Header().Get("Content-Type")) && recorder.body.Len() > 0 {
+		if resp.StatusCode() >= http.StatusBadRequest {
+			status := metav1.Status{}
+			if json.Unmarshal(recorder.body.Bytes(), &status) == nil && status.Kind == "Status" {
+				status.TypeMeta = metav1.TypeMeta{}
+				ev.ResponseStatus = &status
+			}
+		}
+		if recorder.keepBody {
+			if object := app.Auditor.Redact(recorder.body.Bytes()); object != nil {
+				ev.ResponseObject = &runtime.Unknown{Raw: object, ContentType: runtime.ContentTypeJSON}
+			}
+		}
+	}
+
+	ev.Stage = auditinternal.StageResponseComplete
+	ev.StageTimestamp = metav1.NewMicroTime(time.Now())
+	app.Auditor.Record(ev, auditConfig.OmitStages)
+}
+
+// auditFailedAuthentication records a request rejected before its caller is known, like the
+// kube-apiserver the event has no user and is recorded when its response is started
+func auditFailedAuthentication(r *restful.Request, app *setup.OpenCPApp, code int, message string) {
+	if app.Auditor == nil {
+		return
+	}
+
+	received := time.Now()
+	attributes, err := requestAttributes(r.Request)
+	if err != nil {
+		return
+	}
+	attributes.User = nil
+	auditConfig := app.Auditor.Evaluate(attributes)
+	if auditConfig.Level == auditinternal.LevelNone {
+		return
+	}
+
+	ev, err := k8saudit.NewEventFromRequest(r.Request, received, auditConfig.Level, attributes)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	ev.ResponseStatus = &metav1.Status{Status: metav1.StatusFailure, Code: int32(code), Message: message}
+	ev.Stage = auditinternal.StageResponseStarted
+	ev.StageTimestamp = metav1.NewMicroTime(time.Now())
+	app.Auditor.Record(ev, auditConfig.OmitStages)
+}
+
+// auditRequestObject returns the redacted object in the body of the request, in json, the body is kept for the handlers
+func auditRequestObject(r *restful.Request, app *setup.OpenCPApp) *runtime.Unknown {
+	if r.Request.Body == nil || r.Request.Method == http.MethodGet {
+		return nil
+	}
+	body, err := io.ReadAll(r.Request.Body)
+	r.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || len(body) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.HeaderParameter("Content-Type"))
+	if mediaType == pkg.MIME_PROTOBUF {
+		body, err = pkg.DecodeProtobuf(body)
+	} else {
+		body, err = yaml.ToJSON(body)
+	}
+	if err != nil {
+		return nil
+	}
+
+	object := app.Auditor.Redact(body)
+	if object == nil {
+		return nil
+	}
+	return &runtime.Unknown{Raw: object, ContentType: runtime.ContentTypeJSON}
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == restful.MIME_JSON || strings.HasSuffix(mediaType, "+json")
+}
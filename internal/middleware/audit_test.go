@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/audit"
+	"github.com/opencontrolplane/opencp-shim/internal/authentication"
+	"github.com/opencontrolplane/opencp-shim/internal/authorization"
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/internal/store"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+)
+
+const metadataPolicy = `apiVersion: audit.k8s.io/v1
+kind: Policy
+rules:
+- level: Metadata
+`
+
+// auditServer serves /api/v1/namespaces behind the filters of the shim, the events are logged to the returned file
+func auditServer(t *testing.T) (*httptest.Server, string) {
+	dir := t.TempDir()
+	policyFile := filepath.Join(dir, "policy.yaml")
+	if err := os.WriteFile(policyFile, []byte(metadataPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	logFile := filepath.Join(dir, "audit.log")
+
+	auditor, err := audit.NewAuditor(config.Audit{PolicyFile: policyFile, Log: config.AuditLog{Path: logFile, MaxSize: 10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := authentication.NewCache(fakeLogin{}, config.TokenCache{TTL: time.Minute, NegativeTTL: time.Minute, Size: 10})
+	authenticator, err := authentication.NewAuthenticator(config.Authentication{Chain: []string{authentication.BearerAuthenticator}}, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{}
+	cfg.Authorization.Impersonators.Users = []string{tokenUser("admin")}
+	app := &setup.OpenCPApp{
+		Authenticator: authenticator,
+		Authorizer:    authorization.NewAuthorizer(cfg, store.NewMemory()),
+		Auditor:       auditor,
+	}
+
+	ws := new(restful.WebService).Path("/api/v1/namespaces")
+	ws.Route(ws.GET("").To(func(r *restful.Request, w *restful.Response) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	container := restful.NewContainer()
+	container.Add(ws)
+	container.Filter(func(r *restful.Request, w *restful.Response, chain *restful.FilterChain) {
+		r.SetAttribute("app", app)
+		chain.ProcessFilter(r, w)
+	})
+	container.Filter(Authenticate)
+	container.Filter(Audit)
+	container.Filter(Impersonate)
+
+	server := httptest.NewServer(container)
+	t.Cleanup(server.Close)
+	return server, logFile
+}
+
+func auditEvents(t *testing.T, logFile string) []auditv1.Event {
+	file, err := os.Open(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	events := []auditv1.Event{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		ev := auditv1.Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	return events
+}
+
+func TestAuditRecordsTheRequestsRejectedBeforeTheHandlers(t *testing.T) {
+	tests := []struct {
+		name             string
+		token            string
+		impersonate      string
+		code             int
+		user             string
+		impersonatedUser string
+		stage            auditv1.Stage
+	}{
+		{name: "unauthenticated", code: http.StatusUnauthorized, stage: auditv1.StageResponseStarted},
+		{name: "impersonation denied", token: "alice", impersonate: "bob", code: http.StatusForbidden, user: tokenUser("alice"), stage: auditv1.StageResponseComplete},
+		{name: "impersonation allowed", token: "admin", impersonate: "bob", code: http.StatusOK, user: tokenUser("admin"), impersonatedUser: "bob", stage: auditv1.StageResponseComplete},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, logFile := auditServer(t)
+
+			req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/namespaces", nil)
+			if test.token != "" {
+				req.Header.Set("Authorization", "Bearer "+test.token)
+			}
+			if test.impersonate != "" {
+				req.Header.Set(authenticationv1.ImpersonateUserHeader, test.impersonate)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode != test.code {
+				t.Fatalf("the request got %d, expected %d", resp.StatusCode, test.code)
+			}
+
+			events := auditEvents(t, logFile)
+			if len(events) == 0 {
+				t.Fatal("the request has no audit event")
+			}
+			last := events[len(events)-1]
+			if last.Stage != test.stage || last.ResponseStatus == nil || last.ResponseStatus.Code != int32(test.code) {
+				t.Fatalf("the last event is at the stage %s with the status %+v", last.Stage, last.ResponseStatus)
+			}
+			if last.User.Username != test.user {
+				t.Fatalf("the event is of the user %q, expected %q", last.User.Username, test.user)
+			}
+			impersonatedUser := ""
+			if last.ImpersonatedUser != nil {
+				impersonatedUser = last.ImpersonatedUser.Username
+			}
+			if impersonatedUser != test.impersonatedUser {
+				t.Fatalf("the event impersonates %q, expected %q", impersonatedUser, test.impersonatedUser)
+			}
+		})
+	}
+}
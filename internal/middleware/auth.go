@@ -1,53 +1,57 @@
 package middleware
 
 import (
-	"regexp"
-	"strings"
+	"errors"
 
 	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/authentication"
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
-	opencpspec "github.com/opencontrolplane/opencp-spec/grpc"
-	grpcMetadata "google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"k8s.io/apiserver/pkg/endpoints/request"
 )
 
 func Authenticate(r *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
-	// Check the header User-Agent to see if it's kubectl
-	if !strings.Contains(r.HeaderParameter("User-Agent"), "kubectl") {
-		resp.WriteErrorString(401, "401: Not Authorized or not a valid client")
-		return
-	}
-
-	var apiKey string
-	tokens, ok := r.Request.Header["Authorization"]
-	if ok && len(tokens) >= 1 {
-		re := regexp.MustCompile(`(?i)bearer\s+`)
-		apiKey = re.ReplaceAllString(tokens[0], "")
-	}
-
 	// Init the auth client
 	// get the app from the request attribute
 	app := r.Attribute("app").(*setup.OpenCPApp)
 
-	// Modify the ctx to add the token to check if the token is valid
-	ctx := r.Request.Context()
-	ctx = grpcMetadata.AppendToOutgoingContext(ctx, "authorization", "bearer "+apiKey)
+	// Check the header User-Agent against the allowlist of clients
+	if !app.Authenticator.ClientAllowed(r.HeaderParameter("User-Agent")) {
+		unauthenticated(r, resp, app, 401, "401: Not Authorized or not a valid client")
+		return
+	}
 
-	//Call the auth service to check if the token is valid
-	validToken, err := app.LoginClient.Check(ctx, &opencpspec.LoginRequest{Token: apiKey})
-	if err != nil {
-		s, _ := status.FromError(err)
-		resp.WriteErrorString(500, s.Message())
+	// Ask the authenticators of the chain who the caller is
+	response, authenticated, err := app.Authenticator.AuthenticateRequest(r.Request)
+	var backendErr *authentication.BackendError
+	if errors.As(err, &backendErr) {
+		s, _ := status.FromError(backendErr.Err)
+		unauthenticated(r, resp, app, 500, s.Message())
 		return
 	}
 
-	if !validToken.Valid {
-		resp.WriteErrorString(401, "401: Not Authorized")
+	if !authenticated {
+		unauthenticated(r, resp, app, 401, "401: Not Authorized")
 		return
 	}
 
+	// The identity and the token are of this request only, the backend calls made with its context
+	// send them in their metadata. The token is only sent when the backend issued it, the OIDC
+	// tokens and the client certificates are not the backend's to know
+	ctx := r.Request.Context()
+	if response.Authenticator == authentication.BearerAuthenticator {
+		ctx = authentication.WithToken(ctx, authentication.BearerToken(r.Request))
+	}
+	ctx = authentication.WithAuthenticator(ctx, response.Authenticator)
+	ctx = request.WithUser(ctx, response.User)
+
 	r.Request = r.Request.WithContext(ctx)
-	app.Token = apiKey
-	// r.SetAttribute("app", app)
 	chain.ProcessFilter(r, resp)
 }
+
+// unauthenticated answers a request whose caller is not known, it never reaches the Audit
+// filter so its audit event is recorded here
+func unauthenticated(r *restful.Request, resp *restful.Response, app *setup.OpenCPApp, code int, message string) {
+	auditFailedAuthentication(r, app, code, message)
+	resp.WriteErrorString(code, message)
+}
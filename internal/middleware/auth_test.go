@@ -0,0 +1,284 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/authentication"
+	"github.com/opencontrolplane/opencp-shim/internal/config"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	opencpspec "github.com/opencontrolplane/opencp-spec/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcMetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// fakeLogin knows every token
+type fakeLogin struct{}
+
+func (fakeLogin) Check(ctx context.Context, in *opencpspec.LoginRequest, opts ...grpc.CallOption) (*opencpspec.LoginResponse, error) {
+	// Give the other requests time to run, so the identities would cross if they were shared
+	time.Sleep(time.Millisecond)
+	return &opencpspec.LoginResponse{Valid: true}, nil
+}
+
+// tokenUser is the name the shim gives to the owner of a token
+func tokenUser(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return "opencp:token:" + hex.EncodeToString(hash[:])[:16]
+}
+
+// fakeBackend answers every call with the token, the user and the authenticator in the metadata it received
+func fakeBackend(srv interface{}, stream grpc.ServerStream) error {
+	if err := stream.RecvMsg(&emptypb.Empty{}); err != nil {
+		return err
+	}
+	md, _ := grpcMetadata.FromIncomingContext(stream.Context())
+	values := []string{}
+	for _, key := range []string{"authorization", authentication.UserMetadata, authentication.AuthenticatorMetadata} {
+		values = append(values, strings.Join(md.Get(key), ","))
+	}
+	return stream.SendMsg(wrapperspb.String(strings.Join(values, "|")))
+}
+
+// backendServer serves a route calling the fake backend with the context of the request, behind
+// the Authenticate filter. The server asks the clients for their certificates
+func backendServer(t *testing.T, authenticator *authentication.Authenticator) *httptest.Server {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnknownServiceHandler(fakeBackend))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(authentication.UnaryClientInterceptor()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	app := &setup.OpenCPApp{Authenticator: authenticator}
+	ws := new(restful.WebService).Path("/backend")
+	ws.Route(ws.GET("").To(func(r *restful.Request, w *restful.Response) {
+		reply := &wrapperspb.StringValue{}
+		if err := conn.Invoke(r.Request.Context(), "/opencp.Test/Call", &emptypb.Empty{}, reply); err != nil {
+			w.WriteErrorString(http.StatusInternalServerError, err.Error())
+			return
+		}
+		io.WriteString(w, reply.Value)
+	}))
+	container := restful.NewContainer()
+	container.Add(ws)
+	container.Filter(func(r *restful.Request, w *restful.Response, chain *restful.FilterChain) {
+		r.SetAttribute("app", app)
+		chain.ProcessFilter(r, w)
+	})
+	container.Filter(Authenticate)
+
+	httpServer := httptest.NewUnstartedServer(container)
+	httpServer.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	httpServer.StartTLS()
+	t.Cleanup(httpServer.Close)
+	return httpServer
+}
+
+// callBackend calls the route of the server and returns the answer of the fake backend
+func callBackend(client *http.Client, url, token string) (string, error) {
+	req, _ := http.NewRequest(http.MethodGet, url+"/backend", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("got %d %q", resp.StatusCode, body)
+	}
+	return string(body), nil
+}
+
+func TestConcurrentRequestsSendTheirOwnTokenToTheBackend(t *testing.T) {
+	// Every token is validated by the login service, none is kept between the requests
+	cache := authentication.NewCache(fakeLogin{}, config.TokenCache{TTL: 0, NegativeTTL: 0, Size: 1})
+	authenticator, err := authentication.NewAuthenticator(config.Authentication{Chain: []string{authentication.BearerAuthenticator}}, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpServer := backendServer(t, authenticator)
+	client := httpServer.Client()
+
+	tokens := []string{"token-a", "token-b"}
+	var wg sync.WaitGroup
+	errs := make(chan error, 200)
+	for i := 0; i < 200; i++ {
+		token := tokens[i%len(tokens)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			body, err := callBackend(client, httpServer.URL, token)
+			expected := fmt.Sprintf("bearer %s|%s|bearer", token, tokenUser(token))
+			if err != nil || body != expected {
+				errs <- fmt.Errorf("the request with %s got %q from the backend, expected %q: %v", token, body, expected, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestTheCallersOfOtherAuthenticatorsReachTheBackendWithTheirIdentityOnly(t *testing.T) {
+	dir := t.TempDir()
+
+	// The client certificates are signed by an authority of the test
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	caCert, _ := x509.ParseCertificate(caDER)
+	clientCAFile := filepath.Join(dir, "client-ca.crt")
+	if err := os.WriteFile(clientCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	clientDER, _ := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "alice", Organization: []string{"developers"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, &clientKey.PublicKey, caKey)
+	clientCert := tls.Certificate{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}
+
+	// The OIDC tokens are signed by an issuer of the test
+	signingKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	issuer := httptest.NewUnstartedServer(nil)
+	issuer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": issuer.URL, "jwks_uri": issuer.URL + "/keys"})
+		case "/keys":
+			json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: &signingKey.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"}}})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	issuer.StartTLS()
+	defer issuer.Close()
+	issuerCAFile := filepath.Join(dir, "issuer-ca.crt")
+	if err := os.WriteFile(issuerCAFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issuer.Certificate().Raw}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: signingKey}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": issuer.URL,
+		"aud": "opencp",
+		"sub": "bob",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	})
+	signed, err := signer.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idToken, _ := signed.CompactSerialize()
+
+	cache := authentication.NewCache(fakeLogin{}, config.TokenCache{TTL: 0, NegativeTTL: 0, Size: 1})
+	authenticator, err := authentication.NewAuthenticator(config.Authentication{
+		Chain: []string{authentication.X509Authenticator, authentication.OIDCAuthenticator, authentication.BearerAuthenticator},
+		X509:  config.X509{ClientCAFile: clientCAFile},
+		OIDC:  config.OIDC{IssuerURL: issuer.URL, ClientID: "opencp", CAFile: issuerCAFile, UsernameClaim: "sub", UsernamePrefix: "oidc:"},
+	}, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys of the issuer are read in the background, wait for the OIDC tokens to be known
+	oidcReq := httptest.NewRequest(http.MethodGet, "/", nil)
+	oidcReq.Header.Set("Authorization", "Bearer "+idToken)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if response, ok, _ := authenticator.AuthenticateRequest(oidcReq); ok && response.Authenticator == authentication.OIDCAuthenticator {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the OIDC authenticator never knew the token")
+		}
+	}
+
+	httpServer := backendServer(t, authenticator)
+	// The client of the server is shared, the one with the certificate is a copy
+	certificateTransport := httpServer.Client().Transport.(*http.Transport).Clone()
+	certificateTransport.TLSClientConfig.Certificates = []tls.Certificate{clientCert}
+	certificateClient := &http.Client{Transport: certificateTransport}
+
+	tests := []struct {
+		name     string
+		client   *http.Client
+		token    string
+		expected string
+	}{
+		{name: "x509", client: certificateClient, expected: "|alice|x509"},
+		{name: "oidc", client: httpServer.Client(), token: idToken, expected: "|oidc:bob|oidc"},
+		{name: "bearer", client: httpServer.Client(), token: "token-c", expected: "bearer token-c|" + tokenUser("token-c") + "|bearer"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body, err := callBackend(test.client, httpServer.URL, test.token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body != test.expected {
+				t.Fatalf("the backend got %q, expected %q", body, test.expected)
+			}
+		})
+	}
+}
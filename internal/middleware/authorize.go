@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/authorization"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+// Authorize lets the request through when the authorizer allows its verb on its resource,
+// or on its path for the non resource requests, otherwise it is answered with a 403
+func Authorize(r *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	attributes, err := requestAttributes(r.Request)
+	if err != nil {
+		pkg.WriteStatus(resp, pkg.RespondStatus(apierrors.NewBadRequest(err.Error())))
+		return
+	}
+
+	decision, reason, err := app.Authorizer.Authorize(r.Request.Context(), attributes)
+	if decision == authorizer.DecisionAllow {
+		chain.ProcessFilter(r, resp)
+		return
+	}
+	if err != nil {
+		log.Println(err)
+	}
+
+	pkg.WriteStatus(resp, pkg.RespondStatus(forbidden(attributes, reason)))
+}
+
+// requestAttributes returns the user, verb and resource or path of a request, from its RequestInfo
+func requestAttributes(req *http.Request) (authorizer.AttributesRecord, error) {
+	requestInfo, err := pkg.RequestInfoResolver().NewRequestInfo(req)
+	if err != nil {
+		return authorizer.AttributesRecord{}, err
+	}
+
+	return authorizer.AttributesRecord{
+		User:            authorization.User(req.Context()),
+		Verb:            requestInfo.Verb,
+		Namespace:       requestInfo.Namespace,
+		APIGroup:        requestInfo.APIGroup,
+		APIVersion:      requestInfo.APIVersion,
+		Resource:        requestInfo.Resource,
+		Subresource:     requestInfo.Subresource,
+		Name:            requestInfo.Name,
+		ResourceRequest: requestInfo.IsResourceRequest,
+		Path:            requestInfo.Path,
+	}, nil
+}
+
+// forbidden is the error of a denied request, with the message of the kube-apiserver
+func forbidden(a authorizer.AttributesRecord, reason string) error {
+	name := a.User.GetName()
+	var message string
+	switch {
+	case !a.ResourceRequest:
+		message = fmt.Sprintf("User %q cannot %s path %q", name, a.Verb, a.Path)
+	case a.Namespace != "":
+		message = fmt.Sprintf("User %q cannot %s resource %q in API group %q in the namespace %q", name, a.Verb, resourceWithSubresource(a), a.APIGroup, a.Namespace)
+	default:
+		message = fmt.Sprintf("User %q cannot %s resource %q in API group %q at the cluster scope", name, a.Verb, resourceWithSubresource(a), a.APIGroup)
+	}
+	if reason != "" {
+		message += ": " + reason
+	}
+
+	if !a.ResourceRequest {
+		return apierrors.NewForbidden(schema.GroupResource{}, "", errors.New(message))
+	}
+	return apierrors.NewForbidden(schema.GroupResource{Group: a.APIGroup, Resource: a.Resource}, a.Name, errors.New(message))
+}
+
+func resourceWithSubresource(a authorizer.AttributesRecord) string {
+	if a.Subresource != "" {
+		return a.Resource + "/" + a.Subresource
+	}
+	return a.Resource
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"strconv"
+
+	restful "github.com/emicklei/go-restful/v3"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// retryAfterSeconds is how long the clients wait before sending a rejected request again
+const retryAfterSeconds = 1
+
+// FlowControl classifies the request by the flow schemas and waits for a seat in its priority level,
+// the request is answered with a 429 when the level is saturated. The watches are classified but
+// not limited, they last as long as the clients keep them
+func FlowControl(r *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	attributes, err := requestAttributes(r.Request)
+	if err != nil {
+		chain.ProcessFilter(r, resp)
+		return
+	}
+
+	request := app.FlowControl.Classify(attributes)
+	resp.Header().Set(flowcontrolv1beta3.ResponseHeaderMatchedFlowSchemaUID, string(request.FlowSchema.UID))
+	resp.Header().Set(flowcontrolv1beta3.ResponseHeaderMatchedPriorityLevelConfigurationUID, string(request.PriorityLevel.UID))
+	if attributes.Verb == "watch" {
+		chain.ProcessFilter(r, resp)
+		return
+	}
+
+	release, err := app.FlowControl.Wait(r.Request.Context(), request)
+	if err != nil {
+		resp.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+		pkg.WriteStatus(resp, pkg.RespondStatus(apierrors.NewTooManyRequests("Too many requests, please try again later.", retryAfterSeconds)))
+		return
+	}
+	defer release()
+
+	chain.ProcessFilter(r, resp)
+}
@@ -0,0 +1,123 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/authentication"
+	"github.com/opencontrolplane/opencp-shim/internal/authorization"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// Impersonate lets the callers allowed to impersonate act as another user with the
+// Impersonate headers, like the kube-apiserver. The identity of the request becomes the
+// impersonated one and the caller is kept as the impersonator, for the logs and the audit.
+// The backend can not act as another user, so only the requests the shim serves on its own,
+// like the RBAC or the reviews, are served, the backend calls are refused with a 403
+func Impersonate(r *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	impersonatedUser := r.Request.Header.Get(authenticationv1.ImpersonateUserHeader)
+	impersonatedGroups := r.Request.Header.Values(authenticationv1.ImpersonateGroupHeader)
+	impersonatedUID := r.Request.Header.Get(authenticationv1.ImpersonateUIDHeader)
+	impersonatedExtra := map[string][]string{}
+	for header, values := range r.Request.Header {
+		if strings.HasPrefix(header, authenticationv1.ImpersonateUserExtraHeaderPrefix) {
+			key := strings.ToLower(strings.TrimPrefix(header, authenticationv1.ImpersonateUserExtraHeaderPrefix))
+			impersonatedExtra[key] = values
+		}
+	}
+
+	if impersonatedUser == "" {
+		if len(impersonatedGroups) > 0 || impersonatedUID != "" || len(impersonatedExtra) > 0 {
+			pkg.WriteStatus(resp, pkg.RespondStatus(apierrors.NewBadRequest("requested impersonation of groups, uid or extras without impersonating a user")))
+			return
+		}
+		chain.ProcessFilter(r, resp)
+		return
+	}
+
+	ctx := r.Request.Context()
+	requestUser, ok := request.UserFrom(ctx)
+	if !ok {
+		pkg.WriteStatus(resp, pkg.RespondStatus(apierrors.NewUnauthorized("the identity of the caller is not known")))
+		return
+	}
+
+	// Every part of the impersonated identity must be allowed
+	checks := []authorizer.AttributesRecord{{APIGroup: "", Resource: "users", Name: impersonatedUser}}
+	for _, group := range impersonatedGroups {
+		checks = append(checks, authorizer.AttributesRecord{APIGroup: "", Resource: "groups", Name: group})
+	}
+	if impersonatedUID != "" {
+		checks = append(checks, authorizer.AttributesRecord{APIGroup: authenticationv1.GroupName, Resource: "uids", Name: impersonatedUID})
+	}
+	for key, values := range impersonatedExtra {
+		for _, value := range values {
+			checks = append(checks, authorizer.AttributesRecord{APIGroup: authenticationv1.GroupName, Resource: "userextras", Subresource: key, Name: value})
+		}
+	}
+	for _, check := range checks {
+		check.User = requestUser
+		check.Verb = authorization.ImpersonateVerb
+		check.ResourceRequest = true
+		decision, reason, err := app.Authorizer.Authorize(ctx, check)
+		if decision != authorizer.DecisionAllow {
+			message := fmt.Sprintf("User %q cannot impersonate resource %q in API group %q at the cluster scope", requestUser.GetName(), check.Resource, check.APIGroup)
+			if err != nil {
+				reason = err.Error()
+			}
+			if reason != "" {
+				message += ": " + reason
+			}
+			forbidden := apierrors.NewForbidden(schema.GroupResource{Group: check.APIGroup, Resource: check.Resource}, check.Name, errors.New(message))
+			pkg.WriteStatus(resp, pkg.RespondStatus(forbidden))
+			return
+		}
+	}
+
+	impersonated := &user.DefaultInfo{
+		Name:   impersonatedUser,
+		UID:    impersonatedUID,
+		Groups: impersonatedGroups,
+		Extra:  impersonatedExtra,
+	}
+	if len(impersonated.Extra) == 0 {
+		impersonated.Extra = nil
+	}
+	// The impersonated users are authenticated, unless the anonymous one is asked for
+	if impersonatedUser != user.Anonymous {
+		impersonated.Groups = appendMissing(impersonated.Groups, user.AllAuthenticated)
+	}
+
+	ctx = authentication.WithImpersonator(ctx, requestUser)
+	ctx = request.WithUser(ctx, impersonated)
+	r.Request = r.Request.WithContext(ctx)
+
+	// The headers are not sent further, like in the kube-apiserver
+	for header := range r.Request.Header {
+		if strings.HasPrefix(header, "Impersonate-") {
+			r.Request.Header.Del(header)
+		}
+	}
+	chain.ProcessFilter(r, resp)
+}
+
+func appendMissing(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
@@ -6,38 +6,37 @@ import (
 	"time"
 
 	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/authentication"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/apiserver/pkg/endpoints/request"
 )
 
-type responseRecorder struct {
-	http.ResponseWriter
-	Status int
-	Length int
-}
-
 func Logging(r *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
 	start := time.Now()
-	recorder := &responseRecorder{
-		ResponseWriter: resp,
-		Length:         0,
-	}
 
 	fields := log.Fields{
 		"remote_address": requestGetRemoteAddress(r.Request),
 		"user_agent":     r.Request.UserAgent(),
 		"request_id":     r.Request.Header.Get("X-Request-Id"),
 	}
+	if requestUser, ok := request.UserFrom(r.Request.Context()); ok {
+		fields["user"] = requestUser.GetName()
+	}
+	if impersonator, ok := authentication.ImpersonatorFrom(r.Request.Context()); ok {
+		fields["impersonated_by"] = impersonator.GetName()
+	}
 
 	log.WithFields(fields).Infof("Request received for %s %s", r.Request.Method, r.Request.RequestURI)
 
+	// The request is completed once the next filters and the handler wrote the response
+	chain.ProcessFilter(r, resp)
+
 	fields = log.Fields{
-		"status":     recorder.Status,
-		"size":       recorder.Length,
+		"status":     resp.StatusCode(),
+		"size":       resp.ContentLength(),
 		"time_taken": time.Since(start),
 	}
-
 	log.WithFields(fields).Infof("Request completed for %s %s", r.Request.Method, r.Request.RequestURI)
-	chain.ProcessFilter(r, resp)
 }
 
 // RequestGetRemoteAddress returns ip address of the client making the request,
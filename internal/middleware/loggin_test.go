@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	restful "github.com/emicklei/go-restful/v3"
+	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestLoggingRecordsTheResponseOfTheHandler(t *testing.T) {
+	hook := test.NewGlobal()
+	defer hook.Reset()
+
+	ws := new(restful.WebService).Path("/missing")
+	ws.Route(ws.GET("").To(func(r *restful.Request, w *restful.Response) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, "not found")
+	}))
+	container := restful.NewContainer()
+	container.Add(ws)
+	container.Filter(Logging)
+
+	container.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	entries := hook.AllEntries()
+	if len(entries) != 2 {
+		t.Fatalf("got %d log lines, expected the received and completed ones", len(entries))
+	}
+	completed := entries[1]
+	if completed.Level != log.InfoLevel || completed.Data["status"] != http.StatusNotFound || completed.Data["size"] != len("not found") {
+		t.Fatalf("the completed line has the fields %v", completed.Data)
+	}
+}
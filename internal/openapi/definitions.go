@@ -0,0 +1,320 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/go-openapi/spec"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	extensionGroupVersionKind = "x-kubernetes-group-version-kind"
+	extensionListType         = "x-kubernetes-list-type"
+	extensionListMapKeys      = "x-kubernetes-list-map-keys"
+	extensionMapType          = "x-kubernetes-map-type"
+	definitionRef             = "#/definitions/"
+)
+
+// definitionDocs are the descriptions of the opencp.io v1alpha1 types, taken from the
+// comments of the opencp-spec types as they have no SwaggerDoc. The empty key is the
+// description of the type, the others of the fields, by their json name
+var definitionDocs = map[string]map[string]string{
+	"v1alpha1.VirtualMachine": {
+		"":         "VirtualMachine is a virtual machine running in the cloud provider",
+		"metadata": "Standard object's metadata.",
+		"spec":     "Spec defines the desired state of the VirtualMachine.",
+		"status":   "Status is the observed state of the VirtualMachine, set by the cloud provider.",
+	},
+	"v1alpha1.VirtualMachineSpec": {
+		"":           "VirtualMachineSpec defines the desired state of VirtualMachine",
+		"size":       "Size of the virtual machine, one of the sizes offered by the cloud provider.",
+		"image":      "Image the virtual machine boots from.",
+		"firewall":   "Firewall applied to the virtual machine.",
+		"userScript": "UserScript is run on the first boot of the virtual machine.",
+		"ipv4":       "Ipv4 tells if the virtual machine gets a public IPv4 address.",
+		"tags":       "Tags of the virtual machine.",
+	},
+	"v1alpha1.VirtualMachineStatus": {
+		"":          "VirtualMachineStatus defines the observed state of VirtualMachine",
+		"state":     "State of the virtual machine in the cloud provider.",
+		"publicIP":  "PublicIP is the public address of the virtual machine.",
+		"privateIP": "PrivateIP is the address of the virtual machine in its network.",
+	},
+	"v1alpha1.VirtualMachineList": {
+		"":         "VirtualMachineList contains a list of VirtualMachine",
+		"metadata": "Standard list metadata.",
+		"items":    "Items is the list of VirtualMachine.",
+	},
+	"v1alpha1.KubernetesCluster": {
+		"":         "KubernetesCluster is a Kubernetes cluster managed by the cloud provider",
+		"metadata": "Standard object's metadata.",
+		"spec":     "Spec defines the desired state of the KubernetesCluster.",
+		"status":   "Status is the observed state of the KubernetesCluster, set by the cloud provider.",
+	},
+	"v1alpha1.KubernetesClusterSpec": {
+		"":           "KubernetesClusterSpec defines the desired state of KubernetesCluster",
+		"version":    "Version of Kubernetes the cluster runs.",
+		"pools":      "Pools are the node pools of the cluster.",
+		"firewall":   "Firewall applied to the nodes of the cluster.",
+		"kubeconfig": "Kubeconfig to access the cluster, set once the cluster is ready.",
+		"tags":       "Tags of the cluster.",
+	},
+	"v1alpha1.KubernetesClusterStatus": {
+		"":         "KubernetesClusterStatus defines the observed state of KubernetesCluster",
+		"state":    "State of the cluster in the cloud provider.",
+		"publicIP": "PublicIP is the address of the API server of the cluster.",
+	},
+	"v1alpha1.KuberenetesClusterList": {
+		"":         "KubernetesClusterList contains a list of KubernetesCluster",
+		"metadata": "Standard list metadata.",
+		"items":    "Items is the list of KubernetesCluster.",
+	},
+	"v1alpha1.Firewall": {
+		"":         "Firewall is a set of rules filtering the traffic to the resources of the cloud provider",
+		"metadata": "Standard object's metadata.",
+		"spec":     "Spec defines the desired state of the Firewall.",
+		"status":   "Status is the observed state of the Firewall, set by the cloud provider.",
+	},
+	"v1alpha1.FirewallSpec": {
+		"":        "FirewallSpec defines the desired state of Firewall",
+		"network": "Network the firewall belongs to.",
+		"rules":   "Rules of the firewall.",
+	},
+	"v1alpha1.FirewallStatus": {
+		"":           "FirewallStatus defines the observed state of Firewall",
+		"state":      "State of the firewall in the cloud provider.",
+		"totalRules": "TotalRules is the number of rules of the firewall.",
+	},
+	"v1alpha1.FirewallList": {
+		"":         "FirewallList contains a list of Firewall",
+		"metadata": "Standard list metadata.",
+		"items":    "Items is the list of Firewall.",
+	},
+	"v1alpha1.Domain": {
+		"":         "Domain is a DNS domain hosted by the cloud provider",
+		"metadata": "Standard object's metadata.",
+		"spec":     "Spec defines the desired state of the Domain.",
+		"status":   "Status is the observed state of the Domain, set by the cloud provider.",
+	},
+	"v1alpha1.DomainSpec": {
+		"":        "DomainSpec defines the desired state of Domain",
+		"records": "Records of the domain.",
+	},
+	"v1alpha1.DomainStatus": {
+		"":      "DomainStatus defines the observed state of Domain",
+		"state": "State of the domain in the cloud provider.",
+	},
+	"v1alpha1.DomainList": {
+		"":         "DomainList contains a list of Domain",
+		"metadata": "Standard list metadata.",
+		"items":    "Items is the list of Domain.",
+	},
+	"v1alpha1.SSHKey": {
+		"":         "SSHKey is a public SSH key added to the virtual machines",
+		"metadata": "Standard object's metadata.",
+		"spec":     "Spec defines the desired state of the SSHKey.",
+		"status":   "Status is the observed state of the SSHKey, set by the cloud provider.",
+	},
+	"v1alpha1.SSHKeySpec": {
+		"":          "SSHKeySpec defines the desired state of SSHKey",
+		"publicKey": "PublicKey is the public part of the SSH key, in the authorized_keys format.",
+	},
+	"v1alpha1.SSHKeyStatus": {
+		"":      "SSHKeyStatus defines the observed state of SSHKey",
+		"state": "State of the SSH key in the cloud provider.",
+	},
+	"v1alpha1.SSHKeyList": {
+		"":         "SSHKeyList contains a list of SSHKey",
+		"metadata": "Standard list metadata.",
+		"items":    "Items is the list of SSHKey.",
+	},
+	"v1alpha1.IP": {
+		"":         "IP is a reserved public IP address",
+		"metadata": "Standard object's metadata.",
+		"spec":     "Spec defines the desired state of the IP.",
+		"status":   "Status is the observed state of the IP, set by the cloud provider.",
+	},
+	"v1alpha1.IPSpec": {
+		"":       "IPSpec defines the desired state of IP",
+		"region": "Region the IP is reserved in.",
+	},
+	"v1alpha1.IPStatus": {
+		"":           "IPStatus defines the observed state of IP",
+		"ip":         "IP is the reserved address.",
+		"assignedTo": "AssignedTo is the resource the IP is assigned to, if any.",
+		"state":      "State of the IP in the cloud provider.",
+	},
+	"v1alpha1.IPList": {
+		"":         "IPList contains a list of IP",
+		"metadata": "Standard list metadata.",
+		"items":    "Items is the list of IP.",
+	},
+	"v1alpha1.Database": {
+		"":         "Database is a database cluster managed by the cloud provider",
+		"metadata": "Standard object's metadata.",
+		"spec":     "Spec defines the desired state of the Database.",
+		"status":   "Status is the observed state of the Database, set by the cloud provider.",
+	},
+	"v1alpha1.DatabaseSpec": {
+		"":              "DatabaseSpec defines the desired state of Database",
+		"nodes":         "Nodes is the number of nodes of the database cluster.",
+		"size":          "Size of the nodes, one of the sizes offered by the cloud provider.",
+		"engine":        "Engine of the database, like mysql or postgresql.",
+		"engineVersion": "EngineVersion is the version of the engine.",
+		"firewall":      "Firewall applied to the database.",
+	},
+	"v1alpha1.DatabaseStatus": {
+		"":      "DatabaseStatus defines the observed state of Database",
+		"state": "State of the database in the cloud provider.",
+	},
+	"v1alpha1.DatabaseList": {
+		"":         "DatabaseList contains a list of Database",
+		"metadata": "Standard list metadata.",
+		"items":    "Items is the list of Database.",
+	},
+	"v1alpha1.ObjectStorage": {
+		"":         "ObjectStorage is an object storage bucket",
+		"metadata": "Standard object's metadata.",
+		"spec":     "Spec defines the desired state of the ObjectStorage.",
+		"status":   "Status is the observed state of the ObjectStorage, set by the cloud provider.",
+	},
+	"v1alpha1.ObjectStorageSpec": {
+		"":     "ObjectStorageSpec defines the desired state of ObjectStorage",
+		"size": "Size of the bucket in gigabytes.",
+	},
+	"v1alpha1.ObjectStorageStatus": {
+		"":      "ObjectStorageStatus defines the observed state of ObjectStorage",
+		"state": "State of the bucket in the cloud provider.",
+	},
+	"v1alpha1.ObjectStorageList": {
+		"":         "ObjectStorageList contains a list of ObjectStorage",
+		"metadata": "Standard list metadata.",
+		"items":    "Items is the list of ObjectStorage.",
+	},
+	"v1alpha1.ObjectStorageCredential": {
+		"":         "ObjectStorageCredential is a key pair giving access to the object storage",
+		"metadata": "Standard object's metadata.",
+		"spec":     "Spec defines the desired state of the ObjectStorageCredential.",
+		"status":   "Status is the observed state of the ObjectStorageCredential, set by the cloud provider.",
+	},
+	"v1alpha1.ObjectStorageCredentialSpec": {
+		"":          "ObjectStorageCredentialSpec defines the desired state of ObjectStorageCredential",
+		"accessKey": "AccessKey of the credential.",
+		"secretKey": "SecretKey of the credential.",
+	},
+	"v1alpha1.ObjectStorageCredentialStatus": {
+		"":      "ObjectStorageCredentialStatus defines the observed state of ObjectStorageCredential",
+		"state": "State of the credential in the cloud provider.",
+	},
+	"v1alpha1.ObjectStorageCredentialList": {
+		"":         "ObjectStorageCredentialList contains a list of ObjectStorageCredential",
+		"metadata": "Standard list metadata.",
+		"items":    "Items is the list of ObjectStorageCredential.",
+	},
+}
+
+// listTypes are the list-type of the lists which are not atomic, the default of the lists,
+// and the keys of the lists of type map
+var listTypes = map[string]map[string][]string{
+	"v1.ObjectMeta": {
+		"finalizers":      {"set"},
+		"ownerReferences": {"map", "uid"},
+	},
+	"v1alpha1.VirtualMachineSpec":    {"tags": {"set"}},
+	"v1alpha1.KubernetesClusterSpec": {"tags": {"set"}},
+}
+
+// setDefinitionDocs adds the descriptions of the opencp.io types to their definitions,
+// the Kubernetes types already have theirs from their SwaggerDoc
+func setDefinitionDocs(definitions spec.Definitions) {
+	for name, docs := range definitionDocs {
+		definition, ok := definitions[name]
+		if !ok {
+			continue
+		}
+
+		if doc, ok := docs[""]; ok && definition.Description == "" {
+			definition.Description = doc
+		}
+		for field, property := range definition.Properties {
+			if doc, ok := docs[field]; ok && property.Description == "" {
+				property.Description = doc
+				definition.Properties[field] = property
+			}
+		}
+		definitions[name] = definition
+	}
+}
+
+// setDefinitionMarkers adds the list-type and map-type markers used by server side apply
+// and kubectl to merge the lists and maps of the objects
+func setDefinitionMarkers(definitions spec.Definitions) {
+	for name, definition := range definitions {
+		for field, property := range definition.Properties {
+			switch {
+			case property.Type.Contains("array"):
+				listType := []string{"atomic"}
+				if override, ok := listTypes[name][field]; ok {
+					listType = override
+				}
+				property.AddExtension(extensionListType, listType[0])
+				if len(listType) > 1 {
+					property.AddExtension(extensionListMapKeys, listType[1:])
+				}
+			case property.Type.Contains("object") && property.AdditionalProperties != nil:
+				property.AddExtension(extensionMapType, "granular")
+			default:
+				continue
+			}
+			definition.Properties[field] = property
+		}
+		definitions[name] = definition
+	}
+}
+
+// setDefinitionGroupVersionKinds adds the x-kubernetes-group-version-kind of the operations
+// to the definitions they respond with, this is how kubectl explain finds the schema of a
+// kind. The operations on a collection carry the kind of the items, so the definitions
+// with items get the kind of the list
+func setDefinitionGroupVersionKinds(swo *spec.Swagger) {
+	if swo.Paths == nil {
+		return
+	}
+
+	for _, pathItem := range swo.Paths.Paths {
+		for _, operation := range []*spec.Operation{pathItem.Get, pathItem.Put, pathItem.Post, pathItem.Delete, pathItem.Patch} {
+			if operation == nil || operation.Responses == nil {
+				continue
+			}
+			gvk, ok := operation.Extensions[extensionGroupVersionKind].(metav1.GroupVersionKind)
+			if !ok {
+				continue
+			}
+
+			for _, response := range operation.Responses.StatusCodeResponses {
+				if response.Schema == nil {
+					continue
+				}
+				name := strings.TrimPrefix(response.Schema.Ref.String(), definitionRef)
+				definition, ok := swo.Definitions[name]
+				if !ok {
+					continue
+				}
+
+				kind := gvk.Kind
+				if !strings.HasSuffix(name, "."+kind) {
+					if _, ok := definition.Properties["items"]; !ok {
+						continue
+					}
+					kind += "List"
+				}
+				definition.AddExtension(extensionGroupVersionKind, []metav1.GroupVersionKind{{
+					Group:   gvk.Group,
+					Version: gvk.Version,
+					Kind:    kind,
+				}})
+				swo.Definitions[name] = definition
+			}
+		}
+	}
+}
@@ -195,4 +195,8 @@ func SwaggerObject(swo *spec.Swagger) {
 		Name:        "opencp",
 		Description: "Managing resources for OpenCP"}}}
 	swo.Swagger = "2.0"
+
+	setDefinitionGroupVersionKinds(swo)
+	setDefinitionDocs(swo.Definitions)
+	setDefinitionMarkers(swo.Definitions)
 }
@@ -0,0 +1,345 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/go-openapi/spec"
+	openapi_v3 "github.com/google/gnostic/openapiv3"
+	"github.com/munnerz/goautoneg"
+	"github.com/opencontrolplane/opencp-shim/internal/handler"
+	"google.golang.org/protobuf/proto"
+	"k8s.io/kube-openapi/pkg/openapiconv"
+	kubespec "k8s.io/kube-openapi/pkg/validation/spec"
+)
+
+const (
+	openAPIV3Path      = "/openapi/v3"
+	subTypeV3Protobuf  = "com.github.proto-openapi.spec.v3@v1.0+protobuf"
+	openAPIV3SchemaRef = "#/components/schemas/"
+)
+
+// OpenAPIV3Service serves the OpenAPI v3 spec: an index of the group versions and a
+// document for each of them, converted from the OpenAPI v2 spec of the routes
+type OpenAPIV3Service struct {
+	// rwMutex protects All members of this service.
+	rwMutex       sync.RWMutex
+	lastModified  time.Time
+	groupVersions map[string]*openAPIV3GroupVersion
+}
+
+// openAPIV3GroupVersion are the caches of the document of a group version
+type openAPIV3GroupVersion struct {
+	jsonCache  handler.HandlerCache
+	protoCache handler.HandlerCache
+	etagCache  handler.HandlerCache
+}
+
+// openAPIV3Discovery is the index of the group versions, with the url of their documents
+type openAPIV3Discovery struct {
+	Paths map[string]openAPIV3DiscoveryGroupVersion `json:"paths"`
+}
+
+type openAPIV3DiscoveryGroupVersion struct {
+	// ServerRelativeURL has the hash of the document, so clients can cache it until it changes
+	ServerRelativeURL string `json:"serverRelativeURL"`
+}
+
+// NewOpenAPIV3Service returns a new WebService that serves the OpenAPI v3 documents of all services
+func NewOpenAPIV3Service(config restfulspec.Config) *restful.WebService {
+	ws := new(restful.WebService)
+	ws.Path(openAPIV3Path)
+	ws.Produces(restful.MIME_JSON, "application/"+subTypeV3Protobuf)
+
+	resource := &OpenAPIV3Service{}
+
+	swagger := restfulspec.BuildSwagger(config)
+	err := resource.UpdateSpec(swagger)
+	if err != nil {
+		panic(err)
+	}
+
+	ws.Route(ws.GET("").Filter(EncodingFilter).To(resource.getIndex))
+	ws.Route(ws.GET("/{groupversion:*}").Filter(EncodingFilter).To(resource.getGroupVersion))
+	return ws
+}
+
+// UpdateSpec splits the OpenAPI v2 spec in a OpenAPI v3 document per group version
+func (o *OpenAPIV3Service) UpdateSpec(openapiSpec *spec.Swagger) (err error) {
+	documents, err := groupVersionDocuments(openapiSpec)
+	if err != nil {
+		return err
+	}
+
+	o.rwMutex.Lock()
+	defer o.rwMutex.Unlock()
+
+	groupVersions := map[string]*openAPIV3GroupVersion{}
+	for groupVersion, document := range documents {
+		document := document
+		group := &openAPIV3GroupVersion{}
+		if previous, ok := o.groupVersions[groupVersion]; ok {
+			group = previous
+		}
+
+		group.jsonCache = group.jsonCache.New(func() ([]byte, error) {
+			return json.Marshal(document)
+		})
+		group.protoCache = group.protoCache.New(func() ([]byte, error) {
+			json, err := group.jsonCache.Get()
+			if err != nil {
+				return nil, err
+			}
+			return toV3ProtoBinary(json)
+		})
+		group.etagCache = group.etagCache.New(func() ([]byte, error) {
+			json, err := group.jsonCache.Get()
+			if err != nil {
+				return nil, err
+			}
+			return []byte(computeETag(json)), nil
+		})
+		groupVersions[groupVersion] = group
+	}
+	o.groupVersions = groupVersions
+	o.lastModified = time.Now()
+
+	return nil
+}
+
+// groupVersionDocuments converts the OpenAPI v2 spec to v3 and splits its paths by group version,
+// each document only has the schemas its paths use
+func groupVersionDocuments(openapiSpec *spec.Swagger) (map[string]map[string]interface{}, error) {
+	// The conversion works on the kube-openapi types, they share the json format of go-openapi
+	v2JSON, err := json.Marshal(openapiSpec)
+	if err != nil {
+		return nil, err
+	}
+	v2Spec := &kubespec.Swagger{}
+	if err := json.Unmarshal(v2JSON, v2Spec); err != nil {
+		return nil, err
+	}
+
+	v3JSON, err := json.Marshal(openapiconv.ConvertV2ToV3(v2Spec))
+	if err != nil {
+		return nil, err
+	}
+	v3Spec := map[string]interface{}{}
+	if err := json.Unmarshal(v3JSON, &v3Spec); err != nil {
+		return nil, err
+	}
+
+	paths, _ := v3Spec["paths"].(map[string]interface{})
+	components, _ := v3Spec["components"].(map[string]interface{})
+	schemas, _ := components["schemas"].(map[string]interface{})
+
+	documents := map[string]map[string]interface{}{}
+	for pathName, pathItem := range paths {
+		groupVersion := groupVersionPath(pathName)
+		document, ok := documents[groupVersion]
+		if !ok {
+			document = map[string]interface{}{
+				"openapi": v3Spec["openapi"],
+				"info":    v3Spec["info"],
+				"paths":   map[string]interface{}{},
+			}
+			documents[groupVersion] = document
+		}
+		document["paths"].(map[string]interface{})[pathName] = pathItem
+	}
+
+	for _, document := range documents {
+		documentSchemas := map[string]interface{}{}
+		for _, name := range referencedSchemas(document["paths"], schemas) {
+			documentSchemas[name] = schemas[name]
+		}
+		document["components"] = map[string]interface{}{"schemas": documentSchemas}
+	}
+
+	return documents, nil
+}
+
+// groupVersionPath returns the group version a path belongs to, like api/v1 or apis/opencp.io/v1alpha1,
+// the paths outside of a group version are grouped by their first segment
+func groupVersionPath(pathName string) string {
+	segments := strings.Split(strings.Trim(pathName, "/"), "/")
+	switch {
+	case segments[0] == "api" && len(segments) >= 2:
+		return path.Join(segments[:2]...)
+	case segments[0] == "apis" && len(segments) >= 3:
+		return path.Join(segments[:3]...)
+	}
+	return segments[0]
+}
+
+// referencedSchemas returns the names of the schemas referenced from a value, and from those schemas
+func referencedSchemas(value interface{}, schemas map[string]interface{}) []string {
+	found := map[string]bool{}
+	pending := []interface{}{value}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		for _, ref := range schemaRefs(current) {
+			name := strings.TrimPrefix(ref, openAPIV3SchemaRef)
+			if found[name] {
+				continue
+			}
+			if schema, ok := schemas[name]; ok {
+				found[name] = true
+				pending = append(pending, schema)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// schemaRefs returns every $ref to a schema in a value
+func schemaRefs(value interface{}) []string {
+	refs := []string{}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if ref, ok := item.(string); ok && key == "$ref" && strings.HasPrefix(ref, openAPIV3SchemaRef) {
+				refs = append(refs, ref)
+				continue
+			}
+			refs = append(refs, schemaRefs(item)...)
+		}
+	case []interface{}:
+		for _, item := range value {
+			refs = append(refs, schemaRefs(item)...)
+		}
+	}
+	return refs
+}
+
+func toV3ProtoBinary(json []byte) ([]byte, error) {
+	document, err := openapi_v3.ParseDocument(json)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(document)
+}
+
+func constructServerRelativeURL(groupVersion, etag string) string {
+	u := url.URL{Path: path.Join(openAPIV3Path, groupVersion)}
+	query := url.Values{}
+	query.Set("hash", etag)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (o *OpenAPIV3Service) getIndex(req *restful.Request, resp *restful.Response) {
+	o.rwMutex.RLock()
+	defer o.rwMutex.RUnlock()
+
+	discovery := openAPIV3Discovery{Paths: map[string]openAPIV3DiscoveryGroupVersion{}}
+	for groupVersion, group := range o.groupVersions {
+		etag, err := group.etagCache.Get()
+		if err != nil {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		discovery.Paths[groupVersion] = openAPIV3DiscoveryGroupVersion{
+			ServerRelativeURL: constructServerRelativeURL(groupVersion, string(etag)),
+		}
+	}
+
+	data, err := json.Marshal(discovery)
+	if err != nil {
+		resp.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	resp.Header().Set("Content-Type", restful.MIME_JSON)
+	http.ServeContent(resp, req.Request, openAPIV3Path, o.lastModified, bytes.NewReader(data))
+}
+
+func (o *OpenAPIV3Service) getGroupVersion(req *restful.Request, resp *restful.Response) {
+	groupVersion := strings.Trim(req.PathParameter("groupversion"), "/")
+
+	o.rwMutex.RLock()
+	group, ok := o.groupVersions[groupVersion]
+	lastModified := o.lastModified
+	o.rwMutex.RUnlock()
+	if !ok {
+		resp.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	accepted := []struct {
+		Type    string
+		SubType string
+		Cache   *handler.HandlerCache
+	}{
+		{"application", "json", &group.jsonCache},
+		{"application", subTypeV3Protobuf, &group.protoCache},
+	}
+
+	decipherableFormats := req.Request.Header.Get("Accept")
+	if decipherableFormats == "" {
+		decipherableFormats = "*/*"
+	}
+
+	clauses := goautoneg.ParseAccept(decipherableFormats)
+	resp.Header().Add("Vary", "Accept")
+	for _, clause := range clauses {
+		for _, accepts := range accepted {
+			if clause.Type != accepts.Type && clause.Type != "*" {
+				continue
+			}
+			if clause.SubType != accepts.SubType && clause.SubType != "*" {
+				continue
+			}
+
+			data, err := accepts.Cache.Get()
+			if err != nil {
+				log.Printf("Error in OpenAPI v3 handler: %s", err)
+				// only return a 503 if we have no older cache data to serve
+				if data == nil {
+					resp.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+			}
+			etag, err := group.etagCache.Get()
+			if err != nil {
+				resp.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+
+			// An url with an outdated hash is redirected to the current document
+			if hash := req.QueryParameter("hash"); hash != "" {
+				if hash != string(etag) {
+					http.Redirect(resp, req.Request, constructServerRelativeURL(groupVersion, string(etag)), http.StatusMovedPermanently)
+					return
+				}
+				// The document of a hash never changes
+				resp.Header().Set("Cache-Control", "public, immutable")
+				resp.Header().Set("Expires", time.Now().AddDate(1, 0, 0).Format(time.RFC1123))
+			}
+
+			resp.Header().Set("Content-Type", accepts.Type+"/"+accepts.SubType)
+			resp.Header().Set("Etag", strconv.Quote(string(etag)))
+			http.ServeContent(resp, req.Request, "", lastModified, bytes.NewReader(data))
+			return
+		}
+	}
+	resp.WriteHeader(http.StatusNotAcceptable)
+}
@@ -4,21 +4,35 @@ import (
 	"context"
 	"log"
 
+	"github.com/opencontrolplane/opencp-shim/internal/audit"
+	"github.com/opencontrolplane/opencp-shim/internal/authentication"
+	"github.com/opencontrolplane/opencp-shim/internal/authorization"
 	config "github.com/opencontrolplane/opencp-shim/internal/config"
 	etcd "github.com/opencontrolplane/opencp-shim/internal/etcd"
+	"github.com/opencontrolplane/opencp-shim/internal/flowcontrol"
+	"github.com/opencontrolplane/opencp-shim/internal/store"
 	opencpspec "github.com/opencontrolplane/opencp-spec/grpc"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apiserver/pkg/storage/storagebackend"
 	"k8s.io/klog/v2"
 )
 
+// OpenCPApp is shared by all the requests, it is not modified after the startup,
+// what is of a request, like the identity of the caller, is in the context of the request
 type OpenCPApp struct {
-	Config                  config.Config
-	Token                   string
-	Context                 context.Context
-	EtcdClient              *clientv3.Client
+	Config        config.Config
+	Context       context.Context
+	EtcdClient    *clientv3.Client
+	Store         store.Store
+	TokenCache    *authentication.Cache
+	Authenticator *authentication.Authenticator
+	Authorizer    authorization.Authorizer
+	// Auditor is nil when the requests are not audited
+	Auditor                 *audit.Auditor
+	FlowControl             *flowcontrol.Controller
 	Namespace               opencpspec.NamespaceServiceClient
 	LoginClient             opencpspec.LoginClient
 	VirtualMachine          opencpspec.VirtualMachineServiceClient
@@ -54,13 +68,76 @@ func Etcd(config config.Config) (*clientv3.Client, error) {
 	if err != nil {
 		log.Println(err)
 	}
-	defer etcdClient.Close()
 
 	return etcdClient, err
 }
 
+// Store returns the store for the data the backend does not keep, in etcd when
+// there is a client, in memory otherwise
+func Store(etcdClient *clientv3.Client) store.Store {
+	if etcdClient != nil {
+		return store.NewEtcd(etcdClient, "/opencp-shim/")
+	}
+
+	log.Println("etcd is not enabled, the store is kept in memory")
+	return store.NewMemory()
+}
+
+// TokenCache returns the cache of the token validations of the login service
+func TokenCache(loginClient opencpspec.LoginClient, config config.Config) *authentication.Cache {
+	return authentication.NewCache(loginClient, config.TokenCache)
+}
+
+// Authenticator returns the chain of authenticators of the config
+func Authenticator(config config.Config, tokenCache *authentication.Cache) *authentication.Authenticator {
+	authenticator, err := authentication.NewAuthenticator(config.Authentication, tokenCache)
+	if err != nil {
+		klog.Fatalf("could not set up the authentication: %v", err)
+	}
+	return authenticator
+}
+
+// Authorizer returns the authorizer deciding what the callers can do
+func Authorizer(config config.Config, st store.Store) authorization.Authorizer {
+	return authorization.NewAuthorizer(config, st)
+}
+
+// Auditor returns the auditor of the requests, running, or nil when there is no audit policy
+func Auditor(config config.Config) *audit.Auditor {
+	auditor, err := audit.NewAuditor(config.Audit)
+	if err != nil {
+		klog.Fatalf("could not set up the audit: %v", err)
+	}
+	if auditor == nil {
+		return nil
+	}
+	if err := auditor.Run(wait.NeverStop); err != nil {
+		klog.Fatalf("could not start the audit: %v", err)
+	}
+	return auditor
+}
+
+// FlowControl returns the controller of the priority levels and flow schemas of the requests
+func FlowControl(config config.Config) *flowcontrol.Controller {
+	controller, err := flowcontrol.NewController(config.FlowControl)
+	if err != nil {
+		klog.Fatalf("could not set up the flow control: %v", err)
+	}
+	return controller
+}
+
+// dialOptions are the options of the connections to the backend, the calls send the token
+// and the identity of the caller of the request they are made for
+func dialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(authentication.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(authentication.StreamClientInterceptor()),
+	}
+}
+
 func Login(config config.Config) opencpspec.LoginClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -70,7 +147,7 @@ func Login(config config.Config) opencpspec.LoginClient {
 }
 
 func Namespace(config config.Config) opencpspec.NamespaceServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -80,7 +157,7 @@ func Namespace(config config.Config) opencpspec.NamespaceServiceClient {
 }
 
 func VirtualMachine(config config.Config) opencpspec.VirtualMachineServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -90,7 +167,7 @@ func VirtualMachine(config config.Config) opencpspec.VirtualMachineServiceClient
 }
 
 func KubernetesCluster(config config.Config) opencpspec.KubernetesClusterServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -100,7 +177,7 @@ func KubernetesCluster(config config.Config) opencpspec.KubernetesClusterService
 }
 
 func Domain(config config.Config) opencpspec.DomainServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -110,7 +187,7 @@ func Domain(config config.Config) opencpspec.DomainServiceClient {
 }
 
 func SSHKey(config config.Config) opencpspec.SSHKeyServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -120,7 +197,7 @@ func SSHKey(config config.Config) opencpspec.SSHKeyServiceClient {
 }
 
 func Firewall(config config.Config) opencpspec.FirewallServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -130,7 +207,7 @@ func Firewall(config config.Config) opencpspec.FirewallServiceClient {
 }
 
 func IP(config config.Config) opencpspec.IpServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -140,7 +217,7 @@ func IP(config config.Config) opencpspec.IpServiceClient {
 }
 
 func Database(config config.Config) opencpspec.DatabaseServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -150,7 +227,7 @@ func Database(config config.Config) opencpspec.DatabaseServiceClient {
 }
 
 func ObjectStorage(config config.Config) opencpspec.ObjectStorageServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -160,7 +237,7 @@ func ObjectStorage(config config.Config) opencpspec.ObjectStorageServiceClient {
 }
 
 func ObjectStorageCredential(config config.Config) opencpspec.ObjectStorageCredentialServiceClient {
-	conn, err := grpc.Dial(config.GrpcServer.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(config.GrpcServer.Host, dialOptions()...)
 	if err != nil {
 		klog.Fatalf("could not connect: %v", err)
 	}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"strings"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Etcd is a Store that keeps the data in etcd, under a prefix
+type Etcd struct {
+	client *clientv3.Client
+	prefix string
+}
+
+// NewEtcd returns a store using the etcd client, all the keys are stored under the prefix
+func NewEtcd(client *clientv3.Client, prefix string) *Etcd {
+	return &Etcd{client: client, prefix: prefix}
+}
+
+func (e *Etcd) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := e.client.Get(ctx, e.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, ErrNotFound
+	}
+	return resp.Kvs[0].Value, nil
+}
+
+func (e *Etcd) Put(ctx context.Context, key string, value []byte) error {
+	_, err := e.client.Put(ctx, e.prefix+key, string(value))
+	return err
+}
+
+func (e *Etcd) Delete(ctx context.Context, key string) error {
+	_, err := e.client.Delete(ctx, e.prefix+key)
+	return err
+}
+
+func (e *Etcd) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	resp, err := e.client.Get(ctx, e.prefix+prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	items := map[string][]byte{}
+	for _, kv := range resp.Kvs {
+		items[strings.TrimPrefix(string(kv.Key), e.prefix)] = kv.Value
+	}
+	return items, nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Memory is a Store that keeps the data in memory, it is lost on restart
+type Memory struct {
+	mu    sync.RWMutex
+	items map[string][]byte
+}
+
+// NewMemory returns an empty memory store
+func NewMemory() *Memory {
+	return &Memory{items: map[string][]byte{}}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	value, ok := m.items[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return value, nil
+}
+
+func (m *Memory) Put(ctx context.Context, key string, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.items[key] = value
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.items, key)
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := map[string][]byte{}
+	for key, value := range m.items {
+		if strings.HasPrefix(key, prefix) {
+			items[key] = value
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,22 @@
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned when the key is not in the store
+var ErrNotFound = errors.New("key not found in the store")
+
+// Store keeps the data the shim needs about the objects that the backend does not keep,
+// like the roles and bindings of the RBAC and the events recorded by the shim
+type Store interface {
+	// Get returns the value of the key, or ErrNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Put sets the value of the key
+	Put(ctx context.Context, key string, value []byte) error
+	// Delete removes the key, it is not an error if the key does not exist
+	Delete(ctx context.Context, key string) error
+	// List returns the values of the keys starting with the prefix, by key
+	List(ctx context.Context, prefix string) (map[string][]byte, error)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/tls"
 	"log"
 	"net/http"
 	"os"
@@ -8,14 +9,21 @@ import (
 	// "git.civo.com/alejandro/api-v3/pkg"
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
 	restful "github.com/emicklei/go-restful/v3"
+	authn "github.com/opencontrolplane/opencp-shim/internal/authentication"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
 	middleware "github.com/opencontrolplane/opencp-shim/internal/middleware"
 	openapi "github.com/opencontrolplane/opencp-shim/internal/openapi"
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
 
 	// API
 	apis "github.com/opencontrolplane/opencp-shim/services/apis"
+	authentication "github.com/opencontrolplane/opencp-shim/services/authentication"
+	authorization "github.com/opencontrolplane/opencp-shim/services/authorization"
 	core "github.com/opencontrolplane/opencp-shim/services/core"
+	flowcontrol "github.com/opencontrolplane/opencp-shim/services/flowcontrol"
 	opencp "github.com/opencontrolplane/opencp-shim/services/opencp"
+	rbac "github.com/opencontrolplane/opencp-shim/services/rbac"
 
 	// "k8s.io/apiserver/pkg/storage/storagebackend"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -27,14 +35,22 @@ func main() {
 	// Config
 	app.Config = setup.Config("config.yaml")
 
-	// Disable for now as we are not using it
-	// etcdClient, err := setup.Etcd(app.Config)
-	// if err != nil {
-	// 	log.Println(err)
-	// }
-	// app.EtcdClient = etcdClient
+	// Etcd is optional, without it the store is kept in memory
+	if app.Config.EtcdServer.Enabled {
+		etcdClient, err := setup.Etcd(app.Config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.EtcdClient = etcdClient
+	}
+	app.Store = setup.Store(app.EtcdClient)
 
 	app.LoginClient = setup.Login(app.Config)
+	app.TokenCache = setup.TokenCache(app.LoginClient, app.Config)
+	app.Authenticator = setup.Authenticator(app.Config, app.TokenCache)
+	app.Authorizer = setup.Authorizer(app.Config, app.Store)
+	app.Auditor = setup.Auditor(app.Config)
+	app.FlowControl = setup.FlowControl(app.Config)
 	app.VirtualMachine = setup.VirtualMachine(app.Config)
 	app.KubernetesCluster = setup.KubernetesCluster(app.Config)
 	app.Namespace = setup.Namespace(app.Config)
@@ -52,16 +68,30 @@ func main() {
 		chain.ProcessFilter(r, w)
 	})
 
+	// The router errors are written as a Status, like the 406 of the content negotiation
+	restful.DefaultContainer.ServiceErrorHandler(pkg.ServiceErrorHandler)
+
 	// Service
 	coreService := core.NewCore()
 	apisService := apis.NewAPIGroup()
 	opencpService := opencp.NewOpenCP()
+	authenticationService := authentication.NewAuthentication()
+	authorizationService := authorization.NewAuthorization()
+	rbacService := rbac.NewRBAC()
+	flowcontrolService := flowcontrol.NewFlowControl()
+
+	// The routes of the subresources are registered from the resources of the discovery
+	registry := discovery.Registry(app.Config)
 
 	allWebservice := []*restful.WebService{}
-	allWebservice = append(allWebservice, coreService.API()...)
+	allWebservice = append(allWebservice, coreService.API(registry)...)
 	allWebservice = append(allWebservice, coreService.Version()...)
 	allWebservice = append(allWebservice, apisService.APIS()...)
-	allWebservice = append(allWebservice, opencpService.OpenCP()...)
+	allWebservice = append(allWebservice, opencpService.OpenCP(registry)...)
+	allWebservice = append(allWebservice, authenticationService.API()...)
+	allWebservice = append(allWebservice, authorizationService.API()...)
+	allWebservice = append(allWebservice, rbacService.API()...)
+	allWebservice = append(allWebservice, flowcontrolService.API()...)
 
 	// Register the API
 	for _, ws := range allWebservice {
@@ -77,10 +107,15 @@ func main() {
 	}
 	openAPIv2 := openapi.NewOpenAPIService(config)
 	restful.DefaultContainer.Add(openAPIv2)
+	restful.DefaultContainer.Add(openapi.NewOpenAPIV3Service(config))
 
 	// Added the filter
 	restful.DefaultContainer.Filter(middleware.Metrics())
 	restful.DefaultContainer.Filter(middleware.Authenticate)
+	restful.DefaultContainer.Filter(middleware.Audit)
+	restful.DefaultContainer.Filter(middleware.Impersonate)
+	restful.DefaultContainer.Filter(middleware.FlowControl)
+	restful.DefaultContainer.Filter(middleware.Authorize)
 	restful.DefaultContainer.Filter(middleware.AddHeaders)
 	restful.DefaultContainer.Filter(middleware.Logging)
 
@@ -92,10 +127,22 @@ func main() {
 		}
 	}()
 
+	// Serve the admin endpoints, they are not authenticated so they are only on the address of the config
+	adminMux := http.NewServeMux()
+	adminMux.Handle("/token-cache/purge", authn.PurgeHandler(app.TokenCache))
+	go func() {
+		log.Printf("admin endpoints listening at %s", app.Config.TokenCache.PurgeAddress)
+		if err := http.ListenAndServe(app.Config.TokenCache.PurgeAddress, adminMux); err != nil {
+			log.Panicf("error while serving the admin endpoints: %s", err)
+		}
+	}()
+
 	// This ssl is just for development
 	if os.Getenv("SSL") == "true" {
 		log.Println("Starting server with ssl on :4000")
-		err := http.ListenAndServeTLS(":4000", "ssl/server.crt", "ssl/server.key", nil)
+		// The client certificates are asked for, the x509 authenticator verifies them
+		server := &http.Server{Addr: ":4000", TLSConfig: &tls.Config{ClientAuth: tls.RequestClientCert}}
+		err := server.ListenAndServeTLS("ssl/server.crt", "ssl/server.key")
 		log.Fatal(err)
 	} else {
 		log.Println("Starting server on :4000")
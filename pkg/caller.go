@@ -0,0 +1,26 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+// Caller identifies the caller of a request from its user, uid and groups, so what the shim keeps for
+// a caller, like the states of its lists or its events, is never handed to another one. The backend
+// answers every caller with its own objects. It is empty when the request has no user
+func Caller(ctx context.Context) string {
+	u, ok := request.UserFrom(ctx)
+	if !ok {
+		return ""
+	}
+
+	groups := append([]string{}, u.GetGroups()...)
+	sort.Strings(groups)
+	hash := sha256.Sum256([]byte(u.GetName() + "\n" + u.GetUID() + "\n" + strings.Join(groups, "\n")))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metainternalversionscheme "k8s.io/apimachinery/pkg/apis/meta/internalversion/scheme"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// DeleteOptions reads the DeleteOptions of a delete request, like the kube-apiserver they are read
+// from the body when it has any and from the query parameters otherwise
+func DeleteOptions(r *restful.Request) (metav1.DeleteOptions, error) {
+	options := metav1.DeleteOptions{}
+
+	body, err := ReadBody(r)
+	if err != nil {
+		return options, apierrors.NewBadRequest(fmt.Sprintf("error reading body: %v", err))
+	}
+
+	if len(body) > 0 {
+		optionsJSON, err := yaml.ToJSON(body)
+		if err == nil {
+			err = json.Unmarshal(optionsJSON, &options)
+		}
+		if err != nil {
+			return options, apierrors.NewBadRequest(fmt.Sprintf("error decoding the DeleteOptions: %v", err))
+		}
+	} else if err := metainternalversionscheme.ParameterCodec.DecodeParameters(r.Request.URL.Query(), metav1.SchemeGroupVersion, &options); err != nil {
+		return options, apierrors.NewBadRequest(fmt.Sprintf("error decoding the DeleteOptions: %v", err))
+	}
+
+	// The dryRun of the query applies to the options in the body too
+	if len(options.DryRun) == 0 {
+		options.DryRun = r.Request.URL.Query()["dryRun"]
+	}
+
+	errs := metav1validation.ValidateDeleteOptions(&options)
+	if options.GracePeriodSeconds != nil && *options.GracePeriodSeconds < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("gracePeriodSeconds"), *options.GracePeriodSeconds, "must be greater than or equal to 0"))
+	}
+	if len(errs) > 0 {
+		return options, apierrors.NewInvalid(schema.GroupKind{Group: metav1.GroupName, Kind: "DeleteOptions"}, "", errs)
+	}
+
+	return options, nil
+}
+
+// CheckPreconditions returns a 409 Conflict when the object does not match the preconditions of the delete
+func CheckPreconditions(options metav1.DeleteOptions, obj metav1.Object, groupResource schema.GroupResource) error {
+	preconditions := options.Preconditions
+	if preconditions == nil {
+		return nil
+	}
+
+	if preconditions.UID != nil && *preconditions.UID != obj.GetUID() {
+		return apierrors.NewConflict(groupResource, obj.GetName(), fmt.Errorf("Precondition failed: UID in precondition: %v, UID in object meta: %v", *preconditions.UID, obj.GetUID()))
+	}
+	if preconditions.ResourceVersion != nil && *preconditions.ResourceVersion != obj.GetResourceVersion() {
+		return apierrors.NewConflict(groupResource, obj.GetName(), fmt.Errorf("Precondition failed: ResourceVersion in precondition: %v, ResourceVersion in object meta: %v", *preconditions.ResourceVersion, obj.GetResourceVersion()))
+	}
+	return nil
+}
+
+// Terminating marks an object the backend still has after its deletion, like the kube-apiserver
+// does while a deletion is in progress. The backend has no grace period nor finalizers, the
+// propagationPolicy and gracePeriodSeconds of the delete are accepted but not honored
+func Terminating(obj metav1.Object) {
+	if obj.GetDeletionTimestamp() == nil {
+		deletionTimestamp := metav1.Now()
+		obj.SetDeletionTimestamp(&deletionTimestamp)
+	}
+}
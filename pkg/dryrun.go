@@ -0,0 +1,21 @@
+package pkg
+
+import (
+	"fmt"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DryRun tells if the request is a dry run, like in the kube-apiserver All is the only dryRun value supported.
+// The backend has no validation-only calls, the dry runs are checked in the shim and never sent to it
+func DryRun(r *restful.Request) (bool, error) {
+	values := r.Request.URL.Query()["dryRun"]
+	for _, value := range values {
+		if value != metav1.DryRunAll {
+			return false, apierrors.NewBadRequest(fmt.Sprintf("unsupported dryRun value %q, only %q is supported", value, metav1.DryRunAll))
+		}
+	}
+	return len(values) > 0, nil
+}
@@ -0,0 +1,68 @@
+package pkg
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/endpoints/handlers/fieldmanager"
+)
+
+// unstructuredScheme creates, defaults and converts unstructured objects for the field manager.
+// The shim serves a single version of every kind so there is nothing to convert
+type unstructuredScheme struct{}
+
+func (unstructuredScheme) New(kind schema.GroupVersionKind) (runtime.Object, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(kind)
+	return obj, nil
+}
+
+func (unstructuredScheme) Default(in runtime.Object) {}
+
+func (unstructuredScheme) Convert(in, out, context interface{}) error {
+	inObj, ok := in.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unable to convert %T, only unstructured objects are supported", in)
+	}
+	outObj, ok := out.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("unable to convert to %T, only unstructured objects are supported", out)
+	}
+
+	outObj.Object = runtime.DeepCopyJSON(inObj.Object)
+	return nil
+}
+
+func (unstructuredScheme) ConvertToVersion(in runtime.Object, gv runtime.GroupVersioner) (runtime.Object, error) {
+	return in.DeepCopyObject(), nil
+}
+
+func (unstructuredScheme) ConvertFieldLabel(gvk schema.GroupVersionKind, label, value string) (string, string, error) {
+	return label, value, nil
+}
+
+// NewFieldManager returns the field manager tracking the managedFields of a kind, or of one of
+// its subresources, it works with unstructured objects and deduces the schema from the objects themselves
+func NewFieldManager(gvk schema.GroupVersionKind, subresource string) (*fieldmanager.FieldManager, error) {
+	return fieldmanager.NewDefaultCRDFieldManager(
+		fieldmanager.DeducedTypeConverter{},
+		unstructuredScheme{},
+		unstructuredScheme{},
+		unstructuredScheme{},
+		gvk,
+		gvk.GroupVersion(),
+		subresource,
+		nil,
+	)
+}
+
+// ToUnstructured converts any object to an unstructured one
+func ToUnstructured(obj interface{}) (*unstructured.Unstructured, error) {
+	unstructuredObj := &unstructured.Unstructured{}
+	if err := ConvertTo(obj, &unstructuredObj.Object); err != nil {
+		return nil, err
+	}
+	return unstructuredObj, nil
+}
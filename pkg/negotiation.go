@@ -0,0 +1,467 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// MIME_YAML is the media type used to render the objects as yaml
+const MIME_YAML = "application/yaml"
+
+// metaGroup is the group of the Table and PartialObjectMetadata kinds
+const metaGroup = "meta.k8s.io"
+
+// MediaType is one of the media ranges of an Accept header
+type MediaType struct {
+	Type    string
+	SubType string
+	Params  map[string]string
+	Quality float64
+}
+
+// Output is the representation negotiated with the client for a response
+type Output struct {
+	// MediaType is the media type of the body, json or yaml
+	MediaType string
+	// As is the kind the object is transformed to: Table, PartialObjectMetadata,
+	// PartialObjectMetadataList or empty to send the object itself
+	As string
+	// Version of the meta.k8s.io kind asked with As
+	Version string
+	// IncludeObject is what the rows of a Table carry
+	IncludeObject metav1.IncludeObjectPolicy
+}
+
+// ContentType is the Content-Type header of the response, with the parameters of the kind
+func (o Output) ContentType() string {
+	if o.As == "" {
+		return o.MediaType
+	}
+	return fmt.Sprintf("%s;as=%s;g=%s;v=%s", o.MediaType, o.As, metaGroup, o.Version)
+}
+
+// ParseAccept parses an Accept header per RFC 7231, the media ranges are sorted
+// by quality, keeping the order of the header for the same quality. Media ranges
+// with a quality of 0 or that can not be parsed are left out
+func ParseAccept(header string) []MediaType {
+	mediaTypes := []MediaType{}
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		mediaType, params, err := mime.ParseMediaType(part)
+		if err != nil {
+			continue
+		}
+		typ, subType, ok := strings.Cut(mediaType, "/")
+		if !ok {
+			continue
+		}
+
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+			delete(params, "q")
+		}
+		if quality == 0 {
+			continue
+		}
+
+		mediaTypes = append(mediaTypes, MediaType{Type: typ, SubType: subType, Params: params, Quality: quality})
+	}
+
+	sort.SliceStable(mediaTypes, func(i, j int) bool {
+		return mediaTypes[i].Quality > mediaTypes[j].Quality
+	})
+	return mediaTypes
+}
+
+// Negotiate picks the representation of the response from the Accept header, list
+// tells if the response is a collection, as PartialObjectMetadata is only valid for
+// a single object and PartialObjectMetadataList for a collection. A 406 NotAcceptable
+// error is returned when the client accepts none of the representations served
+func Negotiate(r *restful.Request, list bool) (Output, error) {
+	return negotiate(r, list, true)
+}
+
+// negotiate picks the representation of the response, protobuf tells if the object
+// can be sent in protobuf, otherwise the next media type accepted is used
+func negotiate(r *restful.Request, list, protobuf bool) (Output, error) {
+	header := r.HeaderParameter("Accept")
+	if strings.TrimSpace(header) == "" {
+		header = "*/*"
+	}
+
+	for _, mediaType := range ParseAccept(header) {
+		output, ok := acceptable(mediaType, list, protobuf)
+		if !ok {
+			continue
+		}
+
+		if output.As == "Table" {
+			output.IncludeObject = includeObject(r, mediaType)
+		}
+		return output, nil
+	}
+
+	return Output{}, notAcceptable(header)
+}
+
+// acceptable returns the output for a media range, if it is one we serve
+func acceptable(mediaType MediaType, list, protobuf bool) (Output, bool) {
+	output := Output{}
+	switch {
+	case mediaType.Type == "*" && mediaType.SubType == "*", mediaType.Type == "application" && (mediaType.SubType == "*" || mediaType.SubType == "json"):
+		output.MediaType = restful.MIME_JSON
+	case mediaType.Type == "application" && (mediaType.SubType == "yaml" || mediaType.SubType == "yml"):
+		output.MediaType = MIME_YAML
+	case mediaType.Type == "application" && mediaType.SubType == "vnd.kubernetes.protobuf" && protobuf:
+		output.MediaType = MIME_PROTOBUF
+	default:
+		return output, false
+	}
+
+	as, ok := mediaType.Params["as"]
+	if !ok {
+		return output, true
+	}
+	if mediaType.Params["g"] != metaGroup {
+		return output, false
+	}
+	version := mediaType.Params["v"]
+	if version != "v1" && version != "v1beta1" {
+		return output, false
+	}
+
+	switch {
+	case as == "Table":
+	case as == "PartialObjectMetadata" && !list:
+	case as == "PartialObjectMetadataList" && list:
+	default:
+		return output, false
+	}
+
+	output.As = as
+	output.Version = version
+	return output, true
+}
+
+// includeObject is what the rows of a table carry, from the query or the Accept parameters
+// (their names are lower cased when parsed), the object metadata is included by default
+func includeObject(r *restful.Request, mediaType MediaType) metav1.IncludeObjectPolicy {
+	policy := r.QueryParameter("includeObject")
+	if policy == "" {
+		policy = mediaType.Params["includeobject"]
+	}
+
+	switch metav1.IncludeObjectPolicy(policy) {
+	case metav1.IncludeNone, metav1.IncludeObject:
+		return metav1.IncludeObjectPolicy(policy)
+	}
+	return metav1.IncludeMetadata
+}
+
+func notAcceptable(header string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusNotAcceptable,
+		Reason:  metav1.StatusReasonNotAcceptable,
+		Message: fmt.Sprintf("only the following media types are accepted: %s, %s, %s, with the %s Table, PartialObjectMetadata and PartialObjectMetadataList kinds; got %q", restful.MIME_JSON, MIME_YAML, MIME_PROTOBUF, metaGroup, header),
+	}}
+}
+
+// CheckHeader to see if the client asked for a table
+func CheckHeader(request *restful.Request) bool {
+	output, err := Negotiate(request, true)
+	return err == nil && output.As == "Table"
+}
+
+// WriteObject writes an object in the representation negotiated with the client:
+// json, yaml or protobuf, the object itself, a table or the metadata only. Tables built
+// by the handlers are sent as they are, other objects get a table with the name and age
+func WriteObject(r *restful.Request, w *restful.Response, code int, obj interface{}) {
+	// Status objects are sent as they are whatever the kind asked
+	switch obj.(type) {
+	case metav1.Status, *metav1.Status:
+		output, err := Negotiate(r, false)
+		if err != nil {
+			output = Output{MediaType: restful.MIME_JSON}
+		}
+		output.As = ""
+		writeOutput(w, output, code, obj)
+		return
+	}
+
+	content, err := toMap(obj)
+	if err != nil {
+		WriteStatus(w, RespondStatus(err))
+		return
+	}
+	_, list := content["items"]
+	if isTable(obj) {
+		list = true
+	}
+
+	output, err := Negotiate(r, list)
+	if err != nil {
+		WriteStatus(w, RespondStatus(err))
+		return
+	}
+	result, err := transform(obj, content, output)
+	if err != nil {
+		WriteStatus(w, RespondStatus(err))
+		return
+	}
+
+	// Not every kind has a protobuf representation, those are sent in the next media type accepted
+	if output.MediaType == MIME_PROTOBUF {
+		resultContent, err := toMap(result)
+		if err != nil {
+			WriteStatus(w, RespondStatus(err))
+			return
+		}
+		if !protobufEncodable(result, resultContent) {
+			output, err = negotiate(r, list, false)
+			if err != nil {
+				WriteStatus(w, RespondStatus(err))
+				return
+			}
+			result, err = transform(obj, content, output)
+			if err != nil {
+				WriteStatus(w, RespondStatus(err))
+				return
+			}
+		}
+	}
+
+	writeOutput(w, output, code, result)
+}
+
+// transform returns the object as the kind negotiated
+func transform(obj interface{}, content map[string]interface{}, output Output) (interface{}, error) {
+	switch output.As {
+	case "Table":
+		return toTable(obj, content, output)
+	case "PartialObjectMetadata":
+		return toPartialObjectMetadata(content, output.Version)
+	case "PartialObjectMetadataList":
+		return toPartialObjectMetadataList(content, output.Version)
+	}
+	return obj, nil
+}
+
+func writeOutput(w *restful.Response, output Output, code int, obj interface{}) {
+	var content []byte
+	var err error
+	switch output.MediaType {
+	case MIME_YAML:
+		content, err = yaml.Marshal(obj)
+	case MIME_PROTOBUF:
+		content, err = EncodeProtobuf(obj)
+	default:
+		w.WriteHeaderAndJson(code, obj, output.ContentType())
+		return
+	}
+	if err != nil {
+		WriteStatus(w, RespondStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", output.ContentType())
+	w.WriteHeader(code)
+	w.Write(content)
+}
+
+// RawObject returns the object to embed in a table row
+func RawObject(obj interface{}) runtime.RawExtension {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return runtime.RawExtension{}
+	}
+	return runtime.RawExtension{Raw: raw}
+}
+
+func isTable(obj interface{}) bool {
+	switch obj.(type) {
+	case metav1.Table, *metav1.Table:
+		return true
+	}
+	return false
+}
+
+func toMap(obj interface{}) (map[string]interface{}, error) {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	content := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// objectMeta reads the metadata of an object in its map form
+func objectMeta(content map[string]interface{}) (metav1.ObjectMeta, error) {
+	objectMeta := metav1.ObjectMeta{}
+	metadata, ok := content["metadata"]
+	if !ok {
+		return objectMeta, nil
+	}
+	if err := ConvertTo(metadata, &objectMeta); err != nil {
+		return objectMeta, err
+	}
+	return objectMeta, nil
+}
+
+func metaTypeMeta(kind, version string) metav1.TypeMeta {
+	return metav1.TypeMeta{
+		Kind:       kind,
+		APIVersion: schema.GroupVersion{Group: metaGroup, Version: version}.String(),
+	}
+}
+
+func toPartialObjectMetadata(content map[string]interface{}, version string) (*metav1.PartialObjectMetadata, error) {
+	objectMeta, err := objectMeta(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &metav1.PartialObjectMetadata{
+		TypeMeta:   metaTypeMeta("PartialObjectMetadata", version),
+		ObjectMeta: objectMeta,
+	}, nil
+}
+
+func toPartialObjectMetadataList(content map[string]interface{}, version string) (*metav1.PartialObjectMetadataList, error) {
+	list := &metav1.PartialObjectMetadataList{
+		TypeMeta: metaTypeMeta("PartialObjectMetadataList", version),
+		Items:    []metav1.PartialObjectMetadata{},
+	}
+	if err := ConvertTo(content["metadata"], &list.ListMeta); err != nil {
+		return nil, err
+	}
+
+	items, _ := content["items"].([]interface{})
+	for _, item := range items {
+		itemContent, _ := item.(map[string]interface{})
+		partial, err := toPartialObjectMetadata(itemContent, version)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, *partial)
+	}
+	return list, nil
+}
+
+// toTable returns the table of an object, the tables built by the handlers only get
+// the objects of their rows set as asked with includeObject
+func toTable(obj interface{}, content map[string]interface{}, output Output) (*metav1.Table, error) {
+	var table *metav1.Table
+	switch obj := obj.(type) {
+	case metav1.Table:
+		table = &obj
+	case *metav1.Table:
+		table = obj
+	default:
+		var err error
+		table, err = defaultTable(content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	table.TypeMeta = metaTypeMeta("Table", output.Version)
+	for i := range table.Rows {
+		object, err := rowObject(table.Rows[i].Object, output)
+		if err != nil {
+			return nil, err
+		}
+		table.Rows[i].Object = object
+	}
+	return table, nil
+}
+
+// defaultTable is the table of the objects without one, with the name and the age of the objects
+func defaultTable(content map[string]interface{}) (*metav1.Table, error) {
+	table := &metav1.Table{
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Name", Type: "string", Format: "name", Description: "Name must be unique within a namespace"},
+			{Name: "Created At", Type: "date", Description: "CreationTimestamp is a timestamp representing the server time when this object was created"},
+		},
+		Rows: []metav1.TableRow{},
+	}
+
+	items := []interface{}{content}
+	if list, ok := content["items"]; ok {
+		items, _ = list.([]interface{})
+		if err := ConvertTo(content["metadata"], &table.ListMeta); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, item := range items {
+		itemContent, _ := item.(map[string]interface{})
+		objectMeta, err := objectMeta(itemContent)
+		if err != nil {
+			return nil, err
+		}
+		table.Rows = append(table.Rows, metav1.TableRow{
+			Cells:  []interface{}{objectMeta.Name, objectMeta.CreationTimestamp},
+			Object: RawObject(itemContent),
+		})
+	}
+	return table, nil
+}
+
+// rowObject is the object of a table row for the includeObject policy
+func rowObject(object runtime.RawExtension, output Output) (runtime.RawExtension, error) {
+	if output.IncludeObject == metav1.IncludeNone {
+		return runtime.RawExtension{}, nil
+	}
+
+	if object.Raw == nil && object.Object == nil {
+		return object, nil
+	}
+	if output.IncludeObject == metav1.IncludeObject {
+		return object, nil
+	}
+
+	content, err := toMap(object)
+	if err != nil {
+		return object, err
+	}
+	partial, err := toPartialObjectMetadata(content, output.Version)
+	if err != nil {
+		return object, err
+	}
+	return RawObject(partial), nil
+}
+
+// ServiceErrorHandler writes the 406 of the router, when no route produces any of the
+// media types accepted, as a Status like the one of the handlers
+func ServiceErrorHandler(serviceErr restful.ServiceError, r *restful.Request, w *restful.Response) {
+	if serviceErr.Code == http.StatusNotAcceptable {
+		WriteStatus(w, RespondStatus(notAcceptable(r.HeaderParameter("Accept"))))
+		return
+	}
+	w.WriteErrorString(serviceErr.Code, serviceErr.Message)
+}
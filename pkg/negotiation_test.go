@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseAcceptSortsByQuality(t *testing.T) {
+	mediaTypes := ParseAccept("application/yaml;q=0.5, application/json;as=Table;g=meta.k8s.io;v=v1, text/html;q=0, */*;q=0.5, invalid")
+
+	expected := []string{"application/json", "application/yaml", "*/*"}
+	if len(mediaTypes) != len(expected) {
+		t.Fatalf("got the media types %+v", mediaTypes)
+	}
+	for i, mediaType := range mediaTypes {
+		if got := mediaType.Type + "/" + mediaType.SubType; got != expected[i] {
+			t.Fatalf("the media type %d is %s, expected %s", i, got, expected[i])
+		}
+	}
+	if mediaTypes[0].Params["as"] != "Table" || mediaTypes[0].Quality != 1 {
+		t.Fatalf("the first media type is %+v", mediaTypes[0])
+	}
+}
+
+func TestNegotiatePicksTheFirstServedRepresentation(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		query    string
+		list     bool
+		expected Output
+	}{
+		{name: "no header", expected: Output{MediaType: restful.MIME_JSON}},
+		{name: "yaml", accept: "application/yaml", expected: Output{MediaType: MIME_YAML}},
+		{name: "protobuf", accept: "application/vnd.kubernetes.protobuf, application/json", expected: Output{MediaType: MIME_PROTOBUF}},
+		{
+			name:     "table",
+			accept:   "application/json;as=Table;g=meta.k8s.io;v=v1, application/json",
+			list:     true,
+			expected: Output{MediaType: restful.MIME_JSON, As: "Table", Version: "v1", IncludeObject: metav1.IncludeMetadata},
+		},
+		{
+			name:     "table with the object",
+			accept:   "application/json;as=Table;g=meta.k8s.io;v=v1beta1",
+			query:    "?includeObject=Object",
+			expected: Output{MediaType: restful.MIME_JSON, As: "Table", Version: "v1beta1", IncludeObject: metav1.IncludeObject},
+		},
+		{
+			name:     "metadata of a list falls back",
+			accept:   "application/json;as=PartialObjectMetadata;g=meta.k8s.io;v=v1, application/yaml",
+			list:     true,
+			expected: Output{MediaType: MIME_YAML},
+		},
+		{
+			name:     "other group falls back",
+			accept:   "application/json;as=Table;g=example.com;v=v1, application/json",
+			expected: Output{MediaType: restful.MIME_JSON},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/namespaces"+test.query, nil)
+			if test.accept != "" {
+				req.Header.Set("Accept", test.accept)
+			}
+			output, err := Negotiate(restful.NewRequest(req), test.list)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != test.expected {
+				t.Fatalf("got the output %+v, expected %+v", output, test.expected)
+			}
+		})
+	}
+}
+
+func TestNegotiateRejectsTheRepresentationsNotServed(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/v1/namespaces", nil)
+	req.Header.Set("Accept", "text/html, application/json;as=PartialObjectMetadataList;g=meta.k8s.io;v=v1")
+
+	_, err := Negotiate(restful.NewRequest(req), false)
+	if status, ok := err.(apierrors.APIStatus); !ok || status.Status().Reason != metav1.StatusReasonNotAcceptable {
+		t.Fatalf("got the error %v", err)
+	}
+}
+
+func TestWriteObjectSendsTheStatusAsItIs(t *testing.T) {
+	notFound := apierrors.NewNotFound(schema.GroupResource{Group: "opencp.io", Resource: "virtualmachines"}, "web").Status()
+
+	// The handlers write the status by value or by pointer
+	for name, obj := range map[string]interface{}{"value": notFound, "pointer": &notFound} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/apis/opencp.io/v1alpha1/virtualmachines/web", nil)
+			req.Header.Set("Accept", "application/json;as=Table;g=meta.k8s.io;v=v1")
+			recorder := httptest.NewRecorder()
+			WriteObject(restful.NewRequest(req), restful.NewResponse(recorder), int(notFound.Code), obj)
+
+			got := metav1.Status{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if recorder.Code != http.StatusNotFound || got.Reason != metav1.StatusReasonNotFound {
+				t.Fatalf("got %d with the body %s", recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
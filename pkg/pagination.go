@@ -0,0 +1,205 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The sorted lists the continue tokens are issued for, in bytes, a caller only drops its own
+// lists when it is over its share
+const (
+	maxPageSnapshotBytes       = 64 << 20
+	maxCallerPageSnapshotBytes = 16 << 20
+)
+
+var pageSnapshots = newSnapshotCache(maxPageSnapshotBytes, maxCallerPageSnapshotBytes)
+
+// PageOptions configure the continue tokens of the paginated lists
+type PageOptions struct {
+	// TokenTTL is how long a continue token can be used
+	TokenTTL time.Duration
+	// SigningKey is used to sign the continue tokens, so the clients can not forge them
+	SigningKey []byte
+}
+
+// continueToken is the cursor of a paginated list, it is sent to the client signed and base64 encoded
+type continueToken struct {
+	// ResourceVersion is the version of the list when the first page was returned
+	ResourceVersion string `json:"rv"`
+	// Start is the key of the last object returned, the next page starts after it
+	Start string `json:"start"`
+	// Scope is the collection listed, a token can not be used with another collection
+	Scope string `json:"scope"`
+	// Created is when the first page was returned
+	Created int64 `json:"created"`
+}
+
+// Paginate returns the page of the items asked with the limit and continue parameters, and the ListMeta
+// of the page. The items are sorted by namespace and name, the continue token keeps the last key returned
+// and the resourceVersion of the first page. The whole list is only read with the list function for the
+// first page, the next pages are cut from the list of the first page, kept for the caller, so the pages
+// are consistent even if the collection changes. The token expires after the TokenTTL, or once its list
+// is no longer kept, with a 410 Expired error
+func Paginate[T any](r *restful.Request, opts PageOptions, list func() (string, []*T, error), objectMeta func(*T) *metav1.ObjectMeta) ([]*T, metav1.ListMeta, error) {
+	listMeta := metav1.ListMeta{}
+
+	limit, err := listLimit(r)
+	if err != nil {
+		return nil, listMeta, err
+	}
+
+	caller := snapshotCaller(r)
+	token := continueToken{
+		Scope:   watchScope(r),
+		Created: time.Now().Unix(),
+	}
+
+	var sorted []*T
+	if r.QueryParameter("continue") != "" {
+		token, err = decodeContinue(r.QueryParameter("continue"), opts)
+		if err != nil {
+			return nil, listMeta, err
+		}
+		if token.Scope != watchScope(r) {
+			return nil, listMeta, apierrors.NewBadRequest("the continue token was not issued for this list")
+		}
+		listMeta.ResourceVersion = token.ResourceVersion
+
+		sorted, err = getPageSnapshot[T](caller, token)
+		if err != nil {
+			return nil, listMeta, err
+		}
+	} else {
+		resourceVersion, items, err := list()
+		if err != nil {
+			return nil, listMeta, err
+		}
+		token.ResourceVersion = resourceVersion
+		listMeta.ResourceVersion = resourceVersion
+
+		sorted = sortItems(items, objectMeta)
+	}
+
+	start := sort.Search(len(sorted), func(i int) bool {
+		return token.Start == "" || metaKey(objectMeta(sorted[i])) > token.Start
+	})
+	page := sorted[start:]
+
+	if limit > 0 && int64(len(page)) > limit {
+		remaining := int64(len(page)) - limit
+		page = page[:limit]
+
+		if token.Start == "" {
+			addPageSnapshot(caller, token, sorted)
+		}
+		token.Start = metaKey(objectMeta(page[len(page)-1]))
+		listMeta.Continue, err = encodeContinue(token, opts)
+		if err != nil {
+			return nil, listMeta, err
+		}
+		listMeta.RemainingItemCount = &remaining
+	}
+
+	return page, listMeta, nil
+}
+
+// sortItems returns the items with metadata, sorted by namespace and name
+func sortItems[T any](items []*T, objectMeta func(*T) *metav1.ObjectMeta) []*T {
+	sorted := make([]*T, 0, len(items))
+	for _, item := range items {
+		if objectMeta(item) != nil {
+			sorted = append(sorted, item)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return metaKey(objectMeta(sorted[i])) < metaKey(objectMeta(sorted[j]))
+	})
+	return sorted
+}
+
+// addPageSnapshot keeps the sorted list the token is issued for, its size is the one of the encoded items
+func addPageSnapshot[T any](caller string, token continueToken, sorted []*T) {
+	encoded, err := json.Marshal(sorted)
+	if err != nil {
+		return
+	}
+	pageSnapshots.add(caller, token.Scope+"@"+token.ResourceVersion, sorted, int64(len(encoded)))
+}
+
+func getPageSnapshot[T any](caller string, token continueToken) ([]*T, error) {
+	snapshot, ok := pageSnapshots.get(caller, token.Scope+"@"+token.ResourceVersion)
+	sorted, isList := snapshot.([]*T)
+	if !ok || !isList {
+		return nil, apierrors.NewResourceExpired("The list of the provided continue parameter is no longer available, please restart the list without the continue parameter")
+	}
+	return sorted, nil
+}
+
+func listLimit(r *restful.Request) (int64, error) {
+	if r.QueryParameter("limit") == "" {
+		return 0, nil
+	}
+
+	limit, err := strconv.ParseInt(r.QueryParameter("limit"), 10, 64)
+	if err != nil || limit < 0 {
+		return 0, apierrors.NewBadRequest(fmt.Sprintf("invalid limit: %s", r.QueryParameter("limit")))
+	}
+	return limit, nil
+}
+
+func metaKey(meta *metav1.ObjectMeta) string {
+	return meta.Namespace + "/" + meta.Name
+}
+
+func encodeContinue(token continueToken, opts PageOptions) (string, error) {
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(signContinue(encoded, opts)), nil
+}
+
+func decodeContinue(value string, opts PageOptions) (continueToken, error) {
+	token := continueToken{}
+
+	encoded, signature, found := strings.Cut(value, ".")
+	if !found {
+		return token, apierrors.NewBadRequest("invalid continue token")
+	}
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decodedSignature, signContinue(encoded, opts)) {
+		return token, apierrors.NewBadRequest("invalid continue token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return token, apierrors.NewBadRequest("invalid continue token")
+	}
+	if err := json.Unmarshal(payload, &token); err != nil {
+		return token, apierrors.NewBadRequest("invalid continue token")
+	}
+
+	if time.Since(time.Unix(token.Created, 0)) > opts.TokenTTL {
+		return token, apierrors.NewResourceExpired("The provided continue parameter is too old, please restart the list without the continue parameter")
+	}
+	return token, nil
+}
+
+func signContinue(encoded string, opts PageOptions) []byte {
+	mac := hmac.New(sha256.New, opts.SigningKey)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+var testPageOptions = PageOptions{TokenTTL: time.Minute, SigningKey: []byte("test")}
+
+func pageRequest(userName, path string, query url.Values) *restful.Request {
+	req := httptest.NewRequest("GET", path+"?"+query.Encode(), nil)
+	req = req.WithContext(request.WithUser(req.Context(), &user.DefaultInfo{Name: userName}))
+	return restful.NewRequest(req)
+}
+
+func pageItems(names ...string) []*metav1.ObjectMeta {
+	items := make([]*metav1.ObjectMeta, len(names))
+	for i, name := range names {
+		items[i] = &metav1.ObjectMeta{Namespace: "default", Name: name}
+	}
+	return items
+}
+
+// listOf returns the list function of a collection at a resourceVersion
+func listOf(resourceVersion string, items []*metav1.ObjectMeta) func() (string, []*metav1.ObjectMeta, error) {
+	return func() (string, []*metav1.ObjectMeta, error) {
+		return resourceVersion, items, nil
+	}
+}
+
+func itemMeta(item *metav1.ObjectMeta) *metav1.ObjectMeta {
+	return item
+}
+
+func pageNames(page []*metav1.ObjectMeta) []string {
+	names := make([]string, len(page))
+	for i, item := range page {
+		names[i] = item.Name
+	}
+	return names
+}
+
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPaginateSortsAndCutsThePages(t *testing.T) {
+	const path = "/apis/opencp.io/v1alpha1/namespaces/default/domains"
+	items := pageItems("c", "a", "e", "b", "d")
+
+	page, listMeta, err := Paginate(pageRequest("alice", path, url.Values{"limit": {"2"}}), testPageOptions, listOf("1", items), itemMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := pageNames(page); !equalNames(names, []string{"a", "b"}) {
+		t.Fatalf("the first page is %v", names)
+	}
+	if listMeta.Continue == "" || listMeta.RemainingItemCount == nil || *listMeta.RemainingItemCount != 3 {
+		t.Fatalf("the first page has the ListMeta %+v", listMeta)
+	}
+
+	page, listMeta, err = Paginate(pageRequest("alice", path, url.Values{"limit": {"3"}, "continue": {listMeta.Continue}}), testPageOptions, listOf("1", items), itemMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := pageNames(page); !equalNames(names, []string{"c", "d", "e"}) {
+		t.Fatalf("the last page is %v", names)
+	}
+	if listMeta.Continue != "" || listMeta.RemainingItemCount != nil {
+		t.Fatalf("the last page has the ListMeta %+v", listMeta)
+	}
+}
+
+func TestPaginateServesTheNextPagesFromTheFirstList(t *testing.T) {
+	const path = "/apis/opencp.io/v1alpha1/namespaces/default/ips"
+
+	_, listMeta, err := Paginate(pageRequest("alice", path, url.Values{"limit": {"2"}}), testPageOptions, listOf("1", pageItems("a", "b", "c", "d")), itemMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The collection changed since the first page, an object was removed and one was added, it is not read again
+	listed := false
+	changed := func() (string, []*metav1.ObjectMeta, error) {
+		listed = true
+		return "2", pageItems("a", "b", "d", "bb"), nil
+	}
+	page, listMeta, err := Paginate(pageRequest("alice", path, url.Values{"limit": {"2"}, "continue": {listMeta.Continue}}), testPageOptions, changed, itemMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed {
+		t.Fatal("the collection was listed again for the next page")
+	}
+	if names := pageNames(page); !equalNames(names, []string{"c", "d"}) {
+		t.Fatalf("the next page is %v, not the one of the first list", names)
+	}
+	if listMeta.ResourceVersion != "1" {
+		t.Fatalf("the next page has the resourceVersion %s, not the one of the first list", listMeta.ResourceVersion)
+	}
+}
+
+func TestPaginateRejectsTheTokensOfOthers(t *testing.T) {
+	const path = "/apis/opencp.io/v1alpha1/namespaces/default/sshkeys"
+	items := pageItems("a", "b", "c")
+
+	_, listMeta, err := Paginate(pageRequest("alice", path, url.Values{"limit": {"1"}}), testPageOptions, listOf("1", items), itemMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		request *restful.Request
+		opts    PageOptions
+		check   func(error) bool
+	}{
+		{
+			name:    "another caller",
+			request: pageRequest("bob", path, url.Values{"continue": {listMeta.Continue}}),
+			opts:    testPageOptions,
+			check:   apierrors.IsResourceExpired,
+		},
+		{
+			name:    "another collection",
+			request: pageRequest("alice", "/apis/opencp.io/v1alpha1/namespaces/default/domains", url.Values{"continue": {listMeta.Continue}}),
+			opts:    testPageOptions,
+			check:   apierrors.IsBadRequest,
+		},
+		{
+			name:    "a forged token",
+			request: pageRequest("alice", path, url.Values{"continue": {listMeta.Continue + "x"}}),
+			opts:    testPageOptions,
+			check:   apierrors.IsBadRequest,
+		},
+		{
+			name:    "an expired token",
+			request: pageRequest("alice", path, url.Values{"continue": {listMeta.Continue}}),
+			opts:    PageOptions{TokenTTL: -time.Second, SigningKey: testPageOptions.SigningKey},
+			check:   apierrors.IsResourceExpired,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := Paginate(test.request, test.opts, listOf("1", items), itemMeta)
+			if !test.check(err) {
+				t.Fatalf("got the error %v", err)
+			}
+		})
+	}
+}
+
+func TestPaginateRejectsAnInvalidLimit(t *testing.T) {
+	_, _, err := Paginate(pageRequest("alice", "/api/v1/namespaces", url.Values{"limit": {"-1"}}), testPageOptions, listOf("1", pageItems("a")), itemMeta)
+	if !apierrors.IsBadRequest(err) {
+		t.Fatalf("got the error %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"sync"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"google.golang.org/protobuf/proto"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authenticationv1alpha1 "k8s.io/api/authentication/v1alpha1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// MIME_PROTOBUF is the media type of the Kubernetes protobuf wire format
+const MIME_PROTOBUF = "application/vnd.kubernetes.protobuf"
+
+// protobufPrefix is the magic number at the start of every Kubernetes protobuf message
+var protobufPrefix = []byte{0x6b, 0x38, 0x73, 0x00}
+
+// ProtobufKind tells how to send a kind with no protobuf representation of its own
+// as the protobuf message of the backend, like the opencp.io v1alpha1 kinds
+type ProtobufKind struct {
+	// New returns an empty message of the backend
+	New func() proto.Message
+	// FromBackend converts a message of the backend to the object served, it is
+	// only needed for the kinds accepted in the body of the requests
+	FromBackend func(proto.Message) interface{}
+}
+
+var protobufKinds = struct {
+	sync.RWMutex
+	kinds map[schema.GroupVersionKind]ProtobufKind
+}{kinds: map[schema.GroupVersionKind]ProtobufKind{}}
+
+// protobufScheme has the Kubernetes kinds the requests can carry in protobuf
+var protobufScheme = runtime.NewScheme()
+
+func init() {
+	corev1.AddToScheme(protobufScheme)
+	authenticationv1.AddToScheme(protobufScheme)
+	authenticationv1alpha1.AddToScheme(protobufScheme)
+	authorizationv1.AddToScheme(protobufScheme)
+	rbacv1.AddToScheme(protobufScheme)
+	flowcontrolv1beta3.AddToScheme(protobufScheme)
+}
+
+// RegisterProtobufKind registers the backend message used to send a kind in protobuf
+func RegisterProtobufKind(gvk schema.GroupVersionKind, kind ProtobufKind) {
+	protobufKinds.Lock()
+	defer protobufKinds.Unlock()
+
+	protobufKinds.kinds[gvk] = kind
+}
+
+func protobufKind(gvk schema.GroupVersionKind) (ProtobufKind, bool) {
+	protobufKinds.RLock()
+	defer protobufKinds.RUnlock()
+
+	kind, ok := protobufKinds.kinds[gvk]
+	return kind, ok
+}
+
+// gogoMessage is implemented by the Kubernetes types, generated with gogo protobuf
+type gogoMessage interface {
+	Marshal() ([]byte, error)
+	Unmarshal([]byte) error
+}
+
+// asGogoMessage returns the object as a gogo message, taking its address when
+// the object is passed by value
+func asGogoMessage(obj interface{}) (gogoMessage, bool) {
+	if message, ok := obj.(gogoMessage); ok {
+		return message, true
+	}
+
+	value := reflect.ValueOf(obj)
+	if !value.IsValid() || value.Kind() == reflect.Pointer {
+		return nil, false
+	}
+	pointer := reflect.New(value.Type())
+	pointer.Elem().Set(value)
+	message, ok := pointer.Interface().(gogoMessage)
+	return message, ok
+}
+
+// protobufEncodable tells if the object, with the kind in its content, can be sent in protobuf
+func protobufEncodable(obj interface{}, content map[string]interface{}) bool {
+	if _, ok := asGogoMessage(obj); ok {
+		return true
+	}
+	_, ok := protobufKind(contentGroupVersionKind(content))
+	return ok
+}
+
+func contentGroupVersionKind(content map[string]interface{}) schema.GroupVersionKind {
+	apiVersion, _ := content["apiVersion"].(string)
+	kind, _ := content["kind"].(string)
+	return schema.FromAPIVersionAndKind(apiVersion, kind)
+}
+
+// EncodeProtobuf encodes an object in the Kubernetes protobuf envelope: the magic
+// prefix and a runtime.Unknown with the kind and the message of the object
+func EncodeProtobuf(obj interface{}) ([]byte, error) {
+	content, err := toMap(obj)
+	if err != nil {
+		return nil, err
+	}
+	gvk := contentGroupVersionKind(content)
+
+	var raw []byte
+	if message, ok := asGogoMessage(obj); ok {
+		raw, err = message.Marshal()
+	} else if kind, ok := protobufKind(gvk); ok {
+		message := kind.New()
+		if err := ConvertTo(obj, message); err != nil {
+			return nil, err
+		}
+		raw, err = proto.Marshal(message)
+	} else {
+		return nil, fmt.Errorf("%s has no protobuf representation", gvk)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	unknown := runtime.Unknown{
+		TypeMeta: runtime.TypeMeta{
+			APIVersion: gvk.GroupVersion().String(),
+			Kind:       gvk.Kind,
+		},
+		Raw: raw,
+	}
+	envelope, err := unknown.Marshal()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte{}, protobufPrefix...), envelope...), nil
+}
+
+// DecodeProtobuf decodes an object sent in the Kubernetes protobuf envelope and returns it as json
+func DecodeProtobuf(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, protobufPrefix) {
+		return nil, apierrors.NewBadRequest("the body is not a Kubernetes protobuf message")
+	}
+
+	unknown := runtime.Unknown{}
+	if err := unknown.Unmarshal(data[len(protobufPrefix):]); err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("error decoding the protobuf envelope: %v", err))
+	}
+	gvk := schema.FromAPIVersionAndKind(unknown.APIVersion, unknown.Kind)
+
+	var obj interface{}
+	if kind, ok := protobufKind(gvk); ok && kind.FromBackend != nil {
+		message := kind.New()
+		if err := proto.Unmarshal(unknown.Raw, message); err != nil {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("error decoding the %s: %v", gvk.Kind, err))
+		}
+		obj = kind.FromBackend(message)
+	} else if typed, err := protobufScheme.New(gvk); err == nil {
+		message, ok := typed.(gogoMessage)
+		if !ok {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("%s has no protobuf representation", gvk))
+		}
+		if err := message.Unmarshal(unknown.Raw); err != nil {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("error decoding the %s: %v", gvk.Kind, err))
+		}
+		typed.GetObjectKind().SetGroupVersionKind(gvk)
+		obj = typed
+	} else {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("%s can not be sent in protobuf", gvk))
+	}
+
+	return json.Marshal(obj)
+}
+
+// ReadBody reads the object in the body of the request, the objects sent in
+// protobuf are returned as json, so the handlers only deal with json or yaml
+func ReadBody(r *restful.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.HeaderParameter("Content-Type"))
+	if err != nil || mediaType != MIME_PROTOBUF {
+		return body, nil
+	}
+	return DecodeProtobuf(body)
+}
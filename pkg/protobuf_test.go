@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestProtobufRoundTripsTheKubernetesKinds(t *testing.T) {
+	role := rbacv1.Role{
+		TypeMeta:   metav1.TypeMeta{Kind: "Role", APIVersion: rbacv1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "reader"},
+		Rules:      []rbacv1.PolicyRule{{Verbs: []string{"get"}, APIGroups: []string{"opencp.io"}, Resources: []string{"virtualmachines"}}},
+	}
+
+	// The objects are encoded by value too, like the handlers write them
+	for _, obj := range []interface{}{&role, role} {
+		data, err := EncodeProtobuf(obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, protobufPrefix) {
+			t.Fatalf("the message does not start with the protobuf prefix: %x", data[:4])
+		}
+
+		decoded, err := DecodeProtobuf(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := rbacv1.Role{}
+		if err := json.Unmarshal(decoded, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Kind != "Role" || got.Name != "reader" || len(got.Rules) != 1 || got.Rules[0].Resources[0] != "virtualmachines" {
+			t.Fatalf("the role decoded is %+v", got)
+		}
+	}
+}
+
+func TestDecodeProtobufRejectsTheMessagesWithoutEnvelope(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"no prefix":    []byte(`{"kind":"Role"}`),
+		"bad envelope": append(append([]byte{}, protobufPrefix...), 0xff, 0xff),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := DecodeProtobuf(data); !apierrors.IsBadRequest(err) {
+				t.Fatalf("got the error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// LabelSelector parses the labelSelector of the request, an empty selector selects everything
+func LabelSelector(r *restful.Request) (labels.Selector, error) {
+	selector, err := labels.Parse(r.QueryParameter("labelSelector"))
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("unable to parse labelSelector: %v", err))
+	}
+	return selector, nil
+}
+
+// FilterLabels returns the items with labels matching the selector, the backend has no label
+// selector so the lists are always filtered in the shim
+func FilterLabels[T any](items []*T, selector labels.Selector, objectMeta func(*T) *metav1.ObjectMeta) []*T {
+	if selector == nil || selector.Empty() {
+		return items
+	}
+
+	filtered := []*T{}
+	for _, item := range items {
+		meta := objectMeta(item)
+		if meta != nil && selector.Matches(labels.Set(meta.Labels)) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// FieldSelector parses the fieldSelector of the request, only the selectable fields of the kind are supported
+func FieldSelector(r *restful.Request, selectableFields []string) (fields.Selector, error) {
+	selector, err := fields.ParseSelector(r.QueryParameter("fieldSelector"))
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("unable to parse fieldSelector: %v", err))
+	}
+
+	for _, requirement := range selector.Requirements() {
+		if !contains(selectableFields, requirement.Field) {
+			return nil, apierrors.NewBadRequest(fmt.Sprintf("field label not supported: %s", requirement.Field))
+		}
+	}
+	return selector, nil
+}
+
+// FilterFields returns the items with fields matching the selector, object returns
+// the representation of the item the fields are read from
+func FilterFields[T any](items []*T, selector fields.Selector, object func(*T) interface{}) []*T {
+	if selector == nil || selector.Empty() {
+		return items
+	}
+
+	filtered := []*T{}
+	for _, item := range items {
+		if MatchFields(object(item), selector) {
+			filtered = append(filtered, item)
+		}
+	}
+	return filtered
+}
+
+// MatchFields checks if the fields of the object match the selector
+func MatchFields(obj interface{}, selector fields.Selector) bool {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return false
+	}
+	content := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &content); err != nil {
+		return false
+	}
+
+	set := fields.Set{}
+	for _, requirement := range selector.Requirements() {
+		set[requirement.Field] = fieldValue(content, requirement.Field)
+	}
+	return selector.Matches(set)
+}
+
+// fieldValue returns the value of a field like status.state as a string, empty if it is not set
+func fieldValue(content map[string]interface{}, field string) string {
+	var value interface{} = content
+	for _, key := range strings.Split(field, ".") {
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = values[key]
+	}
+
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case map[string]interface{}, []interface{}:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
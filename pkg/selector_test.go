@@ -0,0 +1,102 @@
+package pkg
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func selectorRequest(query url.Values) *restful.Request {
+	return restful.NewRequest(httptest.NewRequest("GET", "/apis/opencp.io/v1alpha1/virtualmachines?"+query.Encode(), nil))
+}
+
+func TestFilterLabelsKeepsTheMatchingItems(t *testing.T) {
+	items := []*metav1.ObjectMeta{
+		{Name: "web", Labels: map[string]string{"app": "web", "tier": "front"}},
+		{Name: "db", Labels: map[string]string{"app": "db"}},
+		{Name: "none"},
+	}
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{selector: "", expected: []string{"web", "db", "none"}},
+		{selector: "app=web", expected: []string{"web"}},
+		{selector: "app!=web", expected: []string{"db", "none"}},
+		{selector: "app in (web,db),!tier", expected: []string{"db"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.selector, func(t *testing.T) {
+			selector, err := LabelSelector(selectorRequest(url.Values{"labelSelector": {test.selector}}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if names := pageNames(FilterLabels(items, selector, itemMeta)); !equalNames(names, test.expected) {
+				t.Fatalf("got the items %v, expected %v", names, test.expected)
+			}
+		})
+	}
+}
+
+func TestLabelSelectorRejectsAnInvalidSelector(t *testing.T) {
+	_, err := LabelSelector(selectorRequest(url.Values{"labelSelector": {"app in (web"}}))
+	if !apierrors.IsBadRequest(err) {
+		t.Fatalf("got the error %v", err)
+	}
+}
+
+type selectedObject struct {
+	Metadata metav1.ObjectMeta `json:"metadata"`
+	Status   struct {
+		State string `json:"state"`
+		Ready bool   `json:"ready"`
+	} `json:"status"`
+}
+
+func TestFilterFieldsMatchesTheNestedFields(t *testing.T) {
+	web := &selectedObject{Metadata: metav1.ObjectMeta{Name: "web"}}
+	web.Status.State, web.Status.Ready = "ACTIVE", true
+	db := &selectedObject{Metadata: metav1.ObjectMeta{Name: "db"}}
+	db.Status.State = "BUILDING"
+	items := []*selectedObject{web, db}
+	selectable := []string{"metadata.name", "status.state", "status.ready"}
+
+	tests := []struct {
+		selector string
+		expected []string
+	}{
+		{selector: "status.state=ACTIVE", expected: []string{"web"}},
+		{selector: "status.state!=ACTIVE", expected: []string{"db"}},
+		{selector: "status.ready=false,metadata.name=db", expected: []string{"db"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.selector, func(t *testing.T) {
+			selector, err := FieldSelector(selectorRequest(url.Values{"fieldSelector": {test.selector}}), selectable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			filtered := FilterFields(items, selector, func(item *selectedObject) interface{} { return item })
+			names := []string{}
+			for _, item := range filtered {
+				names = append(names, item.Metadata.Name)
+			}
+			if !equalNames(names, test.expected) {
+				t.Fatalf("got the items %v, expected %v", names, test.expected)
+			}
+		})
+	}
+}
+
+func TestFieldSelectorRejectsTheFieldsNotSelectable(t *testing.T) {
+	_, err := FieldSelector(selectorRequest(url.Values{"fieldSelector": {"spec.size=large"}}), []string{"metadata.name"})
+	if !apierrors.IsBadRequest(err) {
+		t.Fatalf("got the error %v", err)
+	}
+}
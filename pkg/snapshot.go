@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"container/list"
+	"sync"
+
+	restful "github.com/emicklei/go-restful/v3"
+)
+
+// snapshotCache keeps the states of the collections handed to the callers, so a watch or a paginated
+// list can go on from them. The states are kept per caller, as the backend answers every caller with
+// its own objects, and the cache is bounded by their size: the least recently used states are dropped
+// first, and a caller over its share of the cache only drops its own states
+type snapshotCache struct {
+	maxBytes       int64
+	maxCallerBytes int64
+
+	mu          sync.Mutex
+	lru         *list.List
+	entries     map[string]*list.Element
+	bytes       int64
+	callerBytes map[string]int64
+}
+
+type snapshotEntry struct {
+	key    string
+	caller string
+	value  interface{}
+	size   int64
+}
+
+func newSnapshotCache(maxBytes, maxCallerBytes int64) *snapshotCache {
+	return &snapshotCache{
+		maxBytes:       maxBytes,
+		maxCallerBytes: maxCallerBytes,
+		lru:            list.New(),
+		entries:        map[string]*list.Element{},
+		callerBytes:    map[string]int64{},
+	}
+}
+
+// add keeps the state of the caller, a state bigger than the share of a caller is not kept
+func (c *snapshotCache) add(caller, key string, value interface{}, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cacheKey := caller + "\x00" + key
+	if element, ok := c.entries[cacheKey]; ok {
+		c.remove(element)
+	}
+	if size > c.maxCallerBytes {
+		return
+	}
+
+	c.entries[cacheKey] = c.lru.PushFront(&snapshotEntry{key: cacheKey, caller: caller, value: value, size: size})
+	c.bytes += size
+	c.callerBytes[caller] += size
+
+	for element := c.lru.Back(); element != nil && c.callerBytes[caller] > c.maxCallerBytes; {
+		previous := element.Prev()
+		if element.Value.(*snapshotEntry).caller == caller {
+			c.remove(element)
+		}
+		element = previous
+	}
+	for c.bytes > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *snapshotCache) get(caller, key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[caller+"\x00"+key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*snapshotEntry).value, true
+}
+
+func (c *snapshotCache) remove(element *list.Element) {
+	entry := element.Value.(*snapshotEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	c.bytes -= entry.size
+	c.callerBytes[entry.caller] -= entry.size
+	if c.callerBytes[entry.caller] <= 0 {
+		delete(c.callerBytes, entry.caller)
+	}
+}
+
+// snapshotCaller identifies the caller of a request, the states are kept per caller
+func snapshotCaller(r *restful.Request) string {
+	return Caller(r.Request.Context())
+}
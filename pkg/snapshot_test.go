@@ -0,0 +1,94 @@
+package pkg
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+func TestSnapshotCacheIsPerCaller(t *testing.T) {
+	cache := newSnapshotCache(1000, 100)
+	cache.add("alice", "vms@1", "state of alice", 10)
+
+	if _, ok := cache.get("bob", "vms@1"); ok {
+		t.Fatal("bob got the state of alice")
+	}
+	value, ok := cache.get("alice", "vms@1")
+	if !ok || value != "state of alice" {
+		t.Fatalf("alice got %v, %v", value, ok)
+	}
+}
+
+func TestSnapshotCacheCallerOverItsShareOnlyDropsItsOwnStates(t *testing.T) {
+	cache := newSnapshotCache(1000, 100)
+	cache.add("bob", "vms@1", "state of bob", 60)
+	for i, key := range []string{"vms@1", "vms@2", "vms@3"} {
+		cache.add("alice", key, i, 40)
+	}
+
+	if _, ok := cache.get("bob", "vms@1"); !ok {
+		t.Fatal("the state of bob was dropped by the states of alice")
+	}
+	if _, ok := cache.get("alice", "vms@1"); ok {
+		t.Fatal("the oldest state of alice is kept over her share")
+	}
+	for _, key := range []string{"vms@2", "vms@3"} {
+		if _, ok := cache.get("alice", key); !ok {
+			t.Fatalf("the state %s of alice was dropped", key)
+		}
+	}
+}
+
+func TestSnapshotCacheDropsTheLeastRecentlyUsedStates(t *testing.T) {
+	cache := newSnapshotCache(100, 100)
+	cache.add("alice", "vms@1", 1, 40)
+	cache.add("bob", "vms@1", 2, 40)
+	// Reading the state of alice makes the one of bob the least recently used
+	cache.get("alice", "vms@1")
+	cache.add("carol", "vms@1", 3, 40)
+
+	if _, ok := cache.get("bob", "vms@1"); ok {
+		t.Fatal("the least recently used state is kept over the size of the cache")
+	}
+	if _, ok := cache.get("alice", "vms@1"); !ok {
+		t.Fatal("the recently used state was dropped")
+	}
+	if cache.bytes > cache.maxBytes {
+		t.Fatalf("the cache keeps %d bytes, over its %d bytes", cache.bytes, cache.maxBytes)
+	}
+}
+
+func TestSnapshotCacheDoesNotKeepStatesBiggerThanTheShareOfACaller(t *testing.T) {
+	cache := newSnapshotCache(1000, 100)
+	cache.add("alice", "vms@1", "small", 10)
+	cache.add("alice", "vms@1", "huge", 200)
+
+	if _, ok := cache.get("alice", "vms@1"); ok {
+		t.Fatal("a state bigger than the share of a caller is kept")
+	}
+	if cache.bytes != 0 {
+		t.Fatalf("the cache counts %d bytes for no state", cache.bytes)
+	}
+}
+
+func TestSnapshotCallerDependsOnTheUser(t *testing.T) {
+	callerOf := func(info user.Info) string {
+		req := httptest.NewRequest("GET", "/apis/opencp.io/v1alpha1/virtualmachines", nil)
+		req = req.WithContext(request.WithUser(req.Context(), info))
+		return snapshotCaller(restful.NewRequest(req))
+	}
+
+	alice := callerOf(&user.DefaultInfo{Name: "alice", Groups: []string{"a", "b"}})
+	if alice != callerOf(&user.DefaultInfo{Name: "alice", Groups: []string{"b", "a"}}) {
+		t.Fatal("the order of the groups changes the caller")
+	}
+	if alice == callerOf(&user.DefaultInfo{Name: "bob", Groups: []string{"a", "b"}}) {
+		t.Fatal("two users are the same caller")
+	}
+	if alice == callerOf(&user.DefaultInfo{Name: "alice", Groups: []string{"a"}}) {
+		t.Fatal("two sets of groups are the same caller")
+	}
+}
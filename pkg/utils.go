@@ -9,24 +9,19 @@ import (
 	// "log"
 	"math"
 	"net/http"
-	"strings"
 	"time"
 
 	restful "github.com/emicklei/go-restful/v3"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/endpoints/request"
-	"google.golang.org/grpc/status"
 )
 
-// CheckHeader to see if contains table
-func CheckHeader(request *restful.Request) bool {
-	getHeader := request.HeaderParameter("Accept")
-	return strings.Contains(getHeader, "Table")
-}
-
 func RespondNotFound(requestInfo *request.RequestInfo) metav1.Status {
 	notFound := metav1.Status{
 		TypeMeta: metav1.TypeMeta{
@@ -47,33 +42,67 @@ func RespondNotFound(requestInfo *request.RequestInfo) metav1.Status {
 	return notFound
 }
 
-func RespondError(requestInfo *request.RequestInfo, name, reason string, err error) metav1.Status {
-	var errMessage string
+// RespondGetError returns the status of an error of the backend getting an object, the objects
+// it does not have are not found like in the kube-apiserver, the other errors keep their code
+func RespondGetError(requestInfo *request.RequestInfo, err error) metav1.Status {
+	if status.Code(err) == codes.NotFound {
+		return RespondNotFound(requestInfo)
+	}
+	return RespondStatus(err)
+}
 
-	statusErr, ok := status.FromError(err)
-	if ok {
-		errMessage = statusErr.Message()
+// grpcCodes maps the gRPC codes from the backend to the http status and reason
+var grpcCodes = map[codes.Code]struct {
+	code   int32
+	reason metav1.StatusReason
+}{
+	codes.InvalidArgument:    {http.StatusBadRequest, metav1.StatusReasonBadRequest},
+	codes.FailedPrecondition: {http.StatusConflict, metav1.StatusReasonConflict},
+	codes.Aborted:            {http.StatusConflict, metav1.StatusReasonConflict},
+	codes.AlreadyExists:      {http.StatusConflict, metav1.StatusReasonAlreadyExists},
+	codes.NotFound:           {http.StatusNotFound, metav1.StatusReasonNotFound},
+	codes.PermissionDenied:   {http.StatusForbidden, metav1.StatusReasonForbidden},
+	codes.Unauthenticated:    {http.StatusUnauthorized, metav1.StatusReasonUnauthorized},
+	codes.Unimplemented:      {http.StatusMethodNotAllowed, metav1.StatusReasonMethodNotAllowed},
+	codes.ResourceExhausted:  {http.StatusTooManyRequests, metav1.StatusReasonTooManyRequests},
+	codes.Unavailable:        {http.StatusServiceUnavailable, metav1.StatusReasonServiceUnavailable},
+	codes.DeadlineExceeded:   {http.StatusGatewayTimeout, metav1.StatusReasonTimeout},
+}
+
+// RespondStatus converts an error to a status, api errors keep their status and
+// the gRPC errors from the backend are mapped to the matching http code
+func RespondStatus(err error) metav1.Status {
+	var respondStatus metav1.Status
+
+	if apiStatus, ok := err.(apierrors.APIStatus); ok {
+		respondStatus = apiStatus.Status()
 	} else {
-		errMessage = err.Error()
+		respondStatus = metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: errorMessage(err),
+			Reason:  metav1.StatusReasonInternalError,
+			Code:    http.StatusInternalServerError,
+		}
+		if grpcCode, ok := grpcCodes[status.Code(err)]; ok {
+			respondStatus.Code = grpcCode.code
+			respondStatus.Reason = grpcCode.reason
+		}
 	}
 
-	notFound := metav1.Status{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Status",
-			APIVersion: "v1",
-		},
-		Status:  string(metav1.StatusReasonInternalError),
-		Message: fmt.Sprintf("%s.%s \"%s\"", requestInfo.Resource, requestInfo.APIGroup, name),
-		Reason:  metav1.StatusReason(fmt.Sprintf("%s, %s", reason, errMessage)),
-		Details: &metav1.StatusDetails{
-			Name:  name,
-			Group: requestInfo.APIGroup,
-			Kind:  requestInfo.Resource,
-		},
-		Code: http.StatusInternalServerError,
+	respondStatus.TypeMeta = metav1.TypeMeta{
+		Kind:       "Status",
+		APIVersion: "v1",
 	}
+	return respondStatus
+}
 
-	return notFound
+// WriteStatus writes the status using its code as the http status
+func WriteStatus(w *restful.Response, respondStatus metav1.Status) {
+	code := int(respondStatus.Code)
+	if code == 0 {
+		code = http.StatusOK
+	}
+	w.WriteHeaderAndJson(code, respondStatus, restful.MIME_JSON)
 }
 
 // RequestInfoResolver is a function that returns a RequestInfo object
@@ -122,3 +151,23 @@ func CopyTo(src protoreflect.ProtoMessage, dst interface{}) error {
 
 	return nil
 }
+
+// ConvertTo is a helper function to copy any struct to another struct using the json marshal and unmarshal,
+// it is used to move objects between the v1alpha1 representation and the backend one
+func ConvertTo(src interface{}, dst interface{}) error {
+	exportable, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(exportable, dst)
+}
+
+// errorMessage returns the message of a gRPC error, or the error itself for any other error
+func errorMessage(err error) string {
+	statusErr, ok := status.FromError(err)
+	if ok {
+		return statusErr.Message()
+	}
+	return err.Error()
+}
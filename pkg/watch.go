@@ -0,0 +1,352 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	restful "github.com/emicklei/go-restful/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// defaultWatchTimeout is used when the client does not send timeoutSeconds
+const defaultWatchTimeout = 30 * time.Minute
+
+// The states of the collections kept to resume the watches from, in bytes, a caller only drops
+// its own states when it is over its share
+const (
+	maxWatchSnapshotBytes       = 64 << 20
+	maxCallerWatchSnapshotBytes = 16 << 20
+)
+
+// snapshotItemOverhead is the estimated size of an item of a state besides its key and object
+const snapshotItemOverhead = 64
+
+// WatchListFunc returns the current items of the collection being watched
+type WatchListFunc func(ctx context.Context) ([]metav1.Object, error)
+
+// WatchOptions configure how a collection is watched
+type WatchOptions struct {
+	// TypeMeta of the items, used for the bookmark events
+	TypeMeta metav1.TypeMeta
+	// PollInterval is how often the backend is listed to look for changes
+	PollInterval time.Duration
+	// BookmarkInterval is how often a bookmark is sent when the client allows it
+	BookmarkInterval time.Duration
+}
+
+// watchSnapshot is the state of a collection, by namespace/name of the object
+type watchSnapshot map[string]snapshotItem
+
+// snapshotItem is an object of a state, kept encoded so the size of the state is known
+type snapshotItem struct {
+	resourceVersion string
+	raw             json.RawMessage
+}
+
+var watchSnapshots = newSnapshotCache(maxWatchSnapshotBytes, maxCallerWatchSnapshotBytes)
+
+// addWatchSnapshot keeps a state of the collection of the request, for the caller of the request
+func addWatchSnapshot(caller, scope, resourceVersion string, snapshot watchSnapshot) {
+	watchSnapshots.add(caller, scope+"@"+resourceVersion, snapshot, snapshot.size())
+}
+
+func getWatchSnapshot(caller, scope, resourceVersion string) (watchSnapshot, bool) {
+	snapshot, ok := watchSnapshots.get(caller, scope+"@"+resourceVersion)
+	if !ok {
+		return nil, false
+	}
+	return snapshot.(watchSnapshot), true
+}
+
+func (s watchSnapshot) clone() watchSnapshot {
+	snapshot := make(watchSnapshot, len(s))
+	for key, item := range s {
+		snapshot[key] = item
+	}
+	return snapshot
+}
+
+// size is the size of the state, the encoded objects are shared with the other states
+// of the collection so it is an upper bound
+func (s watchSnapshot) size() int64 {
+	var size int64
+	for key, item := range s {
+		size += int64(len(key) + len(item.resourceVersion) + len(item.raw) + snapshotItemOverhead)
+	}
+	return size
+}
+
+// resourceVersion is the version of the whole collection, derived from the version of every object
+func (s watchSnapshot) resourceVersion() string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	hash := fnv.New64a()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s;", key, s[key].resourceVersion)
+	}
+	return strconv.FormatUint(hash.Sum64(), 10)
+}
+
+func newWatchSnapshot(items []metav1.Object) watchSnapshot {
+	snapshot := watchSnapshot{}
+	for _, item := range items {
+		EnsureResourceVersion(item)
+		raw, err := json.Marshal(item)
+		if err != nil {
+			continue
+		}
+		snapshot[objectKey(item)] = snapshotItem{resourceVersion: item.GetResourceVersion(), raw: raw}
+	}
+	return snapshot
+}
+
+func objectKey(obj metav1.Object) string {
+	return obj.GetNamespace() + "/" + obj.GetName()
+}
+
+// EnsureResourceVersion sets a resourceVersion on objects the backend did not version,
+// derived from the content of the object so it only changes when the object does
+func EnsureResourceVersion(obj metav1.Object) {
+	if obj.GetResourceVersion() != "" {
+		return
+	}
+
+	content, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	hash := fnv.New64a()
+	hash.Write(content)
+	obj.SetResourceVersion(strconv.FormatUint(hash.Sum64(), 10))
+}
+
+// ListResourceVersion returns the resourceVersion of a list and remembers its items,
+// so the client can start a watch from that list
+func ListResourceVersion(r *restful.Request, items []metav1.Object) string {
+	snapshot := newWatchSnapshot(items)
+	resourceVersion := snapshot.resourceVersion()
+	addWatchSnapshot(snapshotCaller(r), watchScope(r), resourceVersion, snapshot)
+	return resourceVersion
+}
+
+// IsWatch checks if the list request is asking for a watch
+func IsWatch(r *restful.Request) bool {
+	watch := r.QueryParameter("watch")
+	return watch == "true" || watch == "1"
+}
+
+// watchScope identifies the collection being listed or watched, so the resourceVersion
+// of one collection is never used to resume another one, the states are also kept per caller
+func watchScope(r *restful.Request) string {
+	return fmt.Sprintf("%s?fieldSelector=%s&labelSelector=%s", r.Request.URL.Path, r.QueryParameter("fieldSelector"), r.QueryParameter("labelSelector"))
+}
+
+func watchTimeout(r *restful.Request) time.Duration {
+	timeout, err := strconv.Atoi(r.QueryParameter("timeoutSeconds"))
+	if err != nil || timeout <= 0 {
+		return defaultWatchTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// Watch streams the changes of a collection as metav1.WatchEvent frames. The backend
+// has no streaming API, so the changes are found diffing successive lists of the
+// collection. Watches can be resumed from the resourceVersion of any list, event or bookmark
+// sent before, as long as it is still in the cache, otherwise a 410 Expired error event is sent
+func Watch(r *restful.Request, w *restful.Response, opts WatchOptions, list WatchListFunc) {
+	ctx, cancel := context.WithTimeout(r.Request.Context(), watchTimeout(r))
+	defer cancel()
+
+	caller, scope := snapshotCaller(r), watchScope(r)
+	known := watchSnapshot{}
+
+	resourceVersion := r.QueryParameter("resourceVersion")
+	if resourceVersion != "" && resourceVersion != "0" {
+		snapshot, ok := getWatchSnapshot(caller, scope, resourceVersion)
+		if !ok {
+			w.Header().Set("Content-Type", restful.MIME_JSON)
+			w.WriteHeader(http.StatusOK)
+			writeWatchStatus(w, metav1.Status{
+				TypeMeta: metav1.TypeMeta{
+					Kind:       "Status",
+					APIVersion: "v1",
+				},
+				Status:  metav1.StatusFailure,
+				Message: fmt.Sprintf("too old resource version: %s", resourceVersion),
+				Reason:  metav1.StatusReasonExpired,
+				Code:    http.StatusGone,
+			})
+			return
+		}
+		known = snapshot
+	}
+
+	w.Header().Set("Content-Type", restful.MIME_JSON)
+	w.WriteHeader(http.StatusOK)
+	w.Flush()
+
+	poll := time.NewTicker(opts.PollInterval)
+	defer poll.Stop()
+
+	var bookmarks <-chan time.Time
+	if r.QueryParameter("allowWatchBookmarks") == "true" && opts.BookmarkInterval > 0 {
+		bookmark := time.NewTicker(opts.BookmarkInterval)
+		defer bookmark.Stop()
+		bookmarks = bookmark.C
+	}
+
+	for {
+		items, err := list(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				writeWatchStatus(w, metav1.Status{
+					TypeMeta: metav1.TypeMeta{
+						Kind:       "Status",
+						APIVersion: "v1",
+					},
+					Status:  metav1.StatusFailure,
+					Message: fmt.Sprintf("error listing %s: %s", opts.TypeMeta.Kind, errorMessage(err)),
+					Reason:  metav1.StatusReasonInternalError,
+					Code:    http.StatusInternalServerError,
+				})
+			}
+			return
+		}
+
+		known, err = sendWatchChanges(w, caller, scope, known, newWatchSnapshot(items))
+		if err != nil {
+			return
+		}
+
+		// A bookmark is sent between two lists, the next list is done right after it
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+		case <-bookmarks:
+			bookmarkVersion := known.resourceVersion()
+			addWatchSnapshot(caller, scope, bookmarkVersion, known)
+
+			bookmark := &metav1.PartialObjectMetadata{
+				TypeMeta:   opts.TypeMeta,
+				ObjectMeta: metav1.ObjectMeta{ResourceVersion: bookmarkVersion},
+			}
+			if err := writeWatchEvent(w, watch.Bookmark, bookmark); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendWatchChanges sends the events needed to go from the known state to the current one,
+// remembering the state after every event so the watch can be resumed from any of them
+func sendWatchChanges(w *restful.Response, caller, scope string, known, current watchSnapshot) (watchSnapshot, error) {
+	keys := []string{}
+	for key := range known {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	for key := range current {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	state := known.clone()
+	for _, key := range keys {
+		before, existed := known[key]
+		after, exists := current[key]
+
+		var eventType watch.EventType
+		var obj interface{}
+		var objResourceVersion string
+		switch {
+		case !existed:
+			eventType, obj, objResourceVersion = watch.Added, after.raw, after.resourceVersion
+			state[key] = after
+		case !exists:
+			delete(state, key)
+			// the deleted object carries the version of the collection without it
+			objResourceVersion = state.resourceVersion()
+			deleted, err := withResourceVersion(before.raw, objResourceVersion)
+			if err != nil {
+				return known, err
+			}
+			eventType, obj = watch.Deleted, deleted
+		case before.resourceVersion != after.resourceVersion:
+			eventType, obj, objResourceVersion = watch.Modified, after.raw, after.resourceVersion
+			state[key] = after
+		default:
+			continue
+		}
+
+		addWatchSnapshot(caller, scope, objResourceVersion, state.clone())
+		if err := writeWatchEvent(w, eventType, obj); err != nil {
+			return known, err
+		}
+	}
+
+	return current, nil
+}
+
+// withResourceVersion returns a copy of the encoded object with another resourceVersion
+func withResourceVersion(raw json.RawMessage, resourceVersion string) (map[string]interface{}, error) {
+	copied := map[string]interface{}{}
+	if err := json.Unmarshal(raw, &copied); err != nil {
+		return nil, err
+	}
+
+	metadata, _ := copied["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+		copied["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = resourceVersion
+
+	return copied, nil
+}
+
+func writeWatchEvent(w *restful.Response, eventType watch.EventType, obj interface{}) error {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	event := metav1.WatchEvent{
+		Type:   string(eventType),
+		Object: runtime.RawExtension{Raw: raw},
+	}
+	if err := json.NewEncoder(w).Encode(event); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
+
+func writeWatchStatus(w *restful.Response, status metav1.Status) {
+	writeWatchEvent(w, watch.Error, status)
+}
+
+// ObjectList returns the items of a list as metav1.Object, pointing to the items themselves
+func ObjectList[T any, PT interface {
+	*T
+	metav1.Object
+}](items []T) []metav1.Object {
+	objects := make([]metav1.Object, len(items))
+	for i := range items {
+		objects[i] = PT(&items[i])
+	}
+	return objects
+}
@@ -2,7 +2,8 @@ package apis
 
 import (
 	restful "github.com/emicklei/go-restful/v3"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 )
 
 type ApisInterface interface {
@@ -17,27 +18,14 @@ func NewAPIGroupModel() *APIGroupModel {
 }
 
 func (a APIGroupModel) List(r *restful.Request, w *restful.Response) {
-	groupList := metav1.APIGroupList{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "APIGroupList",
-			APIVersion: "v1",
-		},
-		Groups: []metav1.APIGroup{
-			{
-				Name: "opencp.io",
-				Versions: []metav1.GroupVersionForDiscovery{
-					{
-						GroupVersion: "opencp.io/v1alpha1",
-						Version:      "v1alpha1",
-					},
-				},
-				PreferredVersion: metav1.GroupVersionForDiscovery{
-					GroupVersion: "opencp.io/v1alpha1",
-					Version:      "v1alpha1",
-				},
-			},
-		},
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	registry := discovery.Registry(app.Config)
+	if discovery.IsAggregated(r) {
+		discovery.Write(r, w, discovery.AggregatedDiscovery(registry, false))
+		return
 	}
 
-	w.WriteAsJson(groupList)
+	discovery.Write(r, w, discovery.APIGroupList(registry))
 }
@@ -0,0 +1,80 @@
+package authentication
+
+import (
+	"net/http"
+
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authenticationv1alpha1 "k8s.io/api/authentication/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type Authentication struct {
+	Review ReviewInterface
+}
+
+func NewAuthentication() *Authentication {
+	return &Authentication{
+		Review: NewReview(),
+	}
+}
+
+func (a Authentication) API() []*restful.WebService {
+	api := new(restful.WebService).Path("/apis/authentication.k8s.io/v1").Consumes(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF).Produces(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF)
+	api.Route(api.GET("").To(a.Review.ResourceList).
+		//Doc
+		Doc("get available resources").Operation("getAuthenticationV1APIResources").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"authentication_v1"}).
+		Writes(metav1.APIResourceList{}).
+		Returns(http.StatusOK, "OK", metav1.APIResourceList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	// SelfSubjectReview API, the object is the same in every version
+	api.Route(api.POST("/selfsubjectreviews").To(a.Review.SelfSubjectReview).
+		//Doc
+		Doc("create a SelfSubjectReview").Operation("createAuthenticationV1SelfSubjectReview").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"authentication_v1"}).
+		AddExtension("x-kubernetes-action", "post").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "authentication.k8s.io", Version: "v1", Kind: "SelfSubjectReview"}).
+		Reads(authenticationv1alpha1.SelfSubjectReview{}).
+		Writes(authenticationv1alpha1.SelfSubjectReview{}).
+		Returns(http.StatusCreated, "Created", authenticationv1alpha1.SelfSubjectReview{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	// TokenReview API
+	api.Route(api.POST("/tokenreviews").To(a.Review.TokenReview).
+		//Doc
+		Doc("create a TokenReview").Operation("createAuthenticationV1TokenReview").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"authentication_v1"}).
+		AddExtension("x-kubernetes-action", "post").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "authentication.k8s.io", Version: "v1", Kind: "TokenReview"}).
+		Reads(authenticationv1.TokenReview{}).
+		Writes(authenticationv1.TokenReview{}).
+		Returns(http.StatusCreated, "Created", authenticationv1.TokenReview{}).
+		Returns(http.StatusBadRequest, "BadRequest", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	// The SelfSubjectReview of the version kubectl auth whoami was introduced with
+	apiV1alpha1 := new(restful.WebService).Path("/apis/authentication.k8s.io/v1alpha1").Consumes(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF).Produces(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF)
+	apiV1alpha1.Route(apiV1alpha1.GET("").To(a.Review.ResourceList).
+		//Doc
+		Doc("get available resources").Operation("getAuthenticationV1alpha1APIResources").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"authentication_v1alpha1"}).
+		Writes(metav1.APIResourceList{}).
+		Returns(http.StatusOK, "OK", metav1.APIResourceList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	apiV1alpha1.Route(apiV1alpha1.POST("/selfsubjectreviews").To(a.Review.SelfSubjectReview).
+		//Doc
+		Doc("create a SelfSubjectReview").Operation("createAuthenticationV1alpha1SelfSubjectReview").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"authentication_v1alpha1"}).
+		AddExtension("x-kubernetes-action", "post").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "authentication.k8s.io", Version: "v1alpha1", Kind: "SelfSubjectReview"}).
+		Reads(authenticationv1alpha1.SelfSubjectReview{}).
+		Writes(authenticationv1alpha1.SelfSubjectReview{}).
+		Returns(http.StatusCreated, "Created", authenticationv1alpha1.SelfSubjectReview{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	return []*restful.WebService{api, apiV1alpha1}
+}
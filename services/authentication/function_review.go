@@ -0,0 +1,126 @@
+package authentication
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/authentication"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	"google.golang.org/grpc/status"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authenticationv1alpha1 "k8s.io/api/authentication/v1alpha1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apiserver/pkg/endpoints/request"
+)
+
+type ReviewInterface interface {
+	ResourceList(r *restful.Request, w *restful.Response)
+	SelfSubjectReview(r *restful.Request, w *restful.Response)
+	TokenReview(r *restful.Request, w *restful.Response)
+}
+
+type Review struct {
+}
+
+func NewReview() *Review {
+	return &Review{}
+}
+
+func (v Review) ResourceList(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	resourceList, _ := discovery.APIResourceList(discovery.Registry(app.Config), groupVersion(r))
+	discovery.Write(r, w, resourceList)
+}
+
+// SelfSubjectReview returns the identity of the caller, for kubectl auth whoami
+func (v Review) SelfSubjectReview(r *restful.Request, w *restful.Response) {
+	requestUser, ok := request.UserFrom(r.Request.Context())
+	if !ok {
+		pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewUnauthorized("the identity of the caller is not known")))
+		return
+	}
+
+	// The SelfSubjectReview is the same object in every version, only the apiVersion changes
+	review := &authenticationv1alpha1.SelfSubjectReview{}
+	if err := readReview(r, review); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	review.Status.UserInfo = authentication.UserInfo(requestUser)
+
+	review.TypeMeta = metav1.TypeMeta{Kind: "SelfSubjectReview", APIVersion: groupVersion(r).String()}
+	review.CreationTimestamp = metav1.Now()
+	pkg.WriteObject(r, w, http.StatusCreated, review)
+}
+
+// TokenReview tells if a token is valid for the backend and who it belongs to, so other
+// services can authenticate the opencp tokens through the shim. The tokens of the backend
+// are not bound to an audience, they are valid for the audiences asked for
+func (v Review) TokenReview(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	review := &authenticationv1.TokenReview{}
+	if err := readReview(r, review); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	if review.Spec.Token == "" {
+		pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewBadRequest("token must not be empty")))
+		return
+	}
+
+	review.Status = authenticationv1.TokenReviewStatus{}
+	tokenUser, validToken, err := app.TokenCache.Authenticate(r.Request.Context(), review.Spec.Token)
+	switch {
+	case err != nil:
+		s, _ := status.FromError(err)
+		review.Status.Error = s.Message()
+	case validToken:
+		review.Status.Authenticated = true
+		review.Status.User = authentication.UserInfo(tokenUser)
+		review.Status.Audiences = review.Spec.Audiences
+	}
+	// The token is not written back, so it does not end in the logs of the callers
+	review.Spec.Token = ""
+
+	review.TypeMeta = metav1.TypeMeta{Kind: "TokenReview", APIVersion: authenticationv1.SchemeGroupVersion.String()}
+	review.CreationTimestamp = metav1.Now()
+	pkg.WriteObject(r, w, http.StatusCreated, review)
+}
+
+// groupVersion returns the version of the authentication.k8s.io group in the path of the request
+func groupVersion(r *restful.Request) schema.GroupVersion {
+	parts := strings.Split(strings.Trim(r.Request.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		return authenticationv1.SchemeGroupVersion
+	}
+	return schema.GroupVersion{Group: discovery.AuthenticationGroup, Version: parts[2]}
+}
+
+// readReview reads the review in the body of the request, in json or yaml
+func readReview(r *restful.Request, review interface{}) error {
+	body, err := pkg.ReadBody(r)
+	if err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("the body could not be read: %v", err))
+	}
+
+	reviewJSON, err := yaml.ToJSON(body)
+	if err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("the body is not valid json or yaml: %v", err))
+	}
+	if err := json.Unmarshal(reviewJSON, review); err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("the body is not a valid review: %v", err))
+	}
+	return nil
+}
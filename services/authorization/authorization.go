@@ -0,0 +1,60 @@
+package authorization
+
+import (
+	"net/http"
+
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type Authorization struct {
+	Review ReviewInterface
+}
+
+func NewAuthorization() *Authorization {
+	return &Authorization{
+		Review: NewReview(),
+	}
+}
+
+func (a Authorization) API() []*restful.WebService {
+	api := new(restful.WebService).Path("/apis/authorization.k8s.io/v1").Consumes(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF).Produces(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF)
+	api.Route(api.GET("").To(a.Review.ResourceList).
+		//Doc
+		Doc("get available resources").Operation("getAuthorizationV1APIResources").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"authorization_v1"}).
+		Writes(metav1.APIResourceList{}).
+		Returns(http.StatusOK, "OK", metav1.APIResourceList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	// SelfSubjectAccessReview API
+	api.Route(api.POST("/selfsubjectaccessreviews").To(a.Review.AccessReview).
+		//Doc
+		Doc("create a SelfSubjectAccessReview").Operation("createAuthorizationV1SelfSubjectAccessReview").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"authorization_v1"}).
+		AddExtension("x-kubernetes-action", "post").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "authorization.k8s.io", Version: "v1", Kind: "SelfSubjectAccessReview"}).
+		Reads(authorizationv1.SelfSubjectAccessReview{}).
+		Writes(authorizationv1.SelfSubjectAccessReview{}).
+		Returns(http.StatusCreated, "Created", authorizationv1.SelfSubjectAccessReview{}).
+		Returns(http.StatusBadRequest, "BadRequest", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	// SelfSubjectRulesReview API
+	api.Route(api.POST("/selfsubjectrulesreviews").To(a.Review.RulesReview).
+		//Doc
+		Doc("create a SelfSubjectRulesReview").Operation("createAuthorizationV1SelfSubjectRulesReview").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"authorization_v1"}).
+		AddExtension("x-kubernetes-action", "post").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "authorization.k8s.io", Version: "v1", Kind: "SelfSubjectRulesReview"}).
+		Reads(authorizationv1.SelfSubjectRulesReview{}).
+		Writes(authorizationv1.SelfSubjectRulesReview{}).
+		Returns(http.StatusCreated, "Created", authorizationv1.SelfSubjectRulesReview{}).
+		Returns(http.StatusBadRequest, "BadRequest", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	return []*restful.WebService{api}
+}
@@ -0,0 +1,147 @@
+package authorization
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	restful "github.com/emicklei/go-restful/v3"
+	authz "github.com/opencontrolplane/opencp-shim/internal/authorization"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+)
+
+type ReviewInterface interface {
+	ResourceList(r *restful.Request, w *restful.Response)
+	AccessReview(r *restful.Request, w *restful.Response)
+	RulesReview(r *restful.Request, w *restful.Response)
+}
+
+type Review struct {
+}
+
+func NewReview() *Review {
+	return &Review{}
+}
+
+func (v Review) ResourceList(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	resourceList, _ := discovery.APIResourceList(discovery.Registry(app.Config), schema.GroupVersion{Group: discovery.AuthorizationGroup, Version: "v1"})
+	discovery.Write(r, w, resourceList)
+}
+
+// AccessReview tells the caller if the authorizer of the shim allows it to do an action
+func (v Review) AccessReview(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	review := &authorizationv1.SelfSubjectAccessReview{}
+	if err := readReview(r, review); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	resourceAttributes := review.Spec.ResourceAttributes
+	nonResourceAttributes := review.Spec.NonResourceAttributes
+	if (resourceAttributes == nil) == (nonResourceAttributes == nil) {
+		pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewBadRequest("exactly one of resourceAttributes or nonResourceAttributes must be set")))
+		return
+	}
+
+	attributes := authorizer.AttributesRecord{User: authz.User(r.Request.Context())}
+	if resourceAttributes != nil {
+		attributes.ResourceRequest = true
+		attributes.Verb = resourceAttributes.Verb
+		attributes.Namespace = resourceAttributes.Namespace
+		attributes.APIGroup = resourceAttributes.Group
+		attributes.APIVersion = resourceAttributes.Version
+		attributes.Resource = resourceAttributes.Resource
+		attributes.Subresource = resourceAttributes.Subresource
+		attributes.Name = resourceAttributes.Name
+	} else {
+		attributes.Path = nonResourceAttributes.Path
+		attributes.Verb = nonResourceAttributes.Verb
+	}
+
+	decision, reason, err := app.Authorizer.Authorize(authz.WithReview(r.Request.Context()), attributes)
+	review.Status = authorizationv1.SubjectAccessReviewStatus{
+		Allowed: decision == authorizer.DecisionAllow,
+		Denied:  decision == authorizer.DecisionDeny,
+		Reason:  reason,
+	}
+	if err != nil {
+		review.Status.EvaluationError = err.Error()
+	}
+
+	review.TypeMeta = metav1.TypeMeta{Kind: "SelfSubjectAccessReview", APIVersion: authorizationv1.SchemeGroupVersion.String()}
+	pkg.WriteObject(r, w, http.StatusCreated, review)
+}
+
+// RulesReview lists the actions the authorizer of the shim allows the caller to do in a namespace
+func (v Review) RulesReview(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	review := &authorizationv1.SelfSubjectRulesReview{}
+	if err := readReview(r, review); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	if review.Spec.Namespace == "" {
+		pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewBadRequest("no namespace on request")))
+		return
+	}
+
+	resourceRules, nonResourceRules, incomplete, err := app.Authorizer.RulesFor(authz.User(r.Request.Context()), review.Spec.Namespace)
+	review.Status = authorizationv1.SubjectRulesReviewStatus{
+		ResourceRules:    []authorizationv1.ResourceRule{},
+		NonResourceRules: []authorizationv1.NonResourceRule{},
+		Incomplete:       incomplete,
+	}
+	for _, rule := range resourceRules {
+		review.Status.ResourceRules = append(review.Status.ResourceRules, authorizationv1.ResourceRule{
+			Verbs:         rule.GetVerbs(),
+			APIGroups:     rule.GetAPIGroups(),
+			Resources:     rule.GetResources(),
+			ResourceNames: rule.GetResourceNames(),
+		})
+	}
+	for _, rule := range nonResourceRules {
+		review.Status.NonResourceRules = append(review.Status.NonResourceRules, authorizationv1.NonResourceRule{
+			Verbs:           rule.GetVerbs(),
+			NonResourceURLs: rule.GetNonResourceURLs(),
+		})
+	}
+	if err != nil {
+		review.Status.EvaluationError = err.Error()
+	}
+
+	review.TypeMeta = metav1.TypeMeta{Kind: "SelfSubjectRulesReview", APIVersion: authorizationv1.SchemeGroupVersion.String()}
+	pkg.WriteObject(r, w, http.StatusCreated, review)
+}
+
+// readReview reads the review in the body of the request, in json or yaml
+func readReview(r *restful.Request, review interface{}) error {
+	body, err := pkg.ReadBody(r)
+	if err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("the body could not be read: %v", err))
+	}
+
+	reviewJSON, err := yaml.ToJSON(body)
+	if err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("the body is not valid json or yaml: %v", err))
+	}
+	if err := json.Unmarshal(reviewJSON, review); err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("the body is not a valid review: %v", err))
+	}
+	return nil
+}
@@ -6,9 +6,10 @@ import (
 
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
 	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	"github.com/opencontrolplane/opencp-shim/pkg"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 var (
@@ -29,8 +30,8 @@ func NewCore() *Core {
 	}
 }
 
-func (c Core) API() []*restful.WebService {
-	api := new(restful.WebService).Path("/api").Consumes(restful.MIME_JSON, "application/yml").Produces(restful.MIME_JSON, "application/yml")
+func (c Core) API(registry []discovery.GroupVersion) []*restful.WebService {
+	api := new(restful.WebService).Path("/api").Consumes(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF).Produces(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF)
 	api.Route(api.GET("").To(c.APIServer.APIServer).
 		//Doc
 		Doc("Available API versions").
@@ -50,6 +51,7 @@ func (c Core) API() []*restful.WebService {
 	api.Route(api.GET("/v1/namespaces").To(c.Network.List).
 		//Doc
 		Doc("list or watch objects of kind Namespace").Operation("listNamespace").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}).
 		Writes(corev1.NamespaceList{}).
 		Returns(http.StatusOK, "OK", corev1.NamespaceList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -57,12 +59,14 @@ func (c Core) API() []*restful.WebService {
 		//Doc
 		Doc("Get a single Namespace").Operation("getNamespace").
 		Param(api.PathParameter("namespace", "name of the Namespace").DataType("string")).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}).
 		Writes(corev1.Namespace{}).
 		Returns(http.StatusOK, "OK", corev1.Namespace{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	api.Route(api.DELETE("/v1/namespaces/{namespace}").To(c.Network.Delete).
 		//Doc
 		Doc("Delete a single Namespace").Operation("deleteNamespace").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}).
 		Writes(corev1.Namespace{}).
 		Param(api.PathParameter("namespace", "name of the Namespace").DataType("string")).
 		Returns(http.StatusOK, "OK", corev1.Namespace{}).
@@ -70,15 +74,32 @@ func (c Core) API() []*restful.WebService {
 	api.Route(api.POST("/v1/namespaces").To(c.Network.Create).
 		//Doc
 		Doc("list or watch objects of kind Namespace").Operation("createNamespace").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Namespace"}).
 		Writes(corev1.Namespace{}).
 		Returns(http.StatusOK, "OK", corev1.Namespace{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 
 	// Events API
+	api.Route(api.GET("/v1/events").To(c.APIServer.Events).
+		//Doc
+		Doc("List or watch the events of all the namespaces").Operation("listEventsForAllNamespaces").
+		AddExtension("x-kubernetes-action", "list").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Event"}).
+		Param(api.QueryParameter("fieldSelector", "selector restricting the events by their fields, like involvedObject.name").DataType("string")).
+		Param(api.QueryParameter("labelSelector", "selector restricting the events by their labels").DataType("string")).
+		Param(api.QueryParameter("watch", "watch the changes of the events").DataType("boolean")).
+		Writes(corev1.EventList{}).
+		Returns(http.StatusOK, "OK", corev1.EventList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	api.Route(api.GET("/v1/namespaces/{namespace}/events").To(c.APIServer.Events).
 		//Doc
 		Doc("Get events for a object").Operation("listEventsForANamespaces").
 		Param(api.PathParameter("namespace", "name of the Namespace").DataType("string")).
+		AddExtension("x-kubernetes-action", "list").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Event"}).
+		Param(api.QueryParameter("fieldSelector", "selector restricting the events by their fields, like involvedObject.name").DataType("string")).
+		Param(api.QueryParameter("labelSelector", "selector restricting the events by their labels").DataType("string")).
+		Param(api.QueryParameter("watch", "watch the changes of the events").DataType("boolean")).
 		Writes(corev1.EventList{}).
 		Returns(http.StatusOK, "OK", corev1.EventList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -91,16 +112,19 @@ func (c Core) API() []*restful.WebService {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
 		Param(opencpAPI.PathParameter("secret", "the secret name").DataType("string")).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "k8s.io", Version: "v1", Kind: "Secret"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "", Version: "v1", Kind: "Secret"}).
 		Writes(corev1.Secret{}).
 		Returns(http.StatusOK, "OK", corev1.Secret{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 
+	// Status API
+	c.StatusHandler(api, registry)
+
 	return []*restful.WebService{api}
 }
 
 func (c Core) Version() []*restful.WebService {
-	version := new(restful.WebService).Path("/version").Consumes(restful.MIME_JSON, "application/yml").Produces(restful.MIME_JSON, "application/yml")
+	version := new(restful.WebService).Path("/version").Consumes(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF).Produces(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF)
 	version.Route(version.GET("").To(c.APIServer.Version))
 
 	return []*restful.WebService{version}
@@ -1,17 +1,21 @@
 package core
 
 import (
+	"context"
 	"log"
-	"strings"
+	"net/http"
 
 	goruntime "runtime"
 	"time"
 
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 	"github.com/opencontrolplane/opencp-shim/pkg"
 	// "github.com/civo/civogo"
 	restful "github.com/emicklei/go-restful/v3"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/version"
 )
 
@@ -42,7 +46,7 @@ func (a APIServer) Version(r *restful.Request, w *restful.Response) {
 		Platform:     "linux/amd64",
 	}
 
-	w.WriteAsJson(version)
+	pkg.WriteObject(r, w, http.StatusOK, version)
 }
 
 func (a APIServer) APIServer(r *restful.Request, w *restful.Response) {
@@ -56,6 +60,15 @@ func (a APIServer) APIServer(r *restful.Request, w *restful.Response) {
 
 	log.Println(apiRequestInfo)
 
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	// The aggregated discovery of the core group is served at /api too
+	if discovery.IsAggregated(r) {
+		discovery.Write(r, w, discovery.AggregatedDiscovery(discovery.Registry(app.Config), true))
+		return
+	}
+
 	apiVersion := metav1.APIVersions{
 		TypeMeta: metav1.TypeMeta{
 			Kind: "APIVersions",
@@ -69,53 +82,32 @@ func (a APIServer) APIServer(r *restful.Request, w *restful.Response) {
 		},
 	}
 
-	w.WriteAsJson(apiVersion)
+	discovery.Write(r, w, apiVersion)
 }
 
 func (a APIServer) ResourceList(r *restful.Request, w *restful.Response) {
-	resourceList := metav1.APIResourceList{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "APIResourceList",
-			APIVersion: "v1",
-		},
-		GroupVersion: "v1",
-		APIResources: []metav1.APIResource{
-			{
-				Kind:         "Namespace",
-				SingularName: "",
-				Name:         "namespaces",
-				Verbs:        []string{"create", "delete", "get", "list"},
-				Namespaced:   false,
-				ShortNames:   []string{"ns"},
-			},
-			{
-				Kind:         "Namespace",
-				SingularName: "",
-				Name:         "namespaces/status",
-				Verbs:        []string{"get"},
-				Namespaced:   false,
-			},
-			{
-				Kind:         "Secret",
-				SingularName: "",
-				Name:         "secrets",
-				// Verbs:        []string{"create", "delete", "get", "list"},
-				Verbs:      []string{"get"},
-				Namespaced: true,
-				ShortNames: []string{"secret"},
-			},
-			{
-				Kind:         "Secret",
-				SingularName: "",
-				Name:         "secrets/status",
-				Verbs:        []string{"get"},
-				Namespaced:   true,
-			},
-		},
-	}
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
 
-	// print the request method and path
-	w.WriteAsJson(resourceList)
+	resourceList, _ := discovery.APIResourceList(discovery.Registry(app.Config), schema.GroupVersion{Version: "v1"})
+	discovery.Write(r, w, resourceList)
+}
+
+// eventSelectableFields are the fields of the events supported in the fieldSelector, like in the kube-apiserver
+var eventSelectableFields = []string{
+	"metadata.name",
+	"metadata.namespace",
+	"involvedObject.kind",
+	"involvedObject.namespace",
+	"involvedObject.name",
+	"involvedObject.uid",
+	"involvedObject.apiVersion",
+	"involvedObject.resourceVersion",
+	"involvedObject.fieldPath",
+	"reason",
+	"reportingComponent",
+	"source",
+	"type",
 }
 
 func (a APIServer) Events(r *restful.Request, w *restful.Response) {
@@ -128,49 +120,75 @@ func (a APIServer) Events(r *restful.Request, w *restful.Response) {
 
 	log.Println(apiRequestInfo)
 
-	fileds := r.QueryParameter("fieldSelector")
-	allFileds := strings.Split(fileds, ",")
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	// The aggregated discovery of the core group is served at /api too
+	if discovery.IsAggregated(r) {
+		discovery.Write(r, w, discovery.AggregatedDiscovery(discovery.Registry(app.Config), true))
+		return
+	}
+
+	// Check the fields and labels used to filter the events
+	fieldSelector, err := pkg.FieldSelector(r, eventSelectableFields)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if pkg.IsWatch(r) {
+		opts := pkg.WatchOptions{
+			TypeMeta: metav1.TypeMeta{
+				Kind:       "Event",
+				APIVersion: "v1",
+			},
+			PollInterval:     app.Config.Watch.PollInterval,
+			BookmarkInterval: app.Config.Watch.BookmarkInterval,
+		}
+		pkg.Watch(r, w, opts, func(ctx context.Context) ([]metav1.Object, error) {
+			allEvent, err := listEvents(ctx, app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(allEvent), nil
+		})
+		return
+	}
 
-	allEvents := make(map[string]string)
-	for _, field := range allFileds {
-		fieldSplit := strings.Split(field, "=")
-		allEvents[fieldSplit[0]] = fieldSplit[1]
+	// Get the page asked with limit and continue, the events are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	eventItems, listMeta, err := paginate(r, app, func() (string, []*corev1.Event, error) {
+		allEvent, err := listEvents(r.Request.Context(), app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
+		if err != nil {
+			return "", nil, err
+		}
+		eventItems := make([]*corev1.Event, len(allEvent))
+		for i := range allEvent {
+			eventItems[i] = &allEvent[i]
+		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(allEvent)), eventItems, nil
+	}, func(event *corev1.Event) *metav1.ObjectMeta {
+		return &event.ObjectMeta
+	})
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	pageEvents := make([]corev1.Event, len(eventItems))
+	for i, event := range eventItems {
+		pageEvents[i] = *event
 	}
 
-	// actionFilter := &civogo.ActionListRequest{
-	// 	PerPage:   100,
-	// 	RelatedID: allEvents["involvedObject.uid"],
-	// 	Details:   "pvc-fd5f94d7-eb92-45b1-9951-17326ee50001",
-	// }
-	// allActions, err := client.ListActions(actionFilter)
-	// if err != nil {
-	// 	log.Println(err)
-	// }
-
-	// allEvent := make([]corev1.Event, len(allActions.Items))
-	// for i, action := range allActions.Items {
-	// 	allEvent[i] = corev1.Event{
-	// 		TypeMeta: metav1.TypeMeta{
-	// 			Kind:       "Event",
-	// 			APIVersion: "v1",
-	// 		},
-	// 		ObjectMeta: metav1.ObjectMeta{
-	// 			Name: apiRequestInfo.Resource,
-	// 		},
-	// 		Source: corev1.EventSource{
-	// 			Component: action.RelatedType,
-	// 		},
-	// 		Reason:  action.Type,
-	// 		Message: action.Details,
-	// 		FirstTimestamp: metav1.Time{
-	// 			Time: action.CreatedAt,
-	// 		},
-	// 		LastTimestamp: metav1.Time{
-	// 			Time: action.UpdatedAt,
-	// 		},
-	// 		Type: "Normal",
-	// 	}
-	// }
+	// If the Header `Accept` is set with Table
+	if pkg.CheckHeader(r) {
+		pkg.WriteObject(r, w, http.StatusOK, eventTable(pageEvents, listMeta))
+		return
+	}
 
 	// Build the Events response
 	eventRespond := &corev1.EventList{
@@ -178,14 +196,10 @@ func (a APIServer) Events(r *restful.Request, w *restful.Response) {
 			Kind:       "EventList",
 			APIVersion: "v1",
 		},
-		ListMeta: metav1.ListMeta{
-			SelfLink:        "/api/v1/events",
-			ResourceVersion: "1",
-		},
-		// Items: allEvent,
-		Items: []corev1.Event{},
+		ListMeta: listMeta,
+		Items:    pageEvents,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(eventRespond)
+	pkg.WriteObject(r, w, http.StatusOK, eventRespond)
 }
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/opencontrolplane/opencp-shim/internal/events"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// listEvents returns the events recorded by the shim, in the namespace or in all of them when it is
+// empty, filtered by the selectors. The backend keeps no events, so the actions made on the objects
+// without the shim, like in the console of the provider, have none
+func listEvents(ctx context.Context, app *setup.OpenCPApp, namespace string, fieldSelector fields.Selector, labelSelector labels.Selector) ([]corev1.Event, error) {
+	allEvent, err := events.List(ctx, app.Store, namespace, app.Config.Events.TTL)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := []corev1.Event{}
+	for _, event := range allEvent {
+		if !fieldSelector.Matches(eventFields(&event)) {
+			continue
+		}
+		if !labelSelector.Matches(labels.Set(event.Labels)) {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+	return filtered, nil
+}
+
+// eventFields returns the fields of an event supported in the fieldSelector, like in the kube-apiserver
+func eventFields(event *corev1.Event) fields.Set {
+	return fields.Set{
+		"metadata.name":                  event.Name,
+		"metadata.namespace":             event.Namespace,
+		"involvedObject.kind":            event.InvolvedObject.Kind,
+		"involvedObject.namespace":       event.InvolvedObject.Namespace,
+		"involvedObject.name":            event.InvolvedObject.Name,
+		"involvedObject.uid":             string(event.InvolvedObject.UID),
+		"involvedObject.apiVersion":      event.InvolvedObject.APIVersion,
+		"involvedObject.resourceVersion": event.InvolvedObject.ResourceVersion,
+		"involvedObject.fieldPath":       event.InvolvedObject.FieldPath,
+		"reason":                         event.Reason,
+		"reportingComponent":             event.ReportingController,
+		"source":                         event.Source.Component,
+		"type":                           event.Type,
+	}
+}
+
+// eventTable returns the events as the Table printed by kubectl get events
+func eventTable(allEvent []corev1.Event, listMeta metav1.ListMeta) metav1.Table {
+	tableRow := []metav1.TableRow{}
+	for i := range allEvent {
+		event := &allEvent[i]
+
+		lastSeen := "<unknown>"
+		if !event.LastTimestamp.IsZero() {
+			lastSeen = duration.HumanDuration(time.Since(event.LastTimestamp.Time))
+		}
+		object := strings.ToLower(event.InvolvedObject.Kind) + "/" + event.InvolvedObject.Name
+
+		tableRow = append(tableRow, metav1.TableRow{
+			Cells:  []interface{}{lastSeen, event.Type, event.Reason, object, strings.TrimSpace(event.Message)},
+			Object: pkg.RawObject(event),
+		})
+	}
+
+	return metav1.Table{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Table",
+			APIVersion: "meta.k8s.io/v1",
+		},
+		ListMeta: listMeta,
+		ColumnDefinitions: []metav1.TableColumnDefinition{
+			{Name: "Last Seen", Type: "string", Description: "Time since the event last happened"},
+			{Name: "Type", Type: "string", Description: "Type of the event, Normal or Warning"},
+			{Name: "Reason", Type: "string", Description: "Reason of the event"},
+			{Name: "Object", Type: "string", Description: "Object the event is about"},
+			{Name: "Message", Type: "string", Description: "Description of the event"},
+		},
+		Rows: tableRow,
+	}
+}
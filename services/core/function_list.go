@@ -0,0 +1,19 @@
+package core
+
+import (
+	restful "github.com/emicklei/go-restful/v3"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// paginate returns the page of a core list asked with limit and continue, and the ListMeta of the page.
+// The backend has no paging so the whole list is read for the first page and the pages are cut in the shim
+func paginate[T any](r *restful.Request, app *setup.OpenCPApp, list func() (string, []*T, error), objectMeta func(*T) *metav1.ObjectMeta) ([]*T, metav1.ListMeta, error) {
+	opts := pkg.PageOptions{
+		TokenTTL:   app.Config.Pagination.TokenTTL,
+		SigningKey: []byte(app.Config.Pagination.SigningKey),
+	}
+
+	return pkg.Paginate(r, opts, list, objectMeta)
+}
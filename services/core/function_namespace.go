@@ -3,7 +3,6 @@ package core
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 
@@ -14,7 +13,9 @@ import (
 	"github.com/opencontrolplane/opencp-shim/pkg"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
 )
 
 type NetworkInterface interface {
@@ -45,10 +46,38 @@ func (n Network) List(r *restful.Request, w *restful.Response) {
 
 	log.Printf("%+v", apiRequestInfo)
 
-	// Get all the networks
-	allNetwork, err := app.Namespace.ListNamespace(r.Request.Context(), &opencpspec.FilterOptions{})
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
 	if err != nil {
-		log.Println(err)
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	// Get the page asked with limit and continue, the networks are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	networkMetadata := func(network *opencpspec.Namespace) *metav1.ObjectMeta {
+		return network.Metadata
+	}
+	allNetwork := &opencpspec.NamespaceList{}
+	var listMeta metav1.ListMeta
+	allNetwork.Items, listMeta, err = paginate(r, app, func() (string, []*opencpspec.Namespace, error) {
+		list, err := app.Namespace.ListNamespace(r.Request.Context(), &opencpspec.FilterOptions{})
+		if err != nil {
+			log.Println(err)
+			return "", nil, err
+		}
+		list.Items = pkg.FilterLabels(list.Items, labelSelector, networkMetadata)
+
+		namespaces := make([]metav1.Object, len(list.Items))
+		for i, network := range list.Items {
+			namespace := namespaceFromBackend(network)
+			namespaces[i] = &namespace
+		}
+		return pkg.ListResourceVersion(r, namespaces), list.Items, nil
+	}, networkMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	// If the Header `Accept` is set with Table
@@ -64,6 +93,7 @@ func (n Network) List(r *restful.Request, w *restful.Response) {
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Name", Type: "string", Format: "name", Description: "Name of the instance"},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the instance (from metadata)"},
@@ -71,7 +101,7 @@ func (n Network) List(r *restful.Request, w *restful.Response) {
 			},
 			Rows: tableRow,
 		}
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -93,10 +123,11 @@ func (n Network) List(r *restful.Request, w *restful.Response) {
 			Kind:       "NamespaceList",
 			APIVersion: "v1",
 		},
-		Items: networks,
+		ListMeta: listMeta,
+		Items:    networks,
 	}
 	// print the request method and path
-	w.WriteAsJson(networkList)
+	pkg.WriteObject(r, w, http.StatusOK, networkList)
 }
 
 func (n Network) Get(r *restful.Request, w *restful.Response) {
@@ -113,6 +144,8 @@ func (n Network) Get(r *restful.Request, w *restful.Response) {
 	network, err := app.Namespace.GetNamespace(r.Request.Context(), &opencpspec.FilterOptions{Name: &apiRequestInfo.Name})
 	if err != nil {
 		log.Println(err)
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
+		return
 	}
 
 	if network == nil {
@@ -132,9 +165,7 @@ func (n Network) Get(r *restful.Request, w *restful.Response) {
 			},
 		}
 
-		// print the request method and path
-		w.ResponseWriter.WriteHeader(http.StatusNotFound)
-		w.WriteAsJson(respondStatus)
+		pkg.WriteStatus(w, respondStatus)
 		return
 	}
 
@@ -156,26 +187,20 @@ func (n Network) Get(r *restful.Request, w *restful.Response) {
 			},
 			Rows: tableRow,
 		}
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	if network != nil {
-		networkRespond := corev1.Namespace{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Namespace",
-				APIVersion: "v1",
-			},
-			ObjectMeta: *network.Metadata,
-			Spec:       *network.Spec,
-			Status:     *network.Status,
-		}
-		w.WriteAsJson(networkRespond)
-		return
+	networkRespond := corev1.Namespace{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Namespace",
+			APIVersion: "v1",
+		},
+		ObjectMeta: *network.Metadata,
+		Spec:       *network.Spec,
+		Status:     *network.Status,
 	}
-
-	// print the request method and path
-	w.WriteAsJson(apiRequestInfo)
+	pkg.WriteObject(r, w, http.StatusOK, networkRespond)
 }
 
 func (n Network) Delete(r *restful.Request, w *restful.Response) {
@@ -188,46 +213,82 @@ func (n Network) Delete(r *restful.Request, w *restful.Response) {
 		log.Println(err)
 	}
 
+	options, err := pkg.DeleteOptions(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
 	// Get the network
 	network, err := app.Namespace.GetNamespace(r.Request.Context(), &opencpspec.FilterOptions{Name: &apiRequestInfo.Name})
 	if err != nil {
 		log.Println(err)
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
+		return
+	}
+	if network == nil || network.Metadata == nil {
+		pkg.WriteStatus(w, pkg.RespondNotFound(apiRequestInfo))
+		return
 	}
 
-	// Delete the network
-	uuidNetwork := string(network.Metadata.UID)
-	_, err = app.Namespace.DeleteNamespace(r.Request.Context(), &opencpspec.FilterOptions{Id: &uuidNetwork})
-	if err != nil {
-		log.Println(err)
+	if err := pkg.CheckPreconditions(options, network.Metadata, corev1.Resource("namespaces")); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	networkRespond := corev1.Namespace{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Namespace",
-			APIVersion: "v1",
-		},
-		ObjectMeta: *network.Metadata,
-		Spec:       *network.Spec,
-		Status:     *network.Status,
+	// Delete the network, a dry run only checks the network exists
+	if len(options.DryRun) == 0 {
+		uuidNetwork := string(network.Metadata.UID)
+		_, err = app.Namespace.DeleteNamespace(r.Request.Context(), &opencpspec.FilterOptions{Id: &uuidNetwork})
+		if err != nil {
+			log.Println(err)
+			pkg.WriteStatus(w, pkg.RespondStatus(err))
+			return
+		}
+
+		// The network is terminating while the backend still has it
+		current, err := app.Namespace.GetNamespace(r.Request.Context(), &opencpspec.FilterOptions{Name: &apiRequestInfo.Name})
+		if err == nil && current != nil && current.Metadata != nil {
+			namespace := namespaceFromBackend(current)
+			pkg.Terminating(&namespace.ObjectMeta)
+			namespace.Status.Phase = corev1.NamespaceTerminating
+			pkg.WriteObject(r, w, http.StatusAccepted, namespace)
+			return
+		}
 	}
 
 	// print the request method and path
-	w.WriteAsJson(networkRespond)
+	pkg.WriteObject(r, w, http.StatusOK, namespaceFromBackend(network))
 }
 
 func (n Network) Create(r *restful.Request, w *restful.Response) {
 	// Get the app config
 	app := r.Attribute("app").(*setup.OpenCPApp)
 
-	body, err := io.ReadAll(r.Request.Body)
+	dryRun, err := pkg.DryRun(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	body, err := pkg.ReadBody(r)
 	if err != nil {
 		log.Printf("Error reading body: %v", err)
 	}
 
 	namespace := &opencpspec.Namespace{}
 	err = json.Unmarshal(body, &namespace)
-	if err != nil {
-		log.Fatalf("error: %v", err)
+	if err != nil || namespace.Metadata == nil || namespace.Metadata.Name == "" {
+		pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewBadRequest(fmt.Sprintf("the body is not a valid Namespace: %v", err))))
+		return
+	}
+
+	// A dry run returns the network as it would be created, without creating it
+	if dryRun {
+		namespace.Metadata.UID = uuid.NewUUID()
+		namespace.Metadata.CreationTimestamp = metav1.Now()
+		pkg.WriteObject(r, w, http.StatusCreated, namespaceFromBackend(namespace))
+		return
 	}
 
 	// Create the network
@@ -235,17 +296,29 @@ func (n Network) Create(r *restful.Request, w *restful.Response) {
 	if err != nil {
 		log.Println(err)
 	}
+	if network == nil || network.Metadata == nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
 
-	networkRespond := corev1.Namespace{
+	// print the request method and path
+	pkg.WriteObject(r, w, http.StatusOK, namespaceFromBackend(network))
+}
+
+// namespaceFromBackend converts the backend network to a Namespace
+func namespaceFromBackend(network *opencpspec.Namespace) corev1.Namespace {
+	namespace := corev1.Namespace{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Namespace",
 			APIVersion: "v1",
 		},
 		ObjectMeta: *network.Metadata,
-		Spec:       *network.Spec,
-		Status:     *network.Status,
 	}
-
-	// print the request method and path
-	w.WriteAsJson(networkRespond)
+	if network.Spec != nil {
+		namespace.Spec = *network.Spec
+	}
+	if network.Status != nil {
+		namespace.Status = *network.Status
+	}
+	return namespace
 }
@@ -37,7 +37,7 @@ func (s *Secret) Get(r *restful.Request, w *restful.Response) {
 	cluster, err := app.KubernetesCluster.GetKubernetesCluster(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name, Namespace: &apiRequestInfo.Namespace})
 	if err != nil {
 		log.Println(err)
-		w.WriteAsJson(pkg.RespondNotFound(apiRequestInfo))
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
 		return
 	}
 
@@ -60,9 +60,7 @@ func (s *Secret) Get(r *restful.Request, w *restful.Response) {
 	}
 
 	if coreSecret.Name == "" {
-		respondStatus := pkg.RespondNotFound(apiRequestInfo)
-		w.ResponseWriter.WriteHeader(http.StatusNotFound)
-		w.WriteAsJson(respondStatus)
+		pkg.WriteStatus(w, pkg.RespondNotFound(apiRequestInfo))
 		return
 	}
 
@@ -86,10 +84,10 @@ func (s *Secret) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
 	// print the request method and path
-	w.WriteAsJson(coreSecret)
+	pkg.WriteObject(r, w, http.StatusOK, coreSecret)
 }
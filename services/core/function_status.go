@@ -0,0 +1,68 @@
+package core
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// statusSubresource is the subresource of the status of the objects
+const statusSubresource = "status"
+
+// statusHandlers are the handlers serving the status subresource of a core resource
+type statusHandlers struct {
+	get restful.RouteFunction
+	// object is the core/v1 object written in the OpenAPI spec
+	object interface{}
+}
+
+// StatusHandler registers the routes of the status subresources of the core group advertised in the discovery,
+// the backend keeps the status of the namespaces and secrets so they are only read
+func (c Core) StatusHandler(api *restful.WebService, registry []discovery.GroupVersion) {
+	handlers := map[string]statusHandlers{
+		"namespaces": {c.Network.Get, corev1.Namespace{}},
+		"secrets":    {c.Secret.Get, corev1.Secret{}},
+	}
+
+	for _, apiResource := range discovery.Subresources(registry, schema.GroupVersion{Version: "v1"}, statusSubresource) {
+		resourceName := strings.TrimSuffix(apiResource.Name, "/"+statusSubresource)
+		handler, ok := handlers[resourceName]
+		if !ok {
+			log.Printf("no status handlers for the resource %s", resourceName)
+			continue
+		}
+
+		path := "/" + resourceName + "/{name}/" + statusSubresource
+		if apiResource.Namespaced {
+			path = "/namespaces/{namespace}" + path
+		}
+		path = "/v1" + path
+
+		for _, verb := range apiResource.Verbs {
+			if verb != "get" {
+				continue
+			}
+
+			route := api.GET(path).To(handler.get).
+				Doc("Read the status of a "+apiResource.Kind).Operation("readCore"+apiResource.Kind+"Status").
+				Metadata(restfulspec.KeyOpenAPITags, []string{"core"}).
+				AddExtension("x-kubernetes-action", "get").
+				AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "", Version: "v1", Kind: apiResource.Kind})
+			if apiResource.Namespaced {
+				route.Param(api.PathParameter("namespace", "namespace of the "+apiResource.Kind).DataType("string"))
+			}
+			api.Route(route.
+				Param(api.PathParameter("name", "name of the "+apiResource.Kind).DataType("string")).
+				Writes(handler.object).
+				Returns(http.StatusOK, "OK", handler.object).
+				Returns(http.StatusUnauthorized, "Unauthorized", nil))
+		}
+	}
+}
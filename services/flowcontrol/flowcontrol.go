@@ -0,0 +1,81 @@
+package flowcontrol
+
+import (
+	"net/http"
+
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type FlowControl struct {
+	Objects ObjectsInterface
+}
+
+func NewFlowControl() *FlowControl {
+	return &FlowControl{
+		Objects: NewObjects(),
+	}
+}
+
+func (a FlowControl) API() []*restful.WebService {
+	api := new(restful.WebService).Path("/apis/flowcontrol.apiserver.k8s.io/v1beta3").Consumes(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF).Produces(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF)
+	tags := []string{"flowcontrolApiserver_v1beta3"}
+	api.Route(api.GET("").To(a.Objects.ResourceList).
+		//Doc
+		Doc("get available resources").Operation("getFlowcontrolApiserverV1beta3APIResources").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		Writes(metav1.APIResourceList{}).
+		Returns(http.StatusOK, "OK", metav1.APIResourceList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	// FlowSchema API
+	flowSchemaGVK := metav1.GroupVersionKind{Group: flowcontrolv1beta3.GroupName, Version: "v1beta3", Kind: "FlowSchema"}
+	api.Route(api.GET("/flowschemas").To(a.Objects.ListFlowSchemas).
+		//Doc
+		Doc("list objects of kind FlowSchema").Operation("listFlowcontrolApiserverV1beta3FlowSchema").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "list").
+		AddExtension("x-kubernetes-group-version-kind", flowSchemaGVK).
+		Writes(flowcontrolv1beta3.FlowSchemaList{}).
+		Returns(http.StatusOK, "OK", flowcontrolv1beta3.FlowSchemaList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	api.Route(api.GET("/flowschemas/{name}").To(a.Objects.GetFlowSchema).
+		//Doc
+		Doc("read the specified FlowSchema").Operation("readFlowcontrolApiserverV1beta3FlowSchema").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "get").
+		AddExtension("x-kubernetes-group-version-kind", flowSchemaGVK).
+		Param(api.PathParameter("name", "name of the FlowSchema").DataType("string")).
+		Writes(flowcontrolv1beta3.FlowSchema{}).
+		Returns(http.StatusOK, "OK", flowcontrolv1beta3.FlowSchema{}).
+		Returns(http.StatusNotFound, "NotFound", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	// PriorityLevelConfiguration API
+	priorityLevelGVK := metav1.GroupVersionKind{Group: flowcontrolv1beta3.GroupName, Version: "v1beta3", Kind: "PriorityLevelConfiguration"}
+	api.Route(api.GET("/prioritylevelconfigurations").To(a.Objects.ListPriorityLevels).
+		//Doc
+		Doc("list objects of kind PriorityLevelConfiguration").Operation("listFlowcontrolApiserverV1beta3PriorityLevelConfiguration").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "list").
+		AddExtension("x-kubernetes-group-version-kind", priorityLevelGVK).
+		Writes(flowcontrolv1beta3.PriorityLevelConfigurationList{}).
+		Returns(http.StatusOK, "OK", flowcontrolv1beta3.PriorityLevelConfigurationList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	api.Route(api.GET("/prioritylevelconfigurations/{name}").To(a.Objects.GetPriorityLevel).
+		//Doc
+		Doc("read the specified PriorityLevelConfiguration").Operation("readFlowcontrolApiserverV1beta3PriorityLevelConfiguration").
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "get").
+		AddExtension("x-kubernetes-group-version-kind", priorityLevelGVK).
+		Param(api.PathParameter("name", "name of the PriorityLevelConfiguration").DataType("string")).
+		Writes(flowcontrolv1beta3.PriorityLevelConfiguration{}).
+		Returns(http.StatusOK, "OK", flowcontrolv1beta3.PriorityLevelConfiguration{}).
+		Returns(http.StatusNotFound, "NotFound", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	return []*restful.WebService{api}
+}
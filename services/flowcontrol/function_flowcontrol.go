@@ -0,0 +1,98 @@
+package flowcontrol
+
+import (
+	"net/http"
+
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	flowcontrolv1beta3 "k8s.io/api/flowcontrol/v1beta3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type ObjectsInterface interface {
+	ResourceList(r *restful.Request, w *restful.Response)
+	ListFlowSchemas(r *restful.Request, w *restful.Response)
+	GetFlowSchema(r *restful.Request, w *restful.Response)
+	ListPriorityLevels(r *restful.Request, w *restful.Response)
+	GetPriorityLevel(r *restful.Request, w *restful.Response)
+}
+
+// Objects serves the flow schemas and priority levels of the config, they are read only
+type Objects struct {
+}
+
+func NewObjects() *Objects {
+	return &Objects{}
+}
+
+func (o Objects) ResourceList(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	resourceList, _ := discovery.APIResourceList(discovery.Registry(app.Config), schema.GroupVersion{Group: discovery.FlowControlGroup, Version: "v1beta3"})
+	discovery.Write(r, w, resourceList)
+}
+
+// ListFlowSchemas returns the flow schemas, in the order they are matched
+func (o Objects) ListFlowSchemas(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	list := &flowcontrolv1beta3.FlowSchemaList{
+		TypeMeta: metav1.TypeMeta{Kind: "FlowSchemaList", APIVersion: flowcontrolv1beta3.SchemeGroupVersion.String()},
+		ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+		Items:    app.FlowControl.FlowSchemas(),
+	}
+	pkg.WriteObject(r, w, http.StatusOK, list)
+}
+
+// GetFlowSchema returns the flow schema of the request
+func (o Objects) GetFlowSchema(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	name := r.PathParameter("name")
+
+	for _, schema := range app.FlowControl.FlowSchemas() {
+		if schema.Name == name {
+			pkg.WriteObject(r, w, http.StatusOK, &schema)
+			return
+		}
+	}
+	pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewNotFound(groupResource("flowschemas"), name)))
+}
+
+// ListPriorityLevels returns the priority levels
+func (o Objects) ListPriorityLevels(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	list := &flowcontrolv1beta3.PriorityLevelConfigurationList{
+		TypeMeta: metav1.TypeMeta{Kind: "PriorityLevelConfigurationList", APIVersion: flowcontrolv1beta3.SchemeGroupVersion.String()},
+		ListMeta: metav1.ListMeta{ResourceVersion: "1"},
+		Items:    app.FlowControl.PriorityLevels(),
+	}
+	pkg.WriteObject(r, w, http.StatusOK, list)
+}
+
+// GetPriorityLevel returns the priority level of the request
+func (o Objects) GetPriorityLevel(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	name := r.PathParameter("name")
+
+	for _, level := range app.FlowControl.PriorityLevels() {
+		if level.Name == name {
+			pkg.WriteObject(r, w, http.StatusOK, &level)
+			return
+		}
+	}
+	pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewNotFound(groupResource("prioritylevelconfigurations"), name)))
+}
+
+func groupResource(resource string) schema.GroupResource {
+	return schema.GroupResource{Group: flowcontrolv1beta3.GroupName, Resource: resource}
+}
@@ -2,35 +2,25 @@ package opencp
 
 import (
 	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 func (c *OpenCP) apiResourceListv1alpha1(r *restful.Request, w *restful.Response) {
 	// Get the app config
 	app := r.Attribute("app").(*setup.OpenCPApp)
 
-	APIResourcesList := []metav1.APIResource{}
-	for _, resource := range app.Config.ApiResource {
-		APIResourcesList = append(APIResourcesList, metav1.APIResource{
-			Kind:         resource.Kind,
-			SingularName: resource.SingularName,
-			Name:         resource.Name,
-			Version:      resource.Version,
-			Verbs:        resource.Verbs,
-			Namespaced:   resource.Namespaced,
-			ShortNames:   resource.ShortNames,
-		})
-	}
+	resourceList, _ := discovery.APIResourceList(discovery.Registry(app.Config), schema.GroupVersion{Group: "opencp.io", Version: "v1alpha1"})
+	discovery.Write(r, w, resourceList)
+}
 
-	resourceList := metav1.APIResourceList{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "APIResourceList",
-			APIVersion: "v1",
-		},
-		GroupVersion: "opencp.io/v1alpha1",
-		APIResources: APIResourcesList,
+// selectableFields returns the fields of a resource supported in the fieldSelector
+func selectableFields(app *setup.OpenCPApp, resourceName string) []string {
+	for _, resource := range app.Config.ApiResource {
+		if resource.Name == resourceName {
+			return resource.SelectableFields
+		}
 	}
-
-	w.WriteAsJson(resourceList)
+	return nil
 }
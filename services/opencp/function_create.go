@@ -0,0 +1,89 @@
+package opencp
+
+import (
+	"log"
+	"net/http"
+
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apiserver/pkg/storage/names"
+)
+
+// createResource creates a opencp.io object from the one in the body, the name is generated
+// from metadata.generateName when the object has no name
+func createResource[T any](r *restful.Request, w *restful.Response, res *resource[T]) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	ctx := r.Request.Context()
+
+	resolver := pkg.RequestInfoResolver()
+	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
+	if err != nil {
+		log.Println(err)
+	}
+
+	dryRun, err := pkg.DryRun(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	obj, err := decodeObject(r, res, apiRequestInfo.Namespace, "")
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	// Default the name and namespace of the object
+	if obj.GetName() == "" && obj.GetGenerateName() != "" {
+		obj.SetName(names.SimpleNameGenerator.GenerateName(obj.GetGenerateName()))
+	}
+	if res.namespaced && obj.GetNamespace() == "" {
+		obj.SetNamespace(apiRequestInfo.Namespace)
+	}
+	if obj.GetName() == "" {
+		pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewInvalid(res.groupVersionKind().GroupKind(), "", field.ErrorList{field.Required(field.NewPath("metadata", "name"), "name or generateName is required")})))
+		return
+	}
+
+	// The object has to be a valid v1alpha1 object
+	if err := validateObject(res, obj); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	// Keep track of the fields set by the manager creating the object
+	empty := &unstructured.Unstructured{}
+	empty.SetGroupVersionKind(res.groupVersionKind())
+
+	fieldManagerTracker, err := pkg.NewFieldManager(res.groupVersionKind(), "")
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	created, err := fieldManagerTracker.Update(empty, obj, fieldManagerName(r))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	createdObj := created.(*unstructured.Unstructured)
+	createdManagedFields := createdObj.GetManagedFields()
+	createdObj.SetManagedFields(nil)
+
+	result, err := res.createObject(ctx, app, createdObj, dryRun)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	result.SetManagedFields(createdManagedFields)
+
+	pkg.WriteObject(r, w, http.StatusCreated, result)
+}
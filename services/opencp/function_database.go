@@ -1,11 +1,10 @@
 package opencp
 
 import (
-	"encoding/json"
+	"context"
 	// "errors"
-	"io"
 	"log"
-	"strings"
+	"net/http"
 
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 	"github.com/opencontrolplane/opencp-shim/pkg"
@@ -14,7 +13,8 @@ import (
 
 	restful "github.com/emicklei/go-restful/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	// "k8s.io/apimachinery/pkg/types"
 )
 
@@ -22,7 +22,7 @@ type DatabaseInterface interface {
 	List(r *restful.Request, w *restful.Response)
 	Get(r *restful.Request, w *restful.Response)
 	Create(r *restful.Request, w *restful.Response)
-	// Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
 	Delete(r *restful.Request, w *restful.Response)
 }
 
@@ -44,51 +44,53 @@ func (d *Database) List(r *restful.Request, w *restful.Response) {
 		log.Println(err)
 	}
 
-	// Check if we need filter the list
-	fileds := r.QueryParameter("fieldSelector")
-	allFields := make(map[string]string)
-	if fileds != "" {
-		filedsList := strings.Split(fileds, ",")
-		for _, field := range filedsList {
-			fieldSplit := strings.Split(field, "=")
-			allFields[fieldSplit[0]] = fieldSplit[1]
-		}
+	// Check if we need filter the list by fields
+	fieldSelector, err := pkg.FieldSelector(r, selectableFields(app, apiRequestInfo.Resource))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	// Get all the networks again and return them
-	var allDatabase *opencpgrpc.DatabaseList
-	if len(allFields) > 0 {
-		nameDatabase := allFields["metadata.name"]
-		allDatabase, err = app.Database.ListDatabase(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &nameDatabase})
-		if err != nil {
-			log.Println(err)
-		}
-	} else {
-		q := apiRequestInfo.Namespace
-		allDatabase, err = app.Database.ListDatabase(r.Request.Context(), &opencpgrpc.FilterOptions{Namespace: &q})
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if pkg.IsWatch(r) {
+		watchResource(r, w, "Database", func(ctx context.Context) ([]metav1.Object, error) {
+			allDatabase, err := listDatabases(ctx, app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(databaseObjects(allDatabase)), nil
+		})
+		return
+	}
+
+	// Get the page asked with limit and continue, the databases are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	allDatabase := &opencpgrpc.DatabaseList{}
+	var listMeta metav1.ListMeta
+	allDatabase.Items, listMeta, err = paginate(r, app, func() (string, []*opencpgrpc.Database, error) {
+		list, err := listDatabases(r.Request.Context(), app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
 		if err != nil {
-			log.Println(err)
+			return "", nil, err
 		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(databaseObjects(list))), list.Items, nil
+	}, databaseMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
 		for _, db := range allDatabase.Items {
 			cell := metav1.TableRow{
-				Cells: []interface{}{db.Metadata.Name, db.Metadata.UID, db.Spec.Nodes, db.Spec.Size, db.Spec.Engine, db.Spec.EngineVersion, db.Status.State},
-				Object: runtime.RawExtension{
-					Object: &metav1.PartialObjectMetadata{
-						TypeMeta: metav1.TypeMeta{
-							Kind:       "Database",
-							APIVersion: "opencp.io/v1alpha1",
-						},
-						ObjectMeta: metav1.ObjectMeta{
-							Name:      db.Metadata.Name,
-							UID:       db.Metadata.UID,
-							Namespace: db.Metadata.Namespace,
-						},
-					},
-				},
+				Cells:  []interface{}{db.Metadata.Name, db.Metadata.UID, db.Spec.Nodes, db.Spec.Size, db.Spec.Engine, db.Spec.EngineVersion, db.Status.State},
+				Object: pkg.RawObject(databaseFromBackend(db)),
 			}
 			tableRow = append(tableRow, cell)
 		}
@@ -98,6 +100,7 @@ func (d *Database) List(r *restful.Request, w *restful.Response) {
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Name", Type: "string", Format: "name", Description: "Name of the Database"},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the Database (from metadata)"},
@@ -110,42 +113,23 @@ func (d *Database) List(r *restful.Request, w *restful.Response) {
 			Rows: tableRow,
 		}
 
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	databaseList := []v1alpha1.Database{}
-	for _, db := range allDatabase.Items {
-
-		var emptyDatabaseSpec v1alpha1.DatabaseSpec
-		var emptyDatabaseStatus v1alpha1.DatabaseStatus
-
-		pkg.CopyTo(db.Spec, &emptyDatabaseSpec)
-		pkg.CopyTo(db.Status, &emptyDatabaseStatus)
-
-		singleDatabase := v1alpha1.Database{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Database",
-				APIVersion: "opencp.io/v1alpha1",
-			},
-			ObjectMeta: *db.Metadata,
-			Spec:       emptyDatabaseSpec,
-			Status:     emptyDatabaseStatus,
-		}
-
-		databaseList = append(databaseList, singleDatabase)
-	}
+	databaseList := databaseObjects(allDatabase)
 
 	list := v1alpha1.DatabaseList{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "DatabaseList",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		Items: databaseList,
+		ListMeta: listMeta,
+		Items:    databaseList,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(list)
+	pkg.WriteObject(r, w, http.StatusOK, list)
 }
 
 // Get - Get a Database
@@ -162,13 +146,19 @@ func (d *Database) Get(r *restful.Request, w *restful.Response) {
 	db, err := app.Database.GetDatabase(r.Request.Context(), &opencpgrpc.FilterOptions{Namespace: &apiRequestInfo.Namespace, Name: &apiRequestInfo.Name})
 	if err != nil {
 		log.Println(err)
-		w.WriteAsJson(pkg.RespondNotFound(apiRequestInfo))
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
 		return
 	}
 
+	// Record the change of state seen as an event
+	if db != nil {
+		observed := databaseFromBackend(db)
+		observeState(r.Request.Context(), app, "Database", &observed)
+	}
+
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
-		cell := metav1.TableRow{Cells: []interface{}{db.Metadata.Name, db.Metadata.UID, db.Spec.Nodes, db.Spec.Size, db.Spec.Engine, db.Spec.EngineVersion, db.Status.State}}
+		cell := metav1.TableRow{Cells: []interface{}{db.Metadata.Name, db.Metadata.UID, db.Spec.Nodes, db.Spec.Size, db.Spec.Engine, db.Spec.EngineVersion, db.Status.State}, Object: pkg.RawObject(databaseFromBackend(db))}
 		tableRow = append(tableRow, cell)
 
 		list := metav1.Table{
@@ -189,7 +179,7 @@ func (d *Database) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -209,46 +199,75 @@ func (d *Database) Get(r *restful.Request, w *restful.Response) {
 		Status:     emptyDatabaseStatus,
 	}
 
+	pkg.EnsureResourceVersion(&database)
+
 	// print the request method and path
-	w.WriteAsJson(database)
+	pkg.WriteObject(r, w, http.StatusOK, database)
 }
 
 // Create - Create a Database
 func (d *Database) Create(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+	createResource(r, w, databaseResource)
+}
 
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+// Delete - Delete a Database
+func (d *Database) Delete(r *restful.Request, w *restful.Response) {
+	deleteResource(r, w, databaseResource)
+}
 
-	// Real all the body of the request and unmarshal it
-	body, err := io.ReadAll(r.Request.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
+// DatabasePatch patch a database, server-side apply creates the database if it does not exist
+func (d *Database) Patch(r *restful.Request, w *restful.Response) {
+	patchResource(r, w, databaseResource)
+}
+
+// listDatabases returns the databases in a namespace matching the field and label selectors, the name
+// and namespace in the field selector are passed to the backend
+func listDatabases(ctx context.Context, app *setup.OpenCPApp, namespace string, fieldSelector fields.Selector, labelSelector labels.Selector) (*opencpgrpc.DatabaseList, error) {
+	if fieldNamespace, ok := fieldSelector.RequiresExactMatch("metadata.namespace"); ok && namespace == "" {
+		namespace = fieldNamespace
+	}
+	filter := &opencpgrpc.FilterOptions{Namespace: &namespace}
+	if name, ok := fieldSelector.RequiresExactMatch("metadata.name"); ok {
+		filter.Name = &name
 	}
 
-	databaseOpenCP := opencpgrpc.Database{}
-	err = json.Unmarshal(body, &databaseOpenCP)
+	databaseList, err := app.Database.ListDatabase(ctx, filter)
 	if err != nil {
-		log.Fatalf("error: %v", err)
+		return nil, err
 	}
 
-	// Create the database
-	db, err := app.Database.CreateDatabase(r.Request.Context(), &databaseOpenCP)
-	if err != nil {
-		log.Println(err)
-		w.WriteAsJson(pkg.RespondError(apiRequestInfo, databaseOpenCP.Metadata.Name, "error creating database", err))
-		return
+	databaseList.Items = pkg.FilterFields(databaseList.Items, fieldSelector, func(db *opencpgrpc.Database) interface{} {
+		return databaseFromBackend(db)
+	})
+	databaseList.Items = pkg.FilterLabels(databaseList.Items, labelSelector, databaseMetadata)
+
+	// Record the changes of state seen in the list as events
+	observeStates(ctx, app, "Database", pkg.ObjectList(databaseObjects(databaseList)))
+	return databaseList, nil
+}
+
+// databaseObjects converts the databases from the backend to the v1alpha1 representation
+func databaseObjects(allDatabase *opencpgrpc.DatabaseList) []v1alpha1.Database {
+	databaseList := []v1alpha1.Database{}
+	for _, db := range allDatabase.Items {
+		databaseList = append(databaseList, databaseFromBackend(db))
 	}
 
-	var emptyDatabaseSpec v1alpha1.DatabaseSpec
-	var emptyDatabaseStatus v1alpha1.DatabaseStatus
+	return databaseList
+}
 
-	pkg.CopyTo(db.Spec, &emptyDatabaseSpec)
-	pkg.CopyTo(db.Status, &emptyDatabaseStatus)
+// databaseMetadata returns the metadata of a database from the backend
+func databaseMetadata(db *opencpgrpc.Database) *metav1.ObjectMeta {
+	return db.Metadata
+}
+
+// databaseFromBackend converts a database from the backend to the v1alpha1 representation
+func databaseFromBackend(db *opencpgrpc.Database) v1alpha1.Database {
+	var databaseSpec v1alpha1.DatabaseSpec
+	var databaseStatus v1alpha1.DatabaseStatus
+
+	pkg.CopyTo(db.Spec, &databaseSpec)
+	pkg.CopyTo(db.Status, &databaseStatus)
 
 	database := v1alpha1.Database{
 		TypeMeta: metav1.TypeMeta{
@@ -256,52 +275,34 @@ func (d *Database) Create(r *restful.Request, w *restful.Response) {
 			APIVersion: "opencp.io/v1alpha1",
 		},
 		ObjectMeta: *db.Metadata,
-		Spec:       emptyDatabaseSpec,
-		Status:     emptyDatabaseStatus,
+		Spec:       databaseSpec,
+		Status:     databaseStatus,
 	}
 
-	w.WriteAsJson(database)
+	// The resourceVersion is derived from the content when the backend does not set it
+	pkg.EnsureResourceVersion(&database)
+	return database
 }
 
-// Delete - Delete a Database
-func (d *Database) Delete(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
-
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
-
-	respondStatus := metav1.Status{}
-	db, err := app.Database.DeleteDatabase(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
-	if err != nil {
-		respondStatus = pkg.RespondError(apiRequestInfo, apiRequestInfo.Name, "error deleteing the database", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
-
-	if db != nil {
-		respondStatus = metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status: "Success",
-			Details: &metav1.StatusDetails{
-				Name:  db.Metadata.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-				UID:   db.Metadata.UID,
-			},
-		}
-	}
-
-	if db == nil {
-		respondStatus = pkg.RespondNotFound(apiRequestInfo)
-	}
-
-	// print the request method and path
-	w.WriteAsJson(respondStatus)
+// databaseResource reads and writes the databases in the backend
+var databaseResource = &resource[opencpgrpc.Database]{
+	kind:       "Database",
+	resource:   "databases",
+	namespaced: true,
+	versioned: func() metav1.Object {
+		return &v1alpha1.Database{}
+	},
+	fromBackend: func(obj *opencpgrpc.Database) metav1.Object {
+		database := databaseFromBackend(obj)
+		return &database
+	},
+	get: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.Database, error) {
+		return app.Database.GetDatabase(ctx, &opencpgrpc.FilterOptions{Name: &name, Namespace: &namespace})
+	},
+	create: func(ctx context.Context, app *setup.OpenCPApp, obj *opencpgrpc.Database) (*opencpgrpc.Database, error) {
+		return app.Database.CreateDatabase(ctx, obj)
+	},
+	delete: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.Database, error) {
+		return app.Database.DeleteDatabase(ctx, &opencpgrpc.FilterOptions{Name: &name, Namespace: &namespace})
+	},
 }
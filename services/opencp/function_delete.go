@@ -0,0 +1,59 @@
+package opencp
+
+import (
+	"log"
+	"net/http"
+
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+
+	restful "github.com/emicklei/go-restful/v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// deleteResource deletes a opencp.io object in the backend with the DeleteOptions of the request, it responds
+// with a success status once the object is gone
+func deleteResource[T any](r *restful.Request, w *restful.Response, res *resource[T]) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	ctx := r.Request.Context()
+
+	resolver := pkg.RequestInfoResolver()
+	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
+	if err != nil {
+		log.Println(err)
+	}
+
+	options, err := pkg.DeleteOptions(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	deleted, inProgress, err := res.deleteObject(ctx, app, apiRequestInfo.Namespace, apiRequestInfo.Name, options)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	// While the deletion is in progress the object is returned with its deletionTimestamp
+	if inProgress {
+		pkg.WriteObject(r, w, http.StatusAccepted, deleted)
+		return
+	}
+
+	respondStatus := metav1.Status{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Status",
+			APIVersion: "v1",
+		},
+		Status: metav1.StatusSuccess,
+		Details: &metav1.StatusDetails{
+			Name:  deleted.GetName(),
+			Group: res.groupResource().Group,
+			Kind:  res.resource,
+			UID:   deleted.GetUID(),
+		},
+	}
+	pkg.WriteObject(r, w, http.StatusOK, respondStatus)
+}
@@ -1,13 +1,10 @@
 package opencp
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"log"
 	"net/http"
 
-	"strings"
-
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 	"github.com/opencontrolplane/opencp-shim/pkg"
 	opencpapi "github.com/opencontrolplane/opencp-spec/apis/v1alpha1"
@@ -15,6 +12,8 @@ import (
 
 	restful "github.com/emicklei/go-restful/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 	// "k8s.io/apimachinery/pkg/types"
 )
 
@@ -22,7 +21,7 @@ type DomainInterface interface {
 	List(r *restful.Request, w *restful.Response)
 	Get(r *restful.Request, w *restful.Response)
 	Create(r *restful.Request, w *restful.Response)
-	// Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
 	Delete(r *restful.Request, w *restful.Response)
 }
 
@@ -44,44 +43,51 @@ func (d *Domain) List(r *restful.Request, w *restful.Response) {
 		log.Println(err)
 	}
 
-	// Check if we need filter the list
-	fileds := r.QueryParameter("fieldSelector")
-	allFields := make(map[string]string)
-	if fileds != "" {
-		filedsList := strings.Split(fileds, ",")
-		for _, field := range filedsList {
-			fieldSplit := strings.Split(field, "=")
-			allFields[fieldSplit[0]] = fieldSplit[1]
-		}
+	// Check if we need filter the list by fields
+	fieldSelector, err := pkg.FieldSelector(r, selectableFields(app, apiRequestInfo.Resource))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	// Get all the domains again and return them
-	var allDomains *opencpgrpc.DomainList
-	if len(allFields) > 0 {
-		q := allFields["metadata.name"]
-		domain, err := app.Domain.GetDomain(r.Request.Context(), &opencpgrpc.FilterOptions{
-			Name: &q,
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if pkg.IsWatch(r) {
+		watchResource(r, w, "Domain", func(ctx context.Context) ([]metav1.Object, error) {
+			allDomains, err := listDomains(ctx, app, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(domainObjects(allDomains)), nil
 		})
-		if err != nil {
-			allDomains = &opencpgrpc.DomainList{}
-		}
+		return
+	}
 
-		if domain != nil {
-			allDomains.Items = append(allDomains.Items, domain)
-		}
-	} else {
-		allDomains, err = app.Domain.ListDomains(r.Request.Context(), &opencpgrpc.FilterOptions{})
+	// Get the page asked with limit and continue, the domains are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	allDomains := &opencpgrpc.DomainList{}
+	var listMeta metav1.ListMeta
+	allDomains.Items, listMeta, err = paginate(r, app, func() (string, []*opencpgrpc.Domain, error) {
+		list, err := listDomains(r.Request.Context(), app, fieldSelector, labelSelector)
 		if err != nil {
-			respondStatus := pkg.RespondError(apiRequestInfo, "", "error listing domains", err)
-			w.WriteAsJson(respondStatus)
-			return
+			return "", nil, err
 		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(domainObjects(list))), list.Items, nil
+	}, domainMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
 		for _, domain := range allDomains.Items {
-			cell := metav1.TableRow{Cells: []interface{}{domain.Metadata.Name, domain.Metadata.UID, len(domain.Spec.Records), domain.Status.State}}
+			cell := metav1.TableRow{Cells: []interface{}{domain.Metadata.Name, domain.Metadata.UID, len(domain.Spec.Records), domain.Status.State}, Object: pkg.RawObject(domainFromBackend(domain))}
 			tableRow = append(tableRow, cell)
 		}
 
@@ -90,6 +96,7 @@ func (d *Domain) List(r *restful.Request, w *restful.Response) {
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Name", Type: "string", Format: "name", Description: "Name of the Domain"},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the Domain (from metadata)"},
@@ -99,42 +106,23 @@ func (d *Domain) List(r *restful.Request, w *restful.Response) {
 			Rows: tableRow,
 		}
 
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	domainList := []opencpapi.Domain{}
-	for _, domain := range allDomains.Items {
-
-		domainSpec := opencpapi.DomainSpec{}
-		domainStatus := &opencpapi.DomainStatus{}
-
-		pkg.CopyTo(domain.Spec, &domainSpec)
-		pkg.CopyTo(domain.Status, &domainStatus)
-
-		singleDomain := &opencpapi.Domain{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Domain",
-				APIVersion: "opencp.io/v1alpha1",
-			},
-			ObjectMeta: *domain.Metadata,
-			Spec:       &domainSpec,
-			Status:     domainStatus,
-		}
-
-		domainList = append(domainList, *singleDomain)
-	}
+	domainList := domainObjects(allDomains)
 
 	list := opencpapi.DomainList{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "DomainList",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		Items: domainList,
+		ListMeta: listMeta,
+		Items:    domainList,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(list)
+	pkg.WriteObject(r, w, http.StatusOK, list)
 }
 
 // DomainGet - Get a domain
@@ -152,21 +140,22 @@ func (d *Domain) Get(r *restful.Request, w *restful.Response) {
 	domain, err := app.Domain.GetDomain(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &q})
 	if err != nil {
 		log.Println(err)
-		w.WriteAsJson(pkg.RespondNotFound(apiRequestInfo))
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
 		return
 	}
 
 	if domain == nil {
-		respondStatus := pkg.RespondNotFound(apiRequestInfo)
-		// print the request method and path
-		w.ResponseWriter.WriteHeader(http.StatusNotFound)
-		w.WriteAsJson(respondStatus)
+		pkg.WriteStatus(w, pkg.RespondNotFound(apiRequestInfo))
 		return
 	}
 
+	// Record the change of state seen as an event
+	observed := domainFromBackend(domain)
+	observeState(r.Request.Context(), app, "Domain", &observed)
+
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
-		cell := metav1.TableRow{Cells: []interface{}{domain.Metadata.Name, domain.Metadata.UID, len(domain.Spec.Records), domain.Status.State}}
+		cell := metav1.TableRow{Cells: []interface{}{domain.Metadata.Name, domain.Metadata.UID, len(domain.Spec.Records), domain.Status.State}, Object: pkg.RawObject(domainFromBackend(domain))}
 		tableRow = append(tableRow, cell)
 
 		list := metav1.Table{
@@ -184,7 +173,7 @@ func (d *Domain) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -204,48 +193,78 @@ func (d *Domain) Get(r *restful.Request, w *restful.Response) {
 		Status:     &domainStatus,
 	}
 
+	pkg.EnsureResourceVersion(domainsRespond)
+
 	// print the request method and path
-	w.WriteAsJson(domainsRespond)
+	pkg.WriteObject(r, w, http.StatusOK, domainsRespond)
 }
 
 // DomainCreate - Create a domain
 func (d *Domain) Create(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+	createResource(r, w, domainResource)
+}
 
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+// DomainDelete - Delete a domain
+func (d *Domain) Delete(r *restful.Request, w *restful.Response) {
+	deleteResource(r, w, domainResource)
+}
 
-	// Real all the body of the request and unmarshal it
-	body, err := io.ReadAll(r.Request.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
-	}
+// DomainPatch patch a domain, server-side apply creates the domain if it does not exist
+func (d *Domain) Patch(r *restful.Request, w *restful.Response) {
+	patchResource(r, w, domainResource)
+}
 
-	domainOpenCP := &opencpgrpc.Domain{}
-	err = json.Unmarshal(body, &domainOpenCP)
-	if err != nil {
-		log.Fatalf("error: %v", err)
+// listDomains returns all the domains matching the field and label selectors,
+// the one named in the field selector is read directly from the backend
+func listDomains(ctx context.Context, app *setup.OpenCPApp, fieldSelector fields.Selector, labelSelector labels.Selector) (*opencpgrpc.DomainList, error) {
+	domainList := &opencpgrpc.DomainList{}
+	if name, ok := fieldSelector.RequiresExactMatch("metadata.name"); ok {
+		item, err := app.Domain.GetDomain(ctx, &opencpgrpc.FilterOptions{Name: &name})
+		if err == nil && item != nil {
+			domainList.Items = []*opencpgrpc.Domain{item}
+		}
+	} else {
+		var err error
+		domainList, err = app.Domain.ListDomains(ctx, &opencpgrpc.FilterOptions{})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Createn the domain
-	domain, err := app.Domain.CreateDomain(r.Request.Context(), domainOpenCP)
-	if err != nil {
-		respondStatus := pkg.RespondError(apiRequestInfo, domainOpenCP.Metadata.Name, "error finding domain", err)
-		w.WriteAsJson(respondStatus)
-		return
+	domainList.Items = pkg.FilterFields(domainList.Items, fieldSelector, func(domain *opencpgrpc.Domain) interface{} {
+		return domainFromBackend(domain)
+	})
+	domainList.Items = pkg.FilterLabels(domainList.Items, labelSelector, domainMetadata)
+
+	// Record the changes of state seen in the list as events
+	observeStates(ctx, app, "Domain", pkg.ObjectList(domainObjects(domainList)))
+	return domainList, nil
+}
+
+// domainObjects converts the domains from the backend to the v1alpha1 representation
+func domainObjects(allDomains *opencpgrpc.DomainList) []opencpapi.Domain {
+	domainList := []opencpapi.Domain{}
+	for _, domain := range allDomains.Items {
+		domainList = append(domainList, domainFromBackend(domain))
 	}
 
-	domainSpec := opencpapi.DomainSpec{}
-	domainStatus := opencpapi.DomainStatus{}
+	return domainList
+}
+
+// domainMetadata returns the metadata of a domain from the backend
+func domainMetadata(domain *opencpgrpc.Domain) *metav1.ObjectMeta {
+	return domain.Metadata
+}
+
+// domainFromBackend converts a domain from the backend to the v1alpha1 representation
+func domainFromBackend(domain *opencpgrpc.Domain) opencpapi.Domain {
+	var domainSpec opencpapi.DomainSpec
+	var domainStatus opencpapi.DomainStatus
 
 	pkg.CopyTo(domain.Spec, &domainSpec)
 	pkg.CopyTo(domain.Status, &domainStatus)
 
-	domainsRespond := &opencpapi.Domain{
+	obj := opencpapi.Domain{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Domain",
 			APIVersion: "opencp.io/v1alpha1",
@@ -255,48 +274,30 @@ func (d *Domain) Create(r *restful.Request, w *restful.Response) {
 		Status:     &domainStatus,
 	}
 
-	// print the request method and path
-	w.WriteAsJson(domainsRespond)
+	// The resourceVersion is derived from the content when the backend does not set it
+	pkg.EnsureResourceVersion(&obj)
+	return obj
 }
 
-// DomainDelete - Delete a domain
-func (d *Domain) Delete(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
-
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
-
-	respondStatus := metav1.Status{}
-	domain, err := app.Domain.DeleteDomain(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
-	if err != nil {
-		respondStatus = pkg.RespondError(apiRequestInfo, apiRequestInfo.Name, "error deleting domain", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
-
-	if domain != nil {
-		respondStatus = metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status: "Success",
-			Details: &metav1.StatusDetails{
-				Name:  domain.Metadata.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-				UID:   domain.Metadata.UID,
-			},
-		}
-	}
-
-	if domain == nil {
-		respondStatus = pkg.RespondNotFound(apiRequestInfo)
-	}
-	// print the request method and path
-	w.WriteAsJson(respondStatus)
+// domainResource reads and writes the domains in the backend
+var domainResource = &resource[opencpgrpc.Domain]{
+	kind:       "Domain",
+	resource:   "domains",
+	namespaced: false,
+	versioned: func() metav1.Object {
+		return &opencpapi.Domain{}
+	},
+	fromBackend: func(obj *opencpgrpc.Domain) metav1.Object {
+		domain := domainFromBackend(obj)
+		return &domain
+	},
+	get: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.Domain, error) {
+		return app.Domain.GetDomain(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
+	create: func(ctx context.Context, app *setup.OpenCPApp, obj *opencpgrpc.Domain) (*opencpgrpc.Domain, error) {
+		return app.Domain.CreateDomain(ctx, obj)
+	},
+	delete: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.Domain, error) {
+		return app.Domain.DeleteDomain(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
 }
@@ -0,0 +1,54 @@
+package opencp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/opencontrolplane/opencp-shim/internal/events"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// objectReference returns the reference to a opencp.io object in its events
+func objectReference(kind string, obj metav1.Object) corev1.ObjectReference {
+	return corev1.ObjectReference{
+		Kind:            kind,
+		APIVersion:      "opencp.io/v1alpha1",
+		Namespace:       obj.GetNamespace(),
+		Name:            obj.GetName(),
+		UID:             obj.GetUID(),
+		ResourceVersion: obj.GetResourceVersion(),
+	}
+}
+
+// recordFailure records a warning event when the backend fails a call on an object
+func recordFailure(ctx context.Context, app *setup.OpenCPApp, involvedObject corev1.ObjectReference, reason string, err error) {
+	if app.Store == nil {
+		return
+	}
+	events.Record(ctx, app.Store, involvedObject, corev1.EventTypeWarning, reason, fmt.Sprintf("Error from the backend: %v", pkg.RespondStatus(err).Message))
+}
+
+// observeState records an event when the status.state of an object read from the backend changed
+func observeState(ctx context.Context, app *setup.OpenCPApp, kind string, obj metav1.Object) {
+	observeStates(ctx, app, kind, []metav1.Object{obj})
+}
+
+// observeStates records an event for every object read from the backend whose status.state changed
+func observeStates(ctx context.Context, app *setup.OpenCPApp, kind string, objects []metav1.Object) {
+	if app.Store == nil {
+		return
+	}
+
+	for _, obj := range objects {
+		content, err := pkg.ToUnstructured(obj)
+		if err != nil {
+			continue
+		}
+		state, _, _ := unstructured.NestedString(content.Object, "status", "state")
+		events.ObserveState(ctx, app.Store, objectReference(kind, obj), state)
+	}
+}
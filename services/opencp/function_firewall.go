@@ -1,11 +1,10 @@
 package opencp
 
 import (
-	"encoding/json"
+	"context"
 	// "errors"
-	"io"
 	"log"
-	"strings"
+	"net/http"
 
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 	"github.com/opencontrolplane/opencp-shim/pkg"
@@ -14,14 +13,15 @@ import (
 
 	restful "github.com/emicklei/go-restful/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type FirewallInterface interface {
 	List(r *restful.Request, w *restful.Response)
 	Get(r *restful.Request, w *restful.Response)
 	Create(r *restful.Request, w *restful.Response)
-	// Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
 	Delete(r *restful.Request, w *restful.Response)
 }
 
@@ -43,51 +43,53 @@ func (f *Firewall) List(r *restful.Request, w *restful.Response) {
 		log.Println(err)
 	}
 
-	// Check if we need filter the list
-	fileds := r.QueryParameter("fieldSelector")
-	allFields := make(map[string]string)
-	if fileds != "" {
-		filedsList := strings.Split(fileds, ",")
-		for _, field := range filedsList {
-			fieldSplit := strings.Split(field, "=")
-			allFields[fieldSplit[0]] = fieldSplit[1]
-		}
+	// Check if we need filter the list by fields
+	fieldSelector, err := pkg.FieldSelector(r, selectableFields(app, apiRequestInfo.Resource))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	// Get all the networks again and return them
-	var allFirewall *opencpgrpc.FirewallList
-	if len(allFields) > 0 {
-		nameFirewall := allFields["metadata.name"]
-		allFirewall, err = app.Firewall.ListFirewall(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &nameFirewall})
-		if err != nil {
-			log.Println(err)
-		}
-	} else {
-		q := apiRequestInfo.Namespace
-		allFirewall, err = app.Firewall.ListFirewall(r.Request.Context(), &opencpgrpc.FilterOptions{Namespace: &q})
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if pkg.IsWatch(r) {
+		watchResource(r, w, "Firewall", func(ctx context.Context) ([]metav1.Object, error) {
+			allFirewall, err := listFirewalls(ctx, app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(firewallObjects(allFirewall)), nil
+		})
+		return
+	}
+
+	// Get the page asked with limit and continue, the firewalls are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	allFirewall := &opencpgrpc.FirewallList{}
+	var listMeta metav1.ListMeta
+	allFirewall.Items, listMeta, err = paginate(r, app, func() (string, []*opencpgrpc.Firewall, error) {
+		list, err := listFirewalls(r.Request.Context(), app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
 		if err != nil {
-			log.Println(err)
+			return "", nil, err
 		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(firewallObjects(list))), list.Items, nil
+	}, firewallMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
 		for _, fw := range allFirewall.Items {
 			cell := metav1.TableRow{
-				Cells: []interface{}{fw.Metadata.Name, fw.Metadata.UID, fw.Status.TotalRules, fw.Status.State},
-				Object: runtime.RawExtension{
-					Object: &metav1.PartialObjectMetadata{
-						TypeMeta: metav1.TypeMeta{
-							Kind:       "VirtualMachine",
-							APIVersion: "opencp.io/v1alpha1",
-						},
-						ObjectMeta: metav1.ObjectMeta{
-							Name:      fw.Metadata.Name,
-							UID:       fw.Metadata.UID,
-							Namespace: fw.Metadata.Namespace,
-						},
-					},
-				},
+				Cells:  []interface{}{fw.Metadata.Name, fw.Metadata.UID, fw.Status.TotalRules, fw.Status.State},
+				Object: pkg.RawObject(firewallFromBackend(fw)),
 			}
 			tableRow = append(tableRow, cell)
 		}
@@ -97,6 +99,7 @@ func (f *Firewall) List(r *restful.Request, w *restful.Response) {
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Name", Type: "string", Format: "name", Description: "Name of the firewall"},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the firewall (from metadata)"},
@@ -106,41 +109,23 @@ func (f *Firewall) List(r *restful.Request, w *restful.Response) {
 			Rows: tableRow,
 		}
 
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	fwList := []v1alpha1.Firewall{}
-	for _, fw := range allFirewall.Items {
-		var emptyFirewallSpec v1alpha1.FirewallSpec
-		var emptyFirewallStatus v1alpha1.FirewallStatus
-
-		pkg.CopyTo(fw.Spec, &emptyFirewallSpec)
-		pkg.CopyTo(fw.Status, &emptyFirewallStatus)
-
-		firewall := v1alpha1.Firewall{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Firewall",
-				APIVersion: "opencp.io/v1alpha1",
-			},
-			ObjectMeta: *fw.Metadata,
-			Spec:       emptyFirewallSpec,
-			Status:     emptyFirewallStatus,
-		}
-
-		fwList = append(fwList, firewall)
-	}
+	fwList := firewallObjects(allFirewall)
 
 	list := v1alpha1.FirewallList{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "FirewallList",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		Items: fwList,
+		ListMeta: listMeta,
+		Items:    fwList,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(list)
+	pkg.WriteObject(r, w, http.StatusOK, list)
 }
 
 // FirewallGet get a firewall
@@ -157,13 +142,19 @@ func (f *Firewall) Get(r *restful.Request, w *restful.Response) {
 	fw, err := app.Firewall.GetFirewall(r.Request.Context(), &opencpgrpc.FilterOptions{Namespace: &apiRequestInfo.Namespace, Name: &apiRequestInfo.Name})
 	if err != nil {
 		log.Println(err)
-		w.WriteAsJson(pkg.RespondNotFound(apiRequestInfo))
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
 		return
 	}
 
+	// Record the change of state seen as an event
+	if fw != nil {
+		observed := firewallFromBackend(fw)
+		observeState(r.Request.Context(), app, "Firewall", &observed)
+	}
+
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
-		cell := metav1.TableRow{Cells: []interface{}{fw.Metadata.Name, fw.Metadata.UID, fw.Status.TotalRules, fw.Status.State}}
+		cell := metav1.TableRow{Cells: []interface{}{fw.Metadata.Name, fw.Metadata.UID, fw.Status.TotalRules, fw.Status.State}, Object: pkg.RawObject(firewallFromBackend(fw))}
 		tableRow = append(tableRow, cell)
 
 		list := metav1.Table{
@@ -181,7 +172,7 @@ func (f *Firewall) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -201,99 +192,110 @@ func (f *Firewall) Get(r *restful.Request, w *restful.Response) {
 		Status:     emptyFirewallStatus,
 	}
 
+	pkg.EnsureResourceVersion(&firewall)
+
 	// print the request method and path
-	w.WriteAsJson(firewall)
+	pkg.WriteObject(r, w, http.StatusOK, firewall)
 }
 
 // FirewallCreate create a firewall
 func (f *Firewall) Create(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+	createResource(r, w, firewallResource)
+}
 
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+// FirewallDelete delete a firewall
+func (f *Firewall) Delete(r *restful.Request, w *restful.Response) {
+	deleteResource(r, w, firewallResource)
+}
 
-	// Real all the body of the request and unmarshal it
-	body, err := io.ReadAll(r.Request.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
+// FirewallPatch patch a firewall, server-side apply creates the firewall if it does not exist
+func (f *Firewall) Patch(r *restful.Request, w *restful.Response) {
+	patchResource(r, w, firewallResource)
+}
+
+// listFirewalls returns the firewalls in a namespace matching the field and label selectors, the name
+// and namespace in the field selector are passed to the backend
+func listFirewalls(ctx context.Context, app *setup.OpenCPApp, namespace string, fieldSelector fields.Selector, labelSelector labels.Selector) (*opencpgrpc.FirewallList, error) {
+	if fieldNamespace, ok := fieldSelector.RequiresExactMatch("metadata.namespace"); ok && namespace == "" {
+		namespace = fieldNamespace
+	}
+	filter := &opencpgrpc.FilterOptions{Namespace: &namespace}
+	if name, ok := fieldSelector.RequiresExactMatch("metadata.name"); ok {
+		filter.Name = &name
 	}
 
-	firewallOpenCP := opencpgrpc.Firewall{}
-	err = json.Unmarshal(body, &firewallOpenCP)
+	firewallList, err := app.Firewall.ListFirewall(ctx, filter)
 	if err != nil {
-		log.Fatalf("error: %v", err)
+		return nil, err
 	}
 
-	// Create the firewall
-	fw, err := app.Firewall.CreateFirewall(r.Request.Context(), &firewallOpenCP)
-	if err != nil {
-		log.Println(err)
-		w.WriteAsJson(pkg.RespondError(apiRequestInfo, firewallOpenCP.Metadata.Name, "error creating firewall", err))
-		return
+	firewallList.Items = pkg.FilterFields(firewallList.Items, fieldSelector, func(fw *opencpgrpc.Firewall) interface{} {
+		return firewallFromBackend(fw)
+	})
+	firewallList.Items = pkg.FilterLabels(firewallList.Items, labelSelector, firewallMetadata)
+
+	// Record the changes of state seen in the list as events
+	observeStates(ctx, app, "Firewall", pkg.ObjectList(firewallObjects(firewallList)))
+	return firewallList, nil
+}
+
+// firewallObjects converts the firewalls from the backend to the v1alpha1 representation
+func firewallObjects(allFirewall *opencpgrpc.FirewallList) []v1alpha1.Firewall {
+	fwList := []v1alpha1.Firewall{}
+	for _, fw := range allFirewall.Items {
+		fwList = append(fwList, firewallFromBackend(fw))
 	}
 
-	// Return the firewall
-	emptyFirewallSpec := v1alpha1.FirewallSpec{}
-	emptyFirewallStatus := v1alpha1.FirewallStatus{}
+	return fwList
+}
 
-	pkg.CopyTo(fw.Spec, &emptyFirewallSpec)
-	pkg.CopyTo(fw.Status, &emptyFirewallStatus)
+// firewallMetadata returns the metadata of a firewall from the backend
+func firewallMetadata(fw *opencpgrpc.Firewall) *metav1.ObjectMeta {
+	return fw.Metadata
+}
 
-	firewallRespond := v1alpha1.Firewall{
+// firewallFromBackend converts a firewall from the backend to the v1alpha1 representation
+func firewallFromBackend(fw *opencpgrpc.Firewall) v1alpha1.Firewall {
+	var firewallSpec v1alpha1.FirewallSpec
+	var firewallStatus v1alpha1.FirewallStatus
+
+	pkg.CopyTo(fw.Spec, &firewallSpec)
+	pkg.CopyTo(fw.Status, &firewallStatus)
+
+	firewall := v1alpha1.Firewall{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "Firewall",
 			APIVersion: "opencp.io/v1alpha1",
 		},
 		ObjectMeta: *fw.Metadata,
-		Spec:       emptyFirewallSpec,
-		Status:     emptyFirewallStatus,
+		Spec:       firewallSpec,
+		Status:     firewallStatus,
 	}
 
-	w.WriteAsJson(firewallRespond)
+	// The resourceVersion is derived from the content when the backend does not set it
+	pkg.EnsureResourceVersion(&firewall)
+	return firewall
 }
 
-// FirewallDelete delete a firewall
-func (f *Firewall) Delete(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
-
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
-
-	respondStatus := metav1.Status{}
-	fw, err := app.Firewall.DeleteFirewall(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
-	if err != nil {
-		respondStatus = pkg.RespondError(apiRequestInfo, apiRequestInfo.Name, "error deleteing the firewall", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
-
-	if fw != nil {
-		respondStatus = metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status: "Success",
-			Details: &metav1.StatusDetails{
-				Name:  fw.Metadata.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-				UID:   fw.Metadata.UID,
-			},
-		}
-	}
-
-	if fw == nil {
-		respondStatus = pkg.RespondNotFound(apiRequestInfo)
-	}
-	// print the request method and path
-	w.WriteAsJson(respondStatus)
+// firewallResource reads and writes the firewalls in the backend
+var firewallResource = &resource[opencpgrpc.Firewall]{
+	kind:       "Firewall",
+	resource:   "firewalls",
+	namespaced: true,
+	versioned: func() metav1.Object {
+		return &v1alpha1.Firewall{}
+	},
+	fromBackend: func(obj *opencpgrpc.Firewall) metav1.Object {
+		firewall := firewallFromBackend(obj)
+		return &firewall
+	},
+	get: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.Firewall, error) {
+		return app.Firewall.GetFirewall(ctx, &opencpgrpc.FilterOptions{Name: &name, Namespace: &namespace})
+	},
+	create: func(ctx context.Context, app *setup.OpenCPApp, obj *opencpgrpc.Firewall) (*opencpgrpc.Firewall, error) {
+		return app.Firewall.CreateFirewall(ctx, obj)
+	},
+	delete: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.Firewall, error) {
+		return app.Firewall.DeleteFirewall(ctx, &opencpgrpc.FilterOptions{Name: &name, Namespace: &namespace})
+	},
 }
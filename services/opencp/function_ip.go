@@ -1,11 +1,9 @@
 package opencp
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"log"
 	"net/http"
-	"strings"
 
 	// "strings"
 
@@ -17,13 +15,15 @@ import (
 
 	restful "github.com/emicklei/go-restful/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type IPInterface interface {
 	List(r *restful.Request, w *restful.Response)
 	Get(r *restful.Request, w *restful.Response)
 	Create(r *restful.Request, w *restful.Response)
-	// Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
 	Delete(r *restful.Request, w *restful.Response)
 }
 
@@ -45,43 +45,51 @@ func (p *IP) List(r *restful.Request, w *restful.Response) {
 		log.Println(err)
 	}
 
-	// Check if we need filter the list
-	fileds := r.QueryParameter("fieldSelector")
-	allFields := make(map[string]string)
-	if fileds != "" {
-		filedsList := strings.Split(fileds, ",")
-		for _, field := range filedsList {
-			fieldSplit := strings.Split(field, "=")
-			allFields[fieldSplit[0]] = fieldSplit[1]
-		}
+	// Check if we need filter the list by fields
+	fieldSelector, err := pkg.FieldSelector(r, selectableFields(app, apiRequestInfo.Resource))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	var allIPs *opencpgrpc.IpList
-	if len(allFields) > 0 {
-		q := allFields["metadata.name"]
-		ip, err := app.IP.GetIp(r.Request.Context(), &opencpgrpc.FilterOptions{
-			Name: &q,
+	if pkg.IsWatch(r) {
+		watchResource(r, w, "IP", func(ctx context.Context) ([]metav1.Object, error) {
+			allIPs, err := listIPs(ctx, app, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(ipObjects(allIPs)), nil
 		})
-		if err != nil {
-			allIPs = &opencpgrpc.IpList{}
-		}
+		return
+	}
 
-		if ip != nil {
-			allIPs.Items = append(allIPs.Items, ip)
-		}
-	} else {
-		allIPs, err = app.IP.ListIp(r.Request.Context(), &opencpgrpc.FilterOptions{})
+	// Get the page asked with limit and continue, the ips are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	allIPs := &opencpgrpc.IpList{}
+	var listMeta metav1.ListMeta
+	allIPs.Items, listMeta, err = paginate(r, app, func() (string, []*opencpgrpc.Ip, error) {
+		list, err := listIPs(r.Request.Context(), app, fieldSelector, labelSelector)
 		if err != nil {
-			respondStatus := pkg.RespondError(apiRequestInfo, "", "error listing ips", err)
-			w.WriteAsJson(respondStatus)
-			return
+			return "", nil, err
 		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(ipObjects(list))), list.Items, nil
+	}, ipMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
 		for _, ip := range allIPs.Items {
-			cell := metav1.TableRow{Cells: []interface{}{ip.Metadata.Name, ip.Metadata.UID, ip.Status.Ip, ip.Status.Assignedto.Name, ip.Status.Assignedto.Type}}
+			cell := metav1.TableRow{Cells: []interface{}{ip.Metadata.Name, ip.Metadata.UID, ip.Status.Ip, ip.Status.Assignedto.Name, ip.Status.Assignedto.Type}, Object: pkg.RawObject(ipFromBackend(ip))}
 			tableRow = append(tableRow, cell)
 		}
 
@@ -90,6 +98,7 @@ func (p *IP) List(r *restful.Request, w *restful.Response) {
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Name", Type: "string", Format: "name", Description: "Name of the instance"},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the instance (from metadata)"},
@@ -101,42 +110,23 @@ func (p *IP) List(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	ipList := []opencpapi.IP{}
-	for _, ip := range allIPs.Items {
-
-		ipSpec := opencpapi.IPSpec{}
-		ipStatus := opencpapi.IPStatus{}
-
-		pkg.CopyTo(ip.Spec, &ipSpec)
-		pkg.CopyTo(ip.Status, &ipStatus)
-
-		singleIP := &opencpapi.IP{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "IP",
-				APIVersion: "opencp.io/v1alpha1",
-			},
-			ObjectMeta: *ip.Metadata,
-			Spec:       ipSpec,
-			Status:     ipStatus,
-		}
-
-		ipList = append(ipList, *singleIP)
-	}
+	ipList := ipObjects(allIPs)
 
 	list := opencpapi.IPList{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "IPList",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		Items: ipList,
+		ListMeta: listMeta,
+		Items:    ipList,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(list)
+	pkg.WriteObject(r, w, http.StatusOK, list)
 }
 
 func (p *IP) Get(r *restful.Request, w *restful.Response) {
@@ -153,21 +143,22 @@ func (p *IP) Get(r *restful.Request, w *restful.Response) {
 	ip, err := app.IP.GetIp(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
 	if err != nil {
 		log.Println(err)
-		w.WriteAsJson(pkg.RespondNotFound(apiRequestInfo))
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
 		return
 	}
 
 	if ip == nil {
-		respondStatus := pkg.RespondNotFound(apiRequestInfo)
-		// print the request method and path
-		w.ResponseWriter.WriteHeader(http.StatusNotFound)
-		w.WriteAsJson(respondStatus)
+		pkg.WriteStatus(w, pkg.RespondNotFound(apiRequestInfo))
 		return
 	}
 
+	// Record the change of state seen as an event
+	observed := ipFromBackend(ip)
+	observeState(r.Request.Context(), app, "IP", &observed)
+
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
-		cell := metav1.TableRow{Cells: []interface{}{ip.Metadata.Name, ip.Metadata.UID, ip.Status.Ip, ip.Status.Assignedto.Name, ip.Status.Assignedto.Type}}
+		cell := metav1.TableRow{Cells: []interface{}{ip.Metadata.Name, ip.Metadata.UID, ip.Status.Ip, ip.Status.Assignedto.Name, ip.Status.Assignedto.Type}, Object: pkg.RawObject(ipFromBackend(ip))}
 		tableRow = append(tableRow, cell)
 
 		list := metav1.Table{
@@ -186,7 +177,7 @@ func (p *IP) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -206,88 +197,76 @@ func (p *IP) Get(r *restful.Request, w *restful.Response) {
 		Status:     ipStatus,
 	}
 
+	pkg.EnsureResourceVersion(ipRespond)
+
 	// print the request method and path
-	w.WriteAsJson(ipRespond)
+	pkg.WriteObject(r, w, http.StatusOK, ipRespond)
 }
 
 func (p *IP) Delete(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+	deleteResource(r, w, ipResource)
+}
 
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+func (p *IP) Create(r *restful.Request, w *restful.Response) {
+	createResource(r, w, ipResource)
+}
 
-	respondStatus := metav1.Status{}
-	ip, err := app.IP.DeleteIp(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
-	if err != nil {
-		respondStatus = pkg.RespondError(apiRequestInfo, apiRequestInfo.Name, "error deleting IP", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
+// IPPatch patch a ip, server-side apply creates the ip if it does not exist
+func (p *IP) Patch(r *restful.Request, w *restful.Response) {
+	patchResource(r, w, ipResource)
+}
 
-	if ip != nil {
-		respondStatus = metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status: "Success",
-			Details: &metav1.StatusDetails{
-				Name:  ip.Metadata.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-				UID:   ip.Metadata.UID,
-			},
+// listIPs returns all the ips matching the field and label selectors,
+// the one named in the field selector is read directly from the backend
+func listIPs(ctx context.Context, app *setup.OpenCPApp, fieldSelector fields.Selector, labelSelector labels.Selector) (*opencpgrpc.IpList, error) {
+	ipList := &opencpgrpc.IpList{}
+	if name, ok := fieldSelector.RequiresExactMatch("metadata.name"); ok {
+		item, err := app.IP.GetIp(ctx, &opencpgrpc.FilterOptions{Name: &name})
+		if err == nil && item != nil {
+			ipList.Items = []*opencpgrpc.Ip{item}
+		}
+	} else {
+		var err error
+		ipList, err = app.IP.ListIp(ctx, &opencpgrpc.FilterOptions{})
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if ip == nil {
-		respondStatus = pkg.RespondNotFound(apiRequestInfo)
-	}
-	// print the request method and path
-	w.WriteAsJson(respondStatus)
-}
-
-func (p *IP) Create(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+	ipList.Items = pkg.FilterFields(ipList.Items, fieldSelector, func(ip *opencpgrpc.Ip) interface{} {
+		return ipFromBackend(ip)
+	})
+	ipList.Items = pkg.FilterLabels(ipList.Items, labelSelector, ipMetadata)
 
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+	// Record the changes of state seen in the list as events
+	observeStates(ctx, app, "IP", pkg.ObjectList(ipObjects(ipList)))
+	return ipList, nil
+}
 
-	body, err := io.ReadAll(r.Request.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
-		// http.Error(w, "can't read body", http.StatusBadRequest)
-		// return
+// ipObjects converts the ips from the backend to the v1alpha1 representation
+func ipObjects(allIPs *opencpgrpc.IpList) []opencpapi.IP {
+	ipList := []opencpapi.IP{}
+	for _, ip := range allIPs.Items {
+		ipList = append(ipList, ipFromBackend(ip))
 	}
 
-	ipOpenCP := &opencpgrpc.Ip{}
-	err = json.Unmarshal(body, ipOpenCP)
-	if err != nil {
-		log.Fatalf("error: %v", err)
-	}
+	return ipList
+}
 
-	ip, err := app.IP.CreateIp(r.Request.Context(), ipOpenCP)
-	if err != nil {
-		respondStatus := pkg.RespondError(apiRequestInfo, ipOpenCP.Metadata.Name, "error finding domain", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
+// ipMetadata returns the metadata of a ip from the backend
+func ipMetadata(ip *opencpgrpc.Ip) *metav1.ObjectMeta {
+	return ip.Metadata
+}
 
-	ipSpec := opencpapi.IPSpec{}
-	ipStatus := opencpapi.IPStatus{}
+// ipFromBackend converts a ip from the backend to the v1alpha1 representation
+func ipFromBackend(ip *opencpgrpc.Ip) opencpapi.IP {
+	var ipSpec opencpapi.IPSpec
+	var ipStatus opencpapi.IPStatus
 
 	pkg.CopyTo(ip.Spec, &ipSpec)
 	pkg.CopyTo(ip.Status, &ipStatus)
 
-	ipRespond := &opencpapi.IP{
+	obj := opencpapi.IP{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "IP",
 			APIVersion: "opencp.io/v1alpha1",
@@ -297,6 +276,30 @@ func (p *IP) Create(r *restful.Request, w *restful.Response) {
 		Status:     ipStatus,
 	}
 
-	// print the request method and path
-	w.WriteAsJson(ipRespond)
+	// The resourceVersion is derived from the content when the backend does not set it
+	pkg.EnsureResourceVersion(&obj)
+	return obj
+}
+
+// ipResource reads and writes the ips in the backend
+var ipResource = &resource[opencpgrpc.Ip]{
+	kind:       "IP",
+	resource:   "ips",
+	namespaced: false,
+	versioned: func() metav1.Object {
+		return &opencpapi.IP{}
+	},
+	fromBackend: func(obj *opencpgrpc.Ip) metav1.Object {
+		ip := ipFromBackend(obj)
+		return &ip
+	},
+	get: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.Ip, error) {
+		return app.IP.GetIp(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
+	create: func(ctx context.Context, app *setup.OpenCPApp, obj *opencpgrpc.Ip) (*opencpgrpc.Ip, error) {
+		return app.IP.CreateIp(ctx, obj)
+	},
+	delete: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.Ip, error) {
+		return app.IP.DeleteIp(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
 }
@@ -1,12 +1,9 @@
 package opencp
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"log"
 	"net/http"
-	"strings"
 
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 	"github.com/opencontrolplane/opencp-shim/pkg"
@@ -15,14 +12,15 @@ import (
 
 	restful "github.com/emicklei/go-restful/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type KubernetesInterface interface {
 	List(r *restful.Request, w *restful.Response)
 	Get(r *restful.Request, w *restful.Response)
 	Create(r *restful.Request, w *restful.Response)
-	Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
 	Delete(r *restful.Request, w *restful.Response)
 }
 
@@ -44,51 +42,53 @@ func (k *Kubernetes) List(r *restful.Request, w *restful.Response) {
 		log.Println(err)
 	}
 
-	// Check if we need filter the list
-	fileds := r.QueryParameter("fieldSelector")
-	allFields := make(map[string]string)
-	if fileds != "" {
-		filedsList := strings.Split(fileds, ",")
-		for _, field := range filedsList {
-			fieldSplit := strings.Split(field, "=")
-			allFields[fieldSplit[0]] = fieldSplit[1]
-		}
+	// Check if we need filter the list by fields
+	fieldSelector, err := pkg.FieldSelector(r, selectableFields(app, apiRequestInfo.Resource))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	// Get all the networks again and return them
-	var kubernetesClusterList *opencpgrpc.KubernetesClusterList
-	if len(allFields) > 0 {
-		nameVm := allFields["metadata.name"]
-		kubernetesClusterList, err = app.KubernetesCluster.ListKubernetesCluster(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &nameVm})
-		if err != nil {
-			log.Println(err)
-		}
-	} else {
-		q := apiRequestInfo.Namespace
-		kubernetesClusterList, err = app.KubernetesCluster.ListKubernetesCluster(r.Request.Context(), &opencpgrpc.FilterOptions{Namespace: &q})
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if pkg.IsWatch(r) {
+		watchResource(r, w, "KubernetesCluster", func(ctx context.Context) ([]metav1.Object, error) {
+			kubernetesClusterList, err := listKubernetesClusters(ctx, app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(kubernetesClusterObjects(kubernetesClusterList)), nil
+		})
+		return
+	}
+
+	// Get the page asked with limit and continue, the kubernetes clusters are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	kubernetesClusterList := &opencpgrpc.KubernetesClusterList{}
+	var listMeta metav1.ListMeta
+	kubernetesClusterList.Items, listMeta, err = paginate(r, app, func() (string, []*opencpgrpc.KubernetesCluster, error) {
+		list, err := listKubernetesClusters(r.Request.Context(), app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
 		if err != nil {
-			log.Println(err)
+			return "", nil, err
 		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(kubernetesClusterObjects(list))), list.Items, nil
+	}, kubernetesClusterMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
 		for _, cluster := range kubernetesClusterList.Items {
 			cell := metav1.TableRow{
-				Cells: []interface{}{cluster.Metadata.Name, cluster.Metadata.UID, len(cluster.Spec.Pools), cluster.Status.PublicIP, cluster.Status.State, pkg.TimeDiff(cluster.Metadata.CreationTimestamp.Time)},
-				Object: runtime.RawExtension{
-					Object: &metav1.PartialObjectMetadata{
-						TypeMeta: metav1.TypeMeta{
-							Kind:       "VirtualMachine",
-							APIVersion: "opencp.io/v1alpha1",
-						},
-						ObjectMeta: metav1.ObjectMeta{
-							Name:      cluster.Metadata.Name,
-							UID:       cluster.Metadata.UID,
-							Namespace: cluster.Metadata.Namespace,
-						},
-					},
-				},
+				Cells:  []interface{}{cluster.Metadata.Name, cluster.Metadata.UID, len(cluster.Spec.Pools), cluster.Status.PublicIP, cluster.Status.State, pkg.TimeDiff(cluster.Metadata.CreationTimestamp.Time)},
+				Object: pkg.RawObject(kubernetesClusterFromBackend(cluster)),
 			}
 			tableRow = append(tableRow, cell)
 		}
@@ -98,6 +98,7 @@ func (k *Kubernetes) List(r *restful.Request, w *restful.Response) {
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Name", Type: "string", Format: "name", Description: "Name of the instance"},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the cluster (from metadata)"},
@@ -109,41 +110,23 @@ func (k *Kubernetes) List(r *restful.Request, w *restful.Response) {
 			Rows: tableRow,
 		}
 
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	k8sList := []v1alpha1.KubernetesCluster{}
-	for _, k8s := range kubernetesClusterList.Items {
-		var emptyKuberntesSpec v1alpha1.KubernetesClusterSpec
-		var emptyKubernetesStatus v1alpha1.KubernetesClusterStatus
-
-		pkg.CopyTo(k8s.Spec, &emptyKuberntesSpec)
-		pkg.CopyTo(k8s.Status, &emptyKubernetesStatus)
-
-		k8s := v1alpha1.KubernetesCluster{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "KubernetesCluster",
-				APIVersion: "opencp.io/v1alpha1",
-			},
-			ObjectMeta: *k8s.Metadata,
-			Spec:       emptyKuberntesSpec,
-			Status:     emptyKubernetesStatus,
-		}
-
-		k8sList = append(k8sList, k8s)
-	}
+	k8sList := kubernetesClusterObjects(kubernetesClusterList)
 
 	list := v1alpha1.KuberenetesClusterList{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "KubernetesClusterList",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		Items: k8sList,
+		ListMeta: listMeta,
+		Items:    k8sList,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(list)
+	pkg.WriteObject(r, w, http.StatusOK, list)
 }
 
 // KubernetesGet get a kubernetes cluster
@@ -160,36 +143,22 @@ func (k *Kubernetes) Get(r *restful.Request, w *restful.Response) {
 	cluster, err := app.KubernetesCluster.GetKubernetesCluster(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name, Namespace: &apiRequestInfo.Namespace})
 	if err != nil {
 		log.Println(err)
-		w.WriteAsJson(pkg.RespondNotFound(apiRequestInfo))
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
 		return
 	}
 
 	if cluster == nil {
-		respondStatus := metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status:  "Failure",
-			Reason:  metav1.StatusReasonNotFound,
-			Code:    http.StatusNotFound,
-			Message: fmt.Sprintf("kubernetes cluster %s not found", apiRequestInfo.Name),
-			Details: &metav1.StatusDetails{
-				Name:  apiRequestInfo.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-			},
-		}
-
-		// print the request method and path
-		w.ResponseWriter.WriteHeader(http.StatusNotFound)
-		w.WriteAsJson(respondStatus)
+		pkg.WriteStatus(w, pkg.RespondNotFound(apiRequestInfo))
 		return
 	}
 
+	// Record the change of state seen as an event
+	observed := kubernetesClusterFromBackend(cluster)
+	observeState(r.Request.Context(), app, "KubernetesCluster", &observed)
+
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
-		cell := metav1.TableRow{Cells: []interface{}{cluster.Metadata.Name, cluster.Metadata.UID, len(cluster.Spec.Pools), cluster.Status.PublicIP, cluster.Status.State, pkg.TimeDiff(cluster.Metadata.CreationTimestamp.Time)}}
+		cell := metav1.TableRow{Cells: []interface{}{cluster.Metadata.Name, cluster.Metadata.UID, len(cluster.Spec.Pools), cluster.Status.PublicIP, cluster.Status.State, pkg.TimeDiff(cluster.Metadata.CreationTimestamp.Time)}, Object: pkg.RawObject(kubernetesClusterFromBackend(cluster))}
 		tableRow = append(tableRow, cell)
 
 		list := metav1.Table{
@@ -209,7 +178,7 @@ func (k *Kubernetes) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -229,109 +198,110 @@ func (k *Kubernetes) Get(r *restful.Request, w *restful.Response) {
 		Status:     emptyKubernetesStatus,
 	}
 
+	pkg.EnsureResourceVersion(&K3sCluster)
+
 	// print the request method and path
-	w.WriteAsJson(K3sCluster)
+	pkg.WriteObject(r, w, http.StatusOK, K3sCluster)
 }
 
 // KubernetesCreate create a kubernetes cluster
 func (k *Kubernetes) Create(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+	createResource(r, w, kubernetesClusterResource)
+}
 
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+// KubernetesDelete delete a kubernetes cluster
+func (k *Kubernetes) Delete(r *restful.Request, w *restful.Response) {
+	deleteResource(r, w, kubernetesClusterResource)
+}
 
-	// Real all the body of the request and unmarshal it
-	body, err := io.ReadAll(r.Request.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
-	}
+// KubernetesPatch patch a kubernetes cluster, server-side apply creates the kubernetes cluster if it does not exist
+func (k *Kubernetes) Patch(r *restful.Request, w *restful.Response) {
+	patchResource(r, w, kubernetesClusterResource)
+}
 
-	kubernetesCluster := opencpgrpc.KubernetesCluster{}
-	err = json.Unmarshal(body, &kubernetesCluster)
-	if err != nil {
-		log.Fatalf("error: %v", err)
+// listKubernetesClusters returns the kubernetes clusters in a namespace matching the field and label selectors, the name
+// and namespace in the field selector are passed to the backend
+func listKubernetesClusters(ctx context.Context, app *setup.OpenCPApp, namespace string, fieldSelector fields.Selector, labelSelector labels.Selector) (*opencpgrpc.KubernetesClusterList, error) {
+	if fieldNamespace, ok := fieldSelector.RequiresExactMatch("metadata.namespace"); ok && namespace == "" {
+		namespace = fieldNamespace
+	}
+	filter := &opencpgrpc.FilterOptions{Namespace: &namespace}
+	if name, ok := fieldSelector.RequiresExactMatch("metadata.name"); ok {
+		filter.Name = &name
 	}
 
-	// Create the cluster
-	cluster, err := app.KubernetesCluster.CreateKubernetesCluster(r.Request.Context(), &kubernetesCluster)
+	kubernetesClusterList, err := app.KubernetesCluster.ListKubernetesCluster(ctx, filter)
 	if err != nil {
-		respondStatus := pkg.RespondError(apiRequestInfo, kubernetesCluster.Metadata.Name, "error creating the kubernetes cluster", err)
-		w.WriteAsJson(respondStatus)
-		return
+		return nil, err
 	}
 
-	var emptyKubernetesSpec v1alpha1.KubernetesClusterSpec
-	var emptyKubernetesStatus v1alpha1.KubernetesClusterStatus
+	kubernetesClusterList.Items = pkg.FilterFields(kubernetesClusterList.Items, fieldSelector, func(k8s *opencpgrpc.KubernetesCluster) interface{} {
+		return kubernetesClusterFromBackend(k8s)
+	})
+	kubernetesClusterList.Items = pkg.FilterLabels(kubernetesClusterList.Items, labelSelector, kubernetesClusterMetadata)
 
-	pkg.CopyTo(cluster.Spec, &emptyKubernetesSpec)
-	pkg.CopyTo(cluster.Status, &emptyKubernetesStatus)
+	// Record the changes of state seen in the list as events
+	observeStates(ctx, app, "KubernetesCluster", pkg.ObjectList(kubernetesClusterObjects(kubernetesClusterList)))
+	return kubernetesClusterList, nil
+}
 
-	// Return the cluster
-	k3sCluster := v1alpha1.KubernetesCluster{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "KubernetesCluster",
-			APIVersion: "opencp.io/v1alpha1",
-		},
-		ObjectMeta: *cluster.Metadata,
-		Spec:       emptyKubernetesSpec,
-		Status:     emptyKubernetesStatus,
+// kubernetesClusterObjects converts the kubernetes clusters from the backend to the v1alpha1 representation
+func kubernetesClusterObjects(kubernetesClusterList *opencpgrpc.KubernetesClusterList) []v1alpha1.KubernetesCluster {
+	k8sList := []v1alpha1.KubernetesCluster{}
+	for _, k8s := range kubernetesClusterList.Items {
+		k8sList = append(k8sList, kubernetesClusterFromBackend(k8s))
 	}
 
-	w.WriteAsJson(k3sCluster)
+	return k8sList
 }
 
-// KubernetesUpdate update a kubernetes cluster
-func (k *Kubernetes) Update(r *restful.Request, w *restful.Response) {
-	// Not implemented
-	// a json respond is returned
-	json := `{"message": "Not implemented"}`
-	w.WriteAsJson(json)
+// kubernetesClusterMetadata returns the metadata of a kubernetes cluster from the backend
+func kubernetesClusterMetadata(k8s *opencpgrpc.KubernetesCluster) *metav1.ObjectMeta {
+	return k8s.Metadata
 }
 
-// KubernetesDelete delete a kubernetes cluster
-func (k *Kubernetes) Delete(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
-
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+// kubernetesClusterFromBackend converts a kubernetes cluster from the backend to the v1alpha1 representation
+func kubernetesClusterFromBackend(k8s *opencpgrpc.KubernetesCluster) v1alpha1.KubernetesCluster {
+	var kubernetesClusterSpec v1alpha1.KubernetesClusterSpec
+	var kubernetesClusterStatus v1alpha1.KubernetesClusterStatus
 
-	respondStatus := metav1.Status{}
-	// Send to delete the cluster
-	cluster, err := app.KubernetesCluster.DeleteKubernetesCluster(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
-	if err != nil {
-		respondStatus = pkg.RespondError(apiRequestInfo, apiRequestInfo.Name, "error deleteing the kubernetes cluster", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
+	pkg.CopyTo(k8s.Spec, &kubernetesClusterSpec)
+	pkg.CopyTo(k8s.Status, &kubernetesClusterStatus)
 
-	if cluster != nil {
-		respondStatus = metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status: metav1.StatusSuccess,
-			Details: &metav1.StatusDetails{
-				Name:  cluster.Metadata.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-				UID:   cluster.Metadata.UID,
-			},
-		}
+	kubernetesCluster := v1alpha1.KubernetesCluster{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "KubernetesCluster",
+			APIVersion: "opencp.io/v1alpha1",
+		},
+		ObjectMeta: *k8s.Metadata,
+		Spec:       kubernetesClusterSpec,
+		Status:     kubernetesClusterStatus,
 	}
 
-	if cluster == nil {
-		respondStatus = pkg.RespondNotFound(apiRequestInfo)
-	}
+	// The resourceVersion is derived from the content when the backend does not set it
+	pkg.EnsureResourceVersion(&kubernetesCluster)
+	return kubernetesCluster
+}
 
-	// print the request method and path
-	w.WriteAsJson(respondStatus)
+// kubernetesClusterResource reads and writes the kubernetes clusters in the backend
+var kubernetesClusterResource = &resource[opencpgrpc.KubernetesCluster]{
+	kind:       "KubernetesCluster",
+	resource:   "kubernetesclusters",
+	namespaced: true,
+	versioned: func() metav1.Object {
+		return &v1alpha1.KubernetesCluster{}
+	},
+	fromBackend: func(obj *opencpgrpc.KubernetesCluster) metav1.Object {
+		kubernetesCluster := kubernetesClusterFromBackend(obj)
+		return &kubernetesCluster
+	},
+	get: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.KubernetesCluster, error) {
+		return app.KubernetesCluster.GetKubernetesCluster(ctx, &opencpgrpc.FilterOptions{Name: &name, Namespace: &namespace})
+	},
+	create: func(ctx context.Context, app *setup.OpenCPApp, obj *opencpgrpc.KubernetesCluster) (*opencpgrpc.KubernetesCluster, error) {
+		return app.KubernetesCluster.CreateKubernetesCluster(ctx, obj)
+	},
+	delete: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.KubernetesCluster, error) {
+		return app.KubernetesCluster.DeleteKubernetesCluster(ctx, &opencpgrpc.FilterOptions{Name: &name, Namespace: &namespace})
+	},
 }
@@ -1,11 +1,9 @@
 package opencp
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"log"
 	"net/http"
-	"strings"
 
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 	"github.com/opencontrolplane/opencp-shim/pkg"
@@ -14,13 +12,15 @@ import (
 
 	restful "github.com/emicklei/go-restful/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type ObjectStorageInterface interface {
 	List(r *restful.Request, w *restful.Response)
 	Get(r *restful.Request, w *restful.Response)
 	Create(r *restful.Request, w *restful.Response)
-	// Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
 	Delete(r *restful.Request, w *restful.Response)
 }
 
@@ -42,45 +42,53 @@ func (s *ObjectStorage) List(r *restful.Request, w *restful.Response) {
 		log.Println(err)
 	}
 
-	// Check if we need filter the list
-	fileds := r.QueryParameter("fieldSelector")
-	allFields := make(map[string]string)
-	if fileds != "" {
-		filedsList := strings.Split(fileds, ",")
-		for _, field := range filedsList {
-			fieldSplit := strings.Split(field, "=")
-			allFields[fieldSplit[0]] = fieldSplit[1]
-		}
+	// Check if we need filter the list by fields
+	fieldSelector, err := pkg.FieldSelector(r, selectableFields(app, apiRequestInfo.Resource))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	// Get all the onbject storage again and return them
-	var allObjectStorage *opencpgrpc.ObjectStorageList
-	if len(allFields) > 0 {
-		q := allFields["metadata.name"]
-		objStorage, err := app.ObjectStorage.GetObjectStorage(r.Request.Context(), &opencpgrpc.FilterOptions{
-			Name: &q,
+	if pkg.IsWatch(r) {
+		watchResource(r, w, "ObjectStorage", func(ctx context.Context) ([]metav1.Object, error) {
+			allObjectStorage, err := listObjectStorages(ctx, app, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(objectStorageObjects(allObjectStorage)), nil
 		})
-		if err != nil {
-			allObjectStorage = &opencpgrpc.ObjectStorageList{}
-		}
+		return
+	}
 
-		if objStorage != nil {
-			allObjectStorage.Items = append(allObjectStorage.Items, objStorage)
-		}
-	} else {
-		allObjectStorage, err = app.ObjectStorage.ListObjectStorage(r.Request.Context(), &opencpgrpc.FilterOptions{})
+	// Get the page asked with limit and continue, the object storages are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	allObjectStorage := &opencpgrpc.ObjectStorageList{}
+	var listMeta metav1.ListMeta
+	allObjectStorage.Items, listMeta, err = paginate(r, app, func() (string, []*opencpgrpc.ObjectStorage, error) {
+		list, err := listObjectStorages(r.Request.Context(), app, fieldSelector, labelSelector)
 		if err != nil {
-			respondStatus := pkg.RespondError(apiRequestInfo, "", "error listing object storage", err)
-			w.WriteAsJson(respondStatus)
-			return
+			return "", nil, err
 		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(objectStorageObjects(list))), list.Items, nil
+	}, objectStorageMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
 		for _, objectstorage := range allObjectStorage.Items {
 			tableRow = append(tableRow, metav1.TableRow{
-				Cells: []interface{}{objectstorage.Metadata.Name, objectstorage.Metadata.UID, objectstorage.Spec.Size, objectstorage.Status.State},
+				Cells:  []interface{}{objectstorage.Metadata.Name, objectstorage.Metadata.UID, objectstorage.Spec.Size, objectstorage.Status.State},
+				Object: pkg.RawObject(objectStorageFromBackend(objectstorage)),
 			})
 		}
 
@@ -89,6 +97,7 @@ func (s *ObjectStorage) List(r *restful.Request, w *restful.Response) {
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Name", Type: "string", Format: "name", Description: "Name of the ObjectStorage", Priority: 0},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the ObjectStorage (from metadata)"},
@@ -98,41 +107,23 @@ func (s *ObjectStorage) List(r *restful.Request, w *restful.Response) {
 			Rows: tableRow,
 		}
 
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	objectstorageList := []v1alpha1.ObjectStorage{}
-	for _, objectstorage := range allObjectStorage.Items {
-		objStorageSpec := v1alpha1.ObjectStorageSpec{}
-		objStorageStatus := v1alpha1.ObjectStorageStatus{}
-
-		pkg.CopyTo(objectstorage.Spec, &objStorageSpec)
-		pkg.CopyTo(objectstorage.Status, &objStorageStatus)
-
-		obstorage := v1alpha1.ObjectStorage{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "ObjectStorage",
-				APIVersion: "opencp.io/v1alpha1",
-			},
-			ObjectMeta: *objectstorage.Metadata,
-			Spec:       objStorageSpec,
-			Status:     objStorageStatus,
-		}
-
-		objectstorageList = append(objectstorageList, obstorage)
-	}
+	objectstorageList := objectStorageObjects(allObjectStorage)
 
 	list := v1alpha1.ObjectStorageList{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ObjectStorageList",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		Items: objectstorageList,
+		ListMeta: listMeta,
+		Items:    objectstorageList,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(list)
+	pkg.WriteObject(r, w, http.StatusOK, list)
 }
 
 // Get - Get a object storage
@@ -152,19 +143,22 @@ func (s *ObjectStorage) Get(r *restful.Request, w *restful.Response) {
 	if err != nil {
 		// print the log
 		log.Println(err)
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
+		return
 	}
 
 	if objectstorage == nil {
-		respondStatus := pkg.RespondNotFound(apiRequestInfo)
-		// print the request method and path
-		w.ResponseWriter.WriteHeader(http.StatusNotFound)
-		w.WriteAsJson(respondStatus)
+		pkg.WriteStatus(w, pkg.RespondNotFound(apiRequestInfo))
 		return
 	}
 
+	// Record the change of state seen as an event
+	observed := objectStorageFromBackend(objectstorage)
+	observeState(r.Request.Context(), app, "ObjectStorage", &observed)
+
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
-		cell := metav1.TableRow{Cells: []interface{}{objectstorage.Metadata.Name, objectstorage.Metadata.UID, objectstorage.Spec.Size, objectstorage.Status.State}}
+		cell := metav1.TableRow{Cells: []interface{}{objectstorage.Metadata.Name, objectstorage.Metadata.UID, objectstorage.Spec.Size, objectstorage.Status.State}, Object: pkg.RawObject(objectStorageFromBackend(objectstorage))}
 		tableRow = append(tableRow, cell)
 
 		list := metav1.Table{
@@ -182,7 +176,7 @@ func (s *ObjectStorage) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -202,97 +196,111 @@ func (s *ObjectStorage) Get(r *restful.Request, w *restful.Response) {
 		Status:     objStorageStatus,
 	}
 
+	pkg.EnsureResourceVersion(&objectstorageReturn)
+
 	// print the request method and path
-	w.WriteAsJson(objectstorageReturn)
+	pkg.WriteObject(r, w, http.StatusOK, objectstorageReturn)
 }
 
 // DomainCreate - Create a domain
 func (s *ObjectStorage) Create(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+	createResource(r, w, objectStorageResource)
+}
 
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+// Delete - Delete a sshkey
+func (s *ObjectStorage) Delete(r *restful.Request, w *restful.Response) {
+	deleteResource(r, w, objectStorageResource)
+}
 
-	// Real all the body of the request and unmarshal it
-	body, err := io.ReadAll(r.Request.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
-	}
+// ObjectStoragePatch patch a object storage, server-side apply creates the object storage if it does not exist
+func (s *ObjectStorage) Patch(r *restful.Request, w *restful.Response) {
+	patchResource(r, w, objectStorageResource)
+}
 
-	objectstorageOpenCP := opencpgrpc.ObjectStorage{}
-	err = json.Unmarshal(body, &objectstorageOpenCP)
-	if err != nil {
-		log.Fatalf("error: %v", err)
+// listObjectStorages returns all the object storage matching the field and label selectors,
+// the one named in the field selector is read directly from the backend
+func listObjectStorages(ctx context.Context, app *setup.OpenCPApp, fieldSelector fields.Selector, labelSelector labels.Selector) (*opencpgrpc.ObjectStorageList, error) {
+	objectStorageList := &opencpgrpc.ObjectStorageList{}
+	if name, ok := fieldSelector.RequiresExactMatch("metadata.name"); ok {
+		item, err := app.ObjectStorage.GetObjectStorage(ctx, &opencpgrpc.FilterOptions{Name: &name})
+		if err == nil && item != nil {
+			objectStorageList.Items = []*opencpgrpc.ObjectStorage{item}
+		}
+	} else {
+		var err error
+		objectStorageList, err = app.ObjectStorage.ListObjectStorage(ctx, &opencpgrpc.FilterOptions{})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Createn the ObjectStore
-	objectstorage, err := app.ObjectStorage.CreateObjectStorage(r.Request.Context(), &objectstorageOpenCP)
-	if err != nil {
-		respondStatus := pkg.RespondError(apiRequestInfo, objectstorageOpenCP.Metadata.Name, "error creating the object storage", err)
-		w.WriteAsJson(respondStatus)
-		return
+	objectStorageList.Items = pkg.FilterFields(objectStorageList.Items, fieldSelector, func(objectstorage *opencpgrpc.ObjectStorage) interface{} {
+		return objectStorageFromBackend(objectstorage)
+	})
+	objectStorageList.Items = pkg.FilterLabels(objectStorageList.Items, labelSelector, objectStorageMetadata)
+
+	// Record the changes of state seen in the list as events
+	observeStates(ctx, app, "ObjectStorage", pkg.ObjectList(objectStorageObjects(objectStorageList)))
+	return objectStorageList, nil
+}
+
+// objectStorageObjects converts the object storage from the backend to the v1alpha1 representation
+func objectStorageObjects(allObjectStorage *opencpgrpc.ObjectStorageList) []v1alpha1.ObjectStorage {
+	objectstorageList := []v1alpha1.ObjectStorage{}
+	for _, objectstorage := range allObjectStorage.Items {
+		objectstorageList = append(objectstorageList, objectStorageFromBackend(objectstorage))
 	}
 
-	objStorageSpec := v1alpha1.ObjectStorageSpec{}
-	objStorageStatus := v1alpha1.ObjectStorageStatus{}
+	return objectstorageList
+}
 
-	pkg.CopyTo(objectstorage.Spec, &objStorageSpec)
-	pkg.CopyTo(objectstorage.Status, &objStorageStatus)
+// objectStorageMetadata returns the metadata of a object storage from the backend
+func objectStorageMetadata(objectstorage *opencpgrpc.ObjectStorage) *metav1.ObjectMeta {
+	return objectstorage.Metadata
+}
+
+// objectStorageFromBackend converts a object storage from the backend to the v1alpha1 representation
+func objectStorageFromBackend(objectstorage *opencpgrpc.ObjectStorage) v1alpha1.ObjectStorage {
+	var objectStorageSpec v1alpha1.ObjectStorageSpec
+	var objectStorageStatus v1alpha1.ObjectStorageStatus
+
+	pkg.CopyTo(objectstorage.Spec, &objectStorageSpec)
+	pkg.CopyTo(objectstorage.Status, &objectStorageStatus)
 
-	obstorageRespond := v1alpha1.ObjectStorage{
+	objectStorage := v1alpha1.ObjectStorage{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ObjectStorage",
 			APIVersion: "opencp.io/v1alpha1",
 		},
 		ObjectMeta: *objectstorage.Metadata,
-		Spec:       objStorageSpec,
-		Status:     objStorageStatus,
+		Spec:       objectStorageSpec,
+		Status:     objectStorageStatus,
 	}
-	w.WriteAsJson(obstorageRespond)
-}
 
-// Delete - Delete a sshkey
-func (s *ObjectStorage) Delete(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
-
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
-
-	respondStatus := metav1.Status{}
-	objectstorage, err := app.ObjectStorage.DeleteObjectStorage(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
-	if err != nil {
-		respondStatus = pkg.RespondError(apiRequestInfo, apiRequestInfo.Name, "error deleting ObjectStore", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
-
-	if objectstorage != nil {
-		respondStatus = metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status: "Success",
-			Details: &metav1.StatusDetails{
-				Name:  objectstorage.Metadata.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-				UID:   objectstorage.Metadata.UID,
-			},
-		}
-	}
+	// The resourceVersion is derived from the content when the backend does not set it
+	pkg.EnsureResourceVersion(&objectStorage)
+	return objectStorage
+}
 
-	if objectstorage == nil {
-		respondStatus = pkg.RespondNotFound(apiRequestInfo)
-	}
-	// print the request method and path
-	w.WriteAsJson(respondStatus)
+// objectStorageResource reads and writes the object storages in the backend
+var objectStorageResource = &resource[opencpgrpc.ObjectStorage]{
+	kind:       "ObjectStorage",
+	resource:   "objectstorages",
+	namespaced: false,
+	versioned: func() metav1.Object {
+		return &v1alpha1.ObjectStorage{}
+	},
+	fromBackend: func(obj *opencpgrpc.ObjectStorage) metav1.Object {
+		objectStorage := objectStorageFromBackend(obj)
+		return &objectStorage
+	},
+	get: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.ObjectStorage, error) {
+		return app.ObjectStorage.GetObjectStorage(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
+	create: func(ctx context.Context, app *setup.OpenCPApp, obj *opencpgrpc.ObjectStorage) (*opencpgrpc.ObjectStorage, error) {
+		return app.ObjectStorage.CreateObjectStorage(ctx, obj)
+	},
+	delete: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.ObjectStorage, error) {
+		return app.ObjectStorage.DeleteObjectStorage(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
 }
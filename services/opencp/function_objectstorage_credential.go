@@ -1,11 +1,9 @@
 package opencp
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"log"
 	"net/http"
-	"strings"
 
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 	"github.com/opencontrolplane/opencp-shim/pkg"
@@ -14,13 +12,15 @@ import (
 
 	restful "github.com/emicklei/go-restful/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type ObjectStorageCredentialInterface interface {
 	List(r *restful.Request, w *restful.Response)
 	Get(r *restful.Request, w *restful.Response)
 	Create(r *restful.Request, w *restful.Response)
-	// Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
 	Delete(r *restful.Request, w *restful.Response)
 }
 
@@ -42,45 +42,53 @@ func (s *ObjectStorageCredential) List(r *restful.Request, w *restful.Response)
 		log.Println(err)
 	}
 
-	// Check if we need filter the list
-	fileds := r.QueryParameter("fieldSelector")
-	allFields := make(map[string]string)
-	if fileds != "" {
-		filedsList := strings.Split(fileds, ",")
-		for _, field := range filedsList {
-			fieldSplit := strings.Split(field, "=")
-			allFields[fieldSplit[0]] = fieldSplit[1]
-		}
+	// Check if we need filter the list by fields
+	fieldSelector, err := pkg.FieldSelector(r, selectableFields(app, apiRequestInfo.Resource))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	// Get all the onbject storage again and return them
-	var allObjectStorageCredential *opencpgrpc.ObjectStorageCredentialList
-	if len(allFields) > 0 {
-		q := allFields["metadata.name"]
-		objStorageCredential, err := app.ObjectStorageCredential.GetObjectStorageCredential(r.Request.Context(), &opencpgrpc.FilterOptions{
-			Name: &q,
+	if pkg.IsWatch(r) {
+		watchResource(r, w, "ObjectStorageCredential", func(ctx context.Context) ([]metav1.Object, error) {
+			allObjectStorageCredential, err := listObjectStorageCredentials(ctx, app, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(objectStorageCredentialObjects(allObjectStorageCredential)), nil
 		})
-		if err != nil {
-			allObjectStorageCredential = &opencpgrpc.ObjectStorageCredentialList{}
-		}
+		return
+	}
 
-		if objStorageCredential != nil {
-			allObjectStorageCredential.Items = append(allObjectStorageCredential.Items, objStorageCredential)
-		}
-	} else {
-		allObjectStorageCredential, err = app.ObjectStorageCredential.ListObjectStorageCredential(r.Request.Context(), &opencpgrpc.FilterOptions{})
+	// Get the page asked with limit and continue, the object storage credentials are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	allObjectStorageCredential := &opencpgrpc.ObjectStorageCredentialList{}
+	var listMeta metav1.ListMeta
+	allObjectStorageCredential.Items, listMeta, err = paginate(r, app, func() (string, []*opencpgrpc.ObjectStorageCredential, error) {
+		list, err := listObjectStorageCredentials(r.Request.Context(), app, fieldSelector, labelSelector)
 		if err != nil {
-			respondStatus := pkg.RespondError(apiRequestInfo, "", "error listing object storage credential", err)
-			w.WriteAsJson(respondStatus)
-			return
+			return "", nil, err
 		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(objectStorageCredentialObjects(list))), list.Items, nil
+	}, objectStorageCredentialMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
 		for _, objectstorageCredential := range allObjectStorageCredential.Items {
 			tableRow = append(tableRow, metav1.TableRow{
-				Cells: []interface{}{objectstorageCredential.Metadata.Name, objectstorageCredential.Metadata.UID, objectstorageCredential.Spec.AccessKey, objectstorageCredential.Status.State},
+				Cells:  []interface{}{objectstorageCredential.Metadata.Name, objectstorageCredential.Metadata.UID, objectstorageCredential.Spec.AccessKey, objectstorageCredential.Status.State},
+				Object: pkg.RawObject(objectStorageCredentialFromBackend(objectstorageCredential)),
 			})
 		}
 
@@ -89,6 +97,7 @@ func (s *ObjectStorageCredential) List(r *restful.Request, w *restful.Response)
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Name", Type: "string", Format: "name", Description: "Name of the ObjectStorage Credential", Priority: 0},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the ObjectStorage Credential (from metadata)"},
@@ -98,42 +107,23 @@ func (s *ObjectStorageCredential) List(r *restful.Request, w *restful.Response)
 			Rows: tableRow,
 		}
 
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	objectstorageCredentialList := []v1alpha1.ObjectStorageCredential{}
-	for _, objectstorage := range allObjectStorageCredential.Items {
-
-		objStorageCredentialSpec := v1alpha1.ObjectStorageCredentialSpec{}
-		objStorageCredentialStatus := v1alpha1.ObjectStorageCredentialStatus{}
-
-		pkg.CopyTo(objectstorage.Spec, &objStorageCredentialSpec)
-		pkg.CopyTo(objectstorage.Status, &objStorageCredentialStatus)
-
-		obstorageCredential := v1alpha1.ObjectStorageCredential{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "ObjectStorageCredential",
-				APIVersion: "opencp.io/v1alpha1",
-			},
-			ObjectMeta: *objectstorage.Metadata,
-			Spec:       objStorageCredentialSpec,
-			Status:     objStorageCredentialStatus,
-		}
-
-		objectstorageCredentialList = append(objectstorageCredentialList, obstorageCredential)
-	}
+	objectstorageCredentialList := objectStorageCredentialObjects(allObjectStorageCredential)
 
 	list := v1alpha1.ObjectStorageCredentialList{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ObjectStorageCredentialList",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		Items: objectstorageCredentialList,
+		ListMeta: listMeta,
+		Items:    objectstorageCredentialList,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(list)
+	pkg.WriteObject(r, w, http.StatusOK, list)
 }
 
 // Get - Get a the object storage credential
@@ -153,19 +143,22 @@ func (s *ObjectStorageCredential) Get(r *restful.Request, w *restful.Response) {
 	if err != nil {
 		// print the log
 		log.Println(err)
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
+		return
 	}
 
 	if objectstorageCredential == nil {
-		respondStatus := pkg.RespondNotFound(apiRequestInfo)
-		// print the request method and path
-		w.ResponseWriter.WriteHeader(http.StatusNotFound)
-		w.WriteAsJson(respondStatus)
+		pkg.WriteStatus(w, pkg.RespondNotFound(apiRequestInfo))
 		return
 	}
 
+	// Record the change of state seen as an event
+	observed := objectStorageCredentialFromBackend(objectstorageCredential)
+	observeState(r.Request.Context(), app, "ObjectStorageCredential", &observed)
+
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
-		cell := metav1.TableRow{Cells: []interface{}{objectstorageCredential.Metadata.Name, objectstorageCredential.Metadata.UID, objectstorageCredential.Spec.AccessKey, objectstorageCredential.Status.State}}
+		cell := metav1.TableRow{Cells: []interface{}{objectstorageCredential.Metadata.Name, objectstorageCredential.Metadata.UID, objectstorageCredential.Spec.AccessKey, objectstorageCredential.Status.State}, Object: pkg.RawObject(objectStorageCredentialFromBackend(objectstorageCredential))}
 		tableRow = append(tableRow, cell)
 
 		list := metav1.Table{
@@ -183,7 +176,7 @@ func (s *ObjectStorageCredential) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -203,99 +196,111 @@ func (s *ObjectStorageCredential) Get(r *restful.Request, w *restful.Response) {
 		Status:     objStorageCredentialStatus,
 	}
 
+	pkg.EnsureResourceVersion(&obs)
+
 	// print the request method and path
-	w.WriteAsJson(obs)
+	pkg.WriteObject(r, w, http.StatusOK, obs)
 }
 
 // DomainCreate - Create a domain
 func (s *ObjectStorageCredential) Create(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+	createResource(r, w, objectStorageCredentialResource)
+}
 
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+// Delete - Delete a sshkey
+func (s *ObjectStorageCredential) Delete(r *restful.Request, w *restful.Response) {
+	deleteResource(r, w, objectStorageCredentialResource)
+}
 
-	// Real all the body of the request and unmarshal it
-	body, err := io.ReadAll(r.Request.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
-	}
+// ObjectStorageCredentialPatch patch a object storage credential, server-side apply creates the object storage credential if it does not exist
+func (s *ObjectStorageCredential) Patch(r *restful.Request, w *restful.Response) {
+	patchResource(r, w, objectStorageCredentialResource)
+}
 
-	objectstorageCredentialOpenCP := opencpgrpc.ObjectStorageCredential{}
-	err = json.Unmarshal(body, &objectstorageCredentialOpenCP)
-	if err != nil {
-		log.Fatalf("error: %v", err)
+// listObjectStorageCredentials returns all the object storage credential matching the field and label selectors,
+// the one named in the field selector is read directly from the backend
+func listObjectStorageCredentials(ctx context.Context, app *setup.OpenCPApp, fieldSelector fields.Selector, labelSelector labels.Selector) (*opencpgrpc.ObjectStorageCredentialList, error) {
+	objectStorageCredentialList := &opencpgrpc.ObjectStorageCredentialList{}
+	if name, ok := fieldSelector.RequiresExactMatch("metadata.name"); ok {
+		item, err := app.ObjectStorageCredential.GetObjectStorageCredential(ctx, &opencpgrpc.FilterOptions{Name: &name})
+		if err == nil && item != nil {
+			objectStorageCredentialList.Items = []*opencpgrpc.ObjectStorageCredential{item}
+		}
+	} else {
+		var err error
+		objectStorageCredentialList, err = app.ObjectStorageCredential.ListObjectStorageCredential(ctx, &opencpgrpc.FilterOptions{})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Createn the ObjectStore
-	objectstorageCredential, err := app.ObjectStorageCredential.CreateObjectStorageCredential(r.Request.Context(), &objectstorageCredentialOpenCP)
-	if err != nil {
-		respondStatus := pkg.RespondError(apiRequestInfo, objectstorageCredentialOpenCP.Metadata.Name, "error creating the object storage credential", err)
-		w.WriteAsJson(respondStatus)
-		return
+	objectStorageCredentialList.Items = pkg.FilterFields(objectStorageCredentialList.Items, fieldSelector, func(credential *opencpgrpc.ObjectStorageCredential) interface{} {
+		return objectStorageCredentialFromBackend(credential)
+	})
+	objectStorageCredentialList.Items = pkg.FilterLabels(objectStorageCredentialList.Items, labelSelector, objectStorageCredentialMetadata)
+
+	// Record the changes of state seen in the list as events
+	observeStates(ctx, app, "ObjectStorageCredential", pkg.ObjectList(objectStorageCredentialObjects(objectStorageCredentialList)))
+	return objectStorageCredentialList, nil
+}
+
+// objectStorageCredentialObjects converts the object storage credential from the backend to the v1alpha1 representation
+func objectStorageCredentialObjects(allObjectStorageCredential *opencpgrpc.ObjectStorageCredentialList) []v1alpha1.ObjectStorageCredential {
+	objectstorageCredentialList := []v1alpha1.ObjectStorageCredential{}
+	for _, credential := range allObjectStorageCredential.Items {
+		objectstorageCredentialList = append(objectstorageCredentialList, objectStorageCredentialFromBackend(credential))
 	}
 
-	objStorageCredentialSpec := v1alpha1.ObjectStorageCredentialSpec{}
-	objStorageCredentialStatus := v1alpha1.ObjectStorageCredentialStatus{}
+	return objectstorageCredentialList
+}
 
-	pkg.CopyTo(objectstorageCredential.Spec, &objStorageCredentialSpec)
-	pkg.CopyTo(objectstorageCredential.Status, &objStorageCredentialStatus)
+// objectStorageCredentialMetadata returns the metadata of a object storage credential from the backend
+func objectStorageCredentialMetadata(credential *opencpgrpc.ObjectStorageCredential) *metav1.ObjectMeta {
+	return credential.Metadata
+}
 
-	obs := v1alpha1.ObjectStorageCredential{
+// objectStorageCredentialFromBackend converts a object storage credential from the backend to the v1alpha1 representation
+func objectStorageCredentialFromBackend(credential *opencpgrpc.ObjectStorageCredential) v1alpha1.ObjectStorageCredential {
+	var objectStorageCredentialSpec v1alpha1.ObjectStorageCredentialSpec
+	var objectStorageCredentialStatus v1alpha1.ObjectStorageCredentialStatus
+
+	pkg.CopyTo(credential.Spec, &objectStorageCredentialSpec)
+	pkg.CopyTo(credential.Status, &objectStorageCredentialStatus)
+
+	objectStorageCredential := v1alpha1.ObjectStorageCredential{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ObjectStorageCredential",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		ObjectMeta: *objectstorageCredential.Metadata,
-		Spec:       objStorageCredentialSpec,
-		Status:     objStorageCredentialStatus,
+		ObjectMeta: *credential.Metadata,
+		Spec:       objectStorageCredentialSpec,
+		Status:     objectStorageCredentialStatus,
 	}
 
-	// print the request method and path
-	w.WriteAsJson(obs)
+	// The resourceVersion is derived from the content when the backend does not set it
+	pkg.EnsureResourceVersion(&objectStorageCredential)
+	return objectStorageCredential
 }
 
-// Delete - Delete a sshkey
-func (s *ObjectStorageCredential) Delete(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
-
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
-
-	respondStatus := metav1.Status{}
-	objectstorageCredential, err := app.ObjectStorageCredential.DeleteObjectStorageCredential(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
-	if err != nil {
-		respondStatus = pkg.RespondError(apiRequestInfo, apiRequestInfo.Name, "error deleting Object Store Credential", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
-
-	if objectstorageCredential != nil {
-		respondStatus = metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status: "Success",
-			Details: &metav1.StatusDetails{
-				Name:  objectstorageCredential.Metadata.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-				UID:   objectstorageCredential.Metadata.UID,
-			},
-		}
-	}
-
-	if objectstorageCredential == nil {
-		respondStatus = pkg.RespondNotFound(apiRequestInfo)
-	}
-	// print the request method and path
-	w.WriteAsJson(respondStatus)
+// objectStorageCredentialResource reads and writes the object storage credentials in the backend
+var objectStorageCredentialResource = &resource[opencpgrpc.ObjectStorageCredential]{
+	kind:       "ObjectStorageCredential",
+	resource:   "objectstoragecredentials",
+	namespaced: false,
+	versioned: func() metav1.Object {
+		return &v1alpha1.ObjectStorageCredential{}
+	},
+	fromBackend: func(obj *opencpgrpc.ObjectStorageCredential) metav1.Object {
+		objectStorageCredential := objectStorageCredentialFromBackend(obj)
+		return &objectStorageCredential
+	},
+	get: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.ObjectStorageCredential, error) {
+		return app.ObjectStorageCredential.GetObjectStorageCredential(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
+	create: func(ctx context.Context, app *setup.OpenCPApp, obj *opencpgrpc.ObjectStorageCredential) (*opencpgrpc.ObjectStorageCredential, error) {
+		return app.ObjectStorageCredential.CreateObjectStorageCredential(ctx, obj)
+	},
+	delete: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.ObjectStorageCredential, error) {
+		return app.ObjectStorageCredential.DeleteObjectStorageCredential(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
 }
@@ -0,0 +1,169 @@
+package opencp
+
+import (
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+
+	restful "github.com/emicklei/go-restful/v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// patchResource patches a opencp.io object, the content type of the request selects the kind of patch
+func patchResource[T any](r *restful.Request, w *restful.Response, res *resource[T]) {
+	contentType, _, err := mime.ParseMediaType(r.HeaderParameter("Content-Type"))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(unsupportedMediaType(r.HeaderParameter("Content-Type"))))
+		return
+	}
+
+	switch types.PatchType(contentType) {
+	case types.ApplyPatchType:
+		applyResource(r, w, res)
+	case types.JSONPatchType, types.MergePatchType, types.StrategicMergePatchType:
+		patchNotSupported(r, w, res)
+	default:
+		pkg.WriteStatus(w, pkg.RespondStatus(unsupportedMediaType(contentType)))
+	}
+}
+
+// patchNotSupported answers a patch that is not an apply, the backend has no update call so a
+// patch of an existing object is refused with a 405
+func patchNotSupported[T any](r *restful.Request, w *restful.Response, res *resource[T]) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	resolver := pkg.RequestInfoResolver()
+	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
+	if err != nil {
+		log.Println(err)
+	}
+
+	live, err := res.getObject(r.Request.Context(), app, apiRequestInfo.Namespace, apiRequestInfo.Name)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	if live == nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewNotFound(res.groupResource(), apiRequestInfo.Name)))
+		return
+	}
+	pkg.WriteStatus(w, pkg.RespondStatus(res.updateNotSupported()))
+}
+
+// fieldManagerName returns the manager of an update, the fieldManager parameter
+// or the name of the client from the user agent like the kube-apiserver does
+func fieldManagerName(r *restful.Request) string {
+	if fieldManager := r.QueryParameter("fieldManager"); fieldManager != "" {
+		return fieldManager
+	}
+
+	userAgent := strings.Split(r.HeaderParameter("User-Agent"), "/")[0]
+	if len(userAgent) > 128 {
+		userAgent = userAgent[:128]
+	}
+	if userAgent == "" {
+		return "unknown"
+	}
+	return userAgent
+}
+
+// applyResource creates the object from the applied configuration (server-side apply), the fields
+// are owned by the field manager of the apply. The backend has no update call, so the apply to an
+// existing object is refused with a 405
+func applyResource[T any](r *restful.Request, w *restful.Response, res *resource[T]) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	ctx := r.Request.Context()
+
+	resolver := pkg.RequestInfoResolver()
+	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
+	if err != nil {
+		log.Println(err)
+	}
+
+	fieldManager := r.QueryParameter("fieldManager")
+	if fieldManager == "" {
+		pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewBadRequest("fieldManager is required for apply patch")))
+		return
+	}
+	force := r.QueryParameter("force") == "true"
+
+	dryRun, err := pkg.DryRun(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	applied, err := decodeObject(r, res, apiRequestInfo.Namespace, apiRequestInfo.Name)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	live, err := res.getObject(ctx, app, apiRequestInfo.Namespace, apiRequestInfo.Name)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	if live != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(res.updateNotSupported()))
+		return
+	}
+
+	empty := &unstructured.Unstructured{}
+	empty.SetGroupVersionKind(res.groupVersionKind())
+	empty.SetName(apiRequestInfo.Name)
+	if res.namespaced {
+		empty.SetNamespace(apiRequestInfo.Namespace)
+	}
+
+	fieldManagerTracker, err := pkg.NewFieldManager(res.groupVersionKind(), "")
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	merged, err := fieldManagerTracker.Apply(empty, applied, fieldManager, force)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	mergedObj := merged.(*unstructured.Unstructured)
+	mergedManagedFields := mergedObj.GetManagedFields()
+	mergedObj.SetManagedFields(nil)
+
+	// The object has to be a valid v1alpha1 object
+	if err := validateObject(res, mergedObj); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	result, err := res.createObject(ctx, app, mergedObj, dryRun)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	result.SetManagedFields(mergedManagedFields)
+
+	pkg.WriteObject(r, w, http.StatusCreated, result)
+}
+
+func unsupportedMediaType(contentType string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusUnsupportedMediaType,
+		Reason:  metav1.StatusReasonUnsupportedMediaType,
+		Message: fmt.Sprintf("the patch content type %q is not supported", contentType),
+	}}
+}
@@ -0,0 +1,46 @@
+package opencp
+
+import (
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	opencpgrpc "github.com/opencontrolplane/opencp-spec/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// The opencp.io kinds have no protobuf representation of their own, they are sent
+// in the Kubernetes protobuf envelope as the protobuf messages of the backend
+func init() {
+	registerProtobuf[opencpgrpc.VirtualMachineList](virtualMachineResource)
+	registerProtobuf[opencpgrpc.KubernetesClusterList](kubernetesClusterResource)
+	registerProtobuf[opencpgrpc.FirewallList](firewallResource)
+	registerProtobuf[opencpgrpc.DatabaseList](databaseResource)
+	registerProtobuf[opencpgrpc.DomainList](domainResource)
+	registerProtobuf[opencpgrpc.SSHKeyList](sshKeyResource)
+	registerProtobuf[opencpgrpc.IpList](ipResource)
+	registerProtobuf[opencpgrpc.ObjectStorageList](objectStorageResource)
+	registerProtobuf[opencpgrpc.ObjectStorageCredentialList](objectStorageCredentialResource)
+}
+
+// registerProtobuf registers the backend messages of a kind and of its list
+func registerProtobuf[L any, T any, PL interface {
+	*L
+	proto.Message
+}, PT interface {
+	*T
+	proto.Message
+}](res *resource[T]) {
+	gvk := res.groupVersionKind()
+
+	pkg.RegisterProtobufKind(gvk, pkg.ProtobufKind{
+		New: func() proto.Message {
+			return PT(new(T))
+		},
+		FromBackend: func(message proto.Message) interface{} {
+			return res.fromBackend((*T)(message.(PT)))
+		},
+	})
+	pkg.RegisterProtobufKind(gvk.GroupVersion().WithKind(gvk.Kind+"List"), pkg.ProtobufKind{
+		New: func() proto.Message {
+			return PL(new(L))
+		},
+	})
+}
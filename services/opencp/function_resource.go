@@ -0,0 +1,231 @@
+package opencp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	restful "github.com/emicklei/go-restful/v3"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// statusSubresource is the subresource of the status of the objects
+const statusSubresource = "status"
+
+// resource describes how a opencp.io kind is read and written in the backend,
+// T is the backend representation of the kind
+type resource[T any] struct {
+	kind       string
+	resource   string
+	namespaced bool
+	// versioned returns a empty opencp.io/v1alpha1 object of the kind
+	versioned func() metav1.Object
+	// fromBackend converts the backend object to the v1alpha1 representation
+	fromBackend func(obj *T) metav1.Object
+	get         func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*T, error)
+	create      func(ctx context.Context, app *setup.OpenCPApp, obj *T) (*T, error)
+	delete      func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*T, error)
+}
+
+func (res *resource[T]) groupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: res.kind}
+}
+
+func (res *resource[T]) groupResource() schema.GroupResource {
+	return schema.GroupResource{Group: "opencp.io", Resource: res.resource}
+}
+
+// getObject returns the object from the backend, it is nil if the object does not exist
+func (res *resource[T]) getObject(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*unstructured.Unstructured, error) {
+	if !res.namespaced {
+		namespace = ""
+	}
+
+	obj, err := res.get(ctx, app, namespace, name)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if obj == nil {
+		return nil, nil
+	}
+
+	current, err := res.toObject(obj)
+	if err != nil {
+		return nil, err
+	}
+	observeStates(ctx, app, res.kind, []metav1.Object{current})
+	return current, nil
+}
+
+// createObject creates the object in the backend and returns the created one, the backend tells
+// if the object already exists. On a dry run the object is returned as it would be created without
+// persisting it
+func (res *resource[T]) createObject(ctx context.Context, app *setup.OpenCPApp, obj *unstructured.Unstructured, dryRun bool) (*unstructured.Unstructured, error) {
+	backendObj, err := res.fromObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		// The backend is not called, so an existing object is only found when it can be read
+		if live, err := res.getObject(ctx, app, obj.GetNamespace(), obj.GetName()); err == nil && live != nil {
+			return nil, apierrors.NewAlreadyExists(res.groupResource(), obj.GetName())
+		}
+		return res.dryRunObject(backendObj)
+	}
+
+	created, err := res.create(ctx, app, backendObj)
+	if status.Code(err) == codes.AlreadyExists {
+		return nil, apierrors.NewAlreadyExists(res.groupResource(), obj.GetName())
+	}
+	if err != nil {
+		recordFailure(ctx, app, objectReference(res.kind, obj), "FailedCreate", err)
+		return nil, err
+	}
+	if created == nil {
+		return nil, apierrors.NewInternalError(errors.New("the backend did not return the created object"))
+	}
+	return res.toObject(created)
+}
+
+// deleteObject deletes the object in the backend once it matches the preconditions of the options, it
+// returns the object and if its deletion is still in progress. On a dry run the object is only checked
+func (res *resource[T]) deleteObject(ctx context.Context, app *setup.OpenCPApp, namespace, name string, options metav1.DeleteOptions) (*unstructured.Unstructured, bool, error) {
+	if !res.namespaced {
+		namespace = ""
+	}
+
+	live, err := res.getObject(ctx, app, namespace, name)
+	if err != nil {
+		return nil, false, err
+	}
+	if live == nil {
+		return nil, false, apierrors.NewNotFound(res.groupResource(), name)
+	}
+	if err := pkg.CheckPreconditions(options, live, res.groupResource()); err != nil {
+		return nil, false, err
+	}
+
+	if len(options.DryRun) > 0 {
+		return live, false, nil
+	}
+
+	deleted, err := res.delete(ctx, app, namespace, name)
+	if status.Code(err) == codes.NotFound || (err == nil && deleted == nil) {
+		return nil, false, apierrors.NewNotFound(res.groupResource(), name)
+	}
+	if err != nil {
+		recordFailure(ctx, app, objectReference(res.kind, live), "FailedDelete", err)
+		return nil, false, err
+	}
+
+	// The deletion is in progress while the backend still has the object, like a virtual machine shutting down
+	current, err := res.getObject(ctx, app, namespace, name)
+	if err != nil || current == nil {
+		obj, err := res.toObject(deleted)
+		return obj, false, err
+	}
+	pkg.Terminating(current)
+	return current, true, nil
+}
+
+// dryRunObject returns the object as the backend would create it, the backend sets the
+// uid and creationTimestamp of the created objects so they are generated in the shim
+func (res *resource[T]) dryRunObject(backendObj *T) (*unstructured.Unstructured, error) {
+	obj, err := res.toObject(backendObj)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj.GetUID() == "" {
+		obj.SetUID(uuid.NewUUID())
+	}
+	if creationTimestamp := obj.GetCreationTimestamp(); creationTimestamp.IsZero() {
+		obj.SetCreationTimestamp(metav1.Now())
+	}
+	return obj, nil
+}
+
+// updateNotSupported is the error of the writes to an existing object of a kind the backend can not update
+func (res *resource[T]) updateNotSupported() error {
+	return apierrors.NewMethodNotSupported(res.groupResource(), "update")
+}
+
+// toObject converts the backend object to its opencp.io/v1alpha1 representation, the resourceVersion
+// is derived from the v1alpha1 object the same way as in the Get and List responses
+func (res *resource[T]) toObject(backendObj *T) (*unstructured.Unstructured, error) {
+	versioned := res.fromBackend(backendObj)
+	pkg.EnsureResourceVersion(versioned)
+
+	return pkg.ToUnstructured(versioned)
+}
+
+// fromObject converts the opencp.io/v1alpha1 object to the backend representation
+func (res *resource[T]) fromObject(obj *unstructured.Unstructured) (*T, error) {
+	// The resourceVersion belongs to the shim, the backend sets its own one if it has any
+	obj = obj.DeepCopy()
+	obj.SetResourceVersion("")
+
+	backendObj := new(T)
+	if err := pkg.ConvertTo(obj.Object, backendObj); err != nil {
+		return nil, apierrors.NewBadRequest(err.Error())
+	}
+	return backendObj, nil
+}
+
+// decodeObject reads the object in the body, in yaml or json, and checks it is for the object in the path,
+// the name is empty when the path is a collection
+func decodeObject[T any](r *restful.Request, res *resource[T], namespace, name string) (*unstructured.Unstructured, error) {
+	body, err := pkg.ReadBody(r)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("error reading body: %v", err))
+	}
+
+	objJSON, err := yaml.ToJSON(body)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("error decoding the object: %v", err))
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(objJSON); err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("error decoding the object: %v", err))
+	}
+
+	if obj.GroupVersionKind() != res.groupVersionKind() {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("the object is a %s, expected a %s", obj.GroupVersionKind(), res.groupVersionKind()))
+	}
+	if name != "" && obj.GetName() != name {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("the name of the object (%s) does not match the name on the URL (%s)", obj.GetName(), name))
+	}
+	if res.namespaced && obj.GetNamespace() != "" && obj.GetNamespace() != namespace {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("the namespace of the object (%s) does not match the namespace on the URL (%s)", obj.GetNamespace(), namespace))
+	}
+
+	return obj, nil
+}
+
+// validateObject checks the object is a valid v1alpha1 object of the kind
+func validateObject[T any](res *resource[T], obj *unstructured.Unstructured) error {
+	objJSON, err := obj.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(objJSON, res.versioned()); err != nil {
+		return apierrors.NewInvalid(res.groupVersionKind().GroupKind(), obj.GetName(), field.ErrorList{field.Invalid(field.NewPath("body"), "", err.Error())})
+	}
+	return nil
+}
@@ -1,11 +1,9 @@
 package opencp
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"log"
 	"net/http"
-	"strings"
 
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 	"github.com/opencontrolplane/opencp-shim/pkg"
@@ -14,13 +12,15 @@ import (
 
 	restful "github.com/emicklei/go-restful/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type SSHKeyInterface interface {
 	List(r *restful.Request, w *restful.Response)
 	Get(r *restful.Request, w *restful.Response)
 	Create(r *restful.Request, w *restful.Response)
-	// Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
 	Delete(r *restful.Request, w *restful.Response)
 }
 
@@ -42,45 +42,53 @@ func (s *SSHKey) List(r *restful.Request, w *restful.Response) {
 		log.Println(err)
 	}
 
-	// Check if we need filter the list
-	fileds := r.QueryParameter("fieldSelector")
-	allFields := make(map[string]string)
-	if fileds != "" {
-		filedsList := strings.Split(fileds, ",")
-		for _, field := range filedsList {
-			fieldSplit := strings.Split(field, "=")
-			allFields[fieldSplit[0]] = fieldSplit[1]
-		}
+	// Check if we need filter the list by fields
+	fieldSelector, err := pkg.FieldSelector(r, selectableFields(app, apiRequestInfo.Resource))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	// Get all the sshkey again and return them
-	var allSSHKey *opencpgrpc.SSHKeyList
-	if len(allFields) > 0 {
-		q := allFields["metadata.name"]
-		sshkey, err := app.SSHkey.GetSSHKey(r.Request.Context(), &opencpgrpc.FilterOptions{
-			Name: &q,
+	if pkg.IsWatch(r) {
+		watchResource(r, w, "SSHKey", func(ctx context.Context) ([]metav1.Object, error) {
+			allSSHKey, err := listSSHKeys(ctx, app, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(sshKeyObjects(allSSHKey)), nil
 		})
-		if err != nil {
-			allSSHKey = &opencpgrpc.SSHKeyList{}
-		}
+		return
+	}
 
-		if sshkey != nil {
-			allSSHKey.Items = append(allSSHKey.Items, sshkey)
-		}
-	} else {
-		allSSHKey, err = app.SSHkey.ListSSHKey(r.Request.Context(), &opencpgrpc.FilterOptions{})
+	// Get the page asked with limit and continue, the sshkeys are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	allSSHKey := &opencpgrpc.SSHKeyList{}
+	var listMeta metav1.ListMeta
+	allSSHKey.Items, listMeta, err = paginate(r, app, func() (string, []*opencpgrpc.SSHKey, error) {
+		list, err := listSSHKeys(r.Request.Context(), app, fieldSelector, labelSelector)
 		if err != nil {
-			respondStatus := pkg.RespondError(apiRequestInfo, "", "error listing sshkeys", err)
-			w.WriteAsJson(respondStatus)
-			return
+			return "", nil, err
 		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(sshKeyObjects(list))), list.Items, nil
+	}, sshKeyMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
 		for _, sshkey := range allSSHKey.Items {
 			tableRow = append(tableRow, metav1.TableRow{
-				Cells: []interface{}{sshkey.Metadata.Name, sshkey.Metadata.UID, sshkey.Metadata.CreationTimestamp, sshkey.Status.State},
+				Cells:  []interface{}{sshkey.Metadata.Name, sshkey.Metadata.UID, sshkey.Metadata.CreationTimestamp, sshkey.Status.State},
+				Object: pkg.RawObject(sshKeyFromBackend(sshkey)),
 			})
 		}
 
@@ -89,6 +97,7 @@ func (s *SSHKey) List(r *restful.Request, w *restful.Response) {
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Name", Type: "string", Format: "name", Description: "Name of the sshkey", Priority: 0},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the ssh key (from metadata)"},
@@ -98,40 +107,23 @@ func (s *SSHKey) List(r *restful.Request, w *restful.Response) {
 			Rows: tableRow,
 		}
 
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	sshkeyList := []v1alpha1.SSHKey{}
-	for _, ssh := range allSSHKey.Items {
-		sshKeySpec := v1alpha1.SSHKeySpec{}
-		sshKeyStatus := v1alpha1.SSHKeyStatus{}
-
-		pkg.CopyTo(ssh.Spec, &sshKeySpec)
-		pkg.CopyTo(ssh.Status, &sshKeyStatus)
-
-		sshkey := v1alpha1.SSHKey{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "SSHKey",
-				APIVersion: "opencp.io/v1alpha1",
-			},
-			ObjectMeta: *ssh.Metadata,
-			Spec:       sshKeySpec,
-			Status:     sshKeyStatus,
-		}
-		sshkeyList = append(sshkeyList, sshkey)
-	}
+	sshkeyList := sshKeyObjects(allSSHKey)
 
 	list := v1alpha1.SSHKeyList{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "SSHKeyList",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		Items: sshkeyList,
+		ListMeta: listMeta,
+		Items:    sshkeyList,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(list)
+	pkg.WriteObject(r, w, http.StatusOK, list)
 }
 
 // Get - Get a sshkey
@@ -152,19 +144,22 @@ func (s *SSHKey) Get(r *restful.Request, w *restful.Response) {
 	if err != nil {
 		// print the log
 		log.Println(err)
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
+		return
 	}
 
 	if sshkey == nil {
-		respondStatus := pkg.RespondNotFound(apiRequestInfo)
-		// print the request method and path
-		w.ResponseWriter.WriteHeader(http.StatusNotFound)
-		w.WriteAsJson(respondStatus)
+		pkg.WriteStatus(w, pkg.RespondNotFound(apiRequestInfo))
 		return
 	}
 
+	// Record the change of state seen as an event
+	observed := sshKeyFromBackend(sshkey)
+	observeState(r.Request.Context(), app, "SSHKey", &observed)
+
 	if pkg.CheckHeader(r) {
 		tableRow := []metav1.TableRow{}
-		cell := metav1.TableRow{Cells: []interface{}{sshkey.Metadata.Name, sshkey.Metadata.UID, sshkey.Metadata.CreationTimestamp, sshkey.Status.State}}
+		cell := metav1.TableRow{Cells: []interface{}{sshkey.Metadata.Name, sshkey.Metadata.UID, sshkey.Metadata.CreationTimestamp, sshkey.Status.State}, Object: pkg.RawObject(sshKeyFromBackend(sshkey))}
 		tableRow = append(tableRow, cell)
 
 		list := metav1.Table{
@@ -182,7 +177,7 @@ func (s *SSHKey) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -202,98 +197,111 @@ func (s *SSHKey) Get(r *restful.Request, w *restful.Response) {
 		Status:     sshkeyStatus,
 	}
 
+	pkg.EnsureResourceVersion(&sshKey)
+
 	// print the request method and path
-	w.WriteAsJson(sshKey)
+	pkg.WriteObject(r, w, http.StatusOK, sshKey)
 }
 
 // DomainCreate - Create a domain
 func (s *SSHKey) Create(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
-
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+	createResource(r, w, sshKeyResource)
+}
 
-	// Real all the body of the request and unmarshal it
-	body, err := io.ReadAll(r.Request.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
-	}
+// Delete - Delete a sshkey
+func (s *SSHKey) Delete(r *restful.Request, w *restful.Response) {
+	deleteResource(r, w, sshKeyResource)
+}
 
-	sshkeyOpenCP := opencpgrpc.SSHKey{}
-	err = json.Unmarshal(body, &sshkeyOpenCP)
-	if err != nil {
-		log.Fatalf("error: %v", err)
-	}
+// SSHKeyPatch patch a ssh key, server-side apply creates the ssh key if it does not exist
+func (s *SSHKey) Patch(r *restful.Request, w *restful.Response) {
+	patchResource(r, w, sshKeyResource)
+}
 
-	// Createn the sshkey
-	sshKey, err := app.SSHkey.CreateSSHKey(r.Request.Context(), &sshkeyOpenCP)
-	if err != nil {
-		respondStatus := pkg.RespondError(apiRequestInfo, sshkeyOpenCP.Metadata.Name, "error creating ssh key", err)
-		w.WriteAsJson(respondStatus)
-		return
+// listSSHKeys returns all the sshkeys matching the field and label selectors,
+// the one named in the field selector is read directly from the backend
+func listSSHKeys(ctx context.Context, app *setup.OpenCPApp, fieldSelector fields.Selector, labelSelector labels.Selector) (*opencpgrpc.SSHKeyList, error) {
+	sshKeyList := &opencpgrpc.SSHKeyList{}
+	if name, ok := fieldSelector.RequiresExactMatch("metadata.name"); ok {
+		item, err := app.SSHkey.GetSSHKey(ctx, &opencpgrpc.FilterOptions{Name: &name})
+		if err == nil && item != nil {
+			sshKeyList.Items = []*opencpgrpc.SSHKey{item}
+		}
+	} else {
+		var err error
+		sshKeyList, err = app.SSHkey.ListSSHKey(ctx, &opencpgrpc.FilterOptions{})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	sshkeySpec := v1alpha1.SSHKeySpec{}
-	sshkeyStatus := v1alpha1.SSHKeyStatus{}
+	sshKeyList.Items = pkg.FilterFields(sshKeyList.Items, fieldSelector, func(ssh *opencpgrpc.SSHKey) interface{} {
+		return sshKeyFromBackend(ssh)
+	})
+	sshKeyList.Items = pkg.FilterLabels(sshKeyList.Items, labelSelector, sshKeyMetadata)
 
-	pkg.CopyTo(sshKey.Spec, &sshkeySpec)
-	pkg.CopyTo(sshKey.Status, &sshkeyStatus)
+	// Record the changes of state seen in the list as events
+	observeStates(ctx, app, "SSHKey", pkg.ObjectList(sshKeyObjects(sshKeyList)))
+	return sshKeyList, nil
+}
 
-	sshkeyRespond := v1alpha1.SSHKey{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "SSHKey",
-			APIVersion: "opencp.io/v1alpha1",
-		},
-		ObjectMeta: *sshKey.Metadata,
-		Spec:       sshkeySpec,
-		Status:     sshkeyStatus,
+// sshKeyObjects converts the sshkeys from the backend to the v1alpha1 representation
+func sshKeyObjects(allSSHKey *opencpgrpc.SSHKeyList) []v1alpha1.SSHKey {
+	sshkeyList := []v1alpha1.SSHKey{}
+	for _, ssh := range allSSHKey.Items {
+		sshkeyList = append(sshkeyList, sshKeyFromBackend(ssh))
 	}
-	w.WriteAsJson(sshkeyRespond)
+
+	return sshkeyList
 }
 
-// Delete - Delete a sshkey
-func (s *SSHKey) Delete(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+// sshKeyMetadata returns the metadata of a ssh key from the backend
+func sshKeyMetadata(ssh *opencpgrpc.SSHKey) *metav1.ObjectMeta {
+	return ssh.Metadata
+}
 
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
+// sshKeyFromBackend converts a ssh key from the backend to the v1alpha1 representation
+func sshKeyFromBackend(ssh *opencpgrpc.SSHKey) v1alpha1.SSHKey {
+	var sshKeySpec v1alpha1.SSHKeySpec
+	var sshKeyStatus v1alpha1.SSHKeyStatus
 
-	respondStatus := metav1.Status{}
-	sshkey, err := app.SSHkey.DeleteSSHKey(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
-	if err != nil {
-		respondStatus = pkg.RespondError(apiRequestInfo, apiRequestInfo.Name, "error deleting sshkey", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
+	pkg.CopyTo(ssh.Spec, &sshKeySpec)
+	pkg.CopyTo(ssh.Status, &sshKeyStatus)
 
-	if sshkey != nil {
-		respondStatus = metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status: "Success",
-			Details: &metav1.StatusDetails{
-				Name:  sshkey.Metadata.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-				UID:   sshkey.Metadata.UID,
-			},
-		}
+	sshKey := v1alpha1.SSHKey{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "SSHKey",
+			APIVersion: "opencp.io/v1alpha1",
+		},
+		ObjectMeta: *ssh.Metadata,
+		Spec:       sshKeySpec,
+		Status:     sshKeyStatus,
 	}
 
-	if sshkey == nil {
-		respondStatus = pkg.RespondNotFound(apiRequestInfo)
-	}
+	// The resourceVersion is derived from the content when the backend does not set it
+	pkg.EnsureResourceVersion(&sshKey)
+	return sshKey
+}
 
-	// print the request method and path
-	w.WriteAsJson(respondStatus)
+// sshKeyResource reads and writes the ssh keys in the backend
+var sshKeyResource = &resource[opencpgrpc.SSHKey]{
+	kind:       "SSHKey",
+	resource:   "sshkeys",
+	namespaced: false,
+	versioned: func() metav1.Object {
+		return &v1alpha1.SSHKey{}
+	},
+	fromBackend: func(obj *opencpgrpc.SSHKey) metav1.Object {
+		sshKey := sshKeyFromBackend(obj)
+		return &sshKey
+	},
+	get: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.SSHKey, error) {
+		return app.SSHkey.GetSSHKey(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
+	create: func(ctx context.Context, app *setup.OpenCPApp, obj *opencpgrpc.SSHKey) (*opencpgrpc.SSHKey, error) {
+		return app.SSHkey.CreateSSHKey(ctx, obj)
+	},
+	delete: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.SSHKey, error) {
+		return app.SSHkey.DeleteSSHKey(ctx, &opencpgrpc.FilterOptions{Name: &name})
+	},
 }
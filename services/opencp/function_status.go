@@ -0,0 +1,76 @@
+package opencp
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	"github.com/opencontrolplane/opencp-spec/apis/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// statusHandlers are the handlers serving the status subresource of a resource, it is read only
+// as the backend has no update call, the Get of the resource serves it
+type statusHandlers struct {
+	get restful.RouteFunction
+	// object is the v1alpha1 object written in the OpenAPI spec
+	object interface{}
+}
+
+// StatusHandler registers the routes of the status subresources advertised in the discovery
+func (c *OpenCP) StatusHandler(registry []discovery.GroupVersion) {
+	handlers := map[string]statusHandlers{
+		"kubernetesclusters":       {c.Kubernetes.Get, v1alpha1.KubernetesCluster{}},
+		"virtualmachines":          {c.VirtualMachine.Get, v1alpha1.VirtualMachine{}},
+		"ips":                      {c.IP.Get, v1alpha1.IP{}},
+		"firewalls":                {c.Firewall.Get, v1alpha1.Firewall{}},
+		"domains":                  {c.Domain.Get, v1alpha1.Domain{}},
+		"sshkeys":                  {c.SSHKey.Get, v1alpha1.SSHKey{}},
+		"objectstorages":           {c.ObjectStorage.Get, v1alpha1.ObjectStorage{}},
+		"objectstoragecredentials": {c.ObjectStorageCredential.Get, v1alpha1.ObjectStorageCredential{}},
+		"databases":                {c.Database.Get, v1alpha1.Database{}},
+	}
+
+	groupVersion := schema.GroupVersion{Group: discovery.OpenCPGroup, Version: "v1alpha1"}
+	for _, apiResource := range discovery.Subresources(registry, groupVersion, statusSubresource) {
+		resourceName := strings.TrimSuffix(apiResource.Name, "/"+statusSubresource)
+		handler, ok := handlers[resourceName]
+		if !ok {
+			log.Printf("no status handlers for the resource %s", resourceName)
+			continue
+		}
+
+		path := "/" + resourceName + "/{name}/" + statusSubresource
+		if apiResource.Namespaced {
+			path = "/namespaces/{namespace}" + path
+		}
+		gvk := metav1.GroupVersionKind{Group: groupVersion.Group, Version: groupVersion.Version, Kind: apiResource.Kind}
+
+		// Only get is served, the backend can not update the status
+		readable := false
+		for _, verb := range apiResource.Verbs {
+			readable = readable || verb == "get"
+		}
+		if !readable {
+			continue
+		}
+
+		route := opencpAPI.GET(path).To(handler.get).
+			Doc("Read the status of a "+apiResource.Kind).Operation("read"+apiResource.Kind+"Status").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			Param(opencpAPI.PathParameter("name", "name of the "+apiResource.Kind).DataType("string")).
+			AddExtension("x-kubernetes-action", "get").
+			AddExtension("x-kubernetes-group-version-kind", gvk).
+			Writes(handler.object).
+			Returns(http.StatusOK, "OK", handler.object).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil)
+		if apiResource.Namespaced {
+			route.Param(opencpAPI.PathParameter("namespace", "namespace of the "+apiResource.Kind).DataType("string"))
+		}
+		opencpAPI.Route(route)
+	}
+}
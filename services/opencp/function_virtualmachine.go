@@ -1,12 +1,9 @@
 package opencp
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"context"
 	"log"
 	"net/http"
-	"strings"
 
 	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
 	"github.com/opencontrolplane/opencp-shim/pkg"
@@ -15,14 +12,15 @@ import (
 
 	restful "github.com/emicklei/go-restful/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type VirtualMachineInterface interface {
 	List(r *restful.Request, w *restful.Response)
 	Get(r *restful.Request, w *restful.Response)
 	Create(r *restful.Request, w *restful.Response)
-	// Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
 	Delete(r *restful.Request, w *restful.Response)
 }
 
@@ -45,31 +43,45 @@ func (v *VirtualMachine) List(r *restful.Request, w *restful.Response) {
 		log.Println(err)
 	}
 
-	// Check if we need filter the list
-	fileds := r.QueryParameter("fieldSelector")
-	allFields := make(map[string]string)
-	if fileds != "" {
-		filedsList := strings.Split(fileds, ",")
-		for _, field := range filedsList {
-			fieldSplit := strings.Split(field, "=")
-			allFields[fieldSplit[0]] = fieldSplit[1]
-		}
+	// Check if we need filter the list by fields
+	fieldSelector, err := pkg.FieldSelector(r, selectableFields(app, apiRequestInfo.Resource))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
-	// Get all the networks again and return them
-	var virtualMachineList *opencpgrpc.VirtualMachineList
-	if len(allFields) > 0 {
-		nameVm := allFields["metadata.name"]
-		virtualMachineList, err = app.VirtualMachine.ListVirtualMachine(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &nameVm})
-		if err != nil {
-			log.Println(err)
-		}
-	} else {
-		q := apiRequestInfo.Namespace
-		virtualMachineList, err = app.VirtualMachine.ListVirtualMachine(r.Request.Context(), &opencpgrpc.FilterOptions{Namespace: &q})
+	// Check if we need filter the list by labels
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if pkg.IsWatch(r) {
+		watchResource(r, w, "VirtualMachine", func(ctx context.Context) ([]metav1.Object, error) {
+			virtualMachineList, err := listVirtualMachines(ctx, app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
+			if err != nil {
+				return nil, err
+			}
+			return pkg.ObjectList(virtualMachineObjects(virtualMachineList)), nil
+		})
+		return
+	}
+
+	// Get the page asked with limit and continue, the virtual machines are only read for the first page,
+	// the next ones are cut from its list, the resourceVersion is the one of the whole list
+	virtualMachineList := &opencpgrpc.VirtualMachineList{}
+	var listMeta metav1.ListMeta
+	virtualMachineList.Items, listMeta, err = paginate(r, app, func() (string, []*opencpgrpc.VirtualMachine, error) {
+		list, err := listVirtualMachines(r.Request.Context(), app, apiRequestInfo.Namespace, fieldSelector, labelSelector)
 		if err != nil {
-			log.Println(err)
+			return "", nil, err
 		}
+		return pkg.ListResourceVersion(r, pkg.ObjectList(virtualMachineObjects(list))), list.Items, nil
+	}, virtualMachineMetadata)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
 	}
 
 	if pkg.CheckHeader(r) {
@@ -82,20 +94,8 @@ func (v *VirtualMachine) List(r *restful.Request, w *restful.Response) {
 			// }
 
 			cell := metav1.TableRow{
-				Cells: []interface{}{vm.Metadata.Name, vm.Metadata.UID, vm.Spec.Size, vm.Status.PublicIP, vm.Status.PrivateIP, vm.Status.State},
-				Object: runtime.RawExtension{
-					Object: &metav1.PartialObjectMetadata{
-						TypeMeta: metav1.TypeMeta{
-							Kind:       "VirtualMachine",
-							APIVersion: "opencp.io/v1alpha1",
-						},
-						ObjectMeta: metav1.ObjectMeta{
-							Name:      vm.Metadata.Name,
-							UID:       vm.Metadata.UID,
-							Namespace: vm.Metadata.Namespace,
-						},
-					},
-				},
+				Cells:  []interface{}{vm.Metadata.Name, vm.Metadata.UID, vm.Spec.Size, vm.Status.PublicIP, vm.Status.PrivateIP, vm.Status.State},
+				Object: pkg.RawObject(virtualMachineFromBackend(vm)),
 			}
 			tableRow = append(tableRow, cell)
 
@@ -106,6 +106,7 @@ func (v *VirtualMachine) List(r *restful.Request, w *restful.Response) {
 				Kind:       "Table",
 				APIVersion: "meta.k8s.io/v1",
 			},
+			ListMeta: listMeta,
 			ColumnDefinitions: []metav1.TableColumnDefinition{
 				{Name: "Hostname", Type: "string", Format: "name", Description: "Hostname of the instance"},
 				{Name: "UID", Type: "string", Format: "string", Description: "UID of the instance (from metadata)"},
@@ -120,45 +121,23 @@ func (v *VirtualMachine) List(r *restful.Request, w *restful.Response) {
 			Rows: tableRow,
 		}
 
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
-	vmList := []v1alpha1.VirtualMachine{}
-	for _, vm := range virtualMachineList.Items {
-		// lasyApply, err := pkg.LastAppliedConfig(ctx, etcdObjectReader, network.Label, &vm, "VirtualMachine")
-		// if err != nil {
-		// 	log.Println(err)
-		// }
-		var emptyVirtualMachineSpec v1alpha1.VirtualMachineSpec
-		var emptyVirtualMachineStatus v1alpha1.VirtualMachineStatus
-
-		pkg.CopyTo(vm.Spec, &emptyVirtualMachineSpec)
-		pkg.CopyTo(vm.Status, &emptyVirtualMachineStatus)
-
-		vm := v1alpha1.VirtualMachine{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "VirtualMachine",
-				APIVersion: "opencp.io/v1alpha1",
-			},
-			ObjectMeta: *vm.Metadata,
-			Spec:       emptyVirtualMachineSpec,
-			Status:     emptyVirtualMachineStatus,
-		}
-
-		vmList = append(vmList, vm)
-	}
+	vmList := virtualMachineObjects(virtualMachineList)
 
 	list := v1alpha1.VirtualMachineList{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "VirtualMachineList",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		Items: vmList,
+		ListMeta: listMeta,
+		Items:    vmList,
 	}
 
 	// print the request method and path
-	w.WriteAsJson(list)
+	pkg.WriteObject(r, w, http.StatusOK, list)
 }
 
 // VirtualMachineGet get a virtual machine
@@ -175,35 +154,21 @@ func (v *VirtualMachine) Get(r *restful.Request, w *restful.Response) {
 	virtualMachine, err := app.VirtualMachine.GetVirtualMachine(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name, Namespace: &apiRequestInfo.Namespace})
 	if err != nil {
 		log.Println(err)
-		w.WriteAsJson(pkg.RespondNotFound(apiRequestInfo))
+		pkg.WriteStatus(w, pkg.RespondGetError(apiRequestInfo, err))
 		return
 	}
 
 	if virtualMachine == nil {
-		respondStatus := metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status:  "Failure",
-			Reason:  metav1.StatusReasonNotFound,
-			Code:    http.StatusNotFound,
-			Message: fmt.Sprintf("Virtual Machine %s not found", apiRequestInfo.Name),
-			Details: &metav1.StatusDetails{
-				Name:  apiRequestInfo.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-			},
-		}
-
-		// print the request method and path
-		w.ResponseWriter.WriteHeader(http.StatusNotFound)
-		w.WriteAsJson(respondStatus)
+		pkg.WriteStatus(w, pkg.RespondNotFound(apiRequestInfo))
 		return
 	}
 
+	// Record the change of state seen as an event
+	observed := virtualMachineFromBackend(virtualMachine)
+	observeState(r.Request.Context(), app, "VirtualMachine", &observed)
+
 	if pkg.CheckHeader(r) {
-		tableRow := []metav1.TableRow{{Cells: []interface{}{virtualMachine.Metadata.Name, virtualMachine.Metadata.UID, virtualMachine.Spec.Size, virtualMachine.Status.PublicIP, virtualMachine.Status.PrivateIP, virtualMachine.Status.State}}}
+		tableRow := []metav1.TableRow{{Cells: []interface{}{virtualMachine.Metadata.Name, virtualMachine.Metadata.UID, virtualMachine.Spec.Size, virtualMachine.Status.PublicIP, virtualMachine.Status.PrivateIP, virtualMachine.Status.State}, Object: pkg.RawObject(virtualMachineFromBackend(virtualMachine))}}
 
 		list := metav1.Table{
 			TypeMeta: metav1.TypeMeta{
@@ -222,7 +187,7 @@ func (v *VirtualMachine) Get(r *restful.Request, w *restful.Response) {
 		}
 
 		// print the request method and path
-		w.WriteAsJson(list)
+		pkg.WriteObject(r, w, http.StatusOK, list)
 		return
 	}
 
@@ -242,148 +207,110 @@ func (v *VirtualMachine) Get(r *restful.Request, w *restful.Response) {
 		Status:     virtualMachineStatus,
 	}
 
+	pkg.EnsureResourceVersion(&virtualMachineRespond)
+
 	// print the request method and path
-	w.WriteAsJson(virtualMachineRespond)
+	pkg.WriteObject(r, w, http.StatusOK, virtualMachineRespond)
 }
 
 // VirtualMachineCreate create a new virtual machine
 func (v *VirtualMachine) Create(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
+	createResource(r, w, virtualMachineResource)
+}
+
+// VirtualMachineDelete delete a kubernetes cluster
+func (v *VirtualMachine) Delete(r *restful.Request, w *restful.Response) {
+	deleteResource(r, w, virtualMachineResource)
+}
 
-	// resolver := pkg.RequestInfoResolver()
-	// apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	// if err != nil {
-	// 	log.Println(err)
-	// }
+// VirtualMachinePatch patch a virtual machine, server-side apply creates the virtual machine if it does not exist
+func (v *VirtualMachine) Patch(r *restful.Request, w *restful.Response) {
+	patchResource(r, w, virtualMachineResource)
+}
 
-	// Real all the body of the request and unmarshal it
-	body, err := io.ReadAll(r.Request.Body)
-	if err != nil {
-		log.Printf("Error reading body: %v", err)
+// listVirtualMachines returns the virtual machines in a namespace matching the field and label selectors, the name
+// and namespace in the field selector are passed to the backend
+func listVirtualMachines(ctx context.Context, app *setup.OpenCPApp, namespace string, fieldSelector fields.Selector, labelSelector labels.Selector) (*opencpgrpc.VirtualMachineList, error) {
+	if fieldNamespace, ok := fieldSelector.RequiresExactMatch("metadata.namespace"); ok && namespace == "" {
+		namespace = fieldNamespace
+	}
+	filter := &opencpgrpc.FilterOptions{Namespace: &namespace}
+	if name, ok := fieldSelector.RequiresExactMatch("metadata.name"); ok {
+		filter.Name = &name
 	}
 
-	virtualMachine := &opencpgrpc.VirtualMachine{}
-	err = json.Unmarshal(body, &virtualMachine)
+	virtualMachineList, err := app.VirtualMachine.ListVirtualMachine(ctx, filter)
 	if err != nil {
-		log.Fatalf("error: %v", err)
+		return nil, err
 	}
 
-	// err = etcdObjectReader.SetStoredCustomResource(virtualMachine.Namespace, virtualMachine.Name, virtualMachine.Annotations[corev1.LastAppliedConfigAnnotation])
-	// if err != nil {
-	// 	log.Println(err)
-	// }
-
-	// getDiskImage, err := client.FindDiskImage(virtualMachine.Spec.Image)
-	// if err != nil {
-	// 	log.Println(err)
-	// }
-
-	// // Create the VM
-	// vm := &civogo.InstanceConfig{
-	// 	Hostname:         virtualMachine.Name,
-	// 	ReverseDNS:       virtualMachine.Name,
-	// 	Size:             virtualMachine.Spec.Size,
-	// 	Region:           client.Region,
-	// 	PublicIPRequired: strconv.FormatBool(virtualMachine.Spec.Ipv4),
-	// 	NetworkID:        getNetwork.ID,
-	// 	TemplateID:       getDiskImage.ID,
-	// 	Script:           virtualMachine.Spec.UserScript,
-	// 	Tags:             virtualMachine.Spec.Tags,
-	// }
-
-	// // Check the firewall
-	// if virtualMachine.Spec.Firewall != "" {
-	// 	getFirewall, err := client.FindFirewall(virtualMachine.Spec.Firewall)
-	// 	if err != nil {
-	// 		log.Println(err)
-	// 	}
-	// 	vm.FirewallID = getFirewall.ID
-	// }
-
-	// if virtualMachine.Spec.Auth.User != "" {
-	// 	vm.InitialUser = virtualMachine.Spec.Auth.User
-	// }
-
-	// if virtualMachine.Spec.Auth.SSHKey != "" {
-	// 	vm.SSHKeyID = virtualMachine.Spec.Auth.SSHKey
-	// }
-
-	virtualMachine, err = app.VirtualMachine.CreateVirtualMachine(r.Request.Context(), virtualMachine)
-	if err != nil {
-		log.Println(err)
+	virtualMachineList.Items = pkg.FilterFields(virtualMachineList.Items, fieldSelector, func(vm *opencpgrpc.VirtualMachine) interface{} {
+		return virtualMachineFromBackend(vm)
+	})
+	virtualMachineList.Items = pkg.FilterLabels(virtualMachineList.Items, labelSelector, virtualMachineMetadata)
+
+	// Record the changes of state seen in the list as events
+	observeStates(ctx, app, "VirtualMachine", pkg.ObjectList(virtualMachineObjects(virtualMachineList)))
+	return virtualMachineList, nil
+}
+
+// virtualMachineObjects converts the virtual machines from the backend to the v1alpha1 representation
+func virtualMachineObjects(virtualMachineList *opencpgrpc.VirtualMachineList) []v1alpha1.VirtualMachine {
+	vmList := []v1alpha1.VirtualMachine{}
+	for _, vm := range virtualMachineList.Items {
+		vmList = append(vmList, virtualMachineFromBackend(vm))
 	}
 
-	// // Get last applied config
-	// lasyApply, err := etcdObjectReader.GetStoredCustomResource(getNetwork.Label, instance.Hostname)
-	// if err != nil {
-	// 	if errors.Is(err, pkg.ErrNotFound) {
-	// 		log.Println(err)
-	// 		// Add to etcd
-	// 	}
-	// }
+	return vmList
+}
+
+// virtualMachineMetadata returns the metadata of a virtual machine from the backend
+func virtualMachineMetadata(vm *opencpgrpc.VirtualMachine) *metav1.ObjectMeta {
+	return vm.Metadata
+}
 
+// virtualMachineFromBackend converts a virtual machine from the backend to the v1alpha1 representation
+func virtualMachineFromBackend(vm *opencpgrpc.VirtualMachine) v1alpha1.VirtualMachine {
 	var virtualMachineSpec v1alpha1.VirtualMachineSpec
 	var virtualMachineStatus v1alpha1.VirtualMachineStatus
 
-	pkg.CopyTo(virtualMachine.Spec, &virtualMachineSpec)
-	pkg.CopyTo(virtualMachine.Status, &virtualMachineStatus)
+	pkg.CopyTo(vm.Spec, &virtualMachineSpec)
+	pkg.CopyTo(vm.Status, &virtualMachineStatus)
 
-	virtualMachineRespond := v1alpha1.VirtualMachine{
+	virtualMachine := v1alpha1.VirtualMachine{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "VirtualMachine",
 			APIVersion: "opencp.io/v1alpha1",
 		},
-		ObjectMeta: *virtualMachine.Metadata,
+		ObjectMeta: *vm.Metadata,
 		Spec:       virtualMachineSpec,
 		Status:     virtualMachineStatus,
 	}
 
-	// w.WriteAsJson(virtualMachineRespond)
-	w.WriteAsJson(virtualMachineRespond)
+	// The resourceVersion is derived from the content when the backend does not set it
+	pkg.EnsureResourceVersion(&virtualMachine)
+	return virtualMachine
 }
 
-// VirtualMachineDelete delete a kubernetes cluster
-func (v *VirtualMachine) Delete(r *restful.Request, w *restful.Response) {
-	// Get the app config
-	app := r.Attribute("app").(*setup.OpenCPApp)
-
-	resolver := pkg.RequestInfoResolver()
-	apiRequestInfo, err := resolver.NewRequestInfo(r.Request)
-	if err != nil {
-		log.Println(err)
-	}
-
-	respondStatus := metav1.Status{}
-	// Send to delete the virtual machine
-	virtualMachine, err := app.VirtualMachine.DeleteVirtualMachine(r.Request.Context(), &opencpgrpc.FilterOptions{Name: &apiRequestInfo.Name})
-	if err != nil {
-		respondStatus := pkg.RespondError(apiRequestInfo, apiRequestInfo.Name, "error deleting the virtual machine", err)
-		w.WriteAsJson(respondStatus)
-		return
-	}
-
-	if virtualMachine != nil {
-		respondStatus = metav1.Status{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Status",
-				APIVersion: "v1",
-			},
-			Status: metav1.StatusSuccess,
-			Details: &metav1.StatusDetails{
-				Name:  virtualMachine.Metadata.Name,
-				Group: apiRequestInfo.APIGroup,
-				Kind:  apiRequestInfo.Resource,
-				UID:   virtualMachine.Metadata.UID,
-			},
-		}
-	}
-
-	if virtualMachine == nil {
-		respondStatus = pkg.RespondNotFound(apiRequestInfo)
-		return
-	}
-
-	// Respond with the status
-	w.WriteAsJson(respondStatus)
+// virtualMachineResource reads and writes the virtual machines in the backend
+var virtualMachineResource = &resource[opencpgrpc.VirtualMachine]{
+	kind:       "VirtualMachine",
+	resource:   "virtualmachines",
+	namespaced: true,
+	versioned: func() metav1.Object {
+		return &v1alpha1.VirtualMachine{}
+	},
+	fromBackend: func(obj *opencpgrpc.VirtualMachine) metav1.Object {
+		virtualMachine := virtualMachineFromBackend(obj)
+		return &virtualMachine
+	},
+	get: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.VirtualMachine, error) {
+		return app.VirtualMachine.GetVirtualMachine(ctx, &opencpgrpc.FilterOptions{Name: &name, Namespace: &namespace})
+	},
+	create: func(ctx context.Context, app *setup.OpenCPApp, obj *opencpgrpc.VirtualMachine) (*opencpgrpc.VirtualMachine, error) {
+		return app.VirtualMachine.CreateVirtualMachine(ctx, obj)
+	},
+	delete: func(ctx context.Context, app *setup.OpenCPApp, namespace, name string) (*opencpgrpc.VirtualMachine, error) {
+		return app.VirtualMachine.DeleteVirtualMachine(ctx, &opencpgrpc.FilterOptions{Name: &name, Namespace: &namespace})
+	},
 }
@@ -0,0 +1,25 @@
+package opencp
+
+import (
+	restful "github.com/emicklei/go-restful/v3"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// watchResource streams the changes of a opencp.io collection, listing it with the given function
+func watchResource(r *restful.Request, w *restful.Response, kind string, list pkg.WatchListFunc) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	opts := pkg.WatchOptions{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       kind,
+			APIVersion: "opencp.io/v1alpha1",
+		},
+		PollInterval:     app.Config.Watch.PollInterval,
+		BookmarkInterval: app.Config.Watch.BookmarkInterval,
+	}
+
+	pkg.Watch(r, w, opts, list)
+}
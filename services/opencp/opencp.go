@@ -6,11 +6,12 @@ import (
 
 	restfulspec "github.com/emicklei/go-restful-openapi/v2"
 	restful "github.com/emicklei/go-restful/v3"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	"github.com/opencontrolplane/opencp-shim/pkg"
 	"github.com/opencontrolplane/opencp-spec/apis/v1alpha1"
 
 	// clientv3 "go.etcd.io/etcd/client/v3"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 )
 
@@ -28,10 +29,12 @@ type OpenCP struct {
 	ObjectStorage           ObjectStorageInterface
 	ObjectStorageCredential ObjectStorageCredentialInterface
 	Database                DatabaseInterface
+	// registry is the discovery, the routes of the verbs it does not advertise are not registered
+	registry []discovery.GroupVersion
 }
 
 func init() {
-	opencpAPI = new(restful.WebService).Path("/apis/opencp.io/v1alpha1").Consumes(restful.MIME_JSON, "application/yaml").Produces(restful.MIME_JSON, "application/yaml")
+	opencpAPI = new(restful.WebService).Path("/apis/opencp.io/v1alpha1").Consumes(restful.MIME_JSON, pkg.MIME_YAML, pkg.MIME_PROTOBUF).Produces(restful.MIME_JSON, pkg.MIME_YAML, pkg.MIME_PROTOBUF)
 }
 
 func NewOpenCP() *OpenCP {
@@ -48,7 +51,8 @@ func NewOpenCP() *OpenCP {
 	}
 }
 
-func (c *OpenCP) OpenCP() []*restful.WebService {
+func (c *OpenCP) OpenCP(registry []discovery.GroupVersion) []*restful.WebService {
+	c.registry = registry
 
 	// API Resource List
 	opencpAPI.Route(opencpAPI.GET("").To(c.apiResourceListv1alpha1))
@@ -62,6 +66,7 @@ func (c *OpenCP) OpenCP() []*restful.WebService {
 	c.ObjectStorageHandler()
 	c.ObjectStorageCredentialHandler()
 	c.DatabaseHandler()
+	c.StatusHandler(registry)
 
 	return []*restful.WebService{opencpAPI}
 }
@@ -77,7 +82,7 @@ func (c *OpenCP) KubernetesHandler() {
 		Returns(http.StatusOK, "OK", v1alpha1.KuberenetesClusterList{}).
 		// add extra metadata to the response
 		AddExtension("x-kubernetes-action", "list").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KuberenetesCluster"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KubernetesCluster"}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.GET("/namespaces/{namespace}/kubernetesclusters").To(c.Kubernetes.List).
 		// Doc
@@ -85,7 +90,7 @@ func (c *OpenCP) KubernetesHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
 		AddExtension("x-kubernetes-action", "list").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KuberenetesCluster"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KubernetesCluster"}).
 		Writes(v1alpha1.KuberenetesClusterList{}).
 		Returns(http.StatusOK, "OK", v1alpha1.KuberenetesClusterList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -96,7 +101,7 @@ func (c *OpenCP) KubernetesHandler() {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
 		Param(opencpAPI.PathParameter("clustername", "name of the kubernetes cluster").DataType("string")).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KuberenetesCluster"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KubernetesCluster"}).
 		Writes(v1alpha1.KubernetesCluster{}).
 		Returns(http.StatusOK, "OK", v1alpha1.KubernetesCluster{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -106,22 +111,28 @@ func (c *OpenCP) KubernetesHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
 		AddExtension("x-kubernetes-action", "post").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KuberenetesCluster"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KubernetesCluster"}).
 		Writes(v1alpha1.KubernetesCluster{}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.KubernetesCluster{}).
-		Returns(http.StatusUnauthorized, "Unauthorized", nil))
-	opencpAPI.Route(opencpAPI.PATCH("/namespaces/{namespace}/kubernetesclusters/{clustername}").To(c.Kubernetes.Update).
-		// Doc
-		Consumes(string(types.JSONPatchType), string(types.MergePatchType)).
-		Doc("Update a kubernetes cluster in a namespace").Operation("KubernetesUpdateByNamespace").
-		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
-		Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
-		Param(opencpAPI.PathParameter("clustername", "name of the kubernetes cluster").DataType("string")).
-		AddExtension("x-kubernetes-action", "patch").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KuberenetesCluster"}).
-		Writes(v1alpha1.KubernetesCluster{}).
-		Returns(http.StatusOK, "OK", v1alpha1.KubernetesCluster{}).
-		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+		Returns(http.StatusCreated, "Created", v1alpha1.KubernetesCluster{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	if c.serves("kubernetesclusters", "patch") {
+		opencpAPI.Route(opencpAPI.PATCH("/namespaces/{namespace}/kubernetesclusters/{clustername}").To(c.Kubernetes.Patch).
+			// Doc
+			Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+			Doc("Patch a kubernetes cluster in a namespace").Operation("KubernetesPatchByNamespace").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
+			Param(opencpAPI.PathParameter("clustername", "name of the kubernetes cluster").DataType("string")).
+			AddExtension("x-kubernetes-action", "patch").
+			AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KubernetesCluster"}).
+			Writes(v1alpha1.KubernetesCluster{}).
+			Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+			Returns(http.StatusOK, "OK", v1alpha1.KubernetesCluster{}).
+			Returns(http.StatusCreated, "Created", v1alpha1.KubernetesCluster{}).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	}
 	opencpAPI.Route(opencpAPI.DELETE("/namespaces/{namespace}/kubernetesclusters/{clustername}").To(c.Kubernetes.Delete).
 		// Doc
 		Doc("Delete a kubernetes cluster in a namespace").Operation("KubernetesDeleteByNamespace").
@@ -129,8 +140,12 @@ func (c *OpenCP) KubernetesHandler() {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
 		Param(opencpAPI.PathParameter("clustername", "name of the kubernetes cluster").DataType("string")).
 		AddExtension("x-kubernetes-action", "delete").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KuberenetesCluster"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "KubernetesCluster"}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+		Param(opencpAPI.QueryParameter("gracePeriodSeconds", "accepted for compatibility, the backend has no grace period and deletes the object on its own terms").DataType("integer")).
+		Param(opencpAPI.QueryParameter("propagationPolicy", "accepted for compatibility, the backend decides what happens to the dependent resources").DataType("string")).
 		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusAccepted, "Accepted", nil).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 }
 
@@ -141,6 +156,7 @@ func (c *OpenCP) IPHandler() {
 		// Doc
 		Doc("get all civo ip").Operation("IPList").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "IP"}).
 		Writes(v1alpha1.IPList{}).
 		Returns(http.StatusOK, "OK", v1alpha1.IPList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -148,24 +164,47 @@ func (c *OpenCP) IPHandler() {
 		// Doc
 		Doc("create civo IP").Operation("IPGet").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "IP"}).
 		Writes(v1alpha1.IP{}).
 		Param(opencpAPI.PathParameter("ipname", "name of the ip").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.IP{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	if c.serves("ips", "patch") {
+		opencpAPI.Route(opencpAPI.PATCH("/ips/{ipname}").To(c.IP.Patch).
+			// Doc
+			Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+			Doc("patch civo IP").Operation("IPPatch").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "IP"}).
+			Writes(v1alpha1.IP{}).
+			Param(opencpAPI.PathParameter("ipname", "name of the ip").DataType("string")).
+			Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+			Returns(http.StatusOK, "OK", v1alpha1.IP{}).
+			Returns(http.StatusCreated, "Created", v1alpha1.IP{}).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	}
 	opencpAPI.Route(opencpAPI.DELETE("/ips/{ipname}").To(c.IP.Delete).
 		// Doc
 		Doc("delete civo IP").Operation("IPDelete").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "IP"}).
 		Writes(metav1.Status{}).
 		Param(opencpAPI.PathParameter("ipname", "name of the ip").DataType("string")).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+		Param(opencpAPI.QueryParameter("gracePeriodSeconds", "accepted for compatibility, the backend has no grace period and deletes the object on its own terms").DataType("integer")).
+		Param(opencpAPI.QueryParameter("propagationPolicy", "accepted for compatibility, the backend decides what happens to the dependent resources").DataType("string")).
 		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusAccepted, "Accepted", nil).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.POST("/ips").To(c.IP.Create).
 		// Doc
 		Doc("Create a civo IP").Operation("IPCreate").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "IP"}).
 		Writes(v1alpha1.IP{}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.IP{}).
+		Returns(http.StatusCreated, "Created", v1alpha1.IP{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 }
 
@@ -177,6 +216,7 @@ func (c *OpenCP) VirtualMachineHandler() {
 		Doc("List all Virtual Machine").Operation("VirtualMachineList").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Operation("VirtualMachineList").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "VirtualMachine"}).
 		Writes(v1alpha1.VirtualMachineList{}).
 		Returns(http.StatusOK, "OK", v1alpha1.VirtualMachineList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -186,6 +226,7 @@ func (c *OpenCP) VirtualMachineHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Operation("VirtualMachineListNamespace").
 		Param(opencpAPI.PathParameter("namespace", "namespace of the virtual machine cluster").DataType("string")).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "VirtualMachine"}).
 		Writes(v1alpha1.VirtualMachineList{}).
 		Returns(http.StatusOK, "OK", v1alpha1.VirtualMachineList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -196,7 +237,7 @@ func (c *OpenCP) VirtualMachineHandler() {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
 		Param(opencpAPI.PathParameter("virtualmachine", "name of the virtual machine").DataType("string")).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "VirtualMachine"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "VirtualMachine"}).
 		Writes(v1alpha1.VirtualMachine{}).
 		Returns(http.StatusOK, "OK", v1alpha1.VirtualMachine{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -206,10 +247,28 @@ func (c *OpenCP) VirtualMachineHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("namespace", "namespace of the virtual machine").DataType("string")).
 		AddExtension("x-kubernetes-action", "post").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "VirtualMachine"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "VirtualMachine"}).
 		Writes(v1alpha1.VirtualMachine{}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.VirtualMachine{}).
-		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+		Returns(http.StatusCreated, "Created", v1alpha1.VirtualMachine{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	if c.serves("virtualmachines", "patch") {
+		opencpAPI.Route(opencpAPI.PATCH("/namespaces/{namespace}/virtualmachines/{virtualmachine}").To(c.VirtualMachine.Patch).
+			// Doc
+			Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+			Doc("Patch a virtual machine in a namespace").Operation("VirtualMachinePatchByNamespace").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
+			Param(opencpAPI.PathParameter("virtualmachine", "name of the virtual machine").DataType("string")).
+			AddExtension("x-kubernetes-action", "patch").
+			AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "VirtualMachine"}).
+			Writes(v1alpha1.VirtualMachine{}).
+			Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+			Returns(http.StatusOK, "OK", v1alpha1.VirtualMachine{}).
+			Returns(http.StatusCreated, "Created", v1alpha1.VirtualMachine{}).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	}
 	opencpAPI.Route(opencpAPI.DELETE("/namespaces/{namespace}/virtualmachines/{virtualmachine}").To(c.VirtualMachine.Delete).
 		// Doc
 		Doc("Delete a virtual machine in a namespace").Operation("VirtualMachineDeleteByNamespace").
@@ -217,8 +276,12 @@ func (c *OpenCP) VirtualMachineHandler() {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the kubernetes cluster").DataType("string")).
 		Param(opencpAPI.PathParameter("virtualmachine", "name of the virtual machine").DataType("string")).
 		AddExtension("x-kubernetes-action", "delete").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "VirtualMachine"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "VirtualMachine"}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+		Param(opencpAPI.QueryParameter("gracePeriodSeconds", "accepted for compatibility, the backend has no grace period and deletes the object on its own terms").DataType("integer")).
+		Param(opencpAPI.QueryParameter("propagationPolicy", "accepted for compatibility, the backend decides what happens to the dependent resources").DataType("string")).
 		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusAccepted, "Accepted", nil).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 }
 
@@ -231,7 +294,7 @@ func (c *OpenCP) FirewallHandler() {
 		Operation("FirewallsList").
 		Writes(v1alpha1.FirewallList{}).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
 		Returns(http.StatusOK, "OK", v1alpha1.FirewallList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.GET("/namespaces/{namespace}/firewalls").To(c.Firewall.List).
@@ -242,7 +305,7 @@ func (c *OpenCP) FirewallHandler() {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the firewall").DataType("string")).
 		Writes(v1alpha1.FirewallList{}).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
 		Returns(http.StatusOK, "OK", v1alpha1.FirewallList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.GET("/namespaces/{namespace}/firewalls/{firewall}").To(c.Firewall.Get).
@@ -252,7 +315,7 @@ func (c *OpenCP) FirewallHandler() {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the firewall").DataType("string")).
 		Param(opencpAPI.PathParameter("firewall", "name of the firewall").DataType("string")).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
 		Writes(v1alpha1.Firewall{}).
 		Returns(http.StatusOK, "OK", v1alpha1.Firewall{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -262,10 +325,28 @@ func (c *OpenCP) FirewallHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("namespace", "namespace of the firewall").DataType("string")).
 		AddExtension("x-kubernetes-action", "post").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
 		Writes(v1alpha1.Firewall{}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.Firewall{}).
-		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+		Returns(http.StatusCreated, "Created", v1alpha1.Firewall{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	if c.serves("firewalls", "patch") {
+		opencpAPI.Route(opencpAPI.PATCH("/namespaces/{namespace}/firewalls/{firewall}").To(c.Firewall.Patch).
+			// Doc
+			Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+			Doc("Patch a firewall in a namespace").Operation("FirewallPatchByNamespace").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			Param(opencpAPI.PathParameter("namespace", "namespace of the firewall").DataType("string")).
+			Param(opencpAPI.PathParameter("firewall", "name of firewall").DataType("string")).
+			AddExtension("x-kubernetes-action", "patch").
+			AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
+			Writes(v1alpha1.Firewall{}).
+			Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+			Returns(http.StatusOK, "OK", v1alpha1.Firewall{}).
+			Returns(http.StatusCreated, "Created", v1alpha1.Firewall{}).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	}
 	opencpAPI.Route(opencpAPI.DELETE("/namespaces/{namespace}/firewalls/{firewall}").To(c.Firewall.Delete).
 		// Doc
 		Doc("Delete a firewall in a namespace").Operation("FirewallDeleteByNamespace").
@@ -273,8 +354,12 @@ func (c *OpenCP) FirewallHandler() {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the firewall").DataType("string")).
 		Param(opencpAPI.PathParameter("firewall", "name of firewall").DataType("string")).
 		AddExtension("x-kubernetes-action", "delete").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Firewall"}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+		Param(opencpAPI.QueryParameter("gracePeriodSeconds", "accepted for compatibility, the backend has no grace period and deletes the object on its own terms").DataType("integer")).
+		Param(opencpAPI.QueryParameter("propagationPolicy", "accepted for compatibility, the backend decides what happens to the dependent resources").DataType("string")).
 		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusAccepted, "Accepted", nil).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 }
 
@@ -287,7 +372,7 @@ func (c *OpenCP) DomainHandler() {
 		Operation("DomainsList").
 		Writes(v1alpha1.DomainList{}).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Domain"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Domain"}).
 		Returns(http.StatusOK, "OK", v1alpha1.DomainList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.GET("/domains/{domain}").To(c.Domain.Get).
@@ -296,7 +381,7 @@ func (c *OpenCP) DomainHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("domain", "name of the domain").DataType("string")).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Domain"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Domain"}).
 		Writes(v1alpha1.Domain{}).
 		Returns(http.StatusOK, "OK", v1alpha1.Domain{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -305,18 +390,39 @@ func (c *OpenCP) DomainHandler() {
 		Doc("Create a domain").Operation("DomainCreate").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		AddExtension("x-kubernetes-action", "post").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Domain"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Domain"}).
 		Writes(v1alpha1.Domain{}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.Domain{}).
-		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+		Returns(http.StatusCreated, "Created", v1alpha1.Domain{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	if c.serves("domains", "patch") {
+		opencpAPI.Route(opencpAPI.PATCH("/domains/{domain}").To(c.Domain.Patch).
+			// Doc
+			Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+			Doc("Patch a domain").Operation("DomainPatch").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			Param(opencpAPI.PathParameter("domain", "name of domain").DataType("string")).
+			AddExtension("x-kubernetes-action", "patch").
+			AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Domain"}).
+			Writes(v1alpha1.Domain{}).
+			Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+			Returns(http.StatusOK, "OK", v1alpha1.Domain{}).
+			Returns(http.StatusCreated, "Created", v1alpha1.Domain{}).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	}
 	opencpAPI.Route(opencpAPI.DELETE("/domains/{domain}").To(c.Domain.Delete).
 		// Doc
 		Doc("Delete a domain").Operation("DomainDelete").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("domain", "name of domain").DataType("string")).
 		AddExtension("x-kubernetes-action", "delete").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Domain"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Domain"}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+		Param(opencpAPI.QueryParameter("gracePeriodSeconds", "accepted for compatibility, the backend has no grace period and deletes the object on its own terms").DataType("integer")).
+		Param(opencpAPI.QueryParameter("propagationPolicy", "accepted for compatibility, the backend decides what happens to the dependent resources").DataType("string")).
 		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusAccepted, "Accepted", nil).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 }
 
@@ -329,7 +435,7 @@ func (c *OpenCP) SSHKeyHandler() {
 		Operation("SSHKeyList").
 		Writes(v1alpha1.SSHKeyList{}).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "SSHKey"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "SSHKey"}).
 		Returns(http.StatusOK, "OK", v1alpha1.SSHKeyList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.GET("/sshkeys/{sshkey}").To(c.SSHKey.Get).
@@ -338,7 +444,7 @@ func (c *OpenCP) SSHKeyHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("sshkey", "name of the ssh key").DataType("string")).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "SSHKey"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "SSHKey"}).
 		Writes(v1alpha1.SSHKey{}).
 		Returns(http.StatusOK, "OK", v1alpha1.SSHKey{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -347,18 +453,39 @@ func (c *OpenCP) SSHKeyHandler() {
 		Doc("Create a ssh key").Operation("SSHKeyCreate").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		AddExtension("x-kubernetes-action", "post").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "SSHKey"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "SSHKey"}).
 		Writes(v1alpha1.SSHKey{}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.SSHKey{}).
-		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+		Returns(http.StatusCreated, "Created", v1alpha1.SSHKey{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	if c.serves("sshkeys", "patch") {
+		opencpAPI.Route(opencpAPI.PATCH("/sshkeys/{sshkey}").To(c.SSHKey.Patch).
+			// Doc
+			Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+			Doc("Patch a ssh key").Operation("SSHKeyPatch").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			Param(opencpAPI.PathParameter("sshkey", "name of ssh key").DataType("string")).
+			AddExtension("x-kubernetes-action", "patch").
+			AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "SSHKey"}).
+			Writes(v1alpha1.SSHKey{}).
+			Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+			Returns(http.StatusOK, "OK", v1alpha1.SSHKey{}).
+			Returns(http.StatusCreated, "Created", v1alpha1.SSHKey{}).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	}
 	opencpAPI.Route(opencpAPI.DELETE("/sshkeys/{sshkey}").To(c.SSHKey.Delete).
 		// Doc
 		Doc("Delete a ssh key").Operation("SSHKeyDelete").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("sshkey", "name of ssh key").DataType("string")).
 		AddExtension("x-kubernetes-action", "delete").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "SSHKey"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "SSHKey"}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+		Param(opencpAPI.QueryParameter("gracePeriodSeconds", "accepted for compatibility, the backend has no grace period and deletes the object on its own terms").DataType("integer")).
+		Param(opencpAPI.QueryParameter("propagationPolicy", "accepted for compatibility, the backend decides what happens to the dependent resources").DataType("string")).
 		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusAccepted, "Accepted", nil).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 }
 
@@ -371,7 +498,7 @@ func (c *OpenCP) ObjectStorageHandler() {
 		Operation("ObjectStorageList").
 		Writes(v1alpha1.ObjectStorageList{}).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorage"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorage"}).
 		Returns(http.StatusOK, "OK", v1alpha1.ObjectStorageList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.GET("/objectstorages/{objectstorage}").To(c.ObjectStorage.Get).
@@ -380,7 +507,7 @@ func (c *OpenCP) ObjectStorageHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("objectstorage", "name of the objectstorage").DataType("string")).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorage"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorage"}).
 		Writes(v1alpha1.ObjectStorage{}).
 		Returns(http.StatusOK, "OK", v1alpha1.ObjectStorage{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -389,18 +516,39 @@ func (c *OpenCP) ObjectStorageHandler() {
 		Doc("Create a ObjectStorage").Operation("ObjectStorageCreate").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		AddExtension("x-kubernetes-action", "post").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorage"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorage"}).
 		Writes(v1alpha1.ObjectStorage{}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.ObjectStorage{}).
-		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+		Returns(http.StatusCreated, "Created", v1alpha1.ObjectStorage{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	if c.serves("objectstorages", "patch") {
+		opencpAPI.Route(opencpAPI.PATCH("/objectstorages/{objectstorage}").To(c.ObjectStorage.Patch).
+			// Doc
+			Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+			Doc("Patch a ObjectStorage").Operation("ObjectStoragePatch").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			Param(opencpAPI.PathParameter("objectstorage", "name of objectstorage").DataType("string")).
+			AddExtension("x-kubernetes-action", "patch").
+			AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorage"}).
+			Writes(v1alpha1.ObjectStorage{}).
+			Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+			Returns(http.StatusOK, "OK", v1alpha1.ObjectStorage{}).
+			Returns(http.StatusCreated, "Created", v1alpha1.ObjectStorage{}).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	}
 	opencpAPI.Route(opencpAPI.DELETE("/objectstorages/{objectstorage}").To(c.ObjectStorage.Delete).
 		// Doc
 		Doc("Delete a ObjectStorage").Operation("ObjectStorageDelete").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("objectstorage", "name of objectstorage").DataType("string")).
 		AddExtension("x-kubernetes-action", "delete").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorage"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorage"}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+		Param(opencpAPI.QueryParameter("gracePeriodSeconds", "accepted for compatibility, the backend has no grace period and deletes the object on its own terms").DataType("integer")).
+		Param(opencpAPI.QueryParameter("propagationPolicy", "accepted for compatibility, the backend decides what happens to the dependent resources").DataType("string")).
 		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusAccepted, "Accepted", nil).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 }
 
@@ -413,7 +561,7 @@ func (c *OpenCP) ObjectStorageCredentialHandler() {
 		Operation("ObjectStorageCredentialList").
 		Writes(v1alpha1.ObjectStorageCredentialList{}).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorageCredential"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorageCredential"}).
 		Returns(http.StatusOK, "OK", v1alpha1.ObjectStorageCredentialList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.GET("/objectstoragecredentials/{credential}").To(c.ObjectStorageCredential.Get).
@@ -422,7 +570,7 @@ func (c *OpenCP) ObjectStorageCredentialHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("credential", "name of the objectstorage credential").DataType("string")).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorageCredential"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorageCredential"}).
 		Writes(v1alpha1.ObjectStorageCredential{}).
 		Returns(http.StatusOK, "OK", v1alpha1.ObjectStorageCredential{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -431,18 +579,39 @@ func (c *OpenCP) ObjectStorageCredentialHandler() {
 		Doc("Create a ObjectStorage Credential").Operation("ObjectStorageCredentialCreate").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		AddExtension("x-kubernetes-action", "post").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorageCredential"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorageCredential"}).
 		Writes(v1alpha1.ObjectStorageCredential{}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.ObjectStorageCredential{}).
-		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+		Returns(http.StatusCreated, "Created", v1alpha1.ObjectStorageCredential{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	if c.serves("objectstoragecredentials", "patch") {
+		opencpAPI.Route(opencpAPI.PATCH("/objectstoragecredentials/{credential}").To(c.ObjectStorageCredential.Patch).
+			// Doc
+			Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+			Doc("Patch a ObjectStorage Credential").Operation("ObjectStorageCredentialPatch").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			Param(opencpAPI.PathParameter("credential", "name of objectstorage credential").DataType("string")).
+			AddExtension("x-kubernetes-action", "patch").
+			AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorageCredential"}).
+			Writes(v1alpha1.ObjectStorageCredential{}).
+			Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+			Returns(http.StatusOK, "OK", v1alpha1.ObjectStorageCredential{}).
+			Returns(http.StatusCreated, "Created", v1alpha1.ObjectStorageCredential{}).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	}
 	opencpAPI.Route(opencpAPI.DELETE("/objectstoragecredentials/{credential}").To(c.ObjectStorageCredential.Delete).
 		// Doc
 		Doc("Delete a ObjectStorage Credential").Operation("ObjectStorageCredentialDelete").
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("credential", "name of objectstorage credential").DataType("string")).
 		AddExtension("x-kubernetes-action", "delete").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorageCredential"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "ObjectStorageCredential"}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+		Param(opencpAPI.QueryParameter("gracePeriodSeconds", "accepted for compatibility, the backend has no grace period and deletes the object on its own terms").DataType("integer")).
+		Param(opencpAPI.QueryParameter("propagationPolicy", "accepted for compatibility, the backend decides what happens to the dependent resources").DataType("string")).
 		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusAccepted, "Accepted", nil).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 }
 
@@ -455,7 +624,7 @@ func (c *OpenCP) DatabaseHandler() {
 		Operation("DatabasesList").
 		Writes(v1alpha1.DatabaseList{}).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
 		Returns(http.StatusOK, "OK", v1alpha1.DatabaseList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.GET("/namespaces/{namespace}/databases").To(c.Database.List).
@@ -465,7 +634,7 @@ func (c *OpenCP) DatabaseHandler() {
 		Operation("DatabasesNamespacesList").
 		Writes(v1alpha1.DatabaseList{}).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
 		Returns(http.StatusOK, "OK", v1alpha1.DatabaseList{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 	opencpAPI.Route(opencpAPI.GET("/namespaces/{namespace}/databases/{database}").To(c.Database.Get).
@@ -475,7 +644,7 @@ func (c *OpenCP) DatabaseHandler() {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the database").DataType("string")).
 		Param(opencpAPI.PathParameter("database", "name of the database").DataType("string")).
 		AddExtension("x-kubernetes-action", "get").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
 		Writes(v1alpha1.Database{}).
 		Returns(http.StatusOK, "OK", v1alpha1.Database{}).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
@@ -485,10 +654,28 @@ func (c *OpenCP) DatabaseHandler() {
 		Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
 		Param(opencpAPI.PathParameter("namespace", "namespace of the database").DataType("string")).
 		AddExtension("x-kubernetes-action", "post").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
 		Writes(v1alpha1.Database{}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
 		Returns(http.StatusOK, "OK", v1alpha1.Database{}).
-		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+		Returns(http.StatusCreated, "Created", v1alpha1.Database{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	if c.serves("databases", "patch") {
+		opencpAPI.Route(opencpAPI.PATCH("/namespaces/{namespace}/databases/{database}").To(c.Database.Patch).
+			// Doc
+			Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+			Doc("Patch a database in a namespace").Operation("DatabasePatchByNamespace").
+			Metadata(restfulspec.KeyOpenAPITags, []string{"opencpIo_v1alpha1"}).
+			Param(opencpAPI.PathParameter("namespace", "namespace of the database").DataType("string")).
+			Param(opencpAPI.PathParameter("database", "name of the database").DataType("string")).
+			AddExtension("x-kubernetes-action", "patch").
+			AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
+			Writes(v1alpha1.Database{}).
+			Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+			Returns(http.StatusOK, "OK", v1alpha1.Database{}).
+			Returns(http.StatusCreated, "Created", v1alpha1.Database{}).
+			Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	}
 	opencpAPI.Route(opencpAPI.DELETE("/namespaces/{namespace}/databases/{database}").To(c.Database.Delete).
 		// Doc
 		Doc("Delete a database in a namespace").Operation("DatabaseDeleteByNamespace").
@@ -496,7 +683,31 @@ func (c *OpenCP) DatabaseHandler() {
 		Param(opencpAPI.PathParameter("namespace", "namespace of the database").DataType("string")).
 		Param(opencpAPI.PathParameter("firewall", "name of database").DataType("string")).
 		AddExtension("x-kubernetes-action", "delete").
-		AddExtension("x-kubernetes-group-version-kind", schema.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: "opencp.io", Version: "v1alpha1", Kind: "Database"}).
+		Param(opencpAPI.QueryParameter("dryRun", "when present, the mutation is validated without being persisted, the only valid value is All").DataType("string")).
+		Param(opencpAPI.QueryParameter("gracePeriodSeconds", "accepted for compatibility, the backend has no grace period and deletes the object on its own terms").DataType("integer")).
+		Param(opencpAPI.QueryParameter("propagationPolicy", "accepted for compatibility, the backend decides what happens to the dependent resources").DataType("string")).
 		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusAccepted, "Accepted", nil).
 		Returns(http.StatusUnauthorized, "Unauthorized", nil))
 }
+
+// serves tells if the discovery advertises the verb for a opencp.io resource
+func (c *OpenCP) serves(resourceName, verb string) bool {
+	for _, gv := range c.registry {
+		if gv.GroupVersion.Group != discovery.OpenCPGroup {
+			continue
+		}
+		for _, apiResource := range gv.Resources {
+			if apiResource.Name != resourceName {
+				continue
+			}
+			for _, v := range apiResource.Verbs {
+				if v == verb {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
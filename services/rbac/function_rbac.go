@@ -0,0 +1,477 @@
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+
+	restful "github.com/emicklei/go-restful/v3"
+	jsonpatch "github.com/evanphx/json-patch"
+	authz "github.com/opencontrolplane/opencp-shim/internal/authorization"
+	"github.com/opencontrolplane/opencp-shim/internal/discovery"
+	setup "github.com/opencontrolplane/opencp-shim/internal/setup"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+type ObjectInterface interface {
+	List(r *restful.Request, w *restful.Response)
+	Get(r *restful.Request, w *restful.Response)
+	Create(r *restful.Request, w *restful.Response)
+	Update(r *restful.Request, w *restful.Response)
+	Patch(r *restful.Request, w *restful.Response)
+	Delete(r *restful.Request, w *restful.Response)
+}
+
+// Objects serves a kind of the rbac.authorization.k8s.io group, kept in the store of the shim
+type Objects[T authz.RBACObject] struct {
+	kind       string
+	resource   string
+	namespaced bool
+	objectMeta func(*T) *metav1.ObjectMeta
+	// rules returns the rules of the roles, nil for the bindings
+	rules func(*T) []rbacv1.PolicyRule
+	// roleRef returns the role of the bindings, it can not be changed once created
+	roleRef func(*T) *rbacv1.RoleRef
+	list    func(items []T, listMeta metav1.ListMeta) interface{}
+}
+
+func ResourceList(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	resourceList, _ := discovery.APIResourceList(discovery.Registry(app.Config), schema.GroupVersion{Group: discovery.RBACGroup, Version: "v1"})
+	discovery.Write(r, w, resourceList)
+}
+
+// List returns the objects of the namespace of the request, or of all the namespaces
+func (o Objects[T]) List(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	namespace := r.PathParameter("namespace")
+
+	labelSelector, err := pkg.LabelSelector(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	list := func(ctx context.Context) ([]*T, error) {
+		items, err := authz.ListRBAC[T](ctx, app.Store, o.resource, namespace)
+		if err != nil {
+			return nil, err
+		}
+		objects := make([]*T, len(items))
+		for i := range items {
+			objects[i] = &items[i]
+		}
+		return pkg.FilterLabels(objects, labelSelector, o.objectMeta), nil
+	}
+
+	if pkg.IsWatch(r) {
+		opts := pkg.WatchOptions{
+			TypeMeta:         metav1.TypeMeta{Kind: o.kind, APIVersion: rbacv1.SchemeGroupVersion.String()},
+			PollInterval:     app.Config.Watch.PollInterval,
+			BookmarkInterval: app.Config.Watch.BookmarkInterval,
+		}
+		pkg.Watch(r, w, opts, func(ctx context.Context) ([]metav1.Object, error) {
+			objects, err := list(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return o.metaObjects(objects), nil
+		})
+		return
+	}
+
+	// The objects are only read for the first page, the next ones are cut from its list
+	opts := pkg.PageOptions{
+		TokenTTL:   app.Config.Pagination.TokenTTL,
+		SigningKey: []byte(app.Config.Pagination.SigningKey),
+	}
+	page, listMeta, err := pkg.Paginate(r, opts, func() (string, []*T, error) {
+		objects, err := list(r.Request.Context())
+		if err != nil {
+			return "", nil, err
+		}
+		return pkg.ListResourceVersion(r, o.metaObjects(objects)), objects, nil
+	}, o.objectMeta)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	items := make([]T, len(page))
+	for i, obj := range page {
+		// The page is shared with the next pages, the objects are set on copies
+		items[i] = *obj
+		o.setTypeMeta(&items[i])
+	}
+	listObject := o.list(items, listMeta)
+	setListTypeMeta(listObject, o.kind+"List")
+	pkg.WriteObject(r, w, http.StatusOK, listObject)
+}
+
+// Get returns the object of the request
+func (o Objects[T]) Get(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+
+	obj, err := authz.GetRBAC[T](r.Request.Context(), app.Store, o.resource, r.PathParameter("namespace"), r.PathParameter("name"))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	o.setTypeMeta(obj)
+	pkg.WriteObject(r, w, http.StatusOK, obj)
+}
+
+// Create creates the object in the body of the request
+func (o Objects[T]) Create(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	if !o.writable(app, w, "create") {
+		return
+	}
+
+	obj, err := o.readObject(r, "")
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	dryRun, err := pkg.DryRun(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if err := o.confirmAllowed(r.Request.Context(), app, obj); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if err := authz.PutRBAC(r.Request.Context(), app.Store, o.resource, o.objectMeta(obj), obj, true, dryRun); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	o.setTypeMeta(obj)
+	pkg.WriteObject(r, w, http.StatusCreated, obj)
+}
+
+// Update replaces the object of the request with the one in the body, when the object
+// has a resourceVersion it has to match the stored one or a 409 is returned
+func (o Objects[T]) Update(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	if !o.writable(app, w, "update") {
+		return
+	}
+	ctx := r.Request.Context()
+
+	obj, err := o.readObject(r, r.PathParameter("name"))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	dryRun, err := pkg.DryRun(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	live, err := authz.GetRBAC[T](ctx, app.Store, o.resource, r.PathParameter("namespace"), r.PathParameter("name"))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	if err := o.validateUpdate(obj, live); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	if err := o.confirmAllowed(ctx, app, obj); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if err := authz.PutRBAC(ctx, app.Store, o.resource, o.objectMeta(obj), obj, false, dryRun); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	o.setTypeMeta(obj)
+	pkg.WriteObject(r, w, http.StatusOK, obj)
+}
+
+// Patch applies a json, merge or strategic merge patch to the object of the request
+func (o Objects[T]) Patch(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	if !o.writable(app, w, "patch") {
+		return
+	}
+	ctx := r.Request.Context()
+
+	contentType, _, err := mime.ParseMediaType(r.HeaderParameter("Content-Type"))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(unsupportedMediaType(r.HeaderParameter("Content-Type"))))
+		return
+	}
+	patchType := types.PatchType(contentType)
+	if patchType != types.JSONPatchType && patchType != types.MergePatchType && patchType != types.StrategicMergePatchType {
+		pkg.WriteStatus(w, pkg.RespondStatus(unsupportedMediaType(contentType)))
+		return
+	}
+	dryRun, err := pkg.DryRun(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	patch, err := pkg.ReadBody(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewBadRequest(fmt.Sprintf("the body could not be read: %v", err))))
+		return
+	}
+
+	live, err := authz.GetRBAC[T](ctx, app.Store, o.resource, r.PathParameter("namespace"), r.PathParameter("name"))
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	o.setTypeMeta(live)
+	original, err := json.Marshal(live)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	var patchedJSON []byte
+	switch patchType {
+	case types.JSONPatchType:
+		jsonPatch, err := jsonpatch.DecodePatch(patch)
+		if err != nil {
+			pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewBadRequest(fmt.Sprintf("error decoding the json patch: %v", err))))
+			return
+		}
+		patchedJSON, err = jsonPatch.Apply(original)
+		if err != nil {
+			pkg.WriteStatus(w, pkg.RespondStatus(o.invalid(r.PathParameter("name"), field.Invalid(field.NewPath("patch"), string(patch), err.Error()))))
+			return
+		}
+	case types.MergePatchType:
+		patchedJSON, err = jsonpatch.MergePatch(original, patch)
+		if err != nil {
+			pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewBadRequest(fmt.Sprintf("error applying the merge patch: %v", err))))
+			return
+		}
+	case types.StrategicMergePatchType:
+		patchedJSON, err = strategicpatch.StrategicMergePatch(original, patch, new(T))
+		if err != nil {
+			pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewBadRequest(fmt.Sprintf("error applying the strategic merge patch: %v", err))))
+			return
+		}
+	}
+
+	obj := new(T)
+	if err := json.Unmarshal(patchedJSON, obj); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(o.invalid(r.PathParameter("name"), field.Invalid(field.NewPath("patch"), string(patch), err.Error()))))
+		return
+	}
+	if err := o.validateUpdate(obj, live); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	if err := o.confirmAllowed(ctx, app, obj); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	if err := authz.PutRBAC(ctx, app.Store, o.resource, o.objectMeta(obj), obj, false, dryRun); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	o.setTypeMeta(obj)
+	pkg.WriteObject(r, w, http.StatusOK, obj)
+}
+
+// Delete removes the object of the request, the answer is a Status like in the kube-apiserver
+func (o Objects[T]) Delete(r *restful.Request, w *restful.Response) {
+	// Get the app config
+	app := r.Attribute("app").(*setup.OpenCPApp)
+	if !o.writable(app, w, "delete") {
+		return
+	}
+	name := r.PathParameter("name")
+
+	dryRun, err := pkg.DryRun(r)
+	if err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+	if err := authz.DeleteRBAC(r.Request.Context(), app.Store, o.resource, r.PathParameter("namespace"), name, dryRun); err != nil {
+		pkg.WriteStatus(w, pkg.RespondStatus(err))
+		return
+	}
+
+	pkg.WriteObject(r, w, http.StatusOK, &metav1.Status{
+		TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   metav1.StatusSuccess,
+		Details: &metav1.StatusDetails{
+			Name:  name,
+			Group: rbacv1.GroupName,
+			Kind:  o.resource,
+		},
+	})
+}
+
+// writable tells if the objects can be written, answering 405 when they can not. Without RBAC
+// nothing checks the rules of the roles and bindings, so they are read only
+func (o Objects[T]) writable(app *setup.OpenCPApp, w *restful.Response, verb string) bool {
+	if app.Config.Authorization.RBAC.Enabled {
+		return true
+	}
+	pkg.WriteStatus(w, pkg.RespondStatus(apierrors.NewMethodNotSupported(schema.GroupResource{Group: rbacv1.GroupName, Resource: o.resource}, verb)))
+	return false
+}
+
+// confirmAllowed checks the caller does not grant more than it has, like the kube-apiserver it must be
+// allowed to escalate the roles and to bind the roles of the bindings, or hold every rule they grant
+func (o Objects[T]) confirmAllowed(ctx context.Context, app *setup.OpenCPApp, obj *T) error {
+	meta := o.objectMeta(obj)
+	if o.roleRef != nil {
+		return authz.ConfirmBindingAllowed(ctx, app.Authorizer, app.Store, authz.User(ctx), o.resource, meta.Namespace, meta.Name, *o.roleRef(obj))
+	}
+	return authz.ConfirmRoleAllowed(ctx, app.Authorizer, authz.User(ctx), o.resource, meta.Namespace, meta.Name, o.rules(obj))
+}
+
+// readObject reads the object in the body of the request, in json, yaml or protobuf. The namespace
+// is the one of the path and the name, when given, has to be the one of the path
+func (o Objects[T]) readObject(r *restful.Request, name string) (*T, error) {
+	body, err := pkg.ReadBody(r)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("the body could not be read: %v", err))
+	}
+	objJSON, err := yaml.ToJSON(body)
+	if err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("the body is not valid json or yaml: %v", err))
+	}
+	obj := new(T)
+	if err := json.Unmarshal(objJSON, obj); err != nil {
+		return nil, apierrors.NewBadRequest(fmt.Sprintf("the body is not a valid %s: %v", o.kind, err))
+	}
+
+	meta := o.objectMeta(obj)
+	errs := field.ErrorList{}
+	if meta.Name == "" {
+		errs = append(errs, field.Required(field.NewPath("metadata", "name"), "name is required"))
+	}
+	if name != "" && meta.Name != name {
+		return nil, apierrors.NewBadRequest("the name of the object does not match the name on the URL")
+	}
+
+	namespace := r.PathParameter("namespace")
+	switch {
+	case !o.namespaced && meta.Namespace != "":
+		errs = append(errs, field.Forbidden(field.NewPath("metadata", "namespace"), "not allowed on this type"))
+	case o.namespaced && meta.Namespace != "" && meta.Namespace != namespace:
+		return nil, apierrors.NewBadRequest("the namespace of the provided object does not match the namespace sent on the request")
+	}
+	meta.Namespace = namespace
+
+	if o.roleRef != nil {
+		errs = append(errs, validateRoleRef(*o.roleRef(obj), o.namespaced)...)
+	}
+	if len(errs) > 0 {
+		return nil, o.invalid(meta.Name, errs...)
+	}
+	return obj, nil
+}
+
+// validateUpdate checks an update keeps what can not change, the role of the bindings
+// and the identity of the object
+func (o Objects[T]) validateUpdate(obj, live *T) error {
+	meta, liveMeta := o.objectMeta(obj), o.objectMeta(live)
+	errs := field.ErrorList{}
+	if meta.Name != liveMeta.Name {
+		errs = append(errs, field.Invalid(field.NewPath("metadata", "name"), meta.Name, "field is immutable"))
+	}
+	if meta.Namespace != liveMeta.Namespace {
+		errs = append(errs, field.Invalid(field.NewPath("metadata", "namespace"), meta.Namespace, "field is immutable"))
+	}
+	if meta.UID != "" && meta.UID != liveMeta.UID {
+		errs = append(errs, field.Invalid(field.NewPath("metadata", "uid"), meta.UID, "field is immutable"))
+	}
+	if o.roleRef != nil && *o.roleRef(obj) != *o.roleRef(live) {
+		errs = append(errs, field.Invalid(field.NewPath("roleRef"), *o.roleRef(obj), "cannot change roleRef"))
+	}
+	if len(errs) > 0 {
+		return o.invalid(liveMeta.Name, errs...)
+	}
+	return nil
+}
+
+// validateRoleRef checks the role of a binding, the cluster role bindings can only bind cluster roles
+func validateRoleRef(roleRef rbacv1.RoleRef, namespaced bool) field.ErrorList {
+	errs := field.ErrorList{}
+	path := field.NewPath("roleRef")
+	if roleRef.APIGroup != rbacv1.GroupName {
+		errs = append(errs, field.NotSupported(path.Child("apiGroup"), roleRef.APIGroup, []string{rbacv1.GroupName}))
+	}
+	kinds := []string{"ClusterRole"}
+	if namespaced {
+		kinds = append(kinds, "Role")
+	}
+	supported := false
+	for _, kind := range kinds {
+		supported = supported || roleRef.Kind == kind
+	}
+	if !supported {
+		errs = append(errs, field.NotSupported(path.Child("kind"), roleRef.Kind, kinds))
+	}
+	if roleRef.Name == "" {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	}
+	return errs
+}
+
+func (o Objects[T]) invalid(name string, errs ...*field.Error) error {
+	return apierrors.NewInvalid(schema.GroupKind{Group: rbacv1.GroupName, Kind: o.kind}, name, errs)
+}
+
+func (o Objects[T]) setTypeMeta(obj *T) {
+	if object, ok := any(obj).(runtime.Object); ok {
+		object.GetObjectKind().SetGroupVersionKind(rbacv1.SchemeGroupVersion.WithKind(o.kind))
+	}
+}
+
+func (o Objects[T]) metaObjects(items []*T) []metav1.Object {
+	objects := make([]metav1.Object, len(items))
+	for i, obj := range items {
+		o.setTypeMeta(obj)
+		objects[i] = any(obj).(metav1.Object)
+	}
+	return objects
+}
+
+func setListTypeMeta(list interface{}, kind string) {
+	if object, ok := list.(runtime.Object); ok {
+		object.GetObjectKind().SetGroupVersionKind(rbacv1.SchemeGroupVersion.WithKind(kind))
+	}
+}
+
+func unsupportedMediaType(contentType string) error {
+	return &apierrors.StatusError{ErrStatus: metav1.Status{
+		Status:  metav1.StatusFailure,
+		Code:    http.StatusUnsupportedMediaType,
+		Reason:  metav1.StatusReasonUnsupportedMediaType,
+		Message: fmt.Sprintf("the patch content type %q is not supported", contentType),
+	}}
+}
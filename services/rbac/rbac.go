@@ -0,0 +1,184 @@
+package rbac
+
+import (
+	"fmt"
+	"net/http"
+
+	restfulspec "github.com/emicklei/go-restful-openapi/v2"
+	restful "github.com/emicklei/go-restful/v3"
+	authz "github.com/opencontrolplane/opencp-shim/internal/authorization"
+	"github.com/opencontrolplane/opencp-shim/pkg"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type RBAC struct {
+	Roles               ObjectInterface
+	ClusterRoles        ObjectInterface
+	RoleBindings        ObjectInterface
+	ClusterRoleBindings ObjectInterface
+}
+
+func NewRBAC() *RBAC {
+	return &RBAC{
+		Roles: &Objects[rbacv1.Role]{
+			kind:       "Role",
+			resource:   authz.RolesResource,
+			namespaced: true,
+			objectMeta: func(role *rbacv1.Role) *metav1.ObjectMeta { return &role.ObjectMeta },
+			rules:      func(role *rbacv1.Role) []rbacv1.PolicyRule { return role.Rules },
+			list: func(items []rbacv1.Role, listMeta metav1.ListMeta) interface{} {
+				return &rbacv1.RoleList{ListMeta: listMeta, Items: items}
+			},
+		},
+		ClusterRoles: &Objects[rbacv1.ClusterRole]{
+			kind:       "ClusterRole",
+			resource:   authz.ClusterRolesResource,
+			objectMeta: func(clusterRole *rbacv1.ClusterRole) *metav1.ObjectMeta { return &clusterRole.ObjectMeta },
+			rules:      func(clusterRole *rbacv1.ClusterRole) []rbacv1.PolicyRule { return clusterRole.Rules },
+			list: func(items []rbacv1.ClusterRole, listMeta metav1.ListMeta) interface{} {
+				return &rbacv1.ClusterRoleList{ListMeta: listMeta, Items: items}
+			},
+		},
+		RoleBindings: &Objects[rbacv1.RoleBinding]{
+			kind:       "RoleBinding",
+			resource:   authz.RoleBindingsResource,
+			namespaced: true,
+			objectMeta: func(binding *rbacv1.RoleBinding) *metav1.ObjectMeta { return &binding.ObjectMeta },
+			roleRef:    func(binding *rbacv1.RoleBinding) *rbacv1.RoleRef { return &binding.RoleRef },
+			list: func(items []rbacv1.RoleBinding, listMeta metav1.ListMeta) interface{} {
+				return &rbacv1.RoleBindingList{ListMeta: listMeta, Items: items}
+			},
+		},
+		ClusterRoleBindings: &Objects[rbacv1.ClusterRoleBinding]{
+			kind:       "ClusterRoleBinding",
+			resource:   authz.ClusterRoleBindingsResource,
+			objectMeta: func(binding *rbacv1.ClusterRoleBinding) *metav1.ObjectMeta { return &binding.ObjectMeta },
+			roleRef:    func(binding *rbacv1.ClusterRoleBinding) *rbacv1.RoleRef { return &binding.RoleRef },
+			list: func(items []rbacv1.ClusterRoleBinding, listMeta metav1.ListMeta) interface{} {
+				return &rbacv1.ClusterRoleBindingList{ListMeta: listMeta, Items: items}
+			},
+		},
+	}
+}
+
+func (a RBAC) API() []*restful.WebService {
+	api := new(restful.WebService).Path("/apis/rbac.authorization.k8s.io/v1").Consumes(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF).Produces(restful.MIME_JSON, "application/yml", pkg.MIME_YAML, pkg.MIME_PROTOBUF)
+	api.Route(api.GET("").To(ResourceList).
+		//Doc
+		Doc("get available resources").Operation("getRbacAuthorizationV1APIResources").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"rbacAuthorization_v1"}).
+		Writes(metav1.APIResourceList{}).
+		Returns(http.StatusOK, "OK", metav1.APIResourceList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	routes(api, "/namespaces/{namespace}/roles", "Role", a.Roles, rbacv1.Role{}, rbacv1.RoleList{})
+	routes(api, "/namespaces/{namespace}/rolebindings", "RoleBinding", a.RoleBindings, rbacv1.RoleBinding{}, rbacv1.RoleBindingList{})
+	routes(api, "/clusterroles", "ClusterRole", a.ClusterRoles, rbacv1.ClusterRole{}, rbacv1.ClusterRoleList{})
+	routes(api, "/clusterrolebindings", "ClusterRoleBinding", a.ClusterRoleBindings, rbacv1.ClusterRoleBinding{}, rbacv1.ClusterRoleBindingList{})
+
+	// The roles and bindings of all the namespaces
+	api.Route(api.GET("/roles").To(a.Roles.List).
+		//Doc
+		Doc("list or watch objects of kind Role").Operation("listRbacAuthorizationV1RoleForAllNamespaces").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"rbacAuthorization_v1"}).
+		AddExtension("x-kubernetes-action", "list").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: rbacv1.GroupName, Version: "v1", Kind: "Role"}).
+		Writes(rbacv1.RoleList{}).
+		Returns(http.StatusOK, "OK", rbacv1.RoleList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+	api.Route(api.GET("/rolebindings").To(a.RoleBindings.List).
+		//Doc
+		Doc("list or watch objects of kind RoleBinding").Operation("listRbacAuthorizationV1RoleBindingForAllNamespaces").
+		Metadata(restfulspec.KeyOpenAPITags, []string{"rbacAuthorization_v1"}).
+		AddExtension("x-kubernetes-action", "list").
+		AddExtension("x-kubernetes-group-version-kind", metav1.GroupVersionKind{Group: rbacv1.GroupName, Version: "v1", Kind: "RoleBinding"}).
+		Writes(rbacv1.RoleBindingList{}).
+		Returns(http.StatusOK, "OK", rbacv1.RoleBindingList{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	return []*restful.WebService{api}
+}
+
+// routes registers the routes of a kind on its collection path
+func routes(api *restful.WebService, path, kind string, objects ObjectInterface, obj, list interface{}) {
+	gvk := metav1.GroupVersionKind{Group: rbacv1.GroupName, Version: "v1", Kind: kind}
+	tags := []string{"rbacAuthorization_v1"}
+
+	api.Route(api.GET(path).To(objects.List).
+		//Doc
+		Doc(fmt.Sprintf("list or watch objects of kind %s", kind)).Operation(fmt.Sprintf("listRbacAuthorizationV1%s", kind)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "list").
+		AddExtension("x-kubernetes-group-version-kind", gvk).
+		Param(api.QueryParameter("labelSelector", fmt.Sprintf("selector restricting the %s by their labels", kind)).DataType("string")).
+		Param(api.QueryParameter("watch", fmt.Sprintf("watch the changes of the %s", kind)).DataType("boolean")).
+		Writes(list).
+		Returns(http.StatusOK, "OK", list).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	api.Route(api.POST(path).To(objects.Create).
+		//Doc
+		Doc(fmt.Sprintf("create a %s", kind)).Operation(fmt.Sprintf("createRbacAuthorizationV1%s", kind)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "post").
+		AddExtension("x-kubernetes-group-version-kind", gvk).
+		Reads(obj).
+		Writes(obj).
+		Returns(http.StatusCreated, "Created", obj).
+		Returns(http.StatusBadRequest, "BadRequest", metav1.Status{}).
+		Returns(http.StatusConflict, "Conflict", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	api.Route(api.GET(path+"/{name}").To(objects.Get).
+		//Doc
+		Doc(fmt.Sprintf("read the specified %s", kind)).Operation(fmt.Sprintf("readRbacAuthorizationV1%s", kind)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "get").
+		AddExtension("x-kubernetes-group-version-kind", gvk).
+		Writes(obj).
+		Returns(http.StatusOK, "OK", obj).
+		Returns(http.StatusNotFound, "NotFound", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	api.Route(api.PUT(path+"/{name}").To(objects.Update).
+		//Doc
+		Doc(fmt.Sprintf("replace the specified %s", kind)).Operation(fmt.Sprintf("replaceRbacAuthorizationV1%s", kind)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "put").
+		AddExtension("x-kubernetes-group-version-kind", gvk).
+		Reads(obj).
+		Writes(obj).
+		Returns(http.StatusOK, "OK", obj).
+		Returns(http.StatusBadRequest, "BadRequest", metav1.Status{}).
+		Returns(http.StatusNotFound, "NotFound", metav1.Status{}).
+		Returns(http.StatusConflict, "Conflict", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	api.Route(api.PATCH(path+"/{name}").To(objects.Patch).
+		//Doc
+		Doc(fmt.Sprintf("partially update the specified %s", kind)).Operation(fmt.Sprintf("patchRbacAuthorizationV1%s", kind)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "patch").
+		AddExtension("x-kubernetes-group-version-kind", gvk).
+		Consumes(string(types.JSONPatchType), string(types.MergePatchType), string(types.StrategicMergePatchType), string(types.ApplyPatchType)).
+		Reads(metav1.Patch{}).
+		Writes(obj).
+		Returns(http.StatusOK, "OK", obj).
+		Returns(http.StatusBadRequest, "BadRequest", metav1.Status{}).
+		Returns(http.StatusNotFound, "NotFound", metav1.Status{}).
+		Returns(http.StatusUnsupportedMediaType, "UnsupportedMediaType", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+
+	api.Route(api.DELETE(path+"/{name}").To(objects.Delete).
+		//Doc
+		Doc(fmt.Sprintf("delete a %s", kind)).Operation(fmt.Sprintf("deleteRbacAuthorizationV1%s", kind)).
+		Metadata(restfulspec.KeyOpenAPITags, tags).
+		AddExtension("x-kubernetes-action", "delete").
+		AddExtension("x-kubernetes-group-version-kind", gvk).
+		Writes(metav1.Status{}).
+		Returns(http.StatusOK, "OK", metav1.Status{}).
+		Returns(http.StatusNotFound, "NotFound", metav1.Status{}).
+		Returns(http.StatusUnauthorized, "Unauthorized", nil))
+}